@@ -0,0 +1,203 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxLoggedBody is how much of a request or response body the access log keeps
+const maxLoggedBody = 4096
+
+// Placeholders for what the access log leaves out
+const (
+	redacted     = "[REDACTED]"
+	bodyTooLarge = "[body too large to redact]"
+	bodyNotJSON  = "[non-JSON body]"
+)
+
+// accessLogEntry is one line of the access log
+type accessLogEntry struct {
+	Time            time.Time         `json:"time"`
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	Query           string            `json:"query,omitempty"`
+	Status          int               `json:"status"`
+	DurationMS      float64           `json:"duration_ms"`
+	IP              string            `json:"ip"`
+	UserAgent       string            `json:"user_agent,omitempty"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+}
+
+// bodyRecorder remembers the status and the start of the body a handler wrote
+type bodyRecorder struct {
+	statusRecorder
+	body bytes.Buffer
+	size int
+}
+
+// Write keeps the first maxLoggedBody bytes while writing the body through
+func (br *bodyRecorder) Write(p []byte) (int, error) {
+	if room := maxLoggedBody - br.body.Len(); room > 0 {
+		br.body.Write(p[:min(room, len(p))])
+	}
+	br.size += len(p)
+	return br.ResponseWriter.Write(p)
+}
+
+// logRequests writes an access log line per request when the access log is
+// on. With body logging on, the line includes headers and JSON bodies with
+// the configured fields and headers redacted, so the log is safe to ship.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Read per request, so SIGHUP reloads turn logging on and off
+		cfg := s.currentConfig().Logging
+		if !cfg.AccessLog {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		entry := accessLogEntry{
+			Time:      start.UTC(),
+			Method:    r.Method,
+			Path:      redactPath(r.URL.Path),
+			Query:     redactQuery(r.URL.RawQuery, cfg.RedactFields),
+			IP:        clientIP(r),
+			UserAgent: r.UserAgent(),
+		}
+
+		recorder := &bodyRecorder{statusRecorder: statusRecorder{ResponseWriter: w, status: http.StatusOK}}
+		if cfg.LogBodies {
+			entry.RequestHeaders = redactHeaders(r.Header, cfg.RedactHeaders)
+			// Keep the start of the body for the log and hand the handler all of it
+			head, _ := io.ReadAll(io.LimitReader(r.Body, maxLoggedBody+1))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+			entry.RequestBody = redactBody(head, cfg.RedactFields)
+		}
+
+		next.ServeHTTP(recorder, r)
+
+		entry.Status = recorder.status
+		entry.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+		if cfg.LogBodies {
+			entry.ResponseHeaders = redactHeaders(recorder.Header(), cfg.RedactHeaders)
+			entry.ResponseBody = redactBody(recorder.body.Bytes(), cfg.RedactFields)
+			if recorder.size > maxLoggedBody {
+				entry.ResponseBody = bodyTooLarge
+			}
+		}
+
+		line, err := json.Marshal(entry)
+		if err != nil {
+			log.Printf("Warning: Failed to encode access log entry: %v", err)
+			return
+		}
+		log.Print(string(line))
+	})
+}
+
+// redactedName reports whether a field or parameter name contains one of
+// the redacted fields
+func redactedName(name string, fields []string) bool {
+	name = strings.ToLower(name)
+	for _, field := range fields {
+		if field != "" && strings.Contains(name, strings.ToLower(field)) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeaders flattens headers for the log, masking the redacted ones
+func redactHeaders(header http.Header, redactedHeaders []string) map[string]string {
+	values := make(map[string]string, len(header))
+	for name, value := range header {
+		values[name] = strings.Join(value, ", ")
+		for _, redactedHeader := range redactedHeaders {
+			if strings.EqualFold(name, redactedHeader) {
+				values[name] = redacted
+				break
+			}
+		}
+	}
+	return values
+}
+
+// redactPath masks the share token of shared list links, which grants
+// access on its own
+func redactPath(path string) string {
+	if strings.HasPrefix(path, sharedListsPath) && len(path) > len(sharedListsPath) {
+		return sharedListsPath + redacted
+	}
+	return path
+}
+
+// redactQuery masks the values of redacted query parameters
+func redactQuery(rawQuery string, fields []string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return redacted
+	}
+	for name, values := range query {
+		if redactedName(name, fields) {
+			for i := range values {
+				values[i] = redacted
+			}
+		}
+	}
+	return query.Encode()
+}
+
+// redactBody returns a JSON body with the values of redacted fields masked
+// at any depth. Other bodies, and JSON bodies too long to log whole, can't
+// be redacted field by field and are left out.
+func redactBody(body []byte, fields []string) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if len(body) > maxLoggedBody {
+		return bodyTooLarge
+	}
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return bodyNotJSON
+	}
+	line, err := json.Marshal(redactValue(value, fields))
+	if err != nil {
+		return redacted
+	}
+	return string(line)
+}
+
+func redactValue(value interface{}, fields []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if redactedName(key, fields) {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(field, fields)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item, fields)
+		}
+	}
+	return value
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Dashboard statistics windows
+const (
+	statsDays            = 30
+	statsTopContributors = 10
+	// statsMaxAge is how long precomputed statistics are served before they
+	// are computed per request again, e.g. while stats-precompute is paused
+	statsMaxAge = 15 * time.Minute
+)
+
+// AdminService computes dashboard statistics for administrators
+type AdminService struct {
+	db          *gorm.DB
+	tokens      *TokenStore
+	mu          sync.Mutex
+	precomputed *AdminStats
+}
+
+// NewAdminService creates a new admin service
+func NewAdminService(db *gorm.DB, tokens *TokenStore) *AdminService {
+	return &AdminService{db: db, tokens: tokens}
+}
+
+// GetStats summarizes users, sessions, and catalog activity of the last 30 days
+func (as *AdminService) GetStats() (*AdminStats, error) {
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from := today.AddDate(0, 0, -(statsDays - 1))
+
+	stats := AdminStats{
+		Users:        UserStats{ByRole: make(map[string]int64)},
+		ActiveTokens: as.tokens.CountActive(),
+		GeneratedAt:  now,
+	}
+
+	var roles []struct {
+		Role  string
+		Count int64
+	}
+	if err := as.db.Model(&User{}).Select("role, count(*) AS count").Group("role").Scan(&roles).Error; err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		stats.Users.ByRole[role.Role] = role.Count
+		stats.Users.Total += role.Count
+	}
+
+	if err := as.db.Model(&Film{}).Count(&stats.Films.Total).Error; err != nil {
+		return nil, err
+	}
+	if err := as.db.Unscoped().Model(&Film{}).Where("deleted_at IS NOT NULL").Count(&stats.Films.Deleted).Error; err != nil {
+		return nil, err
+	}
+
+	// Films deleted since count as created on their day
+	var days []struct {
+		Day   time.Time
+		Count int64
+	}
+	err := as.db.Unscoped().Model(&Film{}).
+		Select("date_trunc('day', created_at AT TIME ZONE 'UTC') AS day, count(*) AS count").
+		Where("created_at >= ?", from).Group("day").Scan(&days).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(days))
+	for _, day := range days {
+		counts[day.Day.Format("2006-01-02")] = day.Count
+	}
+	for day := from; !day.After(today); day = day.AddDate(0, 0, 1) {
+		key := day.Format("2006-01-02")
+		stats.FilmsPerDay = append(stats.FilmsPerDay, DailyCount{Day: key, Count: counts[key]})
+	}
+
+	// Contributors are ranked by metered writes, which include updates and deletes
+	err = as.db.Model(&UsageRollup{}).
+		Select("username, sum(quantity) AS writes").
+		Where("operation = ? AND day >= ?", MeterWrite, from).
+		Group("username").Order("writes DESC").Limit(statsTopContributors).
+		Scan(&stats.TopContributors).Error
+	if err != nil {
+		return nil, err
+	}
+	if stats.TopContributors == nil {
+		stats.TopContributors = []Contributor{}
+	}
+
+	return &stats, nil
+}
+
+// Precompute computes the statistics ahead of requests for the dashboard
+func (as *AdminService) Precompute(ctx context.Context) error {
+	stats, err := (&AdminService{db: as.db.WithContext(ctx), tokens: as.tokens}).GetStats()
+	if err != nil {
+		return err
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.precomputed = stats
+	return nil
+}
+
+// PrecomputedStats returns the statistics computed by the last Precompute,
+// or nil when there are none younger than statsMaxAge
+func (as *AdminService) PrecomputedStats() *AdminStats {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if as.precomputed == nil || time.Since(as.precomputed.GeneratedAt) > statsMaxAge {
+		return nil
+	}
+	stats := *as.precomputed
+	// Counting tokens is cheap, so it is always current
+	stats.ActiveTokens = as.tokens.CountActive()
+	return &stats
+}
+
+// adminStatsHandler returns the dashboard statistics (admin only)
+func (s *Server) adminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	stats := s.adminService.PrecomputedStats()
+	var err error
+	if stats == nil {
+		stats, err = s.adminService.GetStats()
+	}
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute statistics", Code: "stats_failed"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// alertClient posts admin alerts to the configured webhook
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// alertAdmins notifies administrators about a condition that needs attention.
+// The alert is logged and, when the webhook URL of cfg (ALERT_WEBHOOK_URL) is
+// set, posted there as a Slack-compatible {"text": ...} message in the
+// background.
+func alertAdmins(cfg AlertsConfig, message string) {
+	log.Printf("🚨 Admin alert: %s", message)
+
+	url := cfg.WebhookURL
+	if url == "" {
+		return
+	}
+	payload, _ := json.Marshal(map[string]string{"text": "🚨 " + message})
+	go func() {
+		resp, err := alertClient.Post(url, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			log.Printf("Warning: Failed to send admin alert: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("Warning: Failed to send admin alert: webhook answered %s", resp.Status)
+		}
+	}()
+}
+
+// errorCounts are the requests of a route group and how many of them failed
+type errorCounts struct {
+	requests     int64
+	serverErrors int64
+	unauthorized int64
+}
+
+// add sums two counts
+func (ec errorCounts) add(other errorCounts) errorCounts {
+	return errorCounts{
+		requests:     ec.requests + other.requests,
+		serverErrors: ec.serverErrors + other.serverErrors,
+		unauthorized: ec.unauthorized + other.unauthorized,
+	}
+}
+
+// failureRate returns failures per request, or 0 without requests
+func failureRate(failures, requests int64) float64 {
+	if requests == 0 {
+		return 0
+	}
+	return float64(failures) / float64(requests)
+}
+
+// AnomalyMonitor compares the 5xx and 401 rates of each route group in the
+// current window to a rolling baseline of previous windows and alerts admins
+// when a rate exceeds both the group's threshold and a multiple of its baseline
+type AnomalyMonitor struct {
+	config    *liveConfig
+	mu        sync.Mutex
+	current   map[string]errorCounts
+	baseline  map[string][]errorCounts
+	lastAlert map[string]time.Time
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewAnomalyMonitor creates a monitor for the alert settings of config
+func NewAnomalyMonitor(config *liveConfig) *AnomalyMonitor {
+	return &AnomalyMonitor{
+		config:    config,
+		current:   make(map[string]errorCounts),
+		baseline:  make(map[string][]errorCounts),
+		lastAlert: make(map[string]time.Time),
+	}
+}
+
+// routeGroup returns the first configured group whose prefix matches a path
+func routeGroup(groups []AlertGroupConfig, path string) (AlertGroupConfig, bool) {
+	for _, group := range groups {
+		if strings.HasPrefix(path, group.Prefix) {
+			return group, true
+		}
+	}
+	return AlertGroupConfig{}, false
+}
+
+// record counts a finished request in its route group
+func (am *AnomalyMonitor) record(path string, status int) {
+	group, ok := routeGroup(am.config.Load().Alerts.Groups, path)
+	if !ok {
+		return
+	}
+
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	counts := am.current[group.Name]
+	counts.requests++
+	if status >= 500 {
+		counts.serverErrors++
+	} else if status == http.StatusUnauthorized {
+		counts.unauthorized++
+	}
+	am.current[group.Name] = counts
+}
+
+// Start closes a window every configured interval until Stop
+func (am *AnomalyMonitor) Start() {
+	am.stop, am.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(am.done)
+		for {
+			select {
+			case <-time.After(am.config.Load().Alerts.Window):
+				am.check(time.Now())
+			case <-am.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops closing windows. It does nothing when the monitor never started.
+func (am *AnomalyMonitor) Stop() {
+	if am.stop == nil {
+		return
+	}
+	close(am.stop)
+	<-am.done
+	am.stop = nil
+}
+
+// check evaluates the window that just ended and adds it to the baseline
+func (am *AnomalyMonitor) check(now time.Time) {
+	cfg := am.config.Load().Alerts
+
+	am.mu.Lock()
+	var alerts []string
+	for _, group := range cfg.Groups {
+		window := am.current[group.Name]
+		var baseline errorCounts
+		for _, past := range am.baseline[group.Name] {
+			baseline = baseline.add(past)
+		}
+
+		if window.requests >= cfg.MinRequests {
+			checks := []struct {
+				kind      string
+				failures  int64
+				base      int64
+				threshold float64
+			}{
+				{"5xx", window.serverErrors, baseline.serverErrors, group.MaxServerErrorRate},
+				{"401", window.unauthorized, baseline.unauthorized, group.MaxUnauthorizedRate},
+			}
+			for _, check := range checks {
+				current := failureRate(check.failures, window.requests)
+				usual := failureRate(check.base, baseline.requests)
+				if current <= check.threshold || current <= usual*cfg.SpikeFactor {
+					continue
+				}
+				key := group.Name + ":" + check.kind
+				if now.Sub(am.lastAlert[key]) < cfg.Cooldown {
+					continue
+				}
+				am.lastAlert[key] = now
+				alerts = append(alerts, fmt.Sprintf("%s rate of %s routes (%s*) is %.1f%% over the last %s (%d of %d requests), baseline %.1f%%",
+					check.kind, group.Name, group.Prefix, current*100, cfg.Window, check.failures, window.requests, usual*100))
+			}
+		}
+
+		history := append(am.baseline[group.Name], window)
+		if len(history) > cfg.BaselineWindows {
+			history = history[len(history)-cfg.BaselineWindows:]
+		}
+		am.baseline[group.Name] = history
+	}
+	am.current = make(map[string]errorCounts)
+	am.mu.Unlock()
+
+	for _, message := range alerts {
+		alertAdmins(cfg, message)
+	}
+}
@@ -0,0 +1,280 @@
+// Package apitest runs the whole film API over HTTP for end-to-end tests of
+// its endpoints:
+//
+//	func TestCreateFilm(t *testing.T) {
+//		srv := apitest.Start(t)
+//		user := srv.Login("user1", "password123")
+//		user.Post("/api/films", film).ExpectStatus(http.StatusCreated)
+//	}
+//
+// Films and users are kept in memory and loaded from the seed files, so the
+// endpoints that need PostgreSQL (lists, collections, lending, search, and
+// the like) answer 500. Set APITEST_DATABASE=true to run against the
+// database server of the DB_* settings instead, with migrations, seeds, and
+// background jobs, as `serve` would; then every endpoint works. Each test
+// gets a schema of its own there, dropped when the test ends.
+//
+// Every server has its own configuration, state, and, with the database,
+// tables, so tests may run in parallel.
+package apitest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"jirbthagoras/sts_go_3/api"
+)
+
+// Seed accounts, see seeds/users.yaml
+const (
+	AdminUsername = "admin"
+	AdminPassword = "admin123"
+	UserUsername  = "user1"
+	UserPassword  = "password123"
+)
+
+// Server is the film API listening on a local port for one test
+type Server struct {
+	*httptest.Server
+	api *api.Server
+	t   testing.TB
+}
+
+// Start starts the film API for a test and stops it when the test ends
+func Start(t testing.TB) *Server {
+	t.Helper()
+
+	cfg := api.DefaultConfig()
+	if os.Getenv("APITEST_DATABASE") == "true" {
+		var err error
+		if cfg, err = api.LoadConfig("apitest", nil); err != nil {
+			t.Fatalf("failed to load config: %v", err)
+		}
+		cfg.Storage.Backend = "postgres"
+	} else {
+		cfg.Storage.Backend = "memory"
+	}
+	cfg.Server.Warmup = false
+	cfg.Logging.Level = "silent"
+
+	if dir := os.Getenv("SEEDS_DIR"); dir != "" {
+		cfg.Storage.SeedsDir = dir
+	} else {
+		dir, err := findSeeds()
+		if err != nil {
+			t.Fatalf("failed to find the seed files, set SEEDS_DIR: %v", err)
+		}
+		cfg.Storage.SeedsDir = dir
+	}
+	if cfg.Storage.Backend == "postgres" {
+		cfg.Database.Schema = createSchema(t, cfg)
+	}
+
+	films, err := api.New(cfg)
+	if err != nil {
+		t.Fatalf("failed to start the film API: %v", err)
+	}
+	srv := &Server{Server: httptest.NewServer(films), api: films, t: t}
+	t.Cleanup(func() {
+		srv.Server.Close()
+		films.Close()
+	})
+	return srv
+}
+
+// createSchema creates an empty schema for one test and drops it, with
+// everything in it, when the test ends
+func createSchema(t testing.TB, cfg *api.Config) string {
+	t.Helper()
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatalf("failed to name the test schema: %v", err)
+	}
+	schema := "apitest_" + hex.EncodeToString(suffix)
+
+	db, err := api.ConnectDatabase(cfg)
+	if err != nil {
+		t.Fatalf("failed to connect to the database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to connect to the database: %v", err)
+	}
+	if err := db.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		sqlDB.Close()
+		t.Fatalf("failed to create the test schema: %v", err)
+	}
+	// Registered first, so it runs after the server is stopped
+	t.Cleanup(func() {
+		if err := db.Exec("DROP SCHEMA " + schema + " CASCADE").Error; err != nil {
+			t.Errorf("failed to drop the test schema %s: %v", schema, err)
+		}
+		sqlDB.Close()
+	})
+	return schema
+}
+
+// findSeeds returns the seeds directory of the module the test runs in
+func findSeeds() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		seeds := filepath.Join(dir, "seeds")
+		if info, err := os.Stat(seeds); err == nil && info.IsDir() {
+			return seeds, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", os.ErrNotExist
+		}
+		dir = parent
+	}
+}
+
+// Client returns a client sending requests without logging in
+func (s *Server) Client() *Client {
+	return &Client{srv: s, header: http.Header{}}
+}
+
+// Login logs in and returns a client sending requests as the user. The test
+// fails if the login is refused.
+func (s *Server) Login(username, password string) *Client {
+	s.t.Helper()
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	s.Client().Post("/api/login", map[string]string{"username": username, "password": password}).
+		ExpectStatus(http.StatusOK).
+		Decode(&login)
+	return s.Client().WithHeader("Authorization", "Bearer "+login.Token)
+}
+
+// Admin returns a client logged in as the seed admin
+func (s *Server) Admin() *Client {
+	s.t.Helper()
+	return s.Login(AdminUsername, AdminPassword)
+}
+
+// User returns a client logged in as a seed user without admin rights
+func (s *Server) User() *Client {
+	s.t.Helper()
+	return s.Login(UserUsername, UserPassword)
+}
+
+// Client sends requests to a test server, with the same headers on every
+// request
+type Client struct {
+	srv    *Server
+	header http.Header
+}
+
+// WithHeader returns a copy of the client that also sends a header
+func (c *Client) WithHeader(name, value string) *Client {
+	header := c.header.Clone()
+	header.Set(name, value)
+	return &Client{srv: c.srv, header: header}
+}
+
+// Get sends a GET request
+func (c *Client) Get(path string) *Response {
+	c.srv.t.Helper()
+	return c.Do(http.MethodGet, path, nil)
+}
+
+// Post sends a POST request with a body
+func (c *Client) Post(path string, body interface{}) *Response {
+	c.srv.t.Helper()
+	return c.Do(http.MethodPost, path, body)
+}
+
+// Put sends a PUT request with a body
+func (c *Client) Put(path string, body interface{}) *Response {
+	c.srv.t.Helper()
+	return c.Do(http.MethodPut, path, body)
+}
+
+// Delete sends a DELETE request
+func (c *Client) Delete(path string) *Response {
+	c.srv.t.Helper()
+	return c.Do(http.MethodDelete, path, nil)
+}
+
+// Do sends a request. A string or []byte body is sent as is, anything else
+// (but nil) encoded as JSON. The test fails if no response arrives.
+func (c *Client) Do(method, path string, body interface{}) *Response {
+	t := c.srv.t
+	t.Helper()
+
+	var content []byte
+	switch body := body.(type) {
+	case nil:
+	case string:
+		content = []byte(body)
+	case []byte:
+		content = body
+	default:
+		var err error
+		if content, err = json.Marshal(body); err != nil {
+			t.Fatalf("failed to encode request body: %v", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, c.srv.URL+path, bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+	if content != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.srv.Server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read the response of %s %s: %v", method, path, err)
+	}
+	return &Response{Response: resp, Body: data, t: t}
+}
+
+// Response is a response read in full
+type Response struct {
+	*http.Response
+	Body []byte
+	t    testing.TB
+}
+
+// ExpectStatus fails the test unless the response has the status
+func (r *Response) ExpectStatus(status int) *Response {
+	r.t.Helper()
+	if r.StatusCode != status {
+		r.t.Fatalf("%s %s: got status %d, want %d: %s", r.Request.Method, r.Request.URL.Path, r.StatusCode, status, r.Body)
+	}
+	return r
+}
+
+// Decode decodes the JSON body into v, failing the test if it can't
+func (r *Response) Decode(v interface{}) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		r.t.Fatalf("failed to decode the response of %s %s: %v: %s", r.Request.Method, r.Request.URL.Path, err, r.Body)
+	}
+	return r
+}
@@ -0,0 +1,92 @@
+package apitest
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type film struct {
+	ID       uint   `json:"id"`
+	Title    string `json:"title"`
+	Director string `json:"director"`
+	Year     int    `json:"year"`
+	Genre    string `json:"genre"`
+	Version  int    `json:"version"`
+}
+
+func TestFilmLifecycle(t *testing.T) {
+	t.Parallel()
+	srv := Start(t)
+	user, admin := srv.User(), srv.Admin()
+
+	var created film
+	user.Post("/api/films", film{Title: "Paris, Texas", Director: "Wim Wenders", Year: 1984, Genre: "Drama"}).
+		ExpectStatus(http.StatusCreated).
+		Decode(&created)
+	path := fmt.Sprintf("/api/films/%d", created.ID)
+
+	user.Post("/api/films", film{Title: "paris, texas", Director: "Wim Wenders", Year: 1984, Genre: "Drama"}).
+		ExpectStatus(http.StatusConflict)
+
+	var updated film
+	user.Put(path, film{Title: "Paris, Texas", Director: "Wim Wenders", Year: 1984, Genre: "Romance", Version: created.Version}).
+		ExpectStatus(http.StatusOK).
+		Decode(&updated)
+	if updated.Genre != "Romance" || updated.Version != created.Version+1 {
+		t.Errorf("got %+v after the update", updated)
+	}
+	user.Put(path, film{Title: "Paris, Texas", Director: "Wim Wenders", Year: 1984, Genre: "Drama", Version: created.Version}).
+		ExpectStatus(http.StatusConflict)
+
+	admin.Delete(path).ExpectStatus(http.StatusNoContent)
+	user.Get(path).ExpectStatus(http.StatusNotFound)
+}
+
+func TestAuthentication(t *testing.T) {
+	t.Parallel()
+	srv := Start(t)
+
+	srv.Client().Post("/api/films", film{Title: "Stalker", Director: "Andrei Tarkovsky", Year: 1979, Genre: "Sci-Fi"}).
+		ExpectStatus(http.StatusUnauthorized)
+	srv.Client().Post("/api/login", map[string]string{"username": UserUsername, "password": "wrong"}).
+		ExpectStatus(http.StatusUnauthorized)
+	srv.User().Get("/api/admin/users").ExpectStatus(http.StatusForbidden)
+	srv.Admin().Get("/api/admin/users").ExpectStatus(http.StatusOK)
+}
+
+func TestServersKeepTheirOwnState(t *testing.T) {
+	t.Parallel()
+	readOnly, writable := Start(t), Start(t)
+
+	readOnly.Admin().Put("/api/admin/read-only", map[string]bool{"read_only": true}).
+		ExpectStatus(http.StatusOK)
+	readOnly.User().Post("/api/films", film{Title: "Stalker", Director: "Andrei Tarkovsky", Year: 1979, Genre: "Sci-Fi"}).
+		ExpectStatus(http.StatusServiceUnavailable)
+	writable.User().Post("/api/films", film{Title: "Stalker", Director: "Andrei Tarkovsky", Year: 1979, Genre: "Sci-Fi"}).
+		ExpectStatus(http.StatusCreated)
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	t.Parallel()
+	srv := Start(t)
+	user := srv.User().WithHeader("Idempotency-Key", "create-stalker")
+	stalker := film{Title: "Stalker", Director: "Andrei Tarkovsky", Year: 1979, Genre: "Sci-Fi"}
+
+	// A failed request releases the key again
+	user.Post("/api/films", "{").ExpectStatus(http.StatusBadRequest)
+	created := user.Post("/api/films", stalker).ExpectStatus(http.StatusCreated)
+	if created.Header.Get("Idempotent-Replayed") != "" {
+		t.Errorf("the first create was marked as replayed")
+	}
+
+	// Keys belong to the user, not to the token
+	replayed := srv.User().WithHeader("Idempotency-Key", "create-stalker").Post("/api/films", stalker).
+		ExpectStatus(http.StatusCreated)
+	if replayed.Header.Get("Idempotent-Replayed") != "true" || string(replayed.Body) != string(created.Body) {
+		t.Errorf("a retry with a new token was not replayed: %s", replayed.Body)
+	}
+	srv.Admin().WithHeader("Idempotency-Key", "create-stalker").
+		Post("/api/films", film{Title: "Solaris", Director: "Andrei Tarkovsky", Year: 1972, Genre: "Sci-Fi"}).
+		ExpectStatus(http.StatusCreated)
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// API usage windows
+const (
+	defaultUsageHours = 24
+	maxUsageHours     = 30 * 24
+	defaultUsageLimit = 20
+	maxUsageLimit     = 100
+)
+
+// usageKey counts the requests of a user to an endpoint in one hour
+type usageKey struct {
+	username string
+	endpoint string
+	hour     time.Time
+}
+
+// UsageCounter counts API requests per user and endpoint in memory, so
+// requests only take a lock, and adds the counts to the hourly totals of the
+// api_usages table when flushed
+type UsageCounter struct {
+	db      *gorm.DB
+	mu      sync.Mutex
+	pending map[usageKey]int64
+}
+
+// NewUsageCounter creates a new usage counter
+func NewUsageCounter(db *gorm.DB) *UsageCounter {
+	return &UsageCounter{db: db, pending: make(map[usageKey]int64)}
+}
+
+// requestEndpoint names the endpoint of a request by its method and path
+// template, like GET /api/films/{id}, so requests for different films count
+// toward the same endpoint. Without a spec the path is used as is.
+func requestEndpoint(spec *OpenAPISpec, r *http.Request) string {
+	path := r.URL.Path
+	if spec != nil {
+		if template, ok := spec.template(path); ok {
+			path = template
+		}
+	}
+	return r.Method + " " + path
+}
+
+// Record counts a request of a user to an endpoint, as named by requestEndpoint
+func (uc *UsageCounter) Record(username, endpoint string) {
+	key := usageKey{username: username, endpoint: endpoint, hour: time.Now().UTC().Truncate(time.Hour)}
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.pending[key]++
+}
+
+// Flush adds the requests counted since the last flush to the hourly totals.
+// It runs as the api-usage-flush scheduled job; counts that fail to store are
+// kept for the next flush.
+func (uc *UsageCounter) Flush(ctx context.Context) error {
+	uc.mu.Lock()
+	pending := uc.pending
+	uc.pending = make(map[usageKey]int64)
+	uc.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	rows := make([]APIUsage, 0, len(pending))
+	for key, requests := range pending {
+		rows = append(rows, APIUsage{Username: key.username, Endpoint: key.endpoint, Hour: key.hour, Requests: requests})
+	}
+	err := uc.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "username"}, {Name: "endpoint"}, {Name: "hour"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"requests": gorm.Expr("api_usages.requests + excluded.requests")}),
+	}).Create(&rows).Error
+	if err != nil {
+		uc.mu.Lock()
+		for key, requests := range pending {
+			uc.pending[key] += requests
+		}
+		uc.mu.Unlock()
+	}
+	return err
+}
+
+// Purge removes the hourly totals from before a time and returns how many
+// were removed
+func (uc *UsageCounter) Purge(ctx context.Context, before time.Time) (int64, error) {
+	result := uc.db.WithContext(ctx).Where("hour < ?", before).Delete(&APIUsage{})
+	return result.RowsAffected, result.Error
+}
+
+// GetUserUsage sums the requests of a user since a time, by endpoint, most
+// requested first, and by hour. Requests not flushed yet aren't counted.
+func (uc *UsageCounter) GetUserUsage(username string, since time.Time) (*UsageReport, error) {
+	report := UsageReport{Since: since, Endpoints: []EndpointUsage{}, Hours: []HourlyUsage{}}
+	err := uc.db.Model(&APIUsage{}).Select("endpoint, sum(requests) AS requests").
+		Where("username = ? AND hour >= ?", username, since).
+		Group("endpoint").Order("requests DESC, endpoint").
+		Scan(&report.Endpoints).Error
+	if err != nil {
+		return nil, err
+	}
+	err = uc.db.Model(&APIUsage{}).Select("hour, sum(requests) AS requests").
+		Where("username = ? AND hour >= ?", username, since).
+		Group("hour").Order("hour").
+		Scan(&report.Hours).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, endpoint := range report.Endpoints {
+		report.Requests += endpoint.Requests
+	}
+	return &report, nil
+}
+
+// GetTopUsers returns the users who made the most requests since a time,
+// most first, each with their requests by endpoint. Requests not flushed yet
+// aren't counted.
+func (uc *UsageCounter) GetTopUsers(since time.Time, limit int) ([]UserUsage, error) {
+	users := []UserUsage{}
+	err := uc.db.Model(&APIUsage{}).Select("username, sum(requests) AS requests").
+		Where("hour >= ?", since).
+		Group("username").Order("requests DESC, username").Limit(limit).
+		Scan(&users).Error
+	if err != nil || len(users) == 0 {
+		return users, err
+	}
+
+	usernames := make([]string, len(users))
+	index := make(map[string]int, len(users))
+	for i := range users {
+		usernames[i] = users[i].Username
+		index[users[i].Username] = i
+		users[i].Endpoints = []EndpointUsage{}
+	}
+	var endpoints []struct {
+		Username string
+		Endpoint string
+		Requests int64
+	}
+	err = uc.db.Model(&APIUsage{}).Select("username, endpoint, sum(requests) AS requests").
+		Where("hour >= ? AND username IN ?", since, usernames).
+		Group("username, endpoint").Order("requests DESC, endpoint").
+		Scan(&endpoints).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, endpoint := range endpoints {
+		user := &users[index[endpoint.Username]]
+		user.Endpoints = append(user.Endpoints, EndpointUsage{Endpoint: endpoint.Endpoint, Requests: endpoint.Requests})
+	}
+	return users, nil
+}
+
+// usageSince parses the hours parameter of the usage endpoints into the
+// start of the window; the current hour counts as one of the hours
+func usageSince(r *http.Request) (time.Time, bool) {
+	hours := defaultUsageHours
+	if value := r.URL.Query().Get("hours"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxUsageHours {
+			return time.Time{}, false
+		}
+		hours = parsed
+	}
+	return time.Now().UTC().Truncate(time.Hour).Add(time.Duration(1-hours) * time.Hour), true
+}
+
+// meUsageHandler handles GET /api/me/usage, the API usage of the
+// authenticated user
+func (s *Server) meUsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+	since, ok := usageSince(r)
+	if !ok {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "hours must be between 1 and 720", Code: "usage_hours_invalid", Params: Params{"min": 1, "max": 720}})
+		return
+	}
+
+	report, err := s.usageCounter.GetUserUsage(currentUsername(r), since)
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve usage", Code: "usage_retrieve_failed"})
+		return
+	}
+	writeResponse(w, r, http.StatusOK, report)
+}
+
+// adminUsageHandler handles GET /api/admin/usage, the users making the most
+// API requests (admin only)
+func (s *Server) adminUsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+	since, ok := usageSince(r)
+	if !ok {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "hours must be between 1 and 720", Code: "usage_hours_invalid", Params: Params{"min": 1, "max": 720}})
+		return
+	}
+	limit := defaultUsageLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxUsageLimit {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "limit must be between 1 and 100", Code: "limit_invalid", Params: Params{"min": 1, "max": 100}})
+			return
+		}
+		limit = parsed
+	}
+
+	users, err := s.usageCounter.GetTopUsers(since, limit)
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve usage", Code: "usage_retrieve_failed"})
+		return
+	}
+	writeResponse(w, r, http.StatusOK, users)
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// embeddedAssets are the files the server needs at runtime, built into the
+// binary so it works from any working directory
+//
+//go:embed index.html swagger.yaml
+var embeddedAssets embed.FS
+
+// assetFS returns the bundled assets. A directory serves them from there
+// instead, so edits show up without rebuilding during development.
+func assetFS(dir string) fs.FS {
+	if dir != "" {
+		return os.DirFS(dir)
+	}
+	return embeddedAssets
+}
+
+// readAsset reads a bundled asset, from dir when set
+func readAsset(dir, name string) ([]byte, error) {
+	return fs.ReadFile(assetFS(dir), name)
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// backupSchemaVersion is bumped whenever the layout of backups changes
+const backupSchemaVersion = 1
+
+// Backup formats
+const (
+	BackupFormatJSON   = "json"
+	BackupFormatNDJSON = "ndjson"
+)
+
+// backupTable is a table included in backups
+type backupTable struct {
+	name       string
+	primaryKey []string
+}
+
+// backupTables lists the tables of a backup, each after the tables it refers to
+var backupTables = []backupTable{
+	{"organizations", []string{"id"}},
+	{"users", []string{"id"}},
+	{"films", []string{"id"}},
+	{"film_revisions", []string{"id"}},
+	{"collections", []string{"id"}},
+	{"collection_films", []string{"collection_id", "film_id"}},
+	{"film_lists", []string{"id"}},
+	{"film_list_items", []string{"list_id", "film_id"}},
+	{"copies", []string{"id"}},
+	{"loans", []string{"id"}},
+	{"screenings", []string{"id"}},
+	{"film_views", []string{"film_id", "day"}},
+}
+
+// BackupHeader describes a backup. It opens the JSON document and is the
+// first line of NDJSON backups.
+type BackupHeader struct {
+	SchemaVersion int       `json:"schema_version"`
+	GeneratedAt   time.Time `json:"generated_at"`
+	Passwords     bool      `json:"passwords"`
+	Tables        []string  `json:"tables"`
+}
+
+// BackupLine is a line of an NDJSON backup after the header: a row of a
+// table, or the trailer counting the rows, whose absence marks a truncated
+// backup
+type BackupLine struct {
+	Table string                 `json:"table,omitempty"`
+	Row   map[string]interface{} `json:"row,omitempty"`
+	End   bool                   `json:"end,omitempty"`
+	Rows  int64                  `json:"rows,omitempty"`
+}
+
+// backupWriter writes the rows of a backup in one of the backup formats
+type backupWriter interface {
+	Header(header BackupHeader) error
+	Row(table string, row map[string]interface{}) error
+	Close(rows int64) error
+}
+
+// WriteBackup dumps every backup table, row by row as they are read, from
+// one read-only transaction so the tables are consistent with each other.
+// Passwords are left out unless passwords is set. It returns the
+// number of rows written.
+func (es *ExportService) WriteBackup(bw backupWriter, passwords bool) (int64, error) {
+	header := BackupHeader{
+		SchemaVersion: backupSchemaVersion,
+		GeneratedAt:   time.Now().UTC(),
+		Passwords:     passwords,
+	}
+	for _, table := range backupTables {
+		header.Tables = append(header.Tables, table.name)
+	}
+
+	var count int64
+	err := es.db.Transaction(func(tx *gorm.DB) error {
+		if err := bw.Header(header); err != nil {
+			return err
+		}
+		for _, table := range backupTables {
+			rows, err := tx.Table(table.name).Order(strings.Join(table.primaryKey, ", ")).Rows()
+			if err != nil {
+				return err
+			}
+			err = writeBackupRows(bw, table.name, rows, passwords, &count)
+			rows.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return count, err
+	}
+	return count, bw.Close(count)
+}
+
+// writeBackupRows writes the rows of a table as column maps, so backups
+// carry every column whatever the JSON of the models hides
+func writeBackupRows(bw backupWriter, table string, rows *sql.Rows, passwords bool, count *int64) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if table == "users" && column == "password" && !passwords {
+				continue
+			}
+			row[column] = values[i]
+			// Text columns may arrive as bytes, which JSON would base64 encode
+			if b, ok := values[i].([]byte); ok {
+				row[column] = string(b)
+			}
+		}
+		if err := bw.Row(table, row); err != nil {
+			return err
+		}
+		*count++
+	}
+	return rows.Err()
+}
+
+// jsonBackupWriter writes a backup as one JSON document with a list of rows
+// per table, one row per line
+type jsonBackupWriter struct {
+	w      *bufio.Writer
+	tables []string
+	table  int
+	rows   int
+}
+
+func newJSONBackupWriter(w io.Writer) *jsonBackupWriter {
+	return &jsonBackupWriter{w: bufio.NewWriter(w), table: -1}
+}
+
+func (jw *jsonBackupWriter) Header(header BackupHeader) error {
+	jw.tables = header.Tables
+	fields, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	// Reopen the header object to add the tables to it
+	jw.w.Write(fields[:len(fields)-1])
+	_, err = jw.w.WriteString(`,"data":{`)
+	return err
+}
+
+// nextTable closes the list of the current table and opens the next one
+func (jw *jsonBackupWriter) nextTable() {
+	if jw.table >= 0 {
+		jw.w.WriteString("\n]")
+		if jw.table < len(jw.tables)-1 {
+			jw.w.WriteString(",")
+		}
+	}
+	jw.table++
+	jw.rows = 0
+	if jw.table < len(jw.tables) {
+		fmt.Fprintf(jw.w, "\n%q:[", jw.tables[jw.table])
+	}
+}
+
+func (jw *jsonBackupWriter) Row(table string, row map[string]interface{}) error {
+	for jw.table < 0 || jw.tables[jw.table] != table {
+		if jw.table >= len(jw.tables)-1 {
+			return fmt.Errorf("unexpected backup table %s", table)
+		}
+		jw.nextTable()
+	}
+	line, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if jw.rows > 0 {
+		jw.w.WriteString(",")
+	}
+	jw.w.WriteString("\n")
+	jw.rows++
+	_, err = jw.w.Write(line)
+	return err
+}
+
+func (jw *jsonBackupWriter) Close(rows int64) error {
+	for jw.table < len(jw.tables) {
+		jw.nextTable()
+	}
+	jw.w.WriteString("\n}}\n")
+	return jw.w.Flush()
+}
+
+// ndjsonBackupWriter writes a gzipped backup with a line per row
+type ndjsonBackupWriter struct {
+	gz      *gzip.Writer
+	encoder *json.Encoder
+}
+
+func newNDJSONBackupWriter(w io.Writer) *ndjsonBackupWriter {
+	gz := gzip.NewWriter(w)
+	return &ndjsonBackupWriter{gz: gz, encoder: json.NewEncoder(gz)}
+}
+
+func (nw *ndjsonBackupWriter) Header(header BackupHeader) error {
+	return nw.encoder.Encode(header)
+}
+
+func (nw *ndjsonBackupWriter) Row(table string, row map[string]interface{}) error {
+	return nw.encoder.Encode(BackupLine{Table: table, Row: row})
+}
+
+func (nw *ndjsonBackupWriter) Close(rows int64) error {
+	if err := nw.encoder.Encode(BackupLine{End: true, Rows: rows}); err != nil {
+		return err
+	}
+	return nw.gz.Close()
+}
+
+// backupExportHandler handles GET /api/admin/export, streaming a backup of
+// every organization for restoring or cloning the deployment
+func (s *Server) backupExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = BackupFormatJSON
+	}
+	if format != BackupFormatJSON && format != BackupFormatNDJSON {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "format must be json or ndjson", Code: "backup_format_invalid"})
+		return
+	}
+	passwords := r.URL.Query().Get("passwords") == "true"
+
+	counter := &countingWriter{w: w}
+	var bw backupWriter
+	if format == BackupFormatNDJSON {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="backup.ndjson.gz"`)
+		bw = newNDJSONBackupWriter(counter)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="backup.json"`)
+		bw = newJSONBackupWriter(counter)
+	}
+
+	rows, err := s.exportService.WriteBackup(bw, passwords)
+	if err == nil {
+		s.meteringService.RecordRequest(r, MeterExport, rows)
+		return
+	}
+	log.Printf("Warning: Backup export failed: %v", err)
+	// Once the backup has started, the status is sent and a failure can
+	// only cut it short, which leaves the JSON invalid or the NDJSON
+	// without its trailer
+	if counter.n == 0 {
+		w.Header().Del("Content-Disposition")
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to create backup", Code: "backup_create_failed"})
+	}
+}
@@ -0,0 +1,420 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxBatchSize caps the number of items accepted by batch endpoints
+const maxBatchSize = 1000
+
+// ErrBatchSelectorRequired is returned by DeleteFilms when neither IDs nor a
+// filter with at least one condition select the films
+var ErrBatchSelectorRequired = errors.New("ids or filter required")
+
+// Conflict strategies for batch imports, applied to items matching a stored film
+const (
+	ConflictSkip          = "skip"
+	ConflictOverwrite     = "overwrite"
+	ConflictMergeNonEmpty = "merge-nonempty"
+	ConflictFail          = "fail"
+)
+
+// Outcomes reported per batch item
+const (
+	batchActionCreated     = "created"
+	batchActionOverwritten = "overwritten"
+	batchActionMerged      = "merged"
+	batchActionSkipped     = "skipped"
+	batchActionConflict    = "conflict"
+	batchActionFailed      = "failed"
+)
+
+// batchUpdate is an item that will be written over a stored film
+type batchUpdate struct {
+	index   int
+	id      uint
+	filmReq FilmRequest
+}
+
+// mergeNonEmpty fills the empty fields of an imported record from the stored film
+func mergeNonEmpty(existing *Film, filmReq FilmRequest) FilmRequest {
+	merged := FilmRequest{
+		Title:    existing.Title,
+		Director: existing.Director,
+		Year:     existing.Year,
+		Genre:    existing.Genre,
+		Version:  filmReq.Version,
+	}
+	if strings.TrimSpace(filmReq.Title) != "" {
+		merged.Title = filmReq.Title
+	}
+	if strings.TrimSpace(filmReq.Director) != "" {
+		merged.Director = filmReq.Director
+	}
+	if filmReq.Year != 0 {
+		merged.Year = filmReq.Year
+	}
+	if strings.TrimSpace(filmReq.Genre) != "" {
+		merged.Genre = filmReq.Genre
+	}
+	if filmReq.ExternalID != "" {
+		merged.ExternalID = filmReq.ExternalID
+	}
+	// Omitted metadata keeps its stored value, so only the filled fields are carried over
+	if filmReq.RuntimeMinutes != nil && *filmReq.RuntimeMinutes != 0 {
+		merged.RuntimeMinutes = filmReq.RuntimeMinutes
+	}
+	if filled(filmReq.Synopsis) {
+		merged.Synopsis = filmReq.Synopsis
+	}
+	if filled(filmReq.Language) {
+		merged.Language = filmReq.Language
+	}
+	if filled(filmReq.Country) {
+		merged.Country = filmReq.Country
+	}
+	if filled(filmReq.AgeRating) {
+		merged.AgeRating = filmReq.AgeRating
+	}
+	if filled(filmReq.IMDbID) {
+		merged.IMDbID = filmReq.IMDbID
+	}
+	if filled(filmReq.TrailerURL) {
+		merged.TrailerURL = filmReq.TrailerURL
+	}
+	if filmReq.ExternalLinks != nil && len(*filmReq.ExternalLinks) > 0 {
+		merged.ExternalLinks = filmReq.ExternalLinks
+	}
+	return merged
+}
+
+// filled reports whether an optional text field is present and not blank
+func filled(value *string) bool {
+	return value != nil && strings.TrimSpace(*value) != ""
+}
+
+// batchCreateFilmsHandler imports several films in one request. Items matching
+// a stored film by external ID or natural key are handled by the strategy parameter.
+func (s *Server) batchCreateFilmsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	strategy := r.URL.Query().Get("strategy")
+	if strategy == "" {
+		strategy = ConflictSkip
+	}
+	if strategy != ConflictSkip && strategy != ConflictOverwrite && strategy != ConflictMergeNonEmpty && strategy != ConflictFail {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "strategy must be one of skip, overwrite, merge-nonempty, fail", Code: "invalid_strategy", Params: Params{"values": "skip, overwrite, merge-nonempty, fail"}})
+		return
+	}
+
+	var filmReqs []FilmRequest
+	if err := json.NewDecoder(r.Body).Decode(&filmReqs); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON, expected an array of films", Code: "invalid_json_array"})
+		return
+	}
+
+	if len(filmReqs) == 0 || len(filmReqs) > maxBatchSize {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Batch must contain between 1 and 1000 films", Code: "batch_size_invalid", Params: Params{"min": 1, "max": 1000}})
+		return
+	}
+
+	// Validate every item and decide what to do with it before writing anything
+	response := BatchCreateResponse{Strategy: strategy, Results: make([]BatchItemResult, len(filmReqs))}
+	results := response.Results
+	var valid []FilmRequest
+	var validIndexes []int
+	var updates []batchUpdate
+	conflicts := 0
+	hc := HookContext{Action: ActionCreate, Request: r, Username: currentUsername(r)}
+	catalog := s.tenantFilms(r)
+	seen := make(map[string]int)
+	for i, filmReq := range filmReqs {
+		results[i].Index = i
+		if err := s.plugins.runFilmPreValidate(hc, &filmReq); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		filmReq.ExternalID = strings.TrimSpace(filmReq.ExternalID)
+		existing, err := catalog.FindConflict(filmReq, 0)
+		if err != nil {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to check for duplicate films", Code: "duplicate_check_failed"})
+			return
+		}
+		if existing != nil {
+			results[i].ID = existing.ID
+			switch strategy {
+			case ConflictSkip:
+				results[i].Action = batchActionSkipped
+				continue
+			case ConflictFail:
+				results[i].Action = batchActionConflict
+				results[i].Error = fmt.Sprintf("Film already exists with id %d", existing.ID)
+				conflicts++
+				continue
+			case ConflictMergeNonEmpty:
+				filmReq = mergeNonEmpty(existing, filmReq)
+			}
+		}
+
+		if validationErr := ValidateFilmRequest(&filmReq, s.currentConfig()); validationErr != nil {
+			results[i].Error = "Validation failed"
+			results[i].Fields = validationErr.Fields
+			continue
+		}
+
+		// Reject items that refer to the same film as an earlier item in the batch
+		keys := []string{fmt.Sprintf("%s|%d|%s", normalizeFilmKey(filmReq.Title), filmReq.Year, normalizeFilmKey(filmReq.Director))}
+		if filmReq.ExternalID != "" {
+			keys = append(keys, "external:"+filmReq.ExternalID)
+		}
+		duplicate := false
+		for _, key := range keys {
+			if first, exists := seen[key]; exists {
+				results[i].Error = fmt.Sprintf("Duplicate of item %d in this batch", first)
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		for _, key := range keys {
+			seen[key] = i
+		}
+
+		if existing != nil {
+			updates = append(updates, batchUpdate{index: i, id: existing.ID, filmReq: filmReq})
+			continue
+		}
+		valid = append(valid, filmReq)
+		validIndexes = append(validIndexes, i)
+	}
+
+	for i := range results {
+		if results[i].Error != "" && results[i].Action == "" {
+			results[i].Action = batchActionFailed
+		}
+	}
+
+	// The fail strategy only writes when no item matches a stored film
+	if conflicts > 0 {
+		response.Failed = len(filmReqs)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	editor, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if len(valid) > 0 {
+		films, err := catalog.CreateFilms(valid, editor)
+		if err != nil {
+			var quotaErr *QuotaError
+			if errors.As(err, &quotaErr) {
+				writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Film quota exceeded: " + quotaErr.Error(), Code: "film_quota_exceeded", Params: Params{"detail": quotaErr}})
+				return
+			}
+			var dailyQuotaErr *DailyQuotaError
+			if errors.As(err, &dailyQuotaErr) {
+				writeDailyQuotaExceeded(w, r, dailyQuotaErr)
+				return
+			}
+			var hookErr *HookError
+			if errors.As(err, &hookErr) {
+				writeResponse(w, r, http.StatusUnprocessableEntity, errorResponse(hookErr))
+				return
+			}
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to create films", Code: "films_create_failed"})
+			return
+		}
+		for i, film := range films {
+			results[validIndexes[i]].ID = film.ID
+			results[validIndexes[i]].Action = batchActionCreated
+		}
+		response.Created = len(films)
+	}
+
+	// Updates go through the regular update path, one film at a time
+	for _, update := range updates {
+		result := &results[update.index]
+		_, err := catalog.UpdateFilm(update.id, update.filmReq, editor)
+		if err != nil {
+			var hookErr *HookError
+			var duplicateErr *DuplicateFilmError
+			var conflictErr *VersionConflictError
+			if errors.As(err, &hookErr) {
+				result.Error = hookErr.Error()
+			} else if errors.As(err, &duplicateErr) {
+				result.Error = fmt.Sprintf("Film already exists with id %d", duplicateErr.Existing.ID)
+			} else if errors.As(err, &conflictErr) {
+				result.Error = "Film was modified by another request"
+			} else if err.Error() == "film not found" {
+				result.Error = "Film not found"
+			} else if err.Error() == "not the film creator" {
+				result.Error = "Only the creator of a film or an admin can change it"
+			} else {
+				result.Error = "Failed to update film"
+			}
+			result.Action = batchActionFailed
+			continue
+		}
+		if strategy == ConflictMergeNonEmpty {
+			result.Action = batchActionMerged
+		} else {
+			result.Action = batchActionOverwritten
+		}
+		response.Updated++
+	}
+
+	for _, result := range results {
+		if result.Action == batchActionSkipped {
+			response.Skipped++
+		} else if result.Action == batchActionFailed {
+			response.Failed++
+		}
+	}
+	if written := response.Created + response.Updated; written > 0 {
+		s.meteringService.RecordRequest(r, MeterWrite, int64(written))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if response.Created > 0 {
+		w.WriteHeader(http.StatusCreated)
+	} else if response.Failed == len(filmReqs) {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// maxLookupSize caps the number of films fetched by one lookup
+const maxLookupSize = 100
+
+// parseFilmIDs parses a comma-separated list of film IDs
+func parseFilmIDs(value string) ([]uint, error) {
+	var ids []uint
+	for _, part := range strings.Split(value, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+		if err != nil || id == 0 {
+			return nil, &CodedError{Code: "lookup_ids_invalid", Message: "ids must be a comma-separated list of film IDs"}
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// lookupFilms answers with the films of an ID list in the order they were
+// asked for, each once, and the IDs that don't match a film
+func (s *Server) lookupFilms(w http.ResponseWriter, r *http.Request, ids []uint, includes map[string]bool) {
+	if len(ids) == 0 {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "ids is required", Code: "lookup_ids_required"})
+		return
+	}
+	if len(ids) > maxLookupSize {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Batch must contain at most %d IDs", maxLookupSize), Code: "batch_ids_too_many", Params: Params{"max": maxLookupSize}})
+		return
+	}
+
+	found, err := s.tenantFilms(r).GetFilmsByIDs(ids)
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve films", Code: "films_retrieve_failed"})
+		return
+	}
+	byID := make(map[uint]Film, len(found))
+	for _, film := range found {
+		byID[film.ID] = film
+	}
+
+	response := FilmLookupResponse{Data: []Film{}, Missing: []uint{}}
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if film, ok := byID[id]; ok {
+			response.Data = append(response.Data, film)
+		} else {
+			response.Missing = append(response.Missing, id)
+		}
+	}
+	if err := s.includeFilmRelations(includes, response.Data); err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve films", Code: "films_retrieve_failed"})
+		return
+	}
+	response.Data = withFilmLinks(response.Data)
+	writeResponse(w, r, http.StatusOK, response)
+}
+
+// lookupFilmsHandler handles POST /api/films/lookup, the form of GET
+// /api/films?ids= for ID lists too long for a URL
+func (s *Server) lookupFilmsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	var lookupReq FilmLookupRequest
+	if err := json.NewDecoder(r.Body).Decode(&lookupReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+	includes, err := parseFilmIncludes(r)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	s.lookupFilms(w, r, lookupReq.IDs, includes)
+}
+
+// batchDeleteFilmsHandler handles deleting films by ID list or filter
+func (s *Server) batchDeleteFilmsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	var deleteReq BatchDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&deleteReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+
+	if len(deleteReq.IDs) > maxBatchSize {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Batch must contain at most 1000 IDs", Code: "batch_ids_too_many", Params: Params{"max": 1000}})
+		return
+	}
+
+	editor, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := s.tenantFilms(r).DeleteFilms(deleteReq.IDs, deleteReq.Filter, editor)
+	if err != nil {
+		if errors.Is(err, ErrBatchSelectorRequired) {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Either ids or a non-empty filter is required", Code: "batch_selector_required"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete films", Code: "films_delete_failed"})
+		}
+		return
+	}
+
+	if deleted > 0 {
+		s.meteringService.RecordRequest(r, MeterWrite, deleted)
+	}
+
+	writeResponse(w, r, http.StatusOK, BatchDeleteResponse{Deleted: deleted})
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// The benchmarks read films from a real database, configured like the server
+// with the DB_* settings, and compare running with and without the prepared
+// statement cache:
+//
+//	BENCH_DATABASE=true go test -run '^$' -bench . -benchtime 10s
+//
+// They read the films already there, so run them against a seeded database.
+
+func BenchmarkGetAllFilms(b *testing.B) {
+	benchmarkFilmReads(b, func(films *FilmService, id uint) error {
+		_, err := films.GetAllFilms(nil)
+		return err
+	})
+}
+
+func BenchmarkGetFilmByID(b *testing.B) {
+	benchmarkFilmReads(b, func(films *FilmService, id uint) error {
+		_, err := films.GetFilmByID(id)
+		return err
+	})
+}
+
+// benchmarkFilmReads runs a read from parallel goroutines, as under
+// sustained load, once without and once with prepared statements
+func benchmarkFilmReads(b *testing.B, read func(films *FilmService, id uint) error) {
+	if os.Getenv("BENCH_DATABASE") != "true" {
+		b.Skip("set BENCH_DATABASE=true to benchmark against the database")
+	}
+
+	for _, prepare := range []bool{false, true} {
+		b.Run(fmt.Sprintf("prepare_statements=%t", prepare), func(b *testing.B) {
+			cfg, err := LoadConfig("bench", nil)
+			if err != nil {
+				b.Fatalf("failed to load config: %v", err)
+			}
+			cfg.Database.PrepareStatements = prepare
+			cfg.Logging.Level = "silent"
+			cfg.Logging.SlowQueryThreshold = 0
+
+			db, err := ConnectDatabase(cfg)
+			if err != nil {
+				b.Fatalf("failed to connect: %v", err)
+			}
+			sqlDB, _ := db.DB()
+			defer sqlDB.Close()
+
+			var film Film
+			if err := db.First(&film).Error; err != nil {
+				b.Skipf("no film to read: %v", err)
+			}
+			films := NewFilmService(db, newLiveConfig(cfg), newPlugins())
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := read(films, film.ID); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// The token store benchmarks need no database. Every authenticated request
+// looks its token up and touches it, from as many goroutines as there are
+// requests in flight:
+//
+//	go test -run '^$' -bench TokenStore -cpu 1,4,16
+
+func BenchmarkTokenStoreAuthenticate(b *testing.B) {
+	benchmarkTokenStore(b, 0)
+}
+
+// BenchmarkTokenStoreLoginChurn also logs a client in and out every 100 requests
+func BenchmarkTokenStoreLoginChurn(b *testing.B) {
+	benchmarkTokenStore(b, 100)
+}
+
+// benchmarkTokenStore authenticates with 10,000 issued tokens from parallel
+// goroutines, adding and removing a token every churn requests unless churn is 0
+func benchmarkTokenStore(b *testing.B, churn int) {
+	ts := NewTokenStore(newLiveConfig(DefaultConfig()))
+	tokens := make([]string, 10000)
+	for i := range tokens {
+		tokens[i] = ts.GenerateToken()
+		ts.AddToken(tokens[i], "user"+strconv.Itoa(i%100), fixtureTenant, knownScopes)
+	}
+
+	var seed atomic.Uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		n := int(seed.Add(7919))
+		for pb.Next() {
+			n++
+			if churn > 0 && n%churn == 0 {
+				token := ts.GenerateToken()
+				ts.AddToken(token, "churn", fixtureTenant, knownScopes)
+				ts.RemoveToken(token)
+				continue
+			}
+			token := tokens[n%len(tokens)]
+			if _, ok := ts.Lookup(token); !ok {
+				b.Error("token not found")
+				return
+			}
+			ts.Touch(token, "127.0.0.1", "bench")
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Blob store backends
+const (
+	blobsLocal = "local"
+	blobsS3    = "s3"
+)
+
+// errBlobNotFound is returned for keys no blob is stored under
+var errBlobNotFound = errors.New("blob not found")
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	ContentType string
+	Size        int64
+}
+
+// BlobStore keeps uploaded files, like film posters, by key. Keys are
+// slash-separated paths like posters/2/9f86d081.jpg; the extension of a key
+// gives the content type of its blob.
+type BlobStore interface {
+	// Put stores a blob under a key, replacing any blob stored under it
+	Put(ctx context.Context, key string, body io.Reader, size int64) error
+	// Get opens a blob, failing with errBlobNotFound if there is none
+	Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error)
+	// Delete removes a blob; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+	// PresignGet returns a URL clients can download a blob from directly
+	// for ttl, without credentials, or "" if the store can't hand out URLs
+	// and blobs have to be served through the API
+	PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// NewBlobStore creates the blob store the config selects
+func NewBlobStore(cfg BlobsConfig) BlobStore {
+	if cfg.Backend == blobsS3 {
+		return NewS3BlobStore(cfg.S3)
+	}
+	return NewLocalBlobStore(cfg.Dir)
+}
+
+// blobContentType returns the content type of the blob under a key
+func blobContentType(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// validBlobKey reports whether a key is a relative path without . or ..
+// segments, so it can't leave the directory or bucket of the store
+func validBlobKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// LocalBlobStore keeps blobs as files in a directory, for single-instance
+// deployments and development. It can't presign URLs, so its blobs are
+// served through the API.
+type LocalBlobStore struct {
+	dir string
+}
+
+// NewLocalBlobStore creates a blob store in a directory, which is created on
+// the first Put
+func NewLocalBlobStore(dir string) *LocalBlobStore {
+	return &LocalBlobStore{dir: dir}
+}
+
+// file returns the path of the file of a key
+func (ls *LocalBlobStore) file(key string) (string, error) {
+	if !validBlobKey(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(ls.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the blob to a temporary file first and renames it into place,
+// so readers never see a partial blob
+func (ls *LocalBlobStore) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	name, err := ls.file(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Get opens the file of a blob
+func (ls *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	name, err := ls.file(key)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, BlobInfo{}, errBlobNotFound
+	}
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, BlobInfo{}, err
+	}
+	return file, BlobInfo{ContentType: blobContentType(key), Size: stat.Size()}, nil
+}
+
+// Delete removes the file of a blob
+func (ls *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	name, err := ls.file(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// PresignGet returns "": files on disk are only reachable through the API
+func (ls *LocalBlobStore) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// command is a subcommand of the binary
+type command struct {
+	summary string
+	run     func(args []string) error
+}
+
+// commands lists the subcommands; running without one starts the server
+var commands = map[string]command{
+	"serve":          {"Start the API server (default); see serve -h for config flags", serveCommand},
+	"migrate":        {"Run database migrations", migrateCommand},
+	"seed":           {"Load the seed files into the database, or generate test data: -films N -users N", seedCommand},
+	"create-user":    {"Create a user: -username NAME [-password PASS] [-role user|admin]", createUserCommand},
+	"reset-password": {"Set a user's password: -username NAME [-password PASS]", resetPasswordCommand},
+	"purge-tokens":   {"Sign every user out of a running server: -username NAME [-base-url URL] [-password PASS]", purgeTokensCommand},
+	"smoke":          {"Verify a live deployment: -base-url URL -username NAME [-password PASS]", smokeCommand},
+}
+
+// commandOrder is the order commands are listed in the usage text
+var commandOrder = []string{"serve", "migrate", "seed", "create-user", "reset-password", "purge-tokens", "smoke"}
+
+// printUsage lists the available subcommands
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: film-api <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, name := range commandOrder {
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", name, commands[name].summary)
+	}
+}
+
+// RunCommand dispatches to a subcommand of the film-api binary and returns the
+// process exit code; running without one starts the server
+func RunCommand(args []string) int {
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage()
+		return 0
+	}
+
+	cmd, exists := commands[args[0]]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		printUsage()
+		return 2
+	}
+	if err := cmd.run(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "❌ %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// serveCommand loads the configuration from flags, env, and the config file, then starts the server
+func serveCommand(args []string) error {
+	cfg, err := LoadConfig("serve", args)
+	if err != nil {
+		return err
+	}
+	serve(cfg, args)
+	return nil
+}
+
+// openServer connects to the database and creates the services commands use,
+// without starting anything in the background. Commands other than serve
+// take their settings from the config file and env.
+func openServer() (*Server, error) {
+	cfg, err := LoadConfig("config", nil)
+	if err != nil {
+		return nil, err
+	}
+	db, err := ConnectDatabase(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	return NewServer(cfg, db), nil
+}
+
+// readPassword reads a password from stdin when it wasn't given as a flag
+func readPassword(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read password: %v", err)
+	}
+	password = strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("password must not be empty")
+	}
+	return password, nil
+}
+
+func migrateCommand(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	srv, err := openServer()
+	if err != nil {
+		return err
+	}
+	if err := MigrateDatabase(srv.db); err != nil {
+		return err
+	}
+	fmt.Println("✅ Migrations applied")
+	return nil
+}
+
+func seedCommand(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	films := flags.Int("films", 0, "generate this many synthetic films instead of loading the seed files")
+	users := flags.Int("users", 0, "generate this many synthetic users instead of loading the seed files")
+	seed := flags.Uint64("faker-seed", 0, "seed of the synthetic data, the same seed generates the same data (0 is random)")
+	batchSize := flags.Int("batch-size", defaultSyntheticBatchSize, "rows per insert of synthetic data")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	srv, err := openServer()
+	if err != nil {
+		return err
+	}
+	if *films == 0 && *users == 0 {
+		return SeedDatabase(srv.db, srv.cfg.Storage.SeedsDir)
+	}
+
+	insertedFilms, insertedUsers, err := GenerateSyntheticData(srv.db, SyntheticOptions{Films: *films, Users: *users, Seed: *seed, BatchSize: *batchSize})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Generated %d films and %d users\n", insertedFilms, insertedUsers)
+	return nil
+}
+
+func createUserCommand(args []string) error {
+	flags := flag.NewFlagSet("create-user", flag.ContinueOnError)
+	username := flags.String("username", "", "username of the new user")
+	password := flags.String("password", "", "password, read from stdin when omitted")
+	role := flags.String("role", "user", "role of the new user (user or admin)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return fmt.Errorf("-username is required")
+	}
+	if *role != "user" && *role != "admin" {
+		return fmt.Errorf("-role must be user or admin")
+	}
+
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+	srv, err := openServer()
+	if err != nil {
+		return err
+	}
+	if _, err := srv.users.GetUserByUsername(*username); err == nil {
+		return fmt.Errorf("user %s already exists", *username)
+	}
+
+	user, err := srv.users.CreateUser(*username, pass)
+	if err != nil {
+		return err
+	}
+	if *role != user.Role {
+		if err := srv.users.SetRole(*username, *role); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("✅ Created %s %s (id %d)\n", *role, user.Username, user.ID)
+	return nil
+}
+
+func resetPasswordCommand(args []string) error {
+	flags := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	username := flags.String("username", "", "user whose password is reset")
+	password := flags.String("password", "", "new password, read from stdin when omitted")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return fmt.Errorf("-username is required")
+	}
+
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+	srv, err := openServer()
+	if err != nil {
+		return err
+	}
+	if err := srv.users.SetPassword(*username, pass); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Password of %s reset\n", *username)
+	return nil
+}
+
+// purgeTokensCommand signs every user out of a running server. Tokens live
+// in the memory of the server process, so the command asks the server to
+// revoke them, logged in as an admin of the default organization.
+func purgeTokensCommand(args []string) error {
+	flags := flag.NewFlagSet("purge-tokens", flag.ContinueOnError)
+	baseURL := flags.String("base-url", "http://localhost:8080", "Base URL of the server")
+	username := flags.String("username", "", "Admin of the default organization to log in as")
+	password := flags.String("password", "", "Password of the admin, read from stdin when omitted")
+	timeout := flags.Duration("timeout", 10*time.Second, "Timeout of each request")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return fmt.Errorf("-username is required")
+	}
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	client := &smokeClient{
+		baseURL: strings.TrimRight(*baseURL, "/"),
+		client:  &http.Client{Timeout: *timeout},
+	}
+	resp, err := client.do("POST", "/api/login", LoginRequest{
+		Username: *username,
+		Password: pass,
+		Scopes:   []string{scopeUsersAdmin, scopeDeploymentAdmin},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	var login LoginResponse
+	if err := resp.expect(http.StatusOK, &login); err != nil {
+		return fmt.Errorf("login failed: %v", err)
+	}
+
+	client.token = login.Token
+	resp, err = client.do("POST", "/api/admin/tokens/purge", nil, nil)
+	if err != nil {
+		return err
+	}
+	var result TokenPurgeResult
+	if err := resp.expect(http.StatusOK, &result); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Revoked %d login tokens\n", result.Revoked)
+	return nil
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// filmListKey identifies a film listing of GET /api/films: the organization
+// and the query string with its parameters sorted, so ?page=1&page_size=2
+// and ?page_size=2&page=1 share a read
+func filmListKey(r *http.Request) string {
+	return strconv.FormatUint(uint64(currentTenant(r).OrganizationID), 10) + "?" + r.URL.Query().Encode()
+}
+
+// shareRead runs read once for concurrent calls with the same key and hands
+// every caller its result, so a burst of identical requests, like clients
+// refreshing at once after a change, costs the database one query. Calls
+// arriving after the read finished run it again; nothing is cached. Results
+// are shared, so read must return them ready to encode and callers must not
+// change them.
+func shareRead[T any](group *singleflight.Group, key string, read func() (T, error)) (T, error) {
+	value, err, _ := group.Do(key, func() (interface{}, error) {
+		return read()
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return value.(T), nil
+}
+
+// filmPageRead is a page of films as shareRead hands it out
+type filmPageRead struct {
+	films []Film
+	total int64
+	next  *FilmCursor
+}
@@ -0,0 +1,425 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// Collection validation limits
+const (
+	maxCollectionNameLength        = 200
+	maxCollectionDescriptionLength = 1000
+	maxCollectionFilms             = 100
+)
+
+// filmIncludes are the related resources ?include= can embed in film responses
+var filmIncludes = []string{"collection", "views"}
+
+// CollectionService handles collection-related database operations
+type CollectionService struct {
+	db          *gorm.DB
+	tenant      Tenant
+	collections func(*gorm.DB) *gorm.DB
+	films       func(*gorm.DB) *gorm.DB
+}
+
+// NewCollectionService creates a new collection service for the collections
+// and films of every organization
+func NewCollectionService(db *gorm.DB) *CollectionService {
+	return &CollectionService{db: db, collections: anyTenant, films: anyTenant}
+}
+
+// ForTenant returns a collection service that only sees and creates the
+// collections of one organization and only puts and shows its films in them
+func (cs *CollectionService) ForTenant(tenant Tenant) *CollectionService {
+	scope := tenantScope(tenant.OrganizationID)
+	return &CollectionService{db: cs.db, tenant: tenant, collections: scope, films: scope}
+}
+
+// CollectionConflictError reports a film that already belongs to another collection
+type CollectionConflictError struct {
+	FilmID     uint
+	Collection string
+}
+
+func (e *CollectionConflictError) Error() string {
+	return fmt.Sprintf("Film %d is already in collection %s", e.FilmID, e.Collection)
+}
+
+func (e *CollectionConflictError) ErrorCode() (string, Params) {
+	return "collection_film_conflict", Params{"id": e.FilmID, "name": e.Collection}
+}
+
+// collectionMember is a film and the collection it was loaded for
+type collectionMember struct {
+	Film
+	CollectionID uint
+}
+
+// ValidateCollectionRequest trims a collection payload in place and checks it.
+// It returns nil when the collection is valid.
+func ValidateCollectionRequest(collectionReq *CollectionRequest) *ValidationError {
+	collectionReq.Name = strings.TrimSpace(collectionReq.Name)
+	collectionReq.Description = strings.TrimSpace(collectionReq.Description)
+
+	var fields []FieldError
+	if collectionReq.Name == "" {
+		fields = append(fields, FieldError{Field: "name", Message: "is required", Code: "field_required"})
+	} else if utf8.RuneCountInString(collectionReq.Name) > maxCollectionNameLength {
+		fields = append(fields, FieldError{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxCollectionNameLength), Code: "field_too_long", Params: Params{"max": maxCollectionNameLength}})
+	}
+
+	if utf8.RuneCountInString(collectionReq.Description) > maxCollectionDescriptionLength {
+		fields = append(fields, FieldError{Field: "description", Message: fmt.Sprintf("must be at most %d characters", maxCollectionDescriptionLength), Code: "field_too_long", Params: Params{"max": maxCollectionDescriptionLength}})
+	}
+
+	if len(collectionReq.FilmIDs) > maxCollectionFilms {
+		fields = append(fields, FieldError{Field: "film_ids", Message: fmt.Sprintf("must have at most %d items", maxCollectionFilms), Code: "field_too_many_items", Params: Params{"max": maxCollectionFilms}})
+	} else {
+		seen := make(map[uint]bool)
+		for _, id := range collectionReq.FilmIDs {
+			if seen[id] {
+				fields = append(fields, FieldError{Field: "film_ids", Message: fmt.Sprintf("must not repeat film %d", id), Code: "field_repeated_film", Params: Params{"id": id}})
+				break
+			}
+			seen[id] = true
+		}
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// GetCollections retrieves all collections with their films
+func (cs *CollectionService) GetCollections() ([]Collection, error) {
+	var collections []Collection
+	if err := cs.db.Scopes(cs.collections).Order("id").Find(&collections).Error; err != nil {
+		return nil, err
+	}
+	if err := cs.loadFilms(collections); err != nil {
+		return nil, err
+	}
+	return collections, nil
+}
+
+// GetCollectionByID retrieves a collection with its films
+func (cs *CollectionService) GetCollectionByID(id uint) (*Collection, error) {
+	var collection Collection
+	if err := cs.db.Scopes(cs.collections).First(&collection, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("collection not found")
+		}
+		return nil, err
+	}
+	collections := []Collection{collection}
+	if err := cs.loadFilms(collections); err != nil {
+		return nil, err
+	}
+	return &collections[0], nil
+}
+
+// loadFilms fills in the films of collections, in collection order. Deleted
+// films are left out.
+func (cs *CollectionService) loadFilms(collections []Collection) error {
+	if len(collections) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(collections))
+	byID := make(map[uint]*Collection, len(collections))
+	for i := range collections {
+		ids[i] = collections[i].ID
+		byID[collections[i].ID] = &collections[i]
+		collections[i].Films = []Film{}
+	}
+
+	var members []collectionMember
+	err := cs.db.Model(&Film{}).Scopes(cs.films).
+		Select("films.*, collection_films.collection_id").
+		Joins("JOIN collection_films ON collection_films.film_id = films.id").
+		Where("collection_films.collection_id IN ?", ids).
+		Order("collection_films.collection_id, collection_films.position").
+		Find(&members).Error
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if collection := byID[member.CollectionID]; collection != nil {
+			collection.Films = append(collection.Films, *withLinks(&member.Film))
+		}
+	}
+	return nil
+}
+
+// SaveCollection creates a collection (id 0) or updates an existing one. The
+// films of the request replace those of the collection, in the given order.
+func (cs *CollectionService) SaveCollection(id uint, collectionReq CollectionRequest) (*Collection, error) {
+	var collection Collection
+	err := cs.db.Transaction(func(tx *gorm.DB) error {
+		if id != 0 {
+			if err := tx.Scopes(cs.collections).First(&collection, id).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errors.New("collection not found")
+				}
+				return err
+			}
+		}
+
+		var taken int64
+		err := tx.Model(&Collection{}).Scopes(cs.collections).Where("lower(name) = lower(?) AND id <> ?", collectionReq.Name, id).Count(&taken).Error
+		if err != nil {
+			return err
+		}
+		if taken > 0 {
+			return errors.New("collection name taken")
+		}
+
+		if len(collectionReq.FilmIDs) > 0 {
+			var found []uint
+			if err := tx.Model(&Film{}).Scopes(cs.films).Where("id IN ?", collectionReq.FilmIDs).Pluck("id", &found).Error; err != nil {
+				return err
+			}
+			exists := make(map[uint]bool, len(found))
+			for _, filmID := range found {
+				exists[filmID] = true
+			}
+			for _, filmID := range collectionReq.FilmIDs {
+				if !exists[filmID] {
+					return &ValidationError{Fields: []FieldError{{Field: "film_ids", Message: fmt.Sprintf("film %d does not exist", filmID), Code: "field_film_missing", Params: Params{"id": filmID}}}}
+				}
+			}
+
+			var conflict struct {
+				FilmID uint
+				Name   string
+			}
+			err := tx.Table("collection_films").
+				Select("collection_films.film_id, collections.name").
+				Joins("JOIN collections ON collections.id = collection_films.collection_id").
+				Where("collection_films.film_id IN ? AND collection_films.collection_id <> ?", collectionReq.FilmIDs, id).
+				Limit(1).
+				Scan(&conflict).Error
+			if err != nil {
+				return err
+			}
+			if conflict.FilmID != 0 {
+				return &CollectionConflictError{FilmID: conflict.FilmID, Collection: conflict.Name}
+			}
+		}
+
+		if id == 0 {
+			collection.OrganizationID = cs.tenant.OrganizationID
+		}
+		collection.Name = collectionReq.Name
+		collection.Description = collectionReq.Description
+		if err := tx.Save(&collection).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("collection_id = ?", collection.ID).Delete(&CollectionFilm{}).Error; err != nil {
+			return err
+		}
+		if len(collectionReq.FilmIDs) == 0 {
+			return nil
+		}
+		members := make([]CollectionFilm, len(collectionReq.FilmIDs))
+		for i, filmID := range collectionReq.FilmIDs {
+			members[i] = CollectionFilm{CollectionID: collection.ID, FilmID: filmID, Position: i + 1}
+		}
+		return tx.Create(&members).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	collections := []Collection{collection}
+	if err := cs.loadFilms(collections); err != nil {
+		return nil, err
+	}
+	return &collections[0], nil
+}
+
+// DeleteCollection removes a collection. Its films stay in the catalog.
+func (cs *CollectionService) DeleteCollection(id uint) error {
+	return cs.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Scopes(cs.collections).Delete(&Collection{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("collection not found")
+		}
+		return tx.Where("collection_id = ?", id).Delete(&CollectionFilm{}).Error
+	})
+}
+
+// AttachCollections fills in the collection of each film that belongs to one
+func (cs *CollectionService) AttachCollections(films []Film) error {
+	if len(films) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(films))
+	for i, film := range films {
+		ids[i] = film.ID
+	}
+
+	var memberships []struct {
+		FilmID   uint
+		ID       uint
+		Name     string
+		Position int
+	}
+	err := cs.db.Table("collection_films").
+		Select("collection_films.film_id, collections.id, collections.name, collection_films.position").
+		Joins("JOIN collections ON collections.id = collection_films.collection_id").
+		Where("collection_films.film_id IN ?", ids).
+		Scan(&memberships).Error
+	if err != nil {
+		return err
+	}
+
+	byFilm := make(map[uint]*FilmCollection, len(memberships))
+	for _, membership := range memberships {
+		byFilm[membership.FilmID] = &FilmCollection{ID: membership.ID, Name: membership.Name, Position: membership.Position}
+	}
+	for i := range films {
+		films[i].Collection = byFilm[films[i].ID]
+	}
+	return nil
+}
+
+// parseFilmIncludes reads the comma-separated ?include= list of a film request
+func parseFilmIncludes(r *http.Request) (map[string]bool, error) {
+	includes := make(map[string]bool)
+	value := r.URL.Query().Get("include")
+	if value == "" {
+		return includes, nil
+	}
+	for _, include := range strings.Split(value, ",") {
+		include = strings.TrimSpace(include)
+		if !containsFold(filmIncludes, include) {
+			return nil, &CodedError{Code: "include_invalid", Params: Params{"values": strings.Join(filmIncludes, ", ")}, Message: "include must be one of " + strings.Join(filmIncludes, ", ")}
+		}
+		includes[strings.ToLower(include)] = true
+	}
+	return includes, nil
+}
+
+// includeFilmRelations embeds the requested related resources into films
+func (s *Server) includeFilmRelations(includes map[string]bool, films []Film) error {
+	if includes["collection"] {
+		if err := s.collectionService.AttachCollections(films); err != nil {
+			return err
+		}
+	}
+	if includes["views"] {
+		return s.viewCounter.AttachViews(films)
+	}
+	return nil
+}
+
+// collectionsHandler routes /api/collections endpoints
+func (s *Server) collectionsHandler(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	if path == "/api/collections" {
+		switch r.Method {
+		case "GET":
+			collections, err := s.tenantCollections(r).GetCollections()
+			if err != nil {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve collections", Code: "collections_retrieve_failed"})
+				return
+			}
+			if collections == nil {
+				collections = []Collection{}
+			}
+			writeResponse(w, r, http.StatusOK, collections)
+		case "POST":
+			s.saveCollectionHandler(w, r, 0)
+		default:
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(path, "/api/collections/"))
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid collection ID", Code: "invalid_collection_id"})
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		collection, err := s.tenantCollections(r).GetCollectionByID(uint(id))
+		if err != nil {
+			if err.Error() == "collection not found" {
+				writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Collection not found", Code: "collection_not_found"})
+			} else {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve collection", Code: "collection_retrieve_failed"})
+			}
+			return
+		}
+		writeResponse(w, r, http.StatusOK, collection)
+	case "PUT":
+		s.saveCollectionHandler(w, r, uint(id))
+	case "DELETE":
+		if err := s.tenantCollections(r).DeleteCollection(uint(id)); err != nil {
+			if err.Error() == "collection not found" {
+				writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Collection not found", Code: "collection_not_found"})
+			} else {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete collection", Code: "collection_delete_failed"})
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+	}
+}
+
+// saveCollectionHandler creates a collection (id 0) or updates an existing one
+func (s *Server) saveCollectionHandler(w http.ResponseWriter, r *http.Request, id uint) {
+	var collectionReq CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&collectionReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+
+	if validationErr := ValidateCollectionRequest(&collectionReq); validationErr != nil {
+		writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: validationErr.Fields})
+		return
+	}
+
+	collection, err := s.tenantCollections(r).SaveCollection(id, collectionReq)
+	if err != nil {
+		var validationErr *ValidationError
+		var conflictErr *CollectionConflictError
+		switch {
+		case errors.As(err, &validationErr):
+			writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: validationErr.Fields})
+		case errors.As(err, &conflictErr):
+			writeResponse(w, r, http.StatusConflict, errorResponse(conflictErr))
+		case err.Error() == "collection not found":
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Collection not found", Code: "collection_not_found"})
+		case err.Error() == "collection name taken":
+			writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "Collection name already in use", Code: "collection_name_in_use"})
+		default:
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save collection", Code: "collection_save_failed"})
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if id == 0 {
+		status = http.StatusCreated
+	}
+	writeResponse(w, r, status, collection)
+}
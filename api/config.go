@@ -0,0 +1,1018 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	// Time zone names validate even on hosts without a zoneinfo database
+	_ "time/tzdata"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm/logger"
+)
+
+// defaultConfigFile is read when present; CONFIG_FILE or -config point elsewhere
+const defaultConfigFile = "config.yaml"
+
+// Config holds the server configuration. Values are layered with clear
+// precedence: command-line flags override environment variables (including
+// .env), which override the config file, which overrides the defaults.
+type Config struct {
+	Database DatabaseConfig `yaml:"database"`
+	Storage  StorageConfig  `yaml:"storage"`
+	Blobs    BlobsConfig    `yaml:"blobs"`
+	Server   ServerConfig   `yaml:"server"`
+	Auth     AuthConfig     `yaml:"auth"`
+	CORS     CORSConfig     `yaml:"cors"`
+	Proxy    ProxyConfig    `yaml:"proxy"`
+	Logging  LoggingConfig  `yaml:"logging"`
+	Alerts   AlertsConfig   `yaml:"alerts"`
+	Search   SearchConfig   `yaml:"search"`
+	Lending  LendingConfig  `yaml:"lending"`
+	Quota    QuotaConfig    `yaml:"quota"`
+	Media    MediaConfig    `yaml:"media"`
+	Mail     MailConfig     `yaml:"mail"`
+	Jobs     JobsConfig     `yaml:"jobs"`
+}
+
+// StorageConfig selects where films and users are kept
+type StorageConfig struct {
+	// Backend is postgres, or memory to keep films and users in memory and
+	// run without a database; everything else then answers 500
+	Backend string `yaml:"backend"`
+	// SeedsDir holds the seed files read when seeding and on an admin reset
+	SeedsDir string `yaml:"seeds_dir"`
+}
+
+// BlobsConfig selects where uploaded files, like film posters, are kept
+type BlobsConfig struct {
+	// Backend is local to keep files in Dir, or s3 for a bucket of S3 or an
+	// S3-compatible service like MinIO
+	Backend string   `yaml:"backend"`
+	Dir     string   `yaml:"dir"`
+	S3      S3Config `yaml:"s3"`
+	// PresignTTL is how long the download URLs handed out for S3 work
+	PresignTTL time.Duration `yaml:"presign_ttl"`
+}
+
+// S3Config holds the bucket of the s3 blob backend and its credentials
+type S3Config struct {
+	// Endpoint defaults to the AWS endpoint of Region, e.g.
+	// https://s3.eu-west-1.amazonaws.com; set it for MinIO and the like
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	// PathStyle addresses the bucket as endpoint/bucket instead of
+	// bucket.endpoint, as MinIO needs
+	PathStyle bool `yaml:"path_style"`
+}
+
+// schemaName limits database schemas to plain identifiers, as the name
+// goes into the connection string unquoted
+var schemaName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Storage backends
+const (
+	storagePostgres = "postgres"
+	storageMemory   = "memory"
+)
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Port             string `yaml:"port"`
+	ReadOnly         bool   `yaml:"read_only"`
+	ValidateRequests bool   `yaml:"validate_requests"`
+	Warmup           bool   `yaml:"warmup"`
+	// H2C also serves HTTP/2 without TLS, for clients behind a trusted proxy
+	H2C bool `yaml:"h2c"`
+	// MethodOverride serves POST requests as the method in X-HTTP-Method-Override
+	MethodOverride bool `yaml:"method_override"`
+	// PutCreatesFilms makes PUT /api/films/{id} create missing films, as if
+	// every request sent Prefer: create-if-missing
+	PutCreatesFilms bool `yaml:"put_creates_films"`
+	// AllowReset enables POST /api/admin/reset, which deletes every film
+	AllowReset bool `yaml:"allow_reset"`
+	// DemoMode answers every write but signing in and out with 403, for
+	// public demo instances
+	DemoMode bool `yaml:"demo_mode"`
+	// Maintenance starts the server rejecting mutations with 503 and
+	// MaintenanceMessage, asking clients to retry after MaintenanceRetryAfter
+	Maintenance           bool          `yaml:"maintenance"`
+	MaintenanceMessage    string        `yaml:"maintenance_message"`
+	MaintenanceRetryAfter time.Duration `yaml:"maintenance_retry_after"`
+	// ExportDir is where catalog exports are written
+	ExportDir string `yaml:"export_dir"`
+	// AssetsDir serves index.html and swagger.yaml from a directory instead
+	// of the copies built into the binary, to see edits without rebuilding
+	AssetsDir string `yaml:"assets_dir"`
+	// SwaggerUIURL is the swagger-ui-dist copy the Swagger UI loads from
+	SwaggerUIURL string `yaml:"swagger_ui_url"`
+}
+
+// AuthConfig holds login token settings
+type AuthConfig struct {
+	TokenTTL time.Duration `yaml:"token_ttl"`
+	// SlidingExpiration extends a token by TokenTTL whenever it is used,
+	// up to MaxTokenLifetime after login
+	SlidingExpiration bool             `yaml:"sliding_expiration"`
+	MaxTokenLifetime  time.Duration    `yaml:"max_token_lifetime"`
+	LoginGuard        LoginGuardConfig `yaml:"login_guard"`
+}
+
+// LoginGuardConfig slows down and bans clients guessing passwords
+type LoginGuardConfig struct {
+	// DelayAfter is how many failed logins for a username from an IP are
+	// answered at once; the next attempt waits a second, and each further
+	// one twice as long as the last, up to MaxDelay
+	DelayAfter int           `yaml:"delay_after"`
+	MaxDelay   time.Duration `yaml:"max_delay"`
+	// BanAfter failed logins from an IP within Window, whatever the
+	// usernames, ban it for BanDuration; 0 never bans
+	BanAfter    int           `yaml:"ban_after"`
+	Window      time.Duration `yaml:"window"`
+	BanDuration time.Duration `yaml:"ban_duration"`
+	// Allowlist holds IPs and CIDR ranges that are never delayed or banned
+	Allowlist []string `yaml:"allowlist"`
+}
+
+// CORSConfig holds cross-origin settings
+type CORSConfig struct {
+	AllowedOrigins []string      `yaml:"allowed_origins"`
+	AllowedHeaders []string      `yaml:"allowed_headers"`
+	MaxAge         time.Duration `yaml:"max_age"` // how long browsers may cache a preflight
+}
+
+// ProxyConfig holds the reverse proxies the server runs behind
+type ProxyConfig struct {
+	// Trusted holds the IPs and CIDR ranges of proxies whose X-Forwarded-For
+	// header names the client; other requests count as coming from their own
+	// address, whatever they send
+	Trusted []string `yaml:"trusted"`
+}
+
+// SearchConfig holds fuzzy search settings
+type SearchConfig struct {
+	SimilarityThreshold float64 `yaml:"similarity_threshold"`
+}
+
+// LendingConfig holds the rules for borrowing physical copies
+type LendingConfig struct {
+	LoanPeriod time.Duration `yaml:"loan_period"`
+	MaxLoans   int           `yaml:"max_loans"`
+}
+
+// QuotaConfig holds the catalog limits and the limits of users without the
+// admin role
+type QuotaConfig struct {
+	// DailyFilms is how many films a user may create a UTC day, 0 for no limit
+	DailyFilms int64 `yaml:"daily_films"`
+	// Plan is the hosting plan of organizations without one of their own
+	Plan string `yaml:"plan"`
+	// CatalogMaxFilms, when set, overrides the film limit of Plan for them
+	CatalogMaxFilms *int64 `yaml:"catalog_max_films"`
+	// DumpRequests is how many requests each client may send per DumpWindow
+	// to every route dumping whole datasets, like exports and the film stream
+	DumpRequests int           `yaml:"dump_requests"`
+	DumpWindow   time.Duration `yaml:"dump_window"`
+}
+
+// MediaConfig holds the hosts film links may point to
+type MediaConfig struct {
+	// TrailerHosts are the hosts trailers may be embedded from
+	TrailerHosts []string `yaml:"trailer_hosts"`
+	// LinkHosts are the hosts external links may point to, empty for any host
+	LinkHosts []string `yaml:"link_hosts"`
+}
+
+// JobsConfig holds scheduled job settings
+type JobsConfig struct {
+	// Schedules replace the stored cron expressions of jobs, by job name,
+	// when the server starts
+	Schedules map[string]string `yaml:"schedules"`
+	// TrashRetention is how long deleted films are kept before trash-purge
+	// removes them for good, 0 keeps them forever
+	TrashRetention time.Duration `yaml:"trash_retention"`
+	// AccountRetention is how long deleted accounts are kept, anonymized,
+	// before account-purge removes them for good, 0 keeps them forever
+	AccountRetention time.Duration `yaml:"account_retention"`
+	// UsageRetention is how long hourly API usage is kept before
+	// api-usage-purge removes it, 0 keeps it forever
+	UsageRetention time.Duration `yaml:"usage_retention"`
+}
+
+// MailConfig holds outgoing email settings. Without an SMTP host emails are
+// logged instead of sent.
+type MailConfig struct {
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     string `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+	From         string `yaml:"from"`
+}
+
+// LoggingConfig holds logging settings
+type LoggingConfig struct {
+	Level string `yaml:"level"`
+	// SlowQueryThreshold logs slower queries as warnings, 0 turns it off
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold"`
+	// AccessLog logs a line per request, LogBodies adds headers and bodies
+	// for debugging
+	AccessLog bool `yaml:"access_log"`
+	LogBodies bool `yaml:"log_bodies"`
+	// RedactFields are masked in JSON bodies and query strings wherever a
+	// name contains one of them, RedactHeaders are masked in headers
+	RedactFields  []string `yaml:"redact_fields"`
+	RedactHeaders []string `yaml:"redact_headers"`
+}
+
+// AlertsConfig holds admin alerting and error-rate anomaly detection settings
+type AlertsConfig struct {
+	WebhookURL      string             `yaml:"webhook_url"`
+	Window          time.Duration      `yaml:"window"`
+	BaselineWindows int                `yaml:"baseline_windows"`
+	MinRequests     int64              `yaml:"min_requests"`
+	SpikeFactor     float64            `yaml:"spike_factor"`
+	Cooldown        time.Duration      `yaml:"cooldown"`
+	Groups          []AlertGroupConfig `yaml:"groups"`
+}
+
+// AlertGroupConfig holds the error-rate thresholds of the routes under a path prefix
+type AlertGroupConfig struct {
+	Name                string  `yaml:"name"`
+	Prefix              string  `yaml:"prefix"`
+	MaxServerErrorRate  float64 `yaml:"max_5xx_rate"`
+	MaxUnauthorizedRate float64 `yaml:"max_401_rate"`
+}
+
+// liveConfig holds the configuration a server runs with. It is swapped as a
+// whole when the configuration is reloaded, so readers always see a
+// consistent Config.
+type liveConfig struct {
+	current atomic.Pointer[Config]
+}
+
+// newLiveConfig holds cfg, or the defaults for nil
+func newLiveConfig(cfg *Config) *liveConfig {
+	lc := &liveConfig{}
+	lc.Store(cfg)
+	return lc
+}
+
+// Load returns the configuration in use, or the defaults before one is stored
+func (lc *liveConfig) Load() *Config {
+	if lc != nil {
+		if cfg := lc.current.Load(); cfg != nil {
+			return cfg
+		}
+	}
+	return DefaultConfig()
+}
+
+// Store replaces the configuration in use
+func (lc *liveConfig) Store(cfg *Config) {
+	lc.current.Store(cfg)
+}
+
+// DefaultConfig returns the built-in configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Database: DatabaseConfig{
+			Host:         "localhost",
+			Port:         "5432",
+			User:         "postgres",
+			Password:     "passsword",
+			DBName:       "postgres",
+			SSLMode:      "disable",
+			TimeZone:     "UTC",
+			MaxOpenConns: 25,
+			MaxIdleConns: 5,
+		},
+		Storage: StorageConfig{Backend: storagePostgres, SeedsDir: "seeds"},
+		Blobs:   BlobsConfig{Backend: blobsLocal, Dir: "blobs", PresignTTL: 15 * time.Minute},
+		Server: ServerConfig{
+			Port:                  "8080",
+			Warmup:                true,
+			MaintenanceRetryAfter: 5 * time.Minute,
+			ExportDir:             "exports",
+			SwaggerUIURL:          "https://unpkg.com/swagger-ui-dist@3.25.0",
+		},
+		Auth: AuthConfig{
+			TokenTTL:         24 * time.Hour,
+			MaxTokenLifetime: 7 * 24 * time.Hour,
+			LoginGuard:       LoginGuardConfig{DelayAfter: 3, MaxDelay: 16 * time.Second, BanAfter: 20, Window: 15 * time.Minute, BanDuration: 15 * time.Minute},
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "Idempotency-Key", "If-Match", "API-Version", "X-Request-ID"},
+			MaxAge:         10 * time.Minute,
+		},
+		Logging: LoggingConfig{
+			Level:              "info",
+			SlowQueryThreshold: 200 * time.Millisecond,
+			RedactFields:       []string{"password", "token", "secret"},
+			RedactHeaders:      []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"},
+		},
+		Alerts: AlertsConfig{
+			Window:          time.Minute,
+			BaselineWindows: 60,
+			MinRequests:     20,
+			SpikeFactor:     3,
+			Cooldown:        15 * time.Minute,
+			Groups: []AlertGroupConfig{
+				{Name: "auth", Prefix: "/api/login", MaxServerErrorRate: 0.05, MaxUnauthorizedRate: 0.5},
+				{Name: "admin", Prefix: "/api/admin", MaxServerErrorRate: 0.05, MaxUnauthorizedRate: 0.2},
+				{Name: "api", Prefix: "/api/", MaxServerErrorRate: 0.05, MaxUnauthorizedRate: 0.2},
+			},
+		},
+		Search:  SearchConfig{SimilarityThreshold: 0.3},
+		Lending: LendingConfig{LoanPeriod: 14 * 24 * time.Hour, MaxLoans: 5},
+		Quota:   QuotaConfig{Plan: "enterprise", DumpRequests: 10, DumpWindow: time.Hour},
+		Mail:    MailConfig{SMTPPort: "587", From: "films@localhost"},
+		Jobs:    JobsConfig{TrashRetention: 90 * 24 * time.Hour, AccountRetention: 30 * 24 * time.Hour, UsageRetention: 90 * 24 * time.Hour},
+		Media: MediaConfig{
+			TrailerHosts: []string{"www.youtube.com", "youtube.com", "www.youtube-nocookie.com", "youtu.be", "vimeo.com", "player.vimeo.com"},
+		},
+	}
+}
+
+// LoadConfig builds the configuration from the defaults, the config file, the
+// environment, and the given command-line flags. It returns flag.ErrHelp when
+// -h is passed.
+func LoadConfig(name string, args []string) (*Config, error) {
+	cfg := DefaultConfig()
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := flags.String("config", "", "Config file (YAML); defaults to CONFIG_FILE or ./config.yaml")
+	dbHost := flags.String("db-host", "", "Database host")
+	dbPort := flags.String("db-port", "", "Database port")
+	dbUser := flags.String("db-user", "", "Database user")
+	dbPassword := flags.String("db-password", "", "Database password")
+	dbName := flags.String("db-name", "", "Database name")
+	dbSSLMode := flags.String("db-sslmode", "", "Database SSL mode")
+	storage := flags.String("storage", "", "Storage backend: postgres, or memory to run without a database")
+	port := flags.String("port", "", "HTTP port to listen on")
+	readOnly := flags.Bool("read-only", false, "Start in read-only mode, rejecting mutations with 503")
+	validateRequests := flags.Bool("validate-requests", false, "Reject requests that don't match the OpenAPI spec with 400")
+	tokenTTL := flags.Duration("token-ttl", 0, "Login token lifetime (e.g. 24h)")
+	corsOrigins := flags.String("cors-origins", "", "Comma-separated allowed CORS origins (* = any)")
+	logLevel := flags.String("log-level", "", "Log level: silent, error, warn, or info")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// Config file
+	path, required := *configFile, true
+	if path == "" {
+		path = getEnv("CONFIG_FILE", "")
+	}
+	if path == "" {
+		path, required = defaultConfigFile, false
+	}
+	if err := cfg.loadFile(path, required); err != nil {
+		return nil, err
+	}
+
+	// Environment
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	// Flags, only those given explicitly
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "db-host":
+			cfg.Database.Host = *dbHost
+		case "db-port":
+			cfg.Database.Port = *dbPort
+		case "db-user":
+			cfg.Database.User = *dbUser
+		case "db-password":
+			cfg.Database.Password = *dbPassword
+		case "db-name":
+			cfg.Database.DBName = *dbName
+		case "db-sslmode":
+			cfg.Database.SSLMode = *dbSSLMode
+		case "storage":
+			cfg.Storage.Backend = *storage
+		case "port":
+			cfg.Server.Port = *port
+		case "read-only":
+			cfg.Server.ReadOnly = *readOnly
+		case "validate-requests":
+			cfg.Server.ValidateRequests = *validateRequests
+		case "token-ttl":
+			cfg.Auth.TokenTTL = *tokenTTL
+		case "cors-origins":
+			cfg.CORS.AllowedOrigins = splitList(*corsOrigins)
+		case "log-level":
+			cfg.Logging.Level = *logLevel
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile overlays settings from a YAML config file
+func (c *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !required && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// loadEnv overlays settings from environment variables that are set
+func (c *Config) loadEnv() error {
+	c.Database.Host = getEnv("DB_HOST", c.Database.Host)
+	c.Database.Port = getEnv("DB_PORT", c.Database.Port)
+	c.Database.User = getEnv("DB_USER", c.Database.User)
+	c.Database.Password = getEnv("DB_PASSWORD", c.Database.Password)
+	c.Database.DBName = getEnv("DB_NAME", c.Database.DBName)
+	c.Database.SSLMode = getEnv("DB_SSLMODE", c.Database.SSLMode)
+	c.Database.TimeZone = getEnv("DB_TIMEZONE", c.Database.TimeZone)
+	c.Database.Schema = getEnv("DB_SCHEMA", c.Database.Schema)
+	c.Database.MaxOpenConns = getEnvInt("DB_MAX_OPEN_CONNS", c.Database.MaxOpenConns)
+	c.Database.MaxIdleConns = getEnvInt("DB_MAX_IDLE_CONNS", c.Database.MaxIdleConns)
+	if value := getEnv("DB_PREPARE_STATEMENTS", ""); value != "" {
+		prepare, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid DB_PREPARE_STATEMENTS %q: %v", value, err)
+		}
+		c.Database.PrepareStatements = prepare
+	}
+	c.Storage.Backend = getEnv("STORAGE_BACKEND", c.Storage.Backend)
+	c.Storage.SeedsDir = getEnv("SEEDS_DIR", c.Storage.SeedsDir)
+	c.Blobs.Backend = getEnv("BLOB_BACKEND", c.Blobs.Backend)
+	c.Blobs.Dir = getEnv("BLOB_DIR", c.Blobs.Dir)
+	if value := getEnv("BLOB_PRESIGN_TTL", ""); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid BLOB_PRESIGN_TTL %q: %v", value, err)
+		}
+		c.Blobs.PresignTTL = ttl
+	}
+	c.Blobs.S3.Endpoint = getEnv("S3_ENDPOINT", c.Blobs.S3.Endpoint)
+	c.Blobs.S3.Region = getEnv("S3_REGION", c.Blobs.S3.Region)
+	c.Blobs.S3.Bucket = getEnv("S3_BUCKET", c.Blobs.S3.Bucket)
+	c.Blobs.S3.AccessKeyID = getEnv("S3_ACCESS_KEY_ID", c.Blobs.S3.AccessKeyID)
+	c.Blobs.S3.SecretAccessKey = getEnv("S3_SECRET_ACCESS_KEY", c.Blobs.S3.SecretAccessKey)
+	if value := getEnv("S3_PATH_STYLE", ""); value != "" {
+		pathStyle, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid S3_PATH_STYLE %q: %v", value, err)
+		}
+		c.Blobs.S3.PathStyle = pathStyle
+	}
+	c.Server.Port = getEnv("PORT", c.Server.Port)
+	if value := getEnv("READ_ONLY", ""); value != "" {
+		readOnly, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid READ_ONLY %q: %v", value, err)
+		}
+		c.Server.ReadOnly = readOnly
+	}
+	if value := getEnv("WARMUP", ""); value != "" {
+		warmup, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid WARMUP %q: %v", value, err)
+		}
+		c.Server.Warmup = warmup
+	}
+	if value := getEnv("ENABLE_H2C", ""); value != "" {
+		h2c, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid ENABLE_H2C %q: %v", value, err)
+		}
+		c.Server.H2C = h2c
+	}
+	if value := getEnv("METHOD_OVERRIDE", ""); value != "" {
+		override, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid METHOD_OVERRIDE %q: %v", value, err)
+		}
+		c.Server.MethodOverride = override
+	}
+	if value := getEnv("PUT_CREATES_FILMS", ""); value != "" {
+		creates, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid PUT_CREATES_FILMS %q: %v", value, err)
+		}
+		c.Server.PutCreatesFilms = creates
+	}
+	if value := getEnv("ALLOW_RESET", ""); value != "" {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid ALLOW_RESET %q: %v", value, err)
+		}
+		c.Server.AllowReset = allow
+	}
+	if value := getEnv("DEMO_MODE", ""); value != "" {
+		demo, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid DEMO_MODE %q: %v", value, err)
+		}
+		c.Server.DemoMode = demo
+	}
+	if value := getEnv("MAINTENANCE_MODE", ""); value != "" {
+		maintenance, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid MAINTENANCE_MODE %q: %v", value, err)
+		}
+		c.Server.Maintenance = maintenance
+	}
+	c.Server.MaintenanceMessage = getEnv("MAINTENANCE_MESSAGE", c.Server.MaintenanceMessage)
+	if value := getEnv("MAINTENANCE_RETRY_AFTER", ""); value != "" {
+		retryAfter, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid MAINTENANCE_RETRY_AFTER %q: %v", value, err)
+		}
+		c.Server.MaintenanceRetryAfter = retryAfter
+	}
+	if value := getEnv("VALIDATE_REQUESTS", ""); value != "" {
+		validate, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid VALIDATE_REQUESTS %q: %v", value, err)
+		}
+		c.Server.ValidateRequests = validate
+	}
+	c.Server.ExportDir = getEnv("EXPORT_DIR", c.Server.ExportDir)
+	c.Server.AssetsDir = getEnv("ASSETS_DIR", c.Server.AssetsDir)
+	c.Server.SwaggerUIURL = getEnv("SWAGGER_UI_URL", c.Server.SwaggerUIURL)
+	c.Logging.Level = getEnv("LOG_LEVEL", c.Logging.Level)
+	if value := getEnv("SLOW_QUERY_THRESHOLD", ""); value != "" {
+		threshold, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid SLOW_QUERY_THRESHOLD %q: %v", value, err)
+		}
+		c.Logging.SlowQueryThreshold = threshold
+	}
+	if value := getEnv("ACCESS_LOG", ""); value != "" {
+		accessLog, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid ACCESS_LOG %q: %v", value, err)
+		}
+		c.Logging.AccessLog = accessLog
+	}
+	if value := getEnv("LOG_BODIES", ""); value != "" {
+		logBodies, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid LOG_BODIES %q: %v", value, err)
+		}
+		c.Logging.LogBodies = logBodies
+	}
+	if value := getEnv("LOG_REDACT_FIELDS", ""); value != "" {
+		c.Logging.RedactFields = splitList(value)
+	}
+	if value := getEnv("LOG_REDACT_HEADERS", ""); value != "" {
+		c.Logging.RedactHeaders = splitList(value)
+	}
+	c.Alerts.WebhookURL = getEnv("ALERT_WEBHOOK_URL", c.Alerts.WebhookURL)
+
+	if value := getEnv("TOKEN_TTL", ""); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid TOKEN_TTL %q: %v", value, err)
+		}
+		c.Auth.TokenTTL = ttl
+	}
+	if value := getEnv("TOKEN_SLIDING_EXPIRATION", ""); value != "" {
+		sliding, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid TOKEN_SLIDING_EXPIRATION %q: %v", value, err)
+		}
+		c.Auth.SlidingExpiration = sliding
+	}
+	if value := getEnv("TOKEN_MAX_LIFETIME", ""); value != "" {
+		lifetime, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid TOKEN_MAX_LIFETIME %q: %v", value, err)
+		}
+		c.Auth.MaxTokenLifetime = lifetime
+	}
+	if value := getEnv("LOGIN_DELAY_AFTER", ""); value != "" {
+		delayAfter, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid LOGIN_DELAY_AFTER %q: %v", value, err)
+		}
+		c.Auth.LoginGuard.DelayAfter = delayAfter
+	}
+	if value := getEnv("LOGIN_MAX_DELAY", ""); value != "" {
+		maxDelay, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid LOGIN_MAX_DELAY %q: %v", value, err)
+		}
+		c.Auth.LoginGuard.MaxDelay = maxDelay
+	}
+	if value := getEnv("LOGIN_BAN_AFTER", ""); value != "" {
+		banAfter, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid LOGIN_BAN_AFTER %q: %v", value, err)
+		}
+		c.Auth.LoginGuard.BanAfter = banAfter
+	}
+	if value := getEnv("LOGIN_FAILURE_WINDOW", ""); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid LOGIN_FAILURE_WINDOW %q: %v", value, err)
+		}
+		c.Auth.LoginGuard.Window = window
+	}
+	if value := getEnv("LOGIN_BAN_DURATION", ""); value != "" {
+		banDuration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid LOGIN_BAN_DURATION %q: %v", value, err)
+		}
+		c.Auth.LoginGuard.BanDuration = banDuration
+	}
+	if value := getEnv("LOGIN_ALLOWLIST", ""); value != "" {
+		c.Auth.LoginGuard.Allowlist = splitList(value)
+	}
+	if value := getEnv("TRUSTED_PROXIES", ""); value != "" {
+		c.Proxy.Trusted = splitList(value)
+	}
+	if value := getEnv("SEARCH_SIMILARITY_THRESHOLD", ""); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid SEARCH_SIMILARITY_THRESHOLD %q: %v", value, err)
+		}
+		c.Search.SimilarityThreshold = threshold
+	}
+	if value := getEnv("LOAN_PERIOD", ""); value != "" {
+		period, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid LOAN_PERIOD %q: %v", value, err)
+		}
+		c.Lending.LoanPeriod = period
+	}
+	if value := getEnv("MAX_LOANS", ""); value != "" {
+		maxLoans, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid MAX_LOANS %q: %v", value, err)
+		}
+		c.Lending.MaxLoans = maxLoans
+	}
+	if value := getEnv("DAILY_FILM_QUOTA", ""); value != "" {
+		dailyFilms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid DAILY_FILM_QUOTA %q: %v", value, err)
+		}
+		c.Quota.DailyFilms = dailyFilms
+	}
+	c.Quota.Plan = getEnv("PLAN", c.Quota.Plan)
+	if value := getEnv("CATALOG_MAX_FILMS", ""); value != "" {
+		maxFilms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid CATALOG_MAX_FILMS %q: %v", value, err)
+		}
+		c.Quota.CatalogMaxFilms = &maxFilms
+	}
+	if value := getEnv("DUMP_RATE_LIMIT", ""); value != "" {
+		requests, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid DUMP_RATE_LIMIT %q: %v", value, err)
+		}
+		c.Quota.DumpRequests = requests
+	}
+	if value := getEnv("DUMP_RATE_WINDOW", ""); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid DUMP_RATE_WINDOW %q: %v", value, err)
+		}
+		c.Quota.DumpWindow = window
+	}
+	if value := getEnv("TRAILER_ALLOWED_HOSTS", ""); value != "" {
+		c.Media.TrailerHosts = splitList(value)
+	}
+	if value := getEnv("LINK_ALLOWED_HOSTS", ""); value != "" {
+		c.Media.LinkHosts = splitList(value)
+	}
+	if value := getEnv("TRASH_RETENTION", ""); value != "" {
+		retention, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid TRASH_RETENTION %q: %v", value, err)
+		}
+		c.Jobs.TrashRetention = retention
+	}
+	if value := getEnv("ACCOUNT_RETENTION", ""); value != "" {
+		retention, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid ACCOUNT_RETENTION %q: %v", value, err)
+		}
+		c.Jobs.AccountRetention = retention
+	}
+	if value := getEnv("USAGE_RETENTION", ""); value != "" {
+		retention, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid USAGE_RETENTION %q: %v", value, err)
+		}
+		c.Jobs.UsageRetention = retention
+	}
+	// JOB_SCHEDULE_TOKEN_CLEANUP schedules the token-cleanup job, and so on
+	for _, variable := range os.Environ() {
+		key, value, _ := strings.Cut(variable, "=")
+		if name, ok := strings.CutPrefix(key, "JOB_SCHEDULE_"); ok && value != "" {
+			if c.Jobs.Schedules == nil {
+				c.Jobs.Schedules = make(map[string]string)
+			}
+			c.Jobs.Schedules[strings.ReplaceAll(strings.ToLower(name), "_", "-")] = value
+		}
+	}
+	c.Mail.SMTPHost = getEnv("SMTP_HOST", c.Mail.SMTPHost)
+	c.Mail.SMTPPort = getEnv("SMTP_PORT", c.Mail.SMTPPort)
+	c.Mail.SMTPUsername = getEnv("SMTP_USERNAME", c.Mail.SMTPUsername)
+	c.Mail.SMTPPassword = getEnv("SMTP_PASSWORD", c.Mail.SMTPPassword)
+	c.Mail.From = getEnv("MAIL_FROM", c.Mail.From)
+	if value := getEnv("CORS_ALLOWED_ORIGINS", ""); value != "" {
+		c.CORS.AllowedOrigins = splitList(value)
+	}
+	if value := getEnv("CORS_ALLOWED_HEADERS", ""); value != "" {
+		c.CORS.AllowedHeaders = splitList(value)
+	}
+	if value := getEnv("CORS_MAX_AGE", ""); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid CORS_MAX_AGE %q: %v", value, err)
+		}
+		c.CORS.MaxAge = maxAge
+	}
+	return nil
+}
+
+// Validate checks the configuration for values the server can't run with
+func (c *Config) Validate() error {
+	if c.Server.Port == "" {
+		return fmt.Errorf("server port must not be empty")
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		return fmt.Errorf("database connection limits must not be negative")
+	}
+	if _, err := time.LoadLocation(c.Database.TimeZone); err != nil || c.Database.TimeZone == "" {
+		return fmt.Errorf("invalid database time zone %q", c.Database.TimeZone)
+	}
+	if c.Database.Schema != "" && !schemaName.MatchString(c.Database.Schema) {
+		return fmt.Errorf("invalid database schema %q", c.Database.Schema)
+	}
+	if c.Server.MaintenanceRetryAfter < time.Second {
+		return fmt.Errorf("maintenance retry after must be at least a second")
+	}
+	if c.Server.ExportDir == "" || c.Server.SwaggerUIURL == "" {
+		return fmt.Errorf("export directory and Swagger UI URL must not be empty")
+	}
+	if c.Storage.Backend != storagePostgres && c.Storage.Backend != storageMemory {
+		return fmt.Errorf("storage backend must be postgres or memory")
+	}
+	if c.Storage.SeedsDir == "" {
+		return fmt.Errorf("seeds directory must not be empty")
+	}
+	switch c.Blobs.Backend {
+	case blobsLocal:
+		if c.Blobs.Dir == "" {
+			return fmt.Errorf("blob directory must not be empty")
+		}
+	case blobsS3:
+		if c.Blobs.S3.Bucket == "" || c.Blobs.S3.Region == "" || c.Blobs.S3.AccessKeyID == "" || c.Blobs.S3.SecretAccessKey == "" {
+			return fmt.Errorf("the s3 blob backend needs a bucket, region, access key ID, and secret access key")
+		}
+	default:
+		return fmt.Errorf("blob backend must be local or s3")
+	}
+	if c.Blobs.PresignTTL < time.Second || c.Blobs.PresignTTL > 7*24*time.Hour {
+		return fmt.Errorf("blob presign TTL must be between 1s and 168h")
+	}
+	if c.Auth.TokenTTL <= 0 {
+		return fmt.Errorf("token TTL must be positive")
+	}
+	if c.Auth.SlidingExpiration && c.Auth.MaxTokenLifetime < c.Auth.TokenTTL {
+		return fmt.Errorf("max token lifetime must be at least the token TTL")
+	}
+	if guard := c.Auth.LoginGuard; guard.DelayAfter < 0 || guard.MaxDelay < 0 || guard.BanAfter < 0 {
+		return fmt.Errorf("login delay and ban thresholds must not be negative")
+	}
+	if guard := c.Auth.LoginGuard; guard.Window <= 0 || (guard.BanAfter > 0 && guard.BanDuration <= 0) {
+		return fmt.Errorf("login failure window and ban duration must be positive")
+	}
+	for _, entry := range c.Auth.LoginGuard.Allowlist {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return fmt.Errorf("login allowlist entry %q is neither an IP nor a CIDR range", entry)
+		}
+	}
+	for _, entry := range c.Proxy.Trusted {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return fmt.Errorf("trusted proxy %q is neither an IP nor a CIDR range", entry)
+		}
+	}
+	if len(c.CORS.AllowedOrigins) == 0 {
+		return fmt.Errorf("at least one CORS origin is required")
+	}
+	if c.CORS.MaxAge < 0 {
+		return fmt.Errorf("CORS max age must not be negative")
+	}
+	if _, err := c.LogLevel(); err != nil {
+		return err
+	}
+	if c.Logging.SlowQueryThreshold < 0 {
+		return fmt.Errorf("slow query threshold must not be negative")
+	}
+	if c.Alerts.Window <= 0 || c.Alerts.BaselineWindows < 1 || c.Alerts.SpikeFactor <= 0 {
+		return fmt.Errorf("alert window, baseline windows, and spike factor must be positive")
+	}
+	if c.Search.SimilarityThreshold <= 0 || c.Search.SimilarityThreshold > 1 {
+		return fmt.Errorf("search similarity threshold must be above 0 and at most 1")
+	}
+	if c.Lending.LoanPeriod <= 0 || c.Lending.MaxLoans < 1 {
+		return fmt.Errorf("loan period and loan limit must be positive")
+	}
+	for name, expr := range c.Jobs.Schedules {
+		if _, err := parseCron(expr); err != nil {
+			return fmt.Errorf("schedule of job %s: %v", name, err)
+		}
+	}
+	if c.Quota.DailyFilms < 0 {
+		return fmt.Errorf("daily film quota must not be negative")
+	}
+	if _, exists := plans[c.Quota.Plan]; !exists {
+		return fmt.Errorf("unknown plan %q", c.Quota.Plan)
+	}
+	if c.Quota.CatalogMaxFilms != nil && *c.Quota.CatalogMaxFilms < 0 {
+		return fmt.Errorf("catalog film limit must not be negative")
+	}
+	if c.Quota.DumpRequests < 1 || c.Quota.DumpWindow <= 0 {
+		return fmt.Errorf("dump rate limit and window must be positive")
+	}
+	if len(c.Media.TrailerHosts) == 0 {
+		return fmt.Errorf("at least one trailer host is required")
+	}
+	if c.Jobs.TrashRetention < 0 {
+		return fmt.Errorf("trash retention must not be negative")
+	}
+	if c.Jobs.AccountRetention < 0 {
+		return fmt.Errorf("account retention must not be negative")
+	}
+	if c.Jobs.UsageRetention < 0 {
+		return fmt.Errorf("usage retention must not be negative")
+	}
+	if c.Mail.From == "" || (c.Mail.SMTPHost != "" && c.Mail.SMTPPort == "") {
+		return fmt.Errorf("mail sender and SMTP port must not be empty")
+	}
+	for _, group := range c.Alerts.Groups {
+		if group.Name == "" || group.Prefix == "" {
+			return fmt.Errorf("every alert group needs a name and a prefix")
+		}
+	}
+	return nil
+}
+
+// LogLevel maps the logging level onto the database logger's level
+func (c *Config) LogLevel() (logger.LogLevel, error) {
+	switch strings.ToLower(c.Logging.Level) {
+	case "silent":
+		return logger.Silent, nil
+	case "error":
+		return logger.Error, nil
+	case "warn":
+		return logger.Warn, nil
+	case "info":
+		return logger.Info, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q (use silent, error, warn, or info)", c.Logging.Level)
+}
+
+// Addr returns the address the HTTP server listens on
+func (c *Config) Addr() string {
+	return ":" + c.Server.Port
+}
+
+// AllowOrigin returns the Access-Control-Allow-Origin value for a request origin,
+// or "" when the origin isn't allowed
+func (c *Config) AllowOrigin(origin string) string {
+	for _, allowed := range c.CORS.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// reloadableLogger is the database logger. It delegates to a logger that is
+// replaced when the log level is reloaded.
+type reloadableLogger struct {
+	current atomic.Value // logger.Interface
+}
+
+// set replaces the logger queries are logged with
+func (rl *reloadableLogger) set(inner logger.Interface) {
+	rl.current.Store(&inner)
+}
+
+// load returns the logger queries are logged with
+func (rl *reloadableLogger) load() logger.Interface {
+	if inner, ok := rl.current.Load().(*logger.Interface); ok {
+		return *inner
+	}
+	return logger.Default
+}
+
+// LogMode returns a logger fixed at the given level, as used by db.Debug()
+func (rl *reloadableLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return rl.load().LogMode(level)
+}
+
+// Info logs an informational message
+func (rl *reloadableLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	rl.load().Info(ctx, msg, data...)
+}
+
+// Warn logs a warning
+func (rl *reloadableLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	rl.load().Warn(ctx, msg, data...)
+}
+
+// Error logs an error
+func (rl *reloadableLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	rl.load().Error(ctx, msg, data...)
+}
+
+// Trace logs a SQL statement
+func (rl *reloadableLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	rl.load().Trace(ctx, begin, fc, err)
+}
+
+// Reload applies the settings of cfg that can change at runtime: log level
+// and slow query threshold, CORS, token lifetime (for new logins), and
+// sliding expiration. Database and server settings need a restart and keep
+// their current values; read-only mode is switched at runtime with
+// PUT /api/admin/read-only.
+func (s *Server) Reload(cfg *Config) {
+	current := s.currentConfig()
+	if cfg.Database != current.Database || cfg.Storage != current.Storage || cfg.Server != current.Server {
+		log.Printf("Warning: Database, storage, and server settings changed; restart to apply them")
+		cfg.Database = current.Database
+		cfg.Storage = current.Storage
+		cfg.Server = current.Server
+	}
+
+	if queryLogger, ok := s.db.Logger.(*reloadableLogger); ok {
+		inner, _ := newDBLogger(cfg)
+		queryLogger.set(inner)
+	}
+	s.config.Store(cfg)
+	log.Printf("🔄 Configuration reloaded: token_ttl=%s log_level=%s slow_query_threshold=%s cors_origins=%s",
+		cfg.Auth.TokenTTL, cfg.Logging.Level, cfg.Logging.SlowQueryThreshold, strings.Join(cfg.CORS.AllowedOrigins, ","))
+}
+
+// watchReload loads the configuration again from the serve flags, env, and
+// config file whenever the process receives SIGHUP, and applies it to a
+// server. It returns a function that stops watching.
+func watchReload(s *Server, args []string) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			cfg, err := LoadConfig("serve", args)
+			if err != nil {
+				log.Printf("Warning: Failed to reload configuration, keeping the current one: %v", err)
+				continue
+			}
+			s.Reload(cfg)
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
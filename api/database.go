@@ -0,0 +1,280 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// DatabaseConfig holds database configuration
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	DBName   string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
+	TimeZone string `yaml:"timezone"`
+	// Schema, when set, is where the tables are created and looked up
+	// instead of public, so several databases can share one server
+	Schema       string `yaml:"schema"`
+	MaxOpenConns int    `yaml:"max_open_conns"`
+	MaxIdleConns int    `yaml:"max_idle_conns"`
+	// PrepareStatements caches prepared statements per connection and
+	// reuses them, and their query plans, for repeated queries
+	PrepareStatements bool `yaml:"prepare_statements"`
+}
+
+// LoadEnv loads environment variables from .env file
+func LoadEnv() error {
+	file, err := os.Open(".env")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Split key=value
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+
+		// Set environment variable if not already set
+		if os.Getenv(key) == "" {
+			os.Setenv(key, value)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// getEnv gets environment variable or returns default value
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// ConnectDatabase establishes connection to the PostgreSQL database of cfg.
+// Its queries are logged with a logger that Reload can swap.
+func ConnectDatabase(cfg *Config) (*gorm.DB, error) {
+	config := cfg.Database
+	inner, err := newDBLogger(cfg)
+	if err != nil {
+		return nil, err
+	}
+	queryLogger := &reloadableLogger{}
+	queryLogger.set(inner)
+
+	log.Printf("🔗 Connecting to database: %s@%s:%s/%s", config.User, config.Host, config.Port, config.DBName)
+
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=%s",
+		config.Host, config.User, config.Password, config.DBName, config.Port, config.SSLMode, config.TimeZone)
+	if config.Schema != "" {
+		dsn += fmt.Sprintf(" search_path=%s,public", config.Schema)
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger:                 queryLogger,
+		SkipDefaultTransaction: true,
+		PrepareStmt:            config.PrepareStatements,
+		NowFunc:                func() time.Time { return time.Now().UTC() },
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	if err := registerUTCTimestamps(db); err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure connection pool: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+
+	log.Printf("✅ Successfully connected to PostgreSQL database at %s:%s", config.Host, config.Port)
+	return db, nil
+}
+
+// registerUTCTimestamps converts the timestamps of loaded records to UTC, so
+// responses show the same RFC 3339 times whatever the session time zone is
+func registerUTCTimestamps(db *gorm.DB) error {
+	return db.Callback().Query().After("gorm:query").Register("app:utc_timestamps", func(tx *gorm.DB) {
+		if tx.Error == nil && tx.Statement.ReflectValue.IsValid() {
+			toUTC(tx.Statement.ReflectValue)
+		}
+	})
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// toUTC sets the time.Time values of a struct, its nested structs, or a slice of them to UTC
+func toUTC(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !value.IsNil() {
+			toUTC(value.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			toUTC(value.Index(i))
+		}
+	case reflect.Struct:
+		if value.Type() == timeType {
+			if value.CanSet() {
+				value.Set(reflect.ValueOf(value.Interface().(time.Time).UTC()))
+			}
+			return
+		}
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).IsExported() {
+				toUTC(value.Field(i))
+			}
+		}
+	}
+}
+
+// MigrateDatabase runs database migrations
+func MigrateDatabase(db *gorm.DB) error {
+	log.Println("🔄 Running database migrations...")
+
+	err := db.AutoMigrate(&Organization{}, &Film{}, &User{}, &MeteringEvent{}, &UsageRollup{}, &FilmView{}, &FilmRule{}, &Webhook{}, &ExportSnapshot{}, &ScheduledJob{}, &MetricsSnapshot{}, &Collection{}, &CollectionFilm{}, &FilmList{}, &FilmListItem{}, &Copy{}, &Loan{}, &Screening{}, &Notification{}, &OutboxEmail{}, &MailToken{}, &FeatureFlag{}, &FilmRevision{}, &APIUsage{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	// Users, films, and collections from before organizations existed belong to the default one
+	organization, err := ensureDefaultOrganization(db)
+	if err != nil {
+		return fmt.Errorf("failed to create default organization: %v", err)
+	}
+	for _, table := range []string{"users", "films", "collections"} {
+		err = db.Exec(`UPDATE `+table+` SET organization_id = ? WHERE organization_id IS NULL`, organization.ID).Error
+		if err != nil {
+			return fmt.Errorf("failed to move %s to the default organization: %v", table, err)
+		}
+		err = db.Exec(`DO $$ BEGIN
+			ALTER TABLE ` + table + ` ADD CONSTRAINT fk_` + table + `_organization FOREIGN KEY (organization_id) REFERENCES organizations (id);
+		EXCEPTION WHEN duplicate_object THEN NULL;
+		END $$`).Error
+		if err != nil {
+			log.Printf("Warning: Failed to create %s organization foreign key: %v", table, err)
+		}
+	}
+
+	// Catalogs are per organization, so the same film or external ID may appear in several
+	for _, index := range []string{"idx_films_natural_key", "idx_films_external_id"} {
+		if err := db.Exec(`DROP INDEX IF EXISTS ` + index).Error; err != nil {
+			log.Printf("Warning: Failed to drop %s: %v", index, err)
+		}
+	}
+
+	// Films are unique by normalized title, year, and director among the non-deleted rows of an organization
+	err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_films_org_natural_key ON films (organization_id, ` +
+		filmTitleKeySQL + `, year, ` + filmDirectorKeySQL + `) WHERE deleted_at IS NULL`).Error
+	if err != nil {
+		log.Printf("Warning: Failed to create unique film index, remove duplicate films and restart: %v", err)
+	}
+
+	// Collection names are unique per organization, ignoring case
+	if err := db.Exec(`DROP INDEX IF EXISTS idx_collections_name`).Error; err != nil {
+		log.Printf("Warning: Failed to drop idx_collections_name: %v", err)
+	}
+	err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_collections_org_name ON collections (organization_id, lower(name))`).Error
+	if err != nil {
+		log.Printf("Warning: Failed to create unique collection name index, rename duplicate collections and restart: %v", err)
+	}
+
+	// Films point at the user who created them; catalog films have no creator
+	err = db.Exec(`DO $$ BEGIN
+		ALTER TABLE films ADD CONSTRAINT fk_films_created_by FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE SET NULL;
+	EXCEPTION WHEN duplicate_object THEN NULL;
+	END $$`).Error
+	if err != nil {
+		log.Printf("Warning: Failed to create film creator foreign key: %v", err)
+	}
+
+	// Revisions go with their film when the trash is purged
+	err = db.Exec(`DO $$ BEGIN
+		ALTER TABLE film_revisions ADD CONSTRAINT fk_film_revisions_film FOREIGN KEY (film_id) REFERENCES films (id) ON DELETE CASCADE;
+	EXCEPTION WHEN duplicate_object THEN NULL;
+	END $$`).Error
+	if err != nil {
+		log.Printf("Warning: Failed to create film revision foreign key: %v", err)
+	}
+
+	// A copy can only be out on one loan at a time
+	err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_loans_open_copy ON loans (copy_id) WHERE returned_at IS NULL`).Error
+	if err != nil {
+		log.Printf("Warning: Failed to create open loan index, close duplicate loans and restart: %v", err)
+	}
+
+	// Delta sync walks the films of a catalog in the order they changed
+	err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_films_changed_at ON films (organization_id, (COALESCE(deleted_at, updated_at)), id)`).Error
+	if err != nil {
+		log.Printf("Warning: Failed to create film change index, delta sync will scan the films table: %v", err)
+	}
+
+	// Prefix indexes serve the typeahead suggestions, whatever the collation
+	err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_films_title_prefix ON films (lower(title) text_pattern_ops)`).Error
+	if err == nil {
+		err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_films_director_prefix ON films (lower(director) text_pattern_ops)`).Error
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to create film prefix indexes, suggestions will scan the films table: %v", err)
+	}
+
+	// Trigram indexes serve the typo-tolerant film search
+	err = db.Exec(`CREATE EXTENSION IF NOT EXISTS pg_trgm`).Error
+	if err == nil {
+		err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_films_title_trgm ON films USING gin (title gin_trgm_ops)`).Error
+	}
+	if err == nil {
+		err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_films_director_trgm ON films USING gin (director gin_trgm_ops)`).Error
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to set up pg_trgm, film search is unavailable until a superuser runs CREATE EXTENSION pg_trgm: %v", err)
+	}
+
+	log.Println("✅ Database migrations completed successfully")
+	return nil
+}
+
+// SeedDatabase upserts the films and users declared in the seed files of dir
+func SeedDatabase(db *gorm.DB, dir string) error {
+	log.Printf("🌱 Seeding database from %s/...", dir)
+
+	data, err := LoadSeeds(dir)
+	if err != nil {
+		return fmt.Errorf("failed to load seed files: %v", err)
+	}
+
+	films, users, err := ApplySeeds(db, data)
+	if err != nil {
+		return fmt.Errorf("failed to seed database: %v", err)
+	}
+
+	log.Printf("✅ Successfully seeded %d films and %d users", films, users)
+	return nil
+}
@@ -0,0 +1,38 @@
+package api
+
+import "net/http"
+
+// demoMessage is what mutations get on a demo instance
+const demoMessage = "This is a read-only demo, changes are disabled"
+
+// demoBackupMessage is what backup downloads get on a demo instance
+const demoBackupMessage = "This is a demo, backups are disabled"
+
+// demoExempt are the mutating endpoints that keep working in demo mode:
+// signing in and out with the demo accounts, and looking films up
+var demoExempt = map[string]bool{
+	"/api/login":  true,
+	"/api/logout": true,
+	// Looking films up only reads, it is a POST for long ID lists
+	"/api/films/lookup": true,
+}
+
+// rejectWritesInDemo answers mutations with 403 on a demo instance, so
+// visitors can sign in with the published demo accounts, admin included, and
+// try every read without changing what the next visitor sees. Unlike
+// read-only mode there is nothing to wait for and no switch at runtime; the
+// instance is never writable. Full backups are refused too, since they can
+// carry the password hashes of every account.
+func rejectWritesInDemo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/admin/export" {
+			writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: demoBackupMessage, Code: "demo_backup_disabled"})
+			return
+		}
+		if isMutation(r.Method) && !demoExempt[r.URL.Path] {
+			writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: demoMessage, Code: "demo_mode"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
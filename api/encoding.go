@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ResponseEncoder writes a response value in one media type
+type ResponseEncoder func(w io.Writer, v interface{}) error
+
+// registeredEncoder is a media type and the encoder producing it
+type registeredEncoder struct {
+	mediaType string
+	encode    ResponseEncoder
+}
+
+// responseEncoders are the representations clients can ask for with Accept.
+// The first one is the default for missing, wildcard, or unsupported Accept headers.
+var responseEncoders []registeredEncoder
+
+// RegisterEncoder adds a representation for negotiated responses. Registering
+// a media type again replaces its encoder.
+func RegisterEncoder(mediaType string, encode ResponseEncoder) {
+	for i := range responseEncoders {
+		if responseEncoders[i].mediaType == mediaType {
+			responseEncoders[i].encode = encode
+			return
+		}
+	}
+	responseEncoders = append(responseEncoders, registeredEncoder{mediaType: mediaType, encode: encode})
+}
+
+func init() {
+	RegisterEncoder("application/json", encodeJSON)
+	RegisterEncoder("application/xml", encodeXML)
+	RegisterEncoder("text/xml", encodeXML)
+	RegisterEncoder("application/yaml", encodeYAML)
+	RegisterEncoder("application/x-yaml", encodeYAML)
+	RegisterEncoder("text/yaml", encodeYAML)
+}
+
+// acceptedValues lists the values of an Accept-style header, most preferred
+// first, leaving out those with q=0
+func acceptedValues(header string) []string {
+	type acceptedValue struct {
+		value   string
+		quality float64
+	}
+	var accepted []acceptedValue
+	for _, part := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(part, ";")
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if name, q, ok := strings.Cut(strings.TrimSpace(param), "="); ok && name == "q" {
+				if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+					quality = parsed
+				}
+			}
+		}
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" && quality > 0 {
+			accepted = append(accepted, acceptedValue{value: value, quality: quality})
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].quality > accepted[j].quality })
+
+	values := make([]string, len(accepted))
+	for i, candidate := range accepted {
+		values[i] = candidate.value
+	}
+	return values
+}
+
+// negotiateEncoder picks the registered encoder a client prefers most
+func negotiateEncoder(accept string) registeredEncoder {
+	for _, mediaType := range acceptedValues(accept) {
+		if mediaType == "*/*" || mediaType == "application/*" {
+			break
+		}
+		for _, encoder := range responseEncoders {
+			if encoder.mediaType == mediaType {
+				return encoder
+			}
+		}
+	}
+	return responseEncoders[0]
+}
+
+// writeResponse encodes a response in the representation the request asks for
+func writeResponse(w http.ResponseWriter, r *http.Request, statusCode int, v interface{}) {
+	encoder := negotiateEncoder(r.Header.Get("Accept"))
+	v = localizeResponse(r, w, v)
+	w.Header().Set("Content-Type", encoder.mediaType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(statusCode)
+	if err := encoder.encode(w, v); err != nil {
+		log.Printf("Warning: Failed to encode %s response: %v", encoder.mediaType, err)
+	}
+}
+
+// encodeJSON writes the default JSON representation
+func encodeJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// encodeXML writes an XML document. The root element is named after the type
+// of the value, e.g. <film_page>, and lists are wrapped in <list>.
+func encodeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Slice {
+		list := xml.StartElement{Name: xml.Name{Local: "list"}}
+		if err := encoder.EncodeToken(list); err != nil {
+			return err
+		}
+		for i := 0; i < value.Len(); i++ {
+			item := value.Index(i).Interface()
+			if err := encoder.EncodeElement(item, xml.StartElement{Name: xml.Name{Local: xmlElementName(item)}}); err != nil {
+				return err
+			}
+		}
+		if err := encoder.EncodeToken(list.End()); err != nil {
+			return err
+		}
+	} else if err := encoder.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: xmlElementName(v)}}); err != nil {
+		return err
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// xmlElementName turns the type name of a value into snake case
+func xmlElementName(v interface{}) string {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var name strings.Builder
+	for i, r := range t.Name() {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				name.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		name.WriteRune(r)
+	}
+	return name.String()
+}
+
+// encodeYAML writes a YAML document. The value goes through JSON first so the
+// YAML keeps the field names, omitted fields, and field order of the JSON.
+func encodeYAML(w io.Writer, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return err
+	}
+	blockStyle(&document)
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// blockStyle drops the flow style and quoting the JSON input left on a YAML node.
+// The encoder still quotes strings that would otherwise read as another type.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
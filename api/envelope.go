@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// envelopeVersion is the API-Version header value that opts into enveloped responses
+const envelopeVersion = "2"
+
+// maxRequestIDLength bounds the X-Request-ID a client may pass in
+const maxRequestIDLength = 128
+
+// Envelope is the shape of every JSON response under /api with API-Version: 2
+// @Description Response envelope
+type Envelope struct {
+	Data  interface{}                `json:"data"`
+	Error map[string]json.RawMessage `json:"error"`
+	Meta  EnvelopeMeta               `json:"meta"`
+}
+
+// EnvelopeMeta describes the request behind an enveloped response
+// @Description Response metadata
+type EnvelopeMeta struct {
+	RequestID  string                     `json:"request_id" example:"4f9c2a7d1e3b5c60"`
+	DurationMs float64                    `json:"duration_ms" example:"3.21"`
+	Pagination map[string]json.RawMessage `json:"pagination,omitempty"`
+}
+
+// envelopeRecorder holds back a JSON response so it can be wrapped once the
+// handler is done. Other responses, like streams, pass through as written.
+type envelopeRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	passthrough bool
+	body        bytes.Buffer
+}
+
+// WriteHeader records the status code for the envelope, or writes it for
+// responses that aren't JSON
+func (er *envelopeRecorder) WriteHeader(status int) {
+	if er.wroteHeader {
+		return
+	}
+	er.wroteHeader = true
+	er.status = status
+	if !strings.HasPrefix(er.Header().Get("Content-Type"), "application/json") {
+		er.passthrough = true
+		er.ResponseWriter.WriteHeader(status)
+	}
+}
+
+// Write buffers the body for the envelope
+func (er *envelopeRecorder) Write(p []byte) (int, error) {
+	if !er.wroteHeader {
+		er.WriteHeader(http.StatusOK)
+	}
+	if er.passthrough {
+		return er.ResponseWriter.Write(p)
+	}
+	return er.body.Write(p)
+}
+
+// FlushError flushes responses passing through; enveloped ones are sent
+// whole once the handler returns
+func (er *envelopeRecorder) FlushError() error {
+	if !er.wroteHeader {
+		er.WriteHeader(http.StatusOK)
+	}
+	if !er.passthrough {
+		return nil
+	}
+	return http.NewResponseController(er.ResponseWriter).Flush()
+}
+
+// requestID returns the ID a client sent in X-Request-ID, or a new one
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); id != "" && len(id) <= maxRequestIDLength {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// envelopeResponses tags every response with a request ID and, for clients
+// sending API-Version: 2, wraps JSON responses under /api in an Envelope
+func envelopeResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		id := requestID(r)
+		w.Header().Set("X-Request-ID", id)
+		w.Header().Add("Vary", "API-Version")
+
+		if r.Header.Get("API-Version") != envelopeVersion || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &envelopeRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		if recorder.passthrough {
+			return
+		}
+
+		// Other representations, downloads, and empty responses pass through as they are
+		isJSON := strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+		if !isJSON || recorder.body.Len() == 0 || !json.Valid(recorder.body.Bytes()) {
+			w.WriteHeader(recorder.status)
+			w.Write(recorder.body.Bytes())
+			return
+		}
+		var body map[string]json.RawMessage
+		json.Unmarshal(recorder.body.Bytes(), &body)
+
+		envelope := Envelope{Meta: EnvelopeMeta{RequestID: id}}
+		switch {
+		case recorder.status >= 400 && body["error"] != nil:
+			// The message moves to error.message; details such as fields stay beside it
+			body["message"] = body["error"]
+			delete(body, "error")
+			envelope.Error = body
+		case body["data"] != nil && body["page_size"] != nil:
+			// Pages keep their items in data and move the paging details to meta
+			envelope.Data = body["data"]
+			delete(body, "data")
+			envelope.Meta.Pagination = body
+		default:
+			envelope.Data = json.RawMessage(bytes.TrimSpace(recorder.body.Bytes()))
+		}
+		envelope.Meta.DurationMs = float64(time.Since(started).Microseconds()) / 1000
+
+		w.Header().Del("Content-Length")
+		w.WriteHeader(recorder.status)
+		json.NewEncoder(w).Encode(envelope)
+	})
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Event is something that happened in one module that others may react to
+type Event struct {
+	Type string
+	Film *Film
+	Time time.Time
+}
+
+// EventHandler reacts to an event. Handlers run on the worker pool, off the
+// request that published the event.
+type EventHandler func(event Event)
+
+// EventBus passes events between modules without them knowing each other.
+// Modules publish what happened; subscribers decide what to do about it.
+type EventBus struct {
+	pool *WorkerPool
+
+	mu          sync.RWMutex
+	subscribers map[string][]EventHandler
+}
+
+// NewEventBus creates an event bus running handlers on a worker pool
+func NewEventBus(pool *WorkerPool) *EventBus {
+	return &EventBus{pool: pool, subscribers: make(map[string][]EventHandler)}
+}
+
+// Subscribe registers a handler for every event of a type
+func (eb *EventBus) Subscribe(eventType string, handler EventHandler) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	eb.subscribers[eventType] = append(eb.subscribers[eventType], handler)
+}
+
+// Publish hands an event to the handlers subscribed to its type in the
+// background. An event that can't be queued is logged and dropped.
+func (eb *EventBus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	eb.mu.RLock()
+	handlers := append([]EventHandler(nil), eb.subscribers[event.Type]...)
+	eb.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler := handler
+		if err := eb.pool.Submit("event-"+event.Type, PriorityNormal, func() { handler(event) }); err != nil {
+			log.Printf("Warning: Dropped %s event: %v", event.Type, err)
+		}
+	}
+}
+
+// Plugin publishes film events on the bus after every committed change
+func (eb *EventBus) Plugin() Plugin {
+	return Plugin{
+		Name: "events",
+		Films: FilmHooks{
+			PostCommit: func(hc HookContext, film *Film) {
+				if eventType, exists := filmEvents[hc.Action]; exists {
+					filmCopy := *film
+					eb.Publish(Event{Type: eventType, Film: &filmCopy})
+				}
+			},
+		},
+	}
+}
@@ -0,0 +1,325 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Export modes
+const (
+	ExportModeFull = "full"
+	ExportModeDiff = "diff"
+)
+
+// Files inside an export directory
+const (
+	exportFilmsFile    = "films.ndjson"
+	exportManifestFile = "manifest.json"
+)
+
+// exportSchemaVersion is bumped whenever the layout of exported records changes
+const exportSchemaVersion = 1
+
+// ExportService generates full and differential catalog exports as files
+type ExportService struct {
+	db  *gorm.DB
+	dir string
+}
+
+// NewExportService creates a new export service writing below dir
+func NewExportService(db *gorm.DB, dir string) *ExportService {
+	return &ExportService{db: db, dir: dir}
+}
+
+// LastSnapshot returns the most recent export, or nil when there is none
+func (es *ExportService) LastSnapshot() (*ExportSnapshot, error) {
+	var snapshot ExportSnapshot
+	err := es.db.Order("until DESC").First(&snapshot).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// CreateExport writes an export and records its snapshot. Differential exports
+// without an explicit since continue from the end of the last export.
+func (es *ExportService) CreateExport(mode string, since *time.Time, username string) (*ExportSnapshot, error) {
+	if mode == ExportModeDiff && since == nil {
+		last, err := es.LastSnapshot()
+		if err != nil {
+			return nil, err
+		}
+		if last == nil {
+			return nil, &CodedError{Code: "export_no_previous", Message: "no previous export, supply since or run a full export first"}
+		}
+		since = &last.Until
+	}
+	if mode == ExportModeFull {
+		since = nil
+	}
+
+	snapshot := ExportSnapshot{
+		Mode:      mode,
+		Since:     since,
+		Until:     time.Now().UTC(),
+		CreatedBy: username,
+	}
+	// The snapshot is only listed once its files are complete
+	var dir string
+	err := WithTransaction(es.db, func(tx *gorm.DB) error {
+		if err := tx.Create(&snapshot).Error; err != nil {
+			return err
+		}
+		dir = filepath.Join(es.dir, strconv.Itoa(int(snapshot.ID)))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		filmsFile, err := es.writeFilms(tx, filepath.Join(dir, exportFilmsFile), since, snapshot.Until)
+		if err != nil {
+			return err
+		}
+		if err := es.writeManifest(filepath.Join(dir, exportManifestFile), &snapshot, []ExportManifestFile{*filmsFile}); err != nil {
+			return err
+		}
+		snapshot.Rows = filmsFile.Rows
+		snapshot.Files = []string{exportManifestFile, exportFilmsFile}
+		return tx.Save(&snapshot).Error
+	})
+	if err != nil {
+		if dir != "" {
+			os.RemoveAll(dir)
+		}
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// writeManifest writes the manifest describing the data files of an export
+func (es *ExportService) writeManifest(path string, snapshot *ExportSnapshot, files []ExportManifestFile) error {
+	manifest := ExportManifest{
+		SchemaVersion: exportSchemaVersion,
+		ExportID:      snapshot.ID,
+		Mode:          snapshot.Mode,
+		Since:         snapshot.Since,
+		Until:         snapshot.Until,
+		CreatedBy:     snapshot.CreatedBy,
+		GeneratedAt:   time.Now().UTC(),
+		Files:         files,
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o644)
+}
+
+// writeFilms streams the films changed in (since, until] to an NDJSON file and
+// returns its manifest entry. A nil since exports every live film; differential
+// exports include tombstones.
+func (es *ExportService) writeFilms(db *gorm.DB, path string, since *time.Time, until time.Time) (*ExportManifestFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	query := db.Model(&Film{}).Order("id")
+	if since == nil {
+		query = query.Where("created_at <= ?", until)
+	} else {
+		query = query.Unscoped().Where(
+			"(updated_at > ? AND updated_at <= ?) OR (deleted_at > ? AND deleted_at <= ?)",
+			*since, until, *since, until)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Checksum the bytes as they are written instead of reading the file back
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(file, hash)}
+	writer := bufio.NewWriter(counter)
+	encoder := json.NewEncoder(writer)
+	var count int64
+	for rows.Next() {
+		var film Film
+		if err := db.ScanRows(rows, &film); err != nil {
+			return nil, err
+		}
+		record := ExportRecord{Film: film}
+		if film.DeletedAt.Valid {
+			record.Deleted = true
+			record.DeletedAt = &film.DeletedAt.Time
+		}
+		if err := encoder.Encode(record); err != nil {
+			return nil, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	return &ExportManifestFile{
+		Name:   filepath.Base(path),
+		Rows:   count,
+		Bytes:  counter.n,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// GetExports retrieves all export snapshots, newest first
+func (es *ExportService) GetExports() ([]ExportSnapshot, error) {
+	var snapshots []ExportSnapshot
+	err := es.db.Order("id DESC").Find(&snapshots).Error
+	return snapshots, err
+}
+
+// GetExport retrieves an export snapshot by ID
+func (es *ExportService) GetExport(id uint) (*ExportSnapshot, error) {
+	var snapshot ExportSnapshot
+	err := es.db.First(&snapshot, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("export not found")
+		}
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// FilePath returns the path of a file of an export, if the export contains it
+func (es *ExportService) FilePath(snapshot *ExportSnapshot, name string) (string, bool) {
+	for _, file := range snapshot.Files {
+		if file == name {
+			return filepath.Join(es.dir, strconv.Itoa(int(snapshot.ID)), name), true
+		}
+	}
+	return "", false
+}
+
+// exportsHandler routes /api/exports endpoints (admin only)
+func (s *Server) exportsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/exports")
+	path = strings.Trim(path, "/")
+
+	if path == "" {
+		switch r.Method {
+		case "GET":
+			snapshots, err := s.exportService.GetExports()
+			if err != nil {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve exports", Code: "exports_retrieve_failed"})
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(snapshots)
+		case "POST":
+			s.createExportHandler(w, r)
+		default:
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		}
+		return
+	}
+
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	// /api/exports/{id} or /api/exports/{id}/files/{name}
+	parts := strings.Split(path, "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || (len(parts) != 1 && (len(parts) != 3 || parts[1] != "files")) {
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Not found", Code: "not_found"})
+		return
+	}
+
+	snapshot, err := s.exportService.GetExport(uint(id))
+	if err != nil {
+		if err.Error() == "export not found" {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Export not found", Code: "export_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve export", Code: "export_retrieve_failed"})
+		}
+		return
+	}
+
+	if len(parts) == 1 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshot)
+		return
+	}
+
+	file, exists := s.exportService.FilePath(snapshot, parts[2])
+	if !exists {
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Export file not found", Code: "export_file_not_found"})
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"export-%d-%s\"", snapshot.ID, parts[2]))
+	http.ServeFile(w, r, file)
+}
+
+// createExportHandler generates a full or differential export
+func (s *Server) createExportHandler(w http.ResponseWriter, r *http.Request) {
+	exportReq := ExportRequest{Mode: ExportModeFull}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&exportReq); err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+			return
+		}
+	}
+
+	if exportReq.Mode != ExportModeFull && exportReq.Mode != ExportModeDiff {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "mode must be full or diff", Code: "export_mode_invalid"})
+		return
+	}
+
+	snapshot, err := s.exportService.CreateExport(exportReq.Mode, exportReq.Since, currentUsername(r))
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "no previous export") {
+			writeResponse(w, r, http.StatusBadRequest, errorResponse(err))
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to create export", Code: "export_create_failed"})
+		}
+		return
+	}
+
+	s.meteringService.RecordRequest(r, MeterExport, snapshot.Rows)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(snapshot)
+}
@@ -0,0 +1,316 @@
+package api
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fixtureTime is the clock of every fixture and of GORM during tests, so
+// timestamps in responses never depend on when the tests run
+var fixtureTime = time.Date(2025, time.January, 15, 9, 0, 0, 0, time.UTC)
+
+// Tokens handed out to the fixture users
+const (
+	fixtureAdminToken = "fixture-admin-token"
+	fixtureUserToken  = "fixture-user-token"
+	// fixtureReaderToken belongs to the admin but only carries films:read
+	fixtureReaderToken = "fixture-reader-token"
+)
+
+func fixtureString(value string) *string {
+	return &value
+}
+
+func fixtureUint(value uint) *uint {
+	return &value
+}
+
+// fixtureFilms are the catalog every test starts from, with stable IDs
+var fixtureFilms = []Film{
+	{ID: 1, Title: "The Shawshank Redemption", Director: "Frank Darabont", Year: 1994, Genre: "Drama", ExternalID: fixtureString("imdb:tt0111161"), Version: 1, CreatedAt: fixtureTime.AddDate(0, 0, -7), UpdatedAt: fixtureTime.AddDate(0, 0, -7)},
+	{ID: 2, Title: "The Godfather", Director: "Francis Ford Coppola", Year: 1972, Genre: "Crime", Version: 3, CreatedBy: fixtureUint(2), CreatedAt: fixtureTime.AddDate(0, 0, -6), UpdatedAt: fixtureTime.AddDate(0, 0, -2)},
+	{ID: 3, Title: "Spirited Away", Director: "Hayao Miyazaki", Year: 2001, Genre: "Animation", Version: 1, CreatedBy: fixtureUint(2), CreatedAt: fixtureTime.AddDate(0, 0, -1), UpdatedAt: fixtureTime.AddDate(0, 0, -1)},
+}
+
+// fixtureOrganization is the default organization every fixture belongs to
+var fixtureOrganization = Organization{ID: 1, Name: "Default", Slug: defaultTenant, CreatedAt: fixtureTime.AddDate(0, -2, 0), UpdatedAt: fixtureTime.AddDate(0, -2, 0)}
+
+// fixtureTenant is what the fixture tokens act for
+var fixtureTenant = Tenant{OrganizationID: fixtureOrganization.ID, Slug: fixtureOrganization.Slug}
+
+// Fixture users, matching the default seed accounts
+var (
+	fixtureAdmin = User{ID: 1, Username: "admin", Password: "admin123", Role: "admin", Active: true, Email: fixtureString("admin@example.com"), EmailVerified: true, DisplayName: "Site Admin", OrganizationID: 1, CreatedAt: fixtureTime.AddDate(0, -1, 0), UpdatedAt: fixtureTime.AddDate(0, -1, 0)}
+	fixtureUser  = User{ID: 2, Username: "user1", Password: "password123", Role: "user", Active: true, OrganizationID: 1, CreatedAt: fixtureTime.AddDate(0, -1, 0), UpdatedAt: fixtureTime.AddDate(0, -1, 0)}
+)
+
+// fixtureRevisions are the earlier versions of The Godfather, oldest first
+var fixtureRevisions = []FilmRevision{
+	{ID: 1, FilmID: 2, Version: 1, Film: filmSnapshot(Film{Title: "Godfather", Director: "Francis Ford Coppola", Year: 1972, Genre: "Drama"}), ReplacedBy: fixtureUint(2), ReplacedAt: fixtureTime.AddDate(0, 0, -5)},
+	{ID: 2, FilmID: 2, Version: 2, Film: filmSnapshot(Film{Title: "The Godfather", Director: "Francis Ford Coppola", Year: 1972, Genre: "Drama"}), ReplacedBy: fixtureUint(2), ReplacedAt: fixtureTime.AddDate(0, 0, -2)},
+}
+
+var filmColumns = []string{"id", "title", "director", "year", "genre", "external_id", "version", "created_by", "created_at", "updated_at", "deleted_at"}
+
+// filmRows returns result rows holding films
+func filmRows(films ...Film) *sqlmock.Rows {
+	rows := sqlmock.NewRows(append(filmColumns, "poster_key", "poster_sizes"))
+	for _, film := range films {
+		var externalID, createdBy driver.Value
+		if film.ExternalID != nil {
+			externalID = *film.ExternalID
+		}
+		if film.CreatedBy != nil {
+			createdBy = int64(*film.CreatedBy)
+		}
+		rows.AddRow(film.ID, film.Title, film.Director, film.Year, film.Genre, externalID, film.Version, createdBy, film.CreatedAt, film.UpdatedAt, nil, film.PosterKey, film.PosterSizes)
+	}
+	return rows
+}
+
+var userColumns = []string{"id", "username", "password", "role", "active", "email", "email_verified", "display_name", "avatar_url", "digest", "organization_id", "created_at", "updated_at", "deleted_at"}
+
+// userRows returns result rows holding users
+func userRows(users ...User) *sqlmock.Rows {
+	rows := sqlmock.NewRows(userColumns)
+	for _, user := range users {
+		var email driver.Value
+		if user.Email != nil {
+			email = *user.Email
+		}
+		rows.AddRow(user.ID, user.Username, user.Password, user.Role, user.Active, email, user.EmailVerified, user.DisplayName, user.AvatarURL, user.Digest, user.OrganizationID, user.CreatedAt, user.UpdatedAt, nil)
+	}
+	return rows
+}
+
+// organizationRows returns result rows holding organizations
+func organizationRows(organizations ...Organization) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "name", "slug", "plan", "max_films", "created_at", "updated_at"})
+	for _, organization := range organizations {
+		rows.AddRow(organization.ID, organization.Name, organization.Slug, organization.Plan, organization.MaxFilms, organization.CreatedAt, organization.UpdatedAt)
+	}
+	return rows
+}
+
+// countRows returns the result of a count query
+func countRows(count int64) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"count"}).AddRow(count)
+}
+
+var revisionColumns = []string{"id", "film_id", "version", "film", "replaced_by", "replaced_at"}
+
+// revisionRows returns result rows holding film revisions
+func revisionRows(revisions ...FilmRevision) *sqlmock.Rows {
+	rows := sqlmock.NewRows(revisionColumns)
+	for _, revision := range revisions {
+		film, _ := json.Marshal(revision.Film)
+		var replacedBy driver.Value
+		if revision.ReplacedBy != nil {
+			replacedBy = int64(*revision.ReplacedBy)
+		}
+		rows.AddRow(revision.ID, revision.FilmID, revision.Version, film, replacedBy, revision.ReplacedAt)
+	}
+	return rows
+}
+
+// expectMaxFilmID expects the lookup of the highest film ID, before creating
+// a film under a chosen ID
+func expectMaxFilmID(mock sqlmock.Sqlmock, id uint) {
+	mock.ExpectQuery(`SELECT coalesce\(max\(id\), 0\) FROM "films"`).WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(id))
+}
+
+// expectTenantPlan expects the lookup of the plan of an organization, before
+// its catalog quota is checked
+func expectTenantPlan(mock sqlmock.Sqlmock, organization Organization) {
+	mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE "organizations"."id" = \$1`).WithArgs(organization.ID).WillReturnRows(organizationRows(organization))
+}
+
+// expectUser expects the lookup of a user by username, e.g. by requireAdmin
+func expectUser(mock sqlmock.Sqlmock, user User) {
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE username = \$1`).WillReturnRows(userRows(user))
+}
+
+// expectTenantUser expects a user looked up by username within an
+// organization, answering with users
+func expectTenantUser(mock sqlmock.Sqlmock, username string, organizationID uint, users ...User) {
+	mock.ExpectQuery(`SELECT \* FROM "users" WHERE username = \$1 AND "users"."organization_id" = \$2`).
+		WithArgs(username, organizationID).WillReturnRows(userRows(users...))
+}
+
+// expectLogin expects the queries of a successful login: the user, their
+// organization, and the user again to see they are still active
+func expectLogin(mock sqlmock.Sqlmock, user User) {
+	expectUser(mock, user)
+	mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE "organizations"."id" = \$1`).WillReturnRows(organizationRows(fixtureOrganization))
+	expectUser(mock, user)
+}
+
+// expectDuplicateLookup expects the natural key lookup of FindDuplicate
+func expectDuplicateLookup(mock sqlmock.Sqlmock, films ...Film) {
+	mock.ExpectQuery(`SELECT \* FROM "films" WHERE \(btrim`).WillReturnRows(filmRows(films...))
+}
+
+// expectMeteringEvent expects a billable operation to be recorded
+func expectMeteringEvent(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "metering_events"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+}
+
+// newFixtureServer creates a server on a mocked database. Queries must be
+// expected on the mock in the order the request runs them; unmet
+// expectations fail the test.
+func newFixtureServer(t *testing.T) (*Server, sqlmock.Sqlmock) {
+	t.Helper()
+
+	sqlDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	if err != nil {
+		t.Fatalf("failed to create database mock: %v", err)
+	}
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		NowFunc: func() time.Time { return fixtureTime },
+		Logger:  logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := registerUTCTimestamps(gormDB); err != nil {
+		t.Fatalf("failed to register callbacks: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		sqlDB.Close()
+	})
+
+	srv := NewServer(DefaultConfig(), gormDB)
+	t.Cleanup(func() { srv.Close() })
+	srv.ready.Store(true)
+	if srv.spec, err = LoadOpenAPISpec(""); err != nil {
+		t.Fatalf("failed to load OpenAPI spec: %v", err)
+	}
+	srv.exportService = NewExportService(gormDB, t.TempDir())
+	srv.blobs = NewLocalBlobStore(t.TempDir())
+
+	srv.tokenStore.AddToken(fixtureAdminToken, fixtureAdmin.Username, fixtureTenant, knownScopes)
+	srv.tokenStore.AddToken(fixtureUserToken, fixtureUser.Username, fixtureTenant, []string{scopeFilmsRead, scopeFilmsWrite, scopeAccountWrite})
+	srv.tokenStore.AddToken(fixtureReaderToken, fixtureAdmin.Username, fixtureTenant, []string{scopeFilmsRead})
+
+	return srv, mock
+}
+
+// enableMethodOverride lets POST requests tunnel other methods
+func enableMethodOverride(srv *Server) {
+	srv.cfg.Server.MethodOverride = true
+}
+
+// enablePutCreatesFilms makes every PUT to a missing film create it
+func enablePutCreatesFilms(srv *Server) {
+	srv.cfg.Server.PutCreatesFilms = true
+}
+
+// banTestClient fails logins for many usernames from the address of test
+// requests, until the login guard bans it
+func banTestClient(srv *Server) {
+	banTestIP(srv, "192.0.2.1")
+}
+
+// banTestIP fails logins for many usernames from an address until the login
+// guard bans it
+func banTestIP(srv *Server, ip string) {
+	srv.loginGuard.now = func() time.Time { return fixtureTime }
+	guard := srv.cfg.Auth.LoginGuard
+	for i := 0; i < guard.BanAfter; i++ {
+		srv.loginGuard.Fail(ip, fmt.Sprintf("user%d", i), guard)
+	}
+}
+
+// failTestLogins fails n logins for a username from the address of test
+// requests, with the clock of the login guard stopped
+func failTestLogins(srv *Server, username string, n int) {
+	srv.loginGuard.now = func() time.Time { return fixtureTime }
+	for i := 0; i < n; i++ {
+		srv.loginGuard.Fail("192.0.2.1", username, srv.cfg.Auth.LoginGuard)
+	}
+}
+
+// enableReset turns on POST /api/admin/reset, seeding from testdata/seeds
+func enableReset(srv *Server) {
+	srv.cfg.Server.AllowReset = true
+	srv.cfg.Storage.SeedsDir = "testdata/seeds"
+}
+
+// enableDemoMode rejects writes as a public demo instance does
+func enableDemoMode(srv *Server) {
+	srv.cfg.Server.DemoMode = true
+}
+
+// fixturePosterKey is the blob key of the poster stored by storePoster
+const fixturePosterKey = "posters/2/5eed0f1e.png"
+
+// fixturePoster is enough of a PNG for content sniffing
+const fixturePoster = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+// fixtureThumbnail stands in for the small thumbnail of the fixture poster
+const fixtureThumbnail = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\xc8"
+
+// storePoster puts the fixture poster and its small thumbnail into the blob
+// store of the server
+func storePoster(srv *Server) {
+	srv.blobs.Put(context.Background(), fixturePosterKey, strings.NewReader(fixturePoster), int64(len(fixturePoster)))
+	srv.blobs.Put(context.Background(), thumbnailKey(fixturePosterKey, "small"), strings.NewReader(fixtureThumbnail), int64(len(fixtureThumbnail)))
+}
+
+// useS3Blobs moves the server onto an S3 blob store with a fixed clock, so
+// presigned URLs are the same on every run. Nothing is sent to it.
+func useS3Blobs(srv *Server) {
+	store := NewS3BlobStore(S3Config{Endpoint: "https://minio.example.com", Region: "us-east-1", Bucket: "films", AccessKeyID: "fixture-key", SecretAccessKey: "fixture-secret", PathStyle: true})
+	store.now = func() time.Time { return fixtureTime }
+	srv.blobs = store
+}
+
+// useMemoryStorage moves the server onto in-memory films and users holding
+// the fixtures, so requests for them no longer reach the mocked database
+func useMemoryStorage(srv *Server) {
+	films := NewMemoryFilmRepository(srv.config, srv.plugins)
+	for _, film := range fixtureFilms {
+		film.OrganizationID = fixtureOrganization.ID
+		films.table.films[film.ID] = film
+		films.table.nextID = film.ID
+	}
+	for _, revision := range fixtureRevisions {
+		films.table.revisions[revision.FilmID] = append(films.table.revisions[revision.FilmID], revision)
+	}
+	users := NewMemoryUserRepository(srv.plugins)
+	for _, user := range []User{fixtureAdmin, fixtureUser} {
+		users.users[user.Username] = user
+		users.nextID = user.ID
+	}
+	srv.films, srv.users = films, users
+}
+
+// withDailyFilmQuota returns a setup letting users create limit films a day
+func withDailyFilmQuota(limit int64) func(srv *Server) {
+	return func(srv *Server) {
+		cfg := *srv.currentConfig()
+		cfg.Quota.DailyFilms = limit
+		srv.config.Store(&cfg)
+	}
+}
+
+// expectFilmsCreatedToday expects the count of the daily film quota
+func expectFilmsCreatedToday(mock sqlmock.Sqlmock, user User, count int64) {
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "films" WHERE \(created_by = \$1 AND created_at >= \$2\) AND "films"."organization_id" = \$3`).
+		WithArgs(user.ID, fixtureTime.Truncate(24*time.Hour), fixtureOrganization.ID).WillReturnRows(countRows(count))
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Feature flags consulted by the handlers
+const (
+	FlagLending       = "enable_lending"
+	FlagScreenings    = "enable_screenings"
+	FlagSharedLists   = "enable_shared_lists"
+	FlagPasswordReset = "enable_password_reset"
+)
+
+// flagDefinition describes a feature flag and its value until an admin toggles it
+type flagDefinition struct {
+	description string
+	enabled     bool
+}
+
+// knownFlags are the flags admins can toggle
+var knownFlags = map[string]flagDefinition{
+	FlagLending:       {"Lend film copies and show who has them", true},
+	FlagScreenings:    {"Schedule screenings and reserve seats", true},
+	FlagSharedLists:   {"Open shared film lists without logging in", true},
+	FlagPasswordReset: {"Reset forgotten passwords by email", true},
+}
+
+// FlagService keeps the feature flags in memory, so handlers check them
+// without a query. Toggled flags are stored in the database; Reload picks up
+// the ones toggled on other instances.
+type FlagService struct {
+	db    *gorm.DB
+	mu    sync.RWMutex
+	flags map[string]FeatureFlag
+}
+
+// NewFlagService creates a flag service with every flag at its default
+func NewFlagService(db *gorm.DB) *FlagService {
+	fs := &FlagService{db: db}
+	fs.flags = fs.merge(nil)
+	return fs
+}
+
+// merge returns the known flags, with the stored values of toggled ones
+func (fs *FlagService) merge(stored []FeatureFlag) map[string]FeatureFlag {
+	flags := make(map[string]FeatureFlag, len(knownFlags))
+	for name, definition := range knownFlags {
+		flags[name] = FeatureFlag{Name: name, Enabled: definition.enabled}
+	}
+	for _, flag := range stored {
+		if _, ok := flags[flag.Name]; ok {
+			flags[flag.Name] = flag
+		}
+	}
+	for name, flag := range flags {
+		flag.Description = knownFlags[name].description
+		flag.Default = knownFlags[name].enabled
+		flags[name] = flag
+	}
+	return flags
+}
+
+// Reload loads the toggled flags from the database
+func (fs *FlagService) Reload() error {
+	var stored []FeatureFlag
+	if err := fs.db.Find(&stored).Error; err != nil {
+		return err
+	}
+	flags := fs.merge(stored)
+
+	fs.mu.Lock()
+	fs.flags = flags
+	fs.mu.Unlock()
+	return nil
+}
+
+// Enabled reports whether a feature is on
+func (fs *FlagService) Enabled(name string) bool {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.flags[name].Enabled
+}
+
+// GetFlags returns every flag, ordered by name
+func (fs *FlagService) GetFlags() []FeatureFlag {
+	fs.mu.RLock()
+	flags := make([]FeatureFlag, 0, len(fs.flags))
+	for _, flag := range fs.flags {
+		flags = append(flags, flag)
+	}
+	fs.mu.RUnlock()
+
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
+
+// GetFlag returns a flag by name
+func (fs *FlagService) GetFlag(name string) (*FeatureFlag, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	flag, ok := fs.flags[name]
+	if !ok {
+		return nil, errors.New("flag not found")
+	}
+	return &flag, nil
+}
+
+// SetFlag turns a feature on or off for every instance
+func (fs *FlagService) SetFlag(name string, enabled bool, username string) (*FeatureFlag, error) {
+	if _, ok := knownFlags[name]; !ok {
+		return nil, errors.New("flag not found")
+	}
+
+	now := fs.db.NowFunc()
+	flag := FeatureFlag{Name: name, Enabled: enabled, UpdatedBy: username, UpdatedAt: &now}
+	err := fs.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_by", "updated_at"}),
+	}).Create(&flag).Error
+	if err != nil {
+		return nil, err
+	}
+	flag.Description = knownFlags[name].description
+	flag.Default = knownFlags[name].enabled
+
+	fs.mu.Lock()
+	fs.flags[name] = flag
+	fs.mu.Unlock()
+	return &flag, nil
+}
+
+// requireFlag answers 404 while a feature is off, as if it didn't exist
+func (s *Server) requireFlag(name string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !s.flagService.Enabled(name) {
+				writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "This feature is turned off", Code: "feature_disabled"})
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// flagsHandler lists, shows, and toggles feature flags (admin only)
+func (s *Server) flagsHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/flags"), "/")
+
+	if name == "" {
+		if r.Method != "GET" {
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+			return
+		}
+		writeResponse(w, r, http.StatusOK, s.flagService.GetFlags())
+		return
+	}
+
+	var flag *FeatureFlag
+	var err error
+	switch r.Method {
+	case "GET":
+		flag, err = s.flagService.GetFlag(name)
+	case "PUT":
+		var flagReq FeatureFlagRequest
+		if err := json.NewDecoder(r.Body).Decode(&flagReq); err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+			return
+		}
+		if flagReq.Enabled == nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "enabled is required", Code: "flag_enabled_required"})
+			return
+		}
+		flag, err = s.flagService.SetFlag(name, *flagReq.Enabled, currentUsername(r))
+		if err == nil {
+			log.Printf("⚠️  Feature flag %s %s by %s", name, map[bool]string{true: "enabled", false: "disabled"}[flag.Enabled], currentUsername(r))
+		}
+	default:
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	if err != nil {
+		if err.Error() == "flag not found" {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Feature flag not found", Code: "flag_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update feature flag", Code: "flag_update_failed"})
+		}
+		return
+	}
+	writeResponse(w, r, http.StatusOK, flag)
+}
@@ -0,0 +1,2656 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// update rewrites the golden files from the current responses:
+//
+//	go test ./... -run TestGolden -update
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// goldenHeaders are the response headers recorded in golden files
+var goldenHeaders = []string{"Content-Type", "Content-Disposition", "ETag", "Location", "Retry-After", "Content-Language", "Allow", "Access-Control-Allow-Methods", "Access-Control-Max-Age", "Preference-Applied"}
+
+// goldenResponse is the recorded form of a response
+type goldenResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// scrub replaces the string values of keys that change between runs
+func scrub(body []byte, keys []string) []byte {
+	for _, key := range keys {
+		pattern := regexp.MustCompile(`"` + regexp.QuoteMeta(key) + `":("[^"]*"|[-+.eE0-9]+)`)
+		body = pattern.ReplaceAll(body, []byte(`"`+key+`":"SCRUBBED"`))
+	}
+	return body
+}
+
+// assertGolden compares a response to testdata/golden/<name>.json. Bodies
+// keep their field order, so reordering fields shows up as a diff too.
+func assertGolden(t *testing.T, name string, rec *httptest.ResponseRecorder, scrubKeys []string) {
+	t.Helper()
+
+	recorded := goldenResponse{Status: rec.Code, Headers: make(map[string]string)}
+	for _, header := range goldenHeaders {
+		if value := rec.Header().Get(header); value != "" {
+			recorded.Headers[header] = value
+		}
+	}
+	if body := bytes.TrimSpace(rec.Body.Bytes()); len(body) > 0 {
+		body = scrub(body, scrubKeys)
+		if !json.Valid(body) {
+			// Files and other non-JSON bodies are recorded as a string
+			body, _ = json.Marshal(string(body))
+		}
+		recorded.Body = body
+	}
+
+	got, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to encode response: %v", err)
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("missing golden file, run with -update to create it: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("response differs from %s, run with -update if the change is intended\n--- want\n%s\n--- got\n%s", path, want, got)
+	}
+}
+
+// goldenCase is one request and the queries it runs
+type goldenCase struct {
+	name   string
+	method string
+	path   string
+	token  string
+	accept string
+	body   string
+	// header holds further request headers
+	header map[string]string
+	// expect registers the queries the request runs, in order
+	expect func(mock sqlmock.Sqlmock)
+	// setup prepares server state other than the database, if any
+	setup func(srv *Server)
+	// scrub lists response fields that change between runs
+	scrub []string
+	// verify checks server state after the request, if any
+	verify func(t *testing.T, srv *Server)
+}
+
+func runGoldenCases(t *testing.T, cases []goldenCase) {
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, mock := newFixtureServer(t)
+			if tc.setup != nil {
+				tc.setup(srv)
+			}
+			if tc.expect != nil {
+				tc.expect(mock)
+			}
+
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			for name, value := range tc.header {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, req)
+
+			assertGolden(t, tc.name, rec, tc.scrub)
+			if tc.verify != nil {
+				tc.verify(t, srv)
+			}
+		})
+	}
+}
+
+func TestGoldenAuth(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "login", method: "POST", path: "/api/login",
+			body: `{"username":"admin","password":"admin123"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLogin(mock, fixtureAdmin)
+			},
+			scrub: []string{"token"},
+		},
+		{
+			name: "login_invalid_credentials", method: "POST", path: "/api/login",
+			body: `{"username":"admin","password":"wrong"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "login_deactivated", method: "POST", path: "/api/login",
+			body: `{"username":"user1","password":"password123"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				user := fixtureUser
+				user.Active = false
+				expectUser(mock, user)
+			},
+		},
+		{
+			// Deactivated between the password check and issuing the token
+			name: "login_deactivated_meanwhile", method: "POST", path: "/api/login",
+			body: `{"username":"user1","password":"password123"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE "organizations"."id" = \$1`).WillReturnRows(organizationRows(fixtureOrganization))
+				user := fixtureUser
+				user.Active = false
+				expectUser(mock, user)
+			},
+		},
+		{
+			name: "login_banned", method: "POST", path: "/api/login",
+			body:  `{"username":"admin","password":"admin123"}`,
+			setup: banTestClient,
+		},
+		{
+			name: "login_delayed", method: "POST", path: "/api/login",
+			body: `{"username":"admin","password":"admin123"}`,
+			setup: func(srv *Server) {
+				failTestLogins(srv, "admin", srv.cfg.Auth.LoginGuard.DelayAfter+1)
+			},
+		},
+		{
+			// An attempt in flight reserves the delay its failure would earn,
+			// so a concurrent one is turned away
+			name: "login_delayed_concurrent", method: "POST", path: "/api/login",
+			body: `{"username":"admin","password":"admin123"}`,
+			setup: func(srv *Server) {
+				failTestLogins(srv, "admin", srv.cfg.Auth.LoginGuard.DelayAfter-1)
+				srv.loginGuard.Attempt("192.0.2.1", "admin", srv.cfg.Auth.LoginGuard)
+			},
+		},
+		{
+			name: "login_delay_over", method: "POST", path: "/api/login",
+			body: `{"username":"admin","password":"admin123"}`,
+			setup: func(srv *Server) {
+				failTestLogins(srv, "admin", srv.cfg.Auth.LoginGuard.DelayAfter)
+				srv.loginGuard.now = func() time.Time { return fixtureTime.Add(time.Second) }
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLogin(mock, fixtureAdmin)
+			},
+			scrub: []string{"token"},
+		},
+		{
+			name: "login_banned_allowlisted", method: "POST", path: "/api/login",
+			body: `{"username":"admin","password":"admin123"}`,
+			setup: func(srv *Server) {
+				banTestClient(srv)
+				srv.cfg.Auth.LoginGuard.Allowlist = []string{"192.0.2.0/24"}
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLogin(mock, fixtureAdmin)
+			},
+			scrub: []string{"token"},
+		},
+		{
+			// Behind a trusted proxy the client is the last address it forwarded
+			name: "login_banned_behind_proxy", method: "POST", path: "/api/login",
+			body:   `{"username":"admin","password":"admin123"}`,
+			header: map[string]string{"X-Forwarded-For": "203.0.113.9, 198.51.100.7"},
+			setup: func(srv *Server) {
+				srv.cfg.Proxy.Trusted = []string{"192.0.2.0/24"}
+				banTestIP(srv, "198.51.100.7")
+			},
+		},
+		{
+			// Without a trusted proxy X-Forwarded-For is the client's word and ignored
+			name: "login_forwarded_for_untrusted", method: "POST", path: "/api/login",
+			body:   `{"username":"admin","password":"admin123"}`,
+			header: map[string]string{"X-Forwarded-For": "198.51.100.7"},
+			setup: func(srv *Server) {
+				banTestIP(srv, "198.51.100.7")
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLogin(mock, fixtureAdmin)
+			},
+			scrub: []string{"token"},
+		},
+		{
+			name: "login_missing_fields", method: "POST", path: "/api/login",
+			body: `{"username":"admin"}`,
+		},
+		{
+			name: "logout", method: "POST", path: "/api/logout", token: fixtureUserToken,
+		},
+		{
+			name: "missing_token", method: "GET", path: "/api/films",
+		},
+		{
+			name: "invalid_token", method: "GET", path: "/api/films", token: "expired",
+		},
+		{
+			name: "admin_required", method: "GET", path: "/api/admin/stats", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+			},
+		},
+	})
+}
+
+func TestGoldenTokens(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "login_scoped", method: "POST", path: "/api/login",
+			body: `{"username":"user1","password":"password123","scopes":["films:read","films:read"]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectLogin(mock, fixtureUser)
+			},
+			scrub: []string{"token"},
+		},
+		{
+			name: "tokens_purge", method: "POST", path: "/api/admin/tokens/purge", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+			verify: func(t *testing.T, srv *Server) {
+				if active := srv.tokenStore.CountActive(); active != 0 {
+					t.Errorf("%d tokens left after the purge", active)
+				}
+			},
+		},
+		{
+			// Tokens of every organization go, so an organization's own
+			// admins can't purge them
+			name: "tokens_purge_organization_admin", method: "POST", path: "/api/admin/tokens/purge", token: "film-club-admin-token",
+			setup: func(srv *Server) {
+				srv.tokenStore.AddToken("film-club-admin-token", fixtureAdmin.Username, Tenant{OrganizationID: 2, Slug: "film-club"}, []string{scopeUsersAdmin})
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+			verify: func(t *testing.T, srv *Server) {
+				if !srv.tokenStore.ValidateToken(fixtureUserToken) {
+					t.Error("rejected purge revoked tokens")
+				}
+			},
+		},
+		{
+			name: "login_unknown_scope", method: "POST", path: "/api/login",
+			body: `{"username":"admin","password":"admin123","scopes":["films:delete"]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE "organizations"."id" = \$1`).WillReturnRows(organizationRows(fixtureOrganization))
+			},
+		},
+		{
+			name: "login_scope_not_allowed", method: "POST", path: "/api/login",
+			body: `{"username":"user1","password":"password123","scopes":["users:admin"]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE "organizations"."id" = \$1`).WillReturnRows(organizationRows(fixtureOrganization))
+			},
+		},
+		{
+			name: "scope_films_read", method: "GET", path: "/api/films/1", token: fixtureReaderToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[0]))
+			},
+		},
+		{
+			name: "scope_films_write_missing", method: "POST", path: "/api/films", token: fixtureReaderToken,
+			body: `{"title":"Heat","director":"Michael Mann","year":1995,"genre":"Crime"}`,
+		},
+		{
+			name: "scope_account_write_missing", method: "PUT", path: "/api/me", token: fixtureReaderToken,
+			body: `{"email":"someone@example.com"}`,
+		},
+		{
+			name: "scope_account_write_missing_delete", method: "DELETE", path: "/api/me", token: fixtureReaderToken,
+		},
+		{
+			// Reading the user's own data takes no scope
+			name: "scope_account_read", method: "GET", path: "/api/me/sessions", token: fixtureReaderToken,
+			header: map[string]string{"User-Agent": "golden-test"},
+			scrub:  []string{"created_at", "last_used_at", "expires_at"},
+		},
+		{
+			name: "scope_users_admin_missing", method: "GET", path: "/api/admin/stats", token: fixtureReaderToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "logout_all", method: "POST", path: "/api/logout/all", token: fixtureAdminToken,
+		},
+		{
+			name: "sessions_list", method: "GET", path: "/api/me/sessions", token: fixtureUserToken,
+			header: map[string]string{"User-Agent": "golden-test"},
+			scrub:  []string{"created_at", "last_used_at", "expires_at"},
+		},
+		{
+			name: "sessions_revoke", method: "DELETE", path: "/api/me/sessions/" + sessionID(fixtureReaderToken), token: fixtureAdminToken,
+		},
+		{
+			name: "sessions_revoke_other_user", method: "DELETE", path: "/api/me/sessions/" + sessionID(fixtureReaderToken), token: fixtureUserToken,
+		},
+		{
+			name: "introspect_active", method: "POST", path: "/api/token/introspect", token: fixtureUserToken,
+			body:  `{"token":"fixture-reader-token"}`,
+			scrub: []string{"exp"},
+		},
+		{
+			name: "introspect_inactive", method: "POST", path: "/api/token/introspect", token: fixtureUserToken,
+			body: `{"token":"expired"}`,
+		},
+		{
+			name: "introspect_token_required", method: "POST", path: "/api/token/introspect", token: fixtureUserToken,
+			body: `{}`,
+		},
+	})
+}
+
+func TestGoldenFilms(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "films_list", method: "GET", path: "/api/films", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."organization_id" = \$1 AND "films"."deleted_at" IS NULL`).
+					WillReturnRows(filmRows(fixtureFilms...))
+			},
+		},
+		{
+			name: "films_page", method: "GET", path: "/api/films?page=1&page_size=2", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+				mock.ExpectQuery(`SELECT \* FROM "films" .* ORDER BY id LIMIT \d+`).
+					WillReturnRows(filmRows(fixtureFilms[:2]...))
+			},
+		},
+		{
+			name: "films_cursor", method: "GET", path: "/api/films?cursor=&page_size=2", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" .* ORDER BY id LIMIT \d+`).
+					WillReturnRows(filmRows(fixtureFilms...))
+			},
+		},
+		{
+			name: "films_page_middle", method: "GET", path: "/api/films?page=2&page_size=1", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+				mock.ExpectQuery(`SELECT \* FROM "films" .* ORDER BY id LIMIT \d+ OFFSET \d+`).
+					WillReturnRows(filmRows(fixtureFilms[1]))
+			},
+		},
+		{
+			name: "films_query", method: "GET", path: "/api/films?q=" + url.QueryEscape(`year>=1990 AND genre:drama director~"darabont"`), token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."organization_id" = \$1 AND \(\(\(year >= \$2 AND lower\(genre\) = lower\(\$3\)\) AND director ILIKE \$4\)\) AND "films"."deleted_at" IS NULL`).
+					WithArgs(fixtureTenant.OrganizationID, 1990, "drama", "%darabont%").
+					WillReturnRows(filmRows(fixtureFilms[0]))
+			},
+		},
+		{
+			name: "films_query_page", method: "GET", path: "/api/films?page=1&page_size=1&q=" + url.QueryEscape("genre:Drama OR genre:Crime"), token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films" WHERE "films"."organization_id" = \$1 AND \(+lower\(genre\) = lower\(\$2\) OR lower\(genre\) = lower\(\$3\)\)+`).
+					WithArgs(fixtureTenant.OrganizationID, "Drama", "Crime").
+					WillReturnRows(countRows(2))
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."organization_id" = \$1 AND \(+lower\(genre\) = lower\(\$2\) OR lower\(genre\) = lower\(\$3\)\)+ .* ORDER BY id LIMIT \d+`).
+					WithArgs(fixtureTenant.OrganizationID, "Drama", "Crime").
+					WillReturnRows(filmRows(fixtureFilms[0]))
+			},
+		},
+		{
+			name: "films_query_invalid", method: "GET", path: "/api/films?q=" + url.QueryEscape("rating>4"), token: fixtureUserToken,
+		},
+		{
+			name: "films_stream", method: "GET", path: "/api/films/stream", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."organization_id" = \$1 AND "films"."deleted_at" IS NULL ORDER BY id`).
+					WithArgs(fixtureTenant.OrganizationID).
+					WillReturnRows(filmRows(fixtureFilms...))
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_stream_query", method: "GET", path: "/api/films/stream?q=" + url.QueryEscape("genre:Crime"), token: fixtureUserToken,
+			// Streams aren't JSON documents, so they pass the envelope as they are
+			header: map[string]string{"API-Version": "2"},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."organization_id" = \$1 AND lower\(genre\) = lower\(\$2\) AND "films"."deleted_at" IS NULL ORDER BY id`).
+					WithArgs(fixtureTenant.OrganizationID, "Crime").
+					WillReturnRows(filmRows(fixtureFilms[1]))
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_stream_query_invalid", method: "GET", path: "/api/films/stream?q=" + url.QueryEscape("rating>4"), token: fixtureUserToken,
+		},
+		{
+			name: "films_stream_failed", method: "GET", path: "/api/films/stream", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films"`).WillReturnError(errors.New("connection reset"))
+			},
+		},
+		{
+			name: "films_changes", method: "GET", path: "/api/films/changes?since=2025-01-08T00:00:00Z&limit=2", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				godfather, spirited := fixtureFilms[1], fixtureFilms[2]
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE COALESCE\(deleted_at, updated_at\) <= \$1 AND \(COALESCE\(deleted_at, updated_at\), id\) > \(\$2, \$3\) AND "films"."organization_id" = \$4 ORDER BY COALESCE\(deleted_at, updated_at\), id LIMIT 3`).
+					WithArgs(fixtureTime.Add(-syncSettleTime), time.Date(2025, time.January, 8, 0, 0, 0, 0, time.UTC), 0, fixtureTenant.OrganizationID).
+					WillReturnRows(sqlmock.NewRows(filmColumns).
+						AddRow(4, "Solaris", "Andrei Tarkovsky", 1972, "Sci-Fi", nil, 2, 2, fixtureTime.AddDate(0, 0, -5), fixtureTime.AddDate(0, 0, -5), fixtureTime.AddDate(0, 0, -3)).
+						AddRow(godfather.ID, godfather.Title, godfather.Director, godfather.Year, godfather.Genre, nil, godfather.Version, 2, godfather.CreatedAt, godfather.UpdatedAt, nil).
+						AddRow(spirited.ID, spirited.Title, spirited.Director, spirited.Year, spirited.Genre, nil, spirited.Version, 2, spirited.CreatedAt, spirited.UpdatedAt, nil))
+			},
+		},
+		{
+			name: "films_changes_expired", method: "GET", path: "/api/films/changes?since=2024-06-01T00:00:00Z", token: fixtureUserToken,
+		},
+		{
+			name: "films_changes_invalid_since", method: "GET", path: "/api/films/changes?since=yesterday", token: fixtureUserToken,
+		},
+		{
+			name: "films_lookup", method: "GET", path: "/api/films?ids=3,1,99,1", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE id IN \(\$1,\$2,\$3,\$4\) AND "films"."organization_id" = \$5 AND "films"."deleted_at" IS NULL`).
+					WithArgs(3, 1, 99, 1, fixtureTenant.OrganizationID).
+					WillReturnRows(filmRows(fixtureFilms[0], fixtureFilms[2]))
+			},
+		},
+		{
+			name: "films_lookup_post", method: "POST", path: "/api/films/lookup", token: fixtureUserToken,
+			body: `{"ids":[2,7]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE id IN \(\$1,\$2\) AND "films"."organization_id" = \$3 AND "films"."deleted_at" IS NULL`).
+					WithArgs(2, 7, fixtureTenant.OrganizationID).
+					WillReturnRows(filmRows(fixtureFilms[1]))
+			},
+		},
+		{
+			name: "films_lookup_invalid_ids", method: "GET", path: "/api/films?ids=1,two", token: fixtureUserToken,
+		},
+		{
+			name: "films_lookup_with_query", method: "GET", path: "/api/films?ids=1&page=1", token: fixtureUserToken,
+		},
+		{
+			name: "films_search", method: "GET", path: "/api/films/search?q=" + url.QueryEscape("Shawshenk Redemtion"), token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`SELECT set_config\('pg_trgm.word_similarity_threshold', \$1, true\)`).
+					WithArgs("0.3").WillReturnResult(sqlmock.NewResult(0, 1))
+				film := fixtureFilms[0]
+				mock.ExpectQuery(`SELECT films\.\*, GREATEST\(word_similarity\(\$1, title\), word_similarity\(\$2, director\)\) AS score FROM "films" WHERE \(\$3 <% title OR \$4 <% director\) AND "films"."organization_id" = \$5 AND "films"."deleted_at" IS NULL ORDER BY score DESC, id LIMIT \d+`).
+					WithArgs("Shawshenk Redemtion", "Shawshenk Redemtion", "Shawshenk Redemtion", "Shawshenk Redemtion", fixtureTenant.OrganizationID).
+					WillReturnRows(sqlmock.NewRows(append(filmColumns, "score")).
+						AddRow(film.ID, film.Title, film.Director, film.Year, film.Genre, *film.ExternalID, film.Version, nil, film.CreatedAt, film.UpdatedAt, nil, 0.6))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "films_search_missing_term", method: "GET", path: "/api/films/search?q=", token: fixtureUserToken,
+		},
+		{
+			name: "films_suggest", method: "GET", path: "/api/films/suggest?q=Fra&limit=3", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT "title" FROM "films" WHERE \(lower\(title\) LIKE \$1 OR title ILIKE \$2\) AND "films"."organization_id" = \$3 AND "films"."deleted_at" IS NULL GROUP BY "title" ORDER BY lower\(title\) LIKE \$4 DESC, length\(title\), title LIMIT 3`).
+					WithArgs("fra%", "% fra%", fixtureTenant.OrganizationID, "fra%").
+					WillReturnRows(sqlmock.NewRows([]string{"title"}).AddRow("Frankenstein").AddRow("The Fragile Ones"))
+				mock.ExpectQuery(`SELECT "director" FROM "films" WHERE \(lower\(director\) LIKE \$1 OR director ILIKE \$2\) AND "films"."organization_id" = \$3 AND "films"."deleted_at" IS NULL GROUP BY "director" ORDER BY lower\(director\) LIKE \$4 DESC, length\(director\), director LIMIT 3`).
+					WithArgs("fra%", "% fra%", fixtureTenant.OrganizationID, "fra%").
+					WillReturnRows(sqlmock.NewRows([]string{"director"}).AddRow("Frank Darabont").AddRow("Francis Ford Coppola"))
+			},
+		},
+		{
+			name: "films_suggest_invalid_limit", method: "GET", path: "/api/films/suggest?q=sha&limit=100", token: fixtureUserToken,
+		},
+		{
+			name: "films_get_include_collection", method: "GET", path: "/api/films/1?include=collection", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[0]))
+				mock.ExpectQuery(`SELECT collection_films\.film_id, collections\.id, collections\.name, collection_films\.position FROM "collection_films" JOIN collections ON collections\.id = collection_films\.collection_id WHERE collection_films\.film_id IN \(\$1\)`).
+					WillReturnRows(sqlmock.NewRows([]string{"film_id", "id", "name", "position"}).AddRow(1, 1, "Prison Dramas", 1))
+			},
+		},
+		{
+			name: "films_get_include_views", method: "GET", path: "/api/films/1?include=views", token: fixtureUserToken,
+			// Views counted since the last flush are added to the stored totals
+			setup: func(srv *Server) { srv.viewCounter.Record(1) },
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[0]))
+				mock.ExpectQuery(`SELECT film_id, sum\(views\) AS views FROM "film_views" WHERE film_id IN \(\$1\) GROUP BY "film_id"`).
+					WillReturnRows(sqlmock.NewRows([]string{"film_id", "views"}).AddRow(1, 40))
+			},
+		},
+		{
+			name: "films_most_viewed", method: "GET", path: "/api/films/most-viewed?days=7&limit=2", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT films\.id AS film_id, sum\(film_views\.views\) AS views FROM "films" JOIN film_views ON film_views\.film_id = films\.id WHERE film_views\.day >= \$1 AND "films"."organization_id" = \$2 AND "films"."deleted_at" IS NULL GROUP BY "films"."id" ORDER BY views DESC, films\.id LIMIT \d+`).
+					WillReturnRows(sqlmock.NewRows([]string{"film_id", "views"}).AddRow(2, 120).AddRow(1, 75))
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE id IN \(\$1,\$2\)`).WillReturnRows(filmRows(fixtureFilms[0], fixtureFilms[1]))
+			},
+		},
+		{
+			name: "films_most_viewed_invalid_days", method: "GET", path: "/api/films/most-viewed?days=0", token: fixtureUserToken,
+		},
+		{
+			name: "films_trending", method: "GET", path: "/api/films/trending?limit=1", token: fixtureUserToken,
+			setup: func(srv *Server) {
+				srv.trendingService.rankings = map[uint][]TrendingFilm{
+					fixtureTenant.OrganizationID:     {{Film: fixtureFilms[1], Score: 42.5, Rank: 1}, {Film: fixtureFilms[0], Score: 7.25, Rank: 2}},
+					fixtureTenant.OrganizationID + 1: {{Film: fixtureFilms[2], Score: 90, Rank: 1}},
+				}
+				srv.trendingService.computedAt = time.Now()
+			},
+			scrub: []string{"computed_at"},
+		},
+		{
+			// An old ranking is served as is; recomputing is left to the trending job
+			name: "films_trending_stale", method: "GET", path: "/api/films/trending", token: fixtureUserToken,
+			setup: func(srv *Server) {
+				srv.trendingService.rankings = map[uint][]TrendingFilm{fixtureTenant.OrganizationID: {{Film: fixtureFilms[0], Score: 3, Rank: 1}}}
+				srv.trendingService.computedAt = fixtureTime
+			},
+		},
+		{
+			name: "films_trending_computed", method: "GET", path: "/api/films/trending", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM \(SELECT films\.\*, sum\(signals\.score\) AS score, row_number\(\) OVER \(PARTITION BY films\.organization_id ORDER BY sum\(signals\.score\) DESC, films\.id\) AS rank FROM \(SELECT film_id, .+ FROM film_views WHERE day >= \$4 UNION ALL SELECT film_id, .+ FROM loans WHERE borrowed_at >= \$8\) AS signals JOIN films ON films\.id = signals\.film_id AND films\.deleted_at IS NULL GROUP BY films\.id\) AS ranked WHERE rank <= \$9 ORDER BY organization_id, rank`).
+					WillReturnRows(sqlmock.NewRows(append(filmColumns, "organization_id", "score", "rank")).
+						AddRow(2, "The Godfather", "Francis Ford Coppola", 1972, "Crime", nil, 3, 2, fixtureTime, fixtureTime, nil, fixtureTenant.OrganizationID, 12.5, 1))
+			},
+			scrub: []string{"computed_at"},
+		},
+		{
+			name: "films_include_invalid", method: "GET", path: "/api/films?include=director", token: fixtureUserToken,
+		},
+		{
+			name: "films_similar", method: "GET", path: "/api/films/2/similar?limit=5", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[1]))
+				sequel := Film{ID: 4, Title: "The Godfather Part II", Director: "Francis Ford Coppola", Year: 1974, Genre: "Crime", Version: 1, CreatedAt: fixtureTime, UpdatedAt: fixtureTime}
+				mock.ExpectQuery(`SELECT films\.\*, CASE WHEN lower\(director\) = lower\(\$1\) THEN 3 ELSE 0 END \+ CASE WHEN lower\(genre\) = lower\(\$2\) AND genre <> '' THEN 2 ELSE 0 END \+ CASE WHEN year / 10 = \$3 THEN 1 ELSE 0 END AS score FROM "films" WHERE id <> \$4 AND \(\(lower\(director\) = lower\(\$5\) OR \(lower\(genre\) = lower\(\$6\) AND genre <> ''\) OR year / 10 = \$7\)\) AND "films"."organization_id" = \$8 AND "films"."deleted_at" IS NULL ORDER BY score DESC, abs\(year - \$9\), id LIMIT \d+`).
+					WithArgs("Francis Ford Coppola", "Crime", 197, 2, "Francis Ford Coppola", "Crime", 197, fixtureTenant.OrganizationID, 1972).
+					WillReturnRows(sqlmock.NewRows(append(filmColumns, "score")).
+						AddRow(sequel.ID, sequel.Title, sequel.Director, sequel.Year, sequel.Genre, nil, sequel.Version, nil, sequel.CreatedAt, sequel.UpdatedAt, nil, 6))
+			},
+		},
+		{
+			name: "films_similar_not_found", method: "GET", path: "/api/films/99/similar", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+			},
+		},
+		{
+			name: "films_get", method: "GET", path: "/api/films/2", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[1]))
+			},
+		},
+		{
+			name: "films_get_not_found", method: "GET", path: "/api/films/99", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+			},
+		},
+		{
+			name: "films_get_xml", method: "GET", path: "/api/films/1", token: fixtureUserToken, accept: "application/xml",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[0]))
+			},
+		},
+		{
+			name: "films_get_not_found_xml", method: "GET", path: "/api/films/99", token: fixtureUserToken, accept: "application/xml",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+			},
+		},
+		{
+			name: "films_page_xml", method: "GET", path: "/api/films?page=2&page_size=1", token: fixtureUserToken, accept: "text/html, application/xml;q=0.9",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+				mock.ExpectQuery(`SELECT \* FROM "films" .* ORDER BY id LIMIT \d+ OFFSET \d+`).
+					WillReturnRows(filmRows(fixtureFilms[1]))
+			},
+		},
+		{
+			name: "films_list_yaml", method: "GET", path: "/api/films", token: fixtureUserToken, accept: "application/yaml",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."organization_id" = \$1 AND "films"."deleted_at" IS NULL`).
+					WillReturnRows(filmRows(fixtureFilms[:2]...))
+			},
+		},
+		{
+			name: "films_invalid_page_yaml", method: "GET", path: "/api/films?page=0", token: fixtureUserToken, accept: "application/yaml",
+		},
+		{
+			name: "films_unsupported_accept", method: "GET", path: "/api/films/1", token: fixtureUserToken, accept: "text/csv",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[0]))
+			},
+		},
+		{
+			name: "films_invalid_page", method: "GET", path: "/api/films?page=0", token: fixtureUserToken,
+		},
+		{
+			name: "films_create", method: "POST", path: "/api/films", token: fixtureUserToken,
+			body: `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				expectDuplicateLookup(mock)
+				expectTenantPlan(mock, fixtureOrganization)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "films"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(4, 1))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_create_plan_limit", method: "POST", path: "/api/films", token: fixtureUserToken,
+			body: `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				limited := fixtureOrganization
+				limited.Plan = "free"
+				limited.MaxFilms = new(int64)
+				*limited.MaxFilms = 3
+				expectUser(mock, fixtureUser)
+				expectDuplicateLookup(mock)
+				expectTenantPlan(mock, limited)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+			},
+		},
+		{
+			name: "films_create_daily_quota", method: "POST", path: "/api/films", token: fixtureUserToken,
+			body:  `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			setup: withDailyFilmQuota(2),
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				expectDuplicateLookup(mock)
+				expectTenantPlan(mock, fixtureOrganization)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+				expectFilmsCreatedToday(mock, fixtureUser, 2)
+			},
+		},
+		{
+			// Retry-After rounds up, so a client retrying on time finds the
+			// quota reset
+			name: "films_create_daily_quota_subsecond", method: "POST", path: "/api/films", token: fixtureUserToken,
+			body: `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			setup: func(srv *Server) {
+				withDailyFilmQuota(2)(srv)
+				srv.db.Config.NowFunc = func() time.Time { return fixtureTime.Add(500 * time.Millisecond) }
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				expectDuplicateLookup(mock)
+				expectTenantPlan(mock, fixtureOrganization)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+				expectFilmsCreatedToday(mock, fixtureUser, 2)
+			},
+		},
+		{
+			name: "films_create_invalid", method: "POST", path: "/api/films", token: fixtureUserToken,
+			body: `{"title":"","director":"","year":2019,"genre":"Thriller"}`,
+		},
+		{
+			name: "films_create_metadata", method: "POST", path: "/api/films", token: fixtureUserToken,
+			body: `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller","runtime_minutes":132,"synopsis":" A poor family schemes to become employed by a wealthy one. ","language":"kor","country":"kr","age_rating":"r","imdb_id":"TT6751668"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				expectDuplicateLookup(mock)
+				expectTenantPlan(mock, fixtureOrganization)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "films"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(4, 1))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_create_metadata_invalid", method: "POST", path: "/api/films", token: fixtureUserToken,
+			body: `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller","runtime_minutes":-5,"language":"xx","country":"EU","age_rating":"TV-MA","imdb_id":"6751668"}`,
+		},
+		{
+			name: "films_create_links", method: "POST", path: "/api/films", token: fixtureUserToken,
+			body: `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller","trailer_url":"https://www.youtube.com/watch?v=5xH0HfJHsaY","external_links":[{"label":" Wikipedia ","url":"https://en.wikipedia.org/wiki/Parasite_(2019_film)"}]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				expectDuplicateLookup(mock)
+				expectTenantPlan(mock, fixtureOrganization)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "films"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(4, 1))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_create_links_invalid", method: "POST", path: "/api/films", token: fixtureUserToken,
+			body: `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller","trailer_url":"https://trailers.example.com/parasite.mp4","external_links":[{"label":"Home","url":"javascript:alert(1)"},{"label":"","url":"http://example.com/parasite"},{"label":"Fan site","url":"https://user@example.com/"}]}`,
+		},
+		{
+			name: "films_create_duplicate", method: "POST", path: "/api/films", token: fixtureUserToken,
+			body: `{"title":"the shawshank  redemption","director":"Frank Darabont","year":1994,"genre":"Drama"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				expectDuplicateLookup(mock, fixtureFilms[0])
+			},
+		},
+		{
+			name: "films_update", method: "PUT", path: "/api/films/2", token: fixtureUserToken,
+			body: `{"title":"The Godfather","director":"Francis Ford Coppola","year":1972,"genre":"Drama","version":3}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[1]))
+				expectDuplicateLookup(mock)
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "films" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`INSERT INTO "film_revisions"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_revisions", method: "GET", path: "/api/films/2/revisions", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[1]))
+				mock.ExpectQuery(`SELECT \* FROM "film_revisions" WHERE film_id = \$1 ORDER BY version DESC`).WillReturnRows(revisionRows(fixtureRevisions[1], fixtureRevisions[0]))
+			},
+		},
+		{
+			name: "films_revisions_not_found", method: "GET", path: "/api/films/9/revisions", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+			},
+		},
+		{
+			name: "films_revert", method: "POST", path: "/api/films/2/revisions/2/revert", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[1]))
+				mock.ExpectQuery(`SELECT \* FROM "film_revisions" WHERE film_id = \$1 AND version = \$2`).WillReturnRows(revisionRows(fixtureRevisions[1]))
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[1]))
+				expectDuplicateLookup(mock)
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "films" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`INSERT INTO "film_revisions"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_revert_revision_not_found", method: "POST", path: "/api/films/2/revisions/7/revert", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[1]))
+				mock.ExpectQuery(`SELECT \* FROM "film_revisions" WHERE film_id = \$1 AND version = \$2`).WillReturnRows(revisionRows())
+			},
+		},
+		{
+			name: "films_revert_scope_missing", method: "POST", path: "/api/films/2/revisions/1/revert", token: fixtureReaderToken,
+		},
+		{
+			name: "films_update_version_conflict", method: "PUT", path: "/api/films/2", token: fixtureUserToken,
+			body: `{"title":"The Godfather","director":"Francis Ford Coppola","year":1972,"genre":"Drama","version":2}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[1]))
+			},
+		},
+		{
+			name: "films_update_not_creator", method: "PUT", path: "/api/films/1", token: fixtureUserToken,
+			body: `{"title":"The Shawshank Redemption","director":"Frank Darabont","year":1994,"genre":"Drama"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[0]))
+			},
+		},
+		{
+			name: "films_update_as_admin", method: "PUT", path: "/api/films/2", token: fixtureAdminToken,
+			body: `{"title":"The Godfather","director":"Francis Ford Coppola","year":1972,"genre":"Crime"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[1]))
+				expectDuplicateLookup(mock)
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "films" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`INSERT INTO "film_revisions"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_update_not_found", method: "PUT", path: "/api/films/99", token: fixtureUserToken,
+			body: `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+			},
+		},
+		{
+			name: "films_put_create", method: "PUT", path: "/api/films/10", token: fixtureUserToken,
+			body:   `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			header: map[string]string{"Prefer": "create-if-missing"},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+				expectDuplicateLookup(mock)
+				expectMaxFilmID(mock, 3)
+				expectTenantPlan(mock, fixtureOrganization)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "films"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(10, 1))
+				mock.ExpectExec(`SELECT setval\(pg_get_serial_sequence\('films', 'id'\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_put_create_configured", method: "PUT", path: "/api/films/10", token: fixtureUserToken,
+			body:  `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			setup: enablePutCreatesFilms,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+				expectDuplicateLookup(mock)
+				expectMaxFilmID(mock, 3)
+				expectTenantPlan(mock, fixtureOrganization)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "films"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(10, 1))
+				mock.ExpectExec(`SELECT setval\(pg_get_serial_sequence\('films', 'id'\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_put_create_if_match", method: "PUT", path: "/api/films/10", token: fixtureUserToken,
+			body:   `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			header: map[string]string{"Prefer": "create-if-missing", "If-Match": `"1"`},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+			},
+		},
+		{
+			name: "films_put_create_id_taken", method: "PUT", path: "/api/films/10", token: fixtureUserToken,
+			body:   `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			header: map[string]string{"Prefer": "create-if-missing"},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+				expectDuplicateLookup(mock)
+				expectMaxFilmID(mock, 3)
+				expectTenantPlan(mock, fixtureOrganization)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "films"`).WillReturnError(errors.New(`duplicate key value violates unique constraint "films_pkey"`))
+				mock.ExpectRollback()
+				expectDuplicateLookup(mock)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films" WHERE id = \$1`).WillReturnRows(countRows(1))
+			},
+		},
+		{
+			name: "films_put_create_id_out_of_range", method: "PUT", path: "/api/films/9223372036854775806", token: fixtureUserToken,
+			body:   `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			header: map[string]string{"Prefer": "create-if-missing"},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+				expectDuplicateLookup(mock)
+				expectMaxFilmID(mock, 3)
+			},
+		},
+		{
+			name: "films_delete", method: "DELETE", path: "/api/films/3", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[2]))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "films" SET "deleted_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_delete_not_found", method: "DELETE", path: "/api/films/99", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+			},
+		},
+		{
+			name: "films_delete_method_override", method: "POST", path: "/api/films/3", token: fixtureUserToken,
+			header: map[string]string{"X-HTTP-Method-Override": "delete"},
+			setup:  enableMethodOverride,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[2]))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "films" SET "deleted_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_method_override_invalid", method: "POST", path: "/api/films/3", token: fixtureUserToken,
+			header: map[string]string{"X-HTTP-Method-Override": "GET"},
+			setup:  enableMethodOverride,
+		},
+		{
+			name: "films_method_override_disabled", method: "POST", path: "/api/films/3", token: fixtureUserToken,
+			header: map[string]string{"X-HTTP-Method-Override": "DELETE"},
+		},
+		{
+			name: "films_batch_create", method: "POST", path: "/api/films/batch", token: fixtureUserToken,
+			body: `[{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"},{"title":"The Godfather","director":"Francis Ford Coppola","year":1972,"genre":"Crime"},{"title":"","director":"Nobody","year":2000,"genre":"Drama"}]`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectDuplicateLookup(mock)
+				expectDuplicateLookup(mock, fixtureFilms[1])
+				expectDuplicateLookup(mock)
+				expectUser(mock, fixtureUser)
+				expectTenantPlan(mock, fixtureOrganization)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "films"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(4, 1))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_batch_delete", method: "DELETE", path: "/api/films/batch", token: fixtureUserToken,
+			body: `{"ids":[1,2]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectBegin()
+				// Film 1 isn't theirs, so only film 2 is deleted
+				mock.ExpectQuery(`UPDATE "films" SET "deleted_at"=\$1 WHERE id IN \(\$2,\$3\) AND created_by = \$4`).WillReturnRows(filmRows(fixtureFilms[1]))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "films_batch_delete_without_condition", method: "DELETE", path: "/api/films/batch", token: fixtureUserToken,
+			body: `{}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+			},
+		},
+	})
+}
+
+// Identical listings in flight at once share one query: the mock answers it
+// only once, slowly enough for every request to arrive while it runs, and
+// each of them must still get the films
+func TestGoldenFilmsCoalesced(t *testing.T) {
+	srv, mock := newFixtureServer(t)
+	mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."organization_id" = \$1 AND "films"."deleted_at" IS NULL`).
+		WillDelayFor(200 * time.Millisecond).
+		WillReturnRows(filmRows(fixtureFilms...))
+
+	handler := srv.Handler()
+	recorders := make([]*httptest.ResponseRecorder, 5)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/films", nil)
+		req.Header.Set("Authorization", "Bearer "+fixtureUserToken)
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			<-start
+			handler.ServeHTTP(rec, req)
+		}(recorders[i])
+	}
+	close(start)
+	wg.Wait()
+
+	for _, rec := range recorders {
+		assertGolden(t, "films_list", rec, nil)
+	}
+}
+
+func TestGoldenPosters(t *testing.T) {
+	filmWithPoster := fixtureFilms[1]
+	filmWithPoster.PosterKey = fixturePosterKey
+	filmWithThumbnail := filmWithPoster
+	filmWithThumbnail.PosterSizes = "small"
+	png := map[string]string{"Content-Type": "image/png"}
+
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "posters_put", method: "PUT", path: "/api/films/2/poster", token: fixtureUserToken,
+			body: fixturePoster, header: png,
+			setup: storePoster,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(filmWithPoster))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1 .* FOR UPDATE`).WillReturnRows(filmRows(filmWithPoster))
+				mock.ExpectExec(`UPDATE "films" SET "poster_key"=\$1,"poster_sizes"=\$2,"updated_at"=\$3`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+				expectMeteringEvent(mock)
+			},
+		},
+		{
+			name: "posters_put_invalid_type", method: "PUT", path: "/api/films/2/poster", token: fixtureUserToken,
+			body: `{"poster":"https://example.com/godfather.jpg"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[1]))
+			},
+		},
+		{
+			name: "posters_put_too_large", method: "PUT", path: "/api/films/2/poster", token: fixtureUserToken,
+			body: fixturePoster + strings.Repeat("\x00", maxPosterBytes), header: png,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[1]))
+			},
+		},
+		{
+			name: "posters_put_not_creator", method: "PUT", path: "/api/films/1/poster", token: fixtureUserToken,
+			body: fixturePoster, header: png,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[0]))
+			},
+		},
+		{
+			name: "posters_get", method: "GET", path: "/api/films/2/poster", token: fixtureUserToken,
+			setup: storePoster,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(filmWithPoster))
+			},
+		},
+		{
+			name: "posters_get_small", method: "GET", path: "/api/films/2/poster?size=small", token: fixtureUserToken,
+			setup: storePoster,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(filmWithThumbnail))
+			},
+		},
+		{
+			name: "posters_get_size_pending", method: "GET", path: "/api/films/2/poster?size=medium", token: fixtureUserToken,
+			setup: storePoster,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(filmWithThumbnail))
+			},
+		},
+		{name: "posters_get_invalid_size", method: "GET", path: "/api/films/2/poster?size=huge", token: fixtureUserToken},
+		{
+			name: "posters_get_small_presigned", method: "GET", path: "/api/films/2/poster?size=small", token: fixtureUserToken,
+			setup: useS3Blobs,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(filmWithThumbnail))
+			},
+		},
+		{
+			name: "posters_get_not_modified", method: "GET", path: "/api/films/2/poster", token: fixtureUserToken,
+			header: map[string]string{"If-None-Match": `"5eed0f1e"`},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(filmWithPoster))
+			},
+		},
+		{
+			name: "posters_get_presigned", method: "GET", path: "/api/films/2/poster", token: fixtureUserToken,
+			setup: useS3Blobs,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(filmWithPoster))
+			},
+		},
+		{
+			name: "posters_get_missing", method: "GET", path: "/api/films/3/poster", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[2]))
+			},
+		},
+		{
+			name: "posters_delete", method: "DELETE", path: "/api/films/2/poster", token: fixtureUserToken,
+			setup: storePoster,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1 .* FOR UPDATE`).WillReturnRows(filmRows(filmWithPoster))
+				mock.ExpectExec(`UPDATE "films" SET "poster_key"=\$1,"poster_sizes"=\$2,"updated_at"=\$3`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+			},
+		},
+	})
+}
+
+func TestGoldenAccount(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "me", method: "GET", path: "/api/me", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "me_limits", method: "GET", path: "/api/me/limits", token: fixtureUserToken, setup: withDailyFilmQuota(5),
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				expectFilmsCreatedToday(mock, fixtureUser, 2)
+			},
+		},
+		{
+			name: "me_limits_admin", method: "GET", path: "/api/me/limits", token: fixtureAdminToken, setup: withDailyFilmQuota(5),
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				expectFilmsCreatedToday(mock, fixtureAdmin, 7)
+			},
+		},
+		{
+			name: "me_usage", method: "GET", path: "/api/me/usage?hours=3", token: fixtureUserToken,
+			scrub: []string{"since"},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT endpoint, sum\(requests\) AS requests FROM "api_usages" WHERE username = \$1 AND hour >= \$2 GROUP BY "endpoint" ORDER BY requests DESC, endpoint`).
+					WithArgs("user1", sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"endpoint", "requests"}).AddRow("GET /api/films", 40).AddRow("GET /api/films/{id}", 12))
+				mock.ExpectQuery(`SELECT hour, sum\(requests\) AS requests FROM "api_usages" WHERE username = \$1 AND hour >= \$2 GROUP BY "hour" ORDER BY hour`).
+					WithArgs("user1", sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"hour", "requests"}).AddRow(fixtureTime, 30).AddRow(fixtureTime.Add(time.Hour), 22))
+			},
+		},
+		{
+			name: "me_usage_empty", method: "GET", path: "/api/me/usage", token: fixtureUserToken,
+			scrub: []string{"since"},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT endpoint, sum\(requests\) AS requests FROM "api_usages"`).WillReturnRows(sqlmock.NewRows([]string{"endpoint", "requests"}))
+				mock.ExpectQuery(`SELECT hour, sum\(requests\) AS requests FROM "api_usages"`).WillReturnRows(sqlmock.NewRows([]string{"hour", "requests"}))
+			},
+		},
+		{name: "me_usage_invalid_hours", method: "GET", path: "/api/me/usage?hours=721", token: fixtureUserToken},
+		{
+			name: "me_update", method: "PUT", path: "/api/me", token: fixtureUserToken,
+			body: `{"email":"user1@example.com","display_name":"User One","avatar_url":"https://example.com/avatars/user1.png"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE \(email = \$1 AND id <> \$2\)`).WillReturnRows(countRows(0))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "users" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+				// A new address gets a verification code, or isn't kept
+				mock.ExpectExec(`DELETE FROM "mail_tokens" WHERE username = \$1 AND purpose = \$2`).
+					WithArgs(fixtureUser.Username, mailTokenVerifyEmail).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO "mail_tokens"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`INSERT INTO "outbox_emails"`).WithArgs("user1@example.com", "Confirm your email address", sqlmock.AnyArg(), 0, "", sqlmock.AnyArg(), nil, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "me_update_verification_failed", method: "PUT", path: "/api/me", token: fixtureUserToken,
+			body: `{"email":"user1@example.com","display_name":"User One"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE \(email = \$1 AND id <> \$2\)`).WillReturnRows(countRows(0))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "users" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`DELETE FROM "mail_tokens"`).WillReturnError(errors.New("connection reset"))
+				mock.ExpectRollback()
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE \(email = \$1 AND id <> \$2\)`).WillReturnRows(countRows(0))
+			},
+		},
+		{
+			name: "me_update_email_taken", method: "PUT", path: "/api/me", token: fixtureUserToken,
+			body: `{"email":"admin@example.com"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE \(email = \$1 AND id <> \$2\)`).WillReturnRows(countRows(1))
+			},
+		},
+		{
+			name: "me_delete", method: "DELETE", path: "/api/me", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "loans" WHERE borrower = \$1 AND returned_at IS NULL`).WithArgs("user1").WillReturnRows(countRows(0))
+				mock.ExpectBegin()
+				// Usage, loans, and exports stay for the totals, under a pseudonym
+				mock.ExpectExec(`UPDATE "metering_events" SET "username"=\$1 WHERE username = \$2`).WithArgs("deleted-2", "user1").WillReturnResult(sqlmock.NewResult(0, 4))
+				mock.ExpectExec(`UPDATE "usage_rollups" SET "username"=\$1,"updated_at"=\$2 WHERE username = \$3`).WithArgs("deleted-2", sqlmock.AnyArg(), "user1").WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(`UPDATE "loans" SET "borrower"=\$1 WHERE borrower = \$2`).WithArgs("deleted-2", "user1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE "export_snapshots" SET "created_by"=\$1 WHERE created_by = \$2`).WithArgs("deleted-2", "user1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`SELECT "id" FROM "film_lists" WHERE owner = \$1`).WithArgs("user1").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectExec(`DELETE FROM "film_list_items" WHERE list_id IN \(\$1\)`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(`DELETE FROM "film_lists" WHERE id IN \(\$1\)`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`DELETE FROM "notifications" WHERE username = \$1`).WithArgs("user1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`DELETE FROM "mail_tokens" WHERE username = \$1`).WithArgs("user1").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`UPDATE "users" SET "avatar_url"=\$1,"digest"=\$2,"display_name"=\$3,"email"=\$4,"email_verified"=\$5,"password"=\$6,"username"=\$7,"updated_at"=\$8 WHERE "users"."deleted_at" IS NULL AND "id" = \$9`).
+					WithArgs("", false, "", nil, false, "!", "deleted-2", sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE "users" SET "deleted_at"=\$1 WHERE "users"."id" = \$2 AND "users"."deleted_at" IS NULL`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "me_delete_last_admin", method: "DELETE", path: "/api/me", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE role = \$1`).WithArgs("admin").WillReturnRows(countRows(1))
+			},
+		},
+		{
+			name: "me_delete_borrowed_copies", method: "DELETE", path: "/api/me", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "loans"`).WillReturnRows(countRows(1))
+			},
+		},
+		{
+			name: "me_export", method: "GET", path: "/api/me/export", token: fixtureUserToken,
+			header: map[string]string{"User-Agent": "golden-test"},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectQuery(`SELECT \* FROM "film_lists" WHERE owner = \$1 ORDER BY id`).WithArgs("user1").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "owner", "name", "description", "public", "share_token", "created_at", "updated_at"}).
+						AddRow(3, "user1", "Oscar night", "", false, "9f86d081884c7d65", fixtureTime, fixtureTime))
+				mock.ExpectQuery(`SELECT films\.\*, film_list_items\.list_id FROM "films" JOIN film_list_items`).
+					WillReturnRows(sqlmock.NewRows(append(filmColumns, "list_id")).
+						AddRow(1, "Heat", "Michael Mann", 1995, "Crime", nil, 1, nil, fixtureTime, fixtureTime, nil, 3))
+				mock.ExpectQuery(`SELECT \* FROM "loans" WHERE borrower = \$1 ORDER BY borrowed_at, id`).WithArgs("user1").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "copy_id", "film_id", "borrower", "borrowed_at", "due_at", "returned_at"}).
+						AddRow(5, 3, 1, "user1", fixtureTime, fixtureTime.AddDate(0, 0, 14), fixtureTime.AddDate(0, 0, 7)))
+				mock.ExpectQuery(`SELECT \* FROM "notifications" WHERE username = \$1 ORDER BY created_at, id`).WithArgs("user1").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "type", "message", "film_id", "read_at", "created_at"}))
+				mock.ExpectQuery(`SELECT \* FROM "usage_rollups" WHERE username = \$1 ORDER BY day, operation, tenant`).WithArgs("user1").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "tenant", "username", "operation", "day", "quantity", "created_at", "updated_at"}).
+						AddRow(1, "default", "user1", "film.read", fixtureTime, 12, fixtureTime, fixtureTime))
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE created_by = \$1 AND "films"\."deleted_at" IS NULL ORDER BY id`).WithArgs(2).
+					WillReturnRows(filmRows())
+			},
+			scrub: []string{"exported_at", "created_at", "last_used_at", "expires_at"},
+		},
+		{
+			name: "me_verify_email_invalid", method: "POST", path: "/api/me/email/verify", token: fixtureUserToken,
+			body: `{"token":"0123456789abcdef"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "mail_tokens" WHERE hash = \$1 AND purpose = \$2`).
+					WithArgs(hashMailToken("0123456789abcdef"), mailTokenVerifyEmail).
+					WillReturnRows(sqlmock.NewRows([]string{"hash", "username", "purpose", "email", "expires_at", "created_at"}))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "password_reset", method: "POST", path: "/api/password-reset",
+			body: `{"email":"admin@example.com"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE \(email = \$1 AND email_verified = \$2\)`).
+					WithArgs("admin@example.com", true).WillReturnRows(userRows(fixtureAdmin))
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM "mail_tokens" WHERE username = \$1 AND purpose = \$2`).
+					WithArgs(fixtureAdmin.Username, mailTokenPasswordReset).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO "mail_tokens"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`INSERT INTO "outbox_emails"`).WithArgs("admin@example.com", "Reset your password", sqlmock.AnyArg(), 0, "", sqlmock.AnyArg(), nil, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "password_reset_unknown_email", method: "POST", path: "/api/password-reset",
+			body: `{"email":"nobody@example.com"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE \(email = \$1 AND email_verified = \$2\)`).WillReturnRows(userRows())
+			},
+		},
+		{
+			name: "password_reset_confirm_missing_fields", method: "POST", path: "/api/password-reset/confirm",
+			body: `{}`,
+		},
+		{
+			name: "usage", method: "GET", path: "/api/usage?from=2025-01-14&to=2025-01-15", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "usage_rollups" WHERE day >= \$1 AND day <= \$2`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "tenant", "username", "operation", "day", "quantity", "created_at", "updated_at"}).
+						AddRow(1, defaultTenant, "admin", MeterWrite, fixtureTime.AddDate(0, 0, -1).Truncate(24*time.Hour), 12, fixtureTime, fixtureTime).
+						AddRow(2, defaultTenant, "user1", MeterWrite, fixtureTime.Truncate(24*time.Hour), 3, fixtureTime, fixtureTime))
+			},
+		},
+		{
+			name: "usage_invalid_date", method: "GET", path: "/api/usage?from=yesterday", token: fixtureUserToken,
+		},
+	})
+}
+
+func TestGoldenOrganizations(t *testing.T) {
+	filmClub := Organization{ID: 2, Name: "Film Club", Slug: "film-club", CreatedAt: fixtureTime, UpdatedAt: fixtureTime}
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "orgs_list", method: "GET", path: "/api/orgs", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "organizations" ORDER BY id`).WillReturnRows(organizationRows(fixtureOrganization, filmClub))
+			},
+		},
+		{
+			name: "orgs_requires_admin", method: "GET", path: "/api/orgs", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+			},
+		},
+		{
+			name: "orgs_create", method: "POST", path: "/api/orgs", token: fixtureAdminToken,
+			body: `{"name":" Film Club ","slug":"film-club"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "organizations" WHERE slug = \$1`).WithArgs("film-club").WillReturnRows(countRows(0))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "organizations"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "orgs_create_invalid", method: "POST", path: "/api/orgs", token: fixtureAdminToken,
+			body: `{"name":"Film Club","slug":"Film Club"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "orgs_create_slug_taken", method: "POST", path: "/api/orgs", token: fixtureAdminToken,
+			body: `{"name":"Film Club","slug":"film-club"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "organizations" WHERE slug = \$1`).WillReturnRows(countRows(1))
+			},
+		},
+		{
+			name: "orgs_update_plan", method: "PUT", path: "/api/orgs/2", token: fixtureAdminToken,
+			body: `{"name":"Film Club","plan":"pro","max_films":500}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE "organizations"."id" = \$1`).WillReturnRows(organizationRows(filmClub))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "organizations" SET "name"=\$1,"plan"=\$2,"max_films"=\$3,"updated_at"=\$4 WHERE "id" = \$5`).
+					WithArgs("Film Club", "pro", 500, sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "orgs_update_unknown_plan", method: "PUT", path: "/api/orgs/2", token: fixtureAdminToken,
+			body: `{"name":"Film Club","plan":"gold","max_films":-1}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "orgs_delete_default", method: "DELETE", path: "/api/orgs/1", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE "organizations"."id" = \$1`).WillReturnRows(organizationRows(fixtureOrganization))
+			},
+		},
+		{
+			name: "orgs_delete_not_empty", method: "DELETE", path: "/api/orgs/2", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE "organizations"."id" = \$1`).WillReturnRows(organizationRows(filmClub))
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE organization_id = \$1`).WithArgs(2).WillReturnRows(countRows(1))
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films" WHERE organization_id = \$1`).WithArgs(2).WillReturnRows(countRows(0))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "orgs_add_member", method: "PUT", path: "/api/orgs/2/members/user1", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE "organizations"."id" = \$1`).WillReturnRows(organizationRows(filmClub))
+				expectUser(mock, fixtureUser)
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "users" SET "organization_id"=\$1,"updated_at"=\$2 WHERE "users"."deleted_at" IS NULL AND "id" = \$3`).
+					WithArgs(2, sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			verify: func(t *testing.T, srv *Server) {
+				if srv.tokenStore.ValidateToken(fixtureUserToken) {
+					t.Error("moved user's token still valid")
+				}
+			},
+		},
+		{
+			name: "orgs_add_member_unknown_org", method: "PUT", path: "/api/orgs/9/members/user1", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE "organizations"."id" = \$1`).WillReturnRows(organizationRows())
+			},
+		},
+	})
+}
+
+var ruleColumns = []string{"id", "name", "kind", "expression", "message", "enabled", "created_at", "updated_at"}
+
+func TestGoldenRules(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "rules_list", method: "GET", path: "/api/rules", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "film_rules" ORDER BY id`).
+					WillReturnRows(sqlmock.NewRows(ruleColumns).
+						AddRow(1, "No far-future releases", "validate", "year <= 2030", "Year must not be after 2030", true, fixtureTime, fixtureTime))
+			},
+		},
+		{
+			name: "rules_create", method: "POST", path: "/api/rules", token: fixtureAdminToken,
+			body: `{"name":"Default genre","kind":"enrich","expression":"genre == \"\" ? {\"genre\": \"Drama\"} : {}"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "film_rules"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT \* FROM "film_rules" WHERE enabled = \$1 ORDER BY id`).WillReturnRows(sqlmock.NewRows(ruleColumns))
+			},
+		},
+		{
+			name: "rules_create_invalid_expression", method: "POST", path: "/api/rules", token: fixtureAdminToken,
+			body: `{"name":"Broken","kind":"validate","expression":"year <="}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "rules_test", method: "POST", path: "/api/rules/test", token: fixtureAdminToken,
+			body: `{"kind":"validate","expression":"year >= 1900","film":{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "rules_update", method: "PUT", path: "/api/rules/1", token: fixtureAdminToken,
+			body: `{"name":"No far-future releases","kind":"validate","expression":"year <= 2035","message":"Year must not be after 2035","enabled":false}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "film_rules" WHERE "film_rules"."id" = \$1`).
+					WillReturnRows(sqlmock.NewRows(ruleColumns).
+						AddRow(1, "No far-future releases", "validate", "year <= 2030", "Year must not be after 2030", true, fixtureTime.AddDate(0, 0, -3), fixtureTime.AddDate(0, 0, -3)))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "film_rules" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT \* FROM "film_rules" WHERE enabled = \$1 ORDER BY id`).WillReturnRows(sqlmock.NewRows(ruleColumns))
+			},
+		},
+		{
+			name: "rules_delete", method: "DELETE", path: "/api/rules/1", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM "film_rules" WHERE "film_rules"."id" = \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT \* FROM "film_rules" WHERE enabled = \$1 ORDER BY id`).WillReturnRows(sqlmock.NewRows(ruleColumns))
+			},
+		},
+	})
+}
+
+var webhookColumns = []string{"id", "url", "secret", "events", "filters", "active", "created_at", "updated_at"}
+
+func TestGoldenWebhooks(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "webhooks_list", method: "GET", path: "/api/webhooks", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "webhooks"`).
+					WillReturnRows(sqlmock.NewRows(webhookColumns).
+						AddRow(1, "https://example.com/hooks/films", "s3cret", `["film.created"]`, `{"genres":["Drama"]}`, true, fixtureTime, fixtureTime))
+			},
+		},
+		{
+			name: "webhooks_create", method: "POST", path: "/api/webhooks", token: fixtureAdminToken,
+			body: `{"url":"https://example.com/hooks/deletes","secret":"s3cret","events":["film.deleted"]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "webhooks"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "webhooks_delete_not_found", method: "DELETE", path: "/api/webhooks/9", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM "webhooks" WHERE "webhooks"."id" = \$1`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "webhooks_create_invalid", method: "POST", path: "/api/webhooks", token: fixtureAdminToken,
+			body: `{"url":"ftp://example.com","events":["film.renamed"]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+	})
+}
+
+var collectionColumns = []string{"id", "name", "description", "organization_id", "created_at", "updated_at"}
+
+// collectionFilmRows returns the films of a collection, as loaded with their collection ID
+func collectionFilmRows(collectionID uint, films ...Film) *sqlmock.Rows {
+	rows := sqlmock.NewRows(append(filmColumns, "collection_id"))
+	for _, film := range films {
+		rows.AddRow(film.ID, film.Title, film.Director, film.Year, film.Genre, nil, film.Version, nil, film.CreatedAt, film.UpdatedAt, nil, collectionID)
+	}
+	return rows
+}
+
+func TestGoldenCollections(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "collections_get", method: "GET", path: "/api/collections/1", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "collections" WHERE "collections"."id" = \$1 AND "collections"\."organization_id" = \$2`).
+					WithArgs(1, fixtureTenant.OrganizationID).
+					WillReturnRows(sqlmock.NewRows(collectionColumns).AddRow(1, "The Dark Knight Trilogy", "Christopher Nolan's Batman films", fixtureTenant.OrganizationID, fixtureTime, fixtureTime))
+				mock.ExpectQuery(`SELECT films\.\*, collection_films\.collection_id FROM "films" JOIN collection_films ON collection_films\.film_id = films\.id WHERE collection_films\.collection_id IN \(\$1\) AND "films"\."organization_id" = \$2 AND "films"\."deleted_at" IS NULL ORDER BY collection_films\.collection_id, collection_films\.position`).
+					WillReturnRows(collectionFilmRows(1, fixtureFilms[1], fixtureFilms[0]))
+			},
+		},
+		{
+			name: "collections_get_not_found", method: "GET", path: "/api/collections/9", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				// Collections of other organizations are not found either
+				mock.ExpectQuery(`SELECT \* FROM "collections" WHERE "collections"."id" = \$1 AND "collections"\."organization_id" = \$2`).
+					WithArgs(9, fixtureTenant.OrganizationID).WillReturnRows(sqlmock.NewRows(collectionColumns))
+			},
+		},
+		{
+			name: "collections_create", method: "POST", path: "/api/collections", token: fixtureAdminToken,
+			body: `{"name":"Classics","film_ids":[2,1]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "collections" WHERE \(lower\(name\) = lower\(\$1\) AND id <> \$2\) AND "collections"\."organization_id" = \$3`).
+					WithArgs("Classics", 0, fixtureTenant.OrganizationID).WillReturnRows(countRows(0))
+				mock.ExpectQuery(`SELECT "id" FROM "films" WHERE id IN \(\$1,\$2\) AND "films"\."organization_id" = \$3`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+				mock.ExpectQuery(`SELECT collection_films\.film_id, collections\.name FROM "collection_films" JOIN collections`).WillReturnRows(sqlmock.NewRows([]string{"film_id", "name"}))
+				mock.ExpectQuery(`INSERT INTO "collections" \("name","description","organization_id","created_at","updated_at"\)`).
+					WithArgs("Classics", "", fixtureTenant.OrganizationID, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectExec(`DELETE FROM "collection_films" WHERE collection_id = \$1`).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`INSERT INTO "collection_films" \("collection_id","film_id","position"\) VALUES \(\$1,\$2,\$3\),\(\$4,\$5,\$6\)`).
+					WithArgs(2, 2, 1, 2, 1, 2).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT films\.\*, collection_films\.collection_id FROM "films"`).
+					WillReturnRows(collectionFilmRows(2, fixtureFilms[1], fixtureFilms[0]))
+			},
+		},
+		{
+			name: "collections_create_film_taken", method: "POST", path: "/api/collections", token: fixtureAdminToken,
+			body: `{"name":"Classics","film_ids":[1]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "collections"`).WillReturnRows(countRows(0))
+				mock.ExpectQuery(`SELECT "id" FROM "films" WHERE id IN \(\$1\) AND "films"\."organization_id" = \$2`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectQuery(`SELECT collection_films\.film_id, collections\.name FROM "collection_films" JOIN collections`).
+					WillReturnRows(sqlmock.NewRows([]string{"film_id", "name"}).AddRow(1, "Prison Dramas"))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "collections_create_missing_film", method: "POST", path: "/api/collections", token: fixtureAdminToken,
+			body: `{"name":"Classics","film_ids":[1,9]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "collections"`).WillReturnRows(countRows(0))
+				mock.ExpectQuery(`SELECT "id" FROM "films" WHERE id IN \(\$1,\$2\) AND "films"\."organization_id" = \$3`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "collections_create_as_user", method: "POST", path: "/api/collections", token: fixtureUserToken,
+			body: `{"name":"Classics","film_ids":[2,1]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+			},
+		},
+		{
+			name: "collections_create_invalid", method: "POST", path: "/api/collections", token: fixtureAdminToken,
+			body: `{"name":"  ","film_ids":[1,1]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "collections_delete", method: "DELETE", path: "/api/collections/1", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM "collections" WHERE "collections"."id" = \$1 AND "collections"\."organization_id" = \$2`).
+					WithArgs(1, fixtureTenant.OrganizationID).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`DELETE FROM "collection_films" WHERE collection_id = \$1`).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "collections_delete_other_tenant", method: "DELETE", path: "/api/collections/3", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM "collections" WHERE "collections"."id" = \$1 AND "collections"\."organization_id" = \$2`).
+					WithArgs(3, fixtureTenant.OrganizationID).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+		},
+	})
+}
+
+var listColumns = []string{"id", "owner", "name", "description", "public", "share_token", "created_at", "updated_at"}
+
+// listRow returns a list of a user as a result row
+func listRow(id uint, owner string, public bool) *sqlmock.Rows {
+	return sqlmock.NewRows(listColumns).AddRow(id, owner, "Oscar night 2025", "Best picture nominees", public, "5e1f7a0c", fixtureTime, fixtureTime)
+}
+
+// listFilmRows returns the films of a list, as loaded with their list ID
+func listFilmRows(listID uint, films ...Film) *sqlmock.Rows {
+	rows := sqlmock.NewRows(append(filmColumns, "list_id"))
+	for _, film := range films {
+		rows.AddRow(film.ID, film.Title, film.Director, film.Year, film.Genre, nil, film.Version, nil, film.CreatedAt, film.UpdatedAt, nil, listID)
+	}
+	return rows
+}
+
+func TestGoldenLists(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "lists_create", method: "POST", path: "/api/lists", token: fixtureUserToken,
+			body: `{"name":"Oscar night 2025","description":"Best picture nominees","public":true}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "film_lists"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT films\.\*, film_list_items\.list_id FROM "films" JOIN film_list_items ON film_list_items\.film_id = films\.id WHERE film_list_items\.list_id IN \(\$1\) AND "films"\."organization_id" = \$2 AND "films"\."deleted_at" IS NULL ORDER BY film_list_items\.list_id, film_list_items\.position`).
+					WillReturnRows(listFilmRows(1))
+			},
+			scrub: []string{"share_url"},
+		},
+		{
+			name: "lists_get_private_of_other_user", method: "GET", path: "/api/lists/1", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "film_lists" WHERE "film_lists"."id" = \$1`).WillReturnRows(listRow(1, fixtureAdmin.Username, false))
+			},
+		},
+		{
+			name: "lists_add_film", method: "POST", path: "/api/lists/1/films", token: fixtureUserToken,
+			body: `{"film_id":2,"position":1}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "film_lists" WHERE owner = \$1 AND "film_lists"."id" = \$2`).WithArgs(fixtureUser.Username, 1).WillReturnRows(listRow(1, fixtureUser.Username, false))
+				mock.ExpectQuery(`SELECT "id" FROM "films" WHERE "films"\."id" = \$1 AND "films"\."organization_id" = \$2`).WithArgs(2, 1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "film_list_items" WHERE list_id = \$1`).WillReturnRows(countRows(1))
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "film_list_items" WHERE list_id = \$1 AND film_id = \$2`).WillReturnRows(countRows(0))
+				mock.ExpectExec(`UPDATE "film_list_items" SET "position"=position \+ 1 WHERE list_id = \$1 AND position >= \$2`).WithArgs(1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO "film_list_items" \("list_id","film_id","position"\) VALUES \(\$1,\$2,\$3\)`).WithArgs(1, 2, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT films\.\*, film_list_items\.list_id FROM "films"`).WillReturnRows(listFilmRows(1, fixtureFilms[1], fixtureFilms[0]))
+			},
+		},
+		{
+			name: "lists_reorder_mismatch", method: "PUT", path: "/api/lists/1/films", token: fixtureUserToken,
+			body: `{"film_ids":[2]}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "film_lists" WHERE owner = \$1`).WillReturnRows(listRow(1, fixtureUser.Username, false))
+				mock.ExpectQuery(`SELECT "film_id" FROM "film_list_items" WHERE list_id = \$1`).WillReturnRows(sqlmock.NewRows([]string{"film_id"}).AddRow(2).AddRow(1))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "lists_remove_film_not_on_list", method: "DELETE", path: "/api/lists/1/films/3", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "film_lists" WHERE owner = \$1`).WillReturnRows(listRow(1, fixtureUser.Username, false))
+				mock.ExpectQuery(`SELECT \* FROM "film_list_items" WHERE list_id = \$1 AND film_id = \$2`).WillReturnRows(sqlmock.NewRows([]string{"list_id", "film_id", "position"}))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "lists_shared", method: "GET", path: "/api/shared/lists/5e1f7a0c",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "film_lists" WHERE share_token = \$1 AND public = \$2`).WithArgs("5e1f7a0c", true).WillReturnRows(listRow(1, fixtureUser.Username, true))
+				mock.ExpectQuery(`SELECT "organization_id" FROM "users" WHERE username = \$1`).WithArgs(fixtureUser.Username).
+					WillReturnRows(sqlmock.NewRows([]string{"organization_id"}).AddRow(1))
+				mock.ExpectQuery(`SELECT films\.\*, film_list_items\.list_id FROM "films" .* AND "films"\."organization_id" = \$2`).WithArgs(1, 1).
+					WillReturnRows(listFilmRows(1, fixtureFilms[2]))
+			},
+		},
+	})
+}
+
+var (
+	copyColumns = []string{"id", "film_id", "label", "created_at", "updated_at"}
+	loanColumns = []string{"id", "copy_id", "film_id", "borrower", "borrowed_at", "due_at", "returned_at"}
+)
+
+func TestGoldenLending(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "copies_list", method: "GET", path: "/api/films/1/copies", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[0]))
+				mock.ExpectQuery(`SELECT \* FROM "copies" WHERE film_id = \$1 ORDER BY id`).
+					WillReturnRows(sqlmock.NewRows(copyColumns).AddRow(1, 1, "DVD #1", fixtureTime, fixtureTime).AddRow(2, 1, "Blu-ray #1", fixtureTime, fixtureTime))
+				mock.ExpectQuery(`SELECT \* FROM "loans" WHERE film_id = \$1 AND returned_at IS NULL`).
+					WillReturnRows(sqlmock.NewRows(loanColumns).AddRow(1, 2, 1, fixtureUser.Username, fixtureTime, fixtureTime.AddDate(0, 0, 14), nil))
+			},
+		},
+		{
+			name: "copies_add_requires_admin", method: "POST", path: "/api/films/1/copies", token: fixtureUserToken,
+			body: `{"label":"DVD #3"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+			},
+		},
+		{
+			name: "copies_borrow", method: "POST", path: "/api/copies/1/borrow", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "copies" WHERE "copies"\."id" = \$1 AND film_id IN \(SELECT id FROM films WHERE organization_id = \$2\)`).WillReturnRows(sqlmock.NewRows(copyColumns).AddRow(1, 1, "DVD #1", fixtureTime, fixtureTime))
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "loans" WHERE copy_id = \$1 AND returned_at IS NULL`).WillReturnRows(countRows(0))
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "loans" WHERE borrower = \$1 AND returned_at IS NULL`).WithArgs(fixtureUser.Username).WillReturnRows(countRows(1))
+				mock.ExpectQuery(`INSERT INTO "loans"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				mock.ExpectCommit()
+			},
+			scrub: []string{"borrowed_at", "due_at"},
+		},
+		{
+			name: "copies_borrow_on_loan", method: "POST", path: "/api/copies/2/borrow", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "copies" WHERE "copies"\."id" = \$1 AND film_id IN \(SELECT id FROM films WHERE organization_id = \$2\)`).WillReturnRows(sqlmock.NewRows(copyColumns).AddRow(2, 1, "Blu-ray #1", fixtureTime, fixtureTime))
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "loans" WHERE copy_id = \$1 AND returned_at IS NULL`).WillReturnRows(countRows(1))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "copies_return_not_borrower", method: "POST", path: "/api/copies/2/return", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "loans" WHERE \(copy_id = \$1 AND returned_at IS NULL\) AND film_id IN \(SELECT id FROM films WHERE organization_id = \$2\)`).
+					WithArgs(2, 1).WillReturnRows(sqlmock.NewRows(loanColumns).AddRow(1, 2, 1, "demo", fixtureTime, fixtureTime.AddDate(0, 0, 14), nil))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "admin_loans", method: "GET", path: "/api/admin/loans?overdue=true", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "loans" WHERE returned_at IS NULL AND due_at < \$1 AND film_id IN \(SELECT id FROM films WHERE organization_id = \$2\) ORDER BY due_at, id`).
+					WillReturnRows(sqlmock.NewRows(loanColumns).
+						AddRow(1, 2, 1, fixtureUser.Username, fixtureTime.AddDate(0, 0, -20), fixtureTime.AddDate(0, 0, -6), nil).
+						AddRow(2, 5, 3, fixtureUser.Username, fixtureTime.AddDate(0, 0, -16), fixtureTime.AddDate(0, 0, -2), nil))
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE id IN \(\$1,\$2\)`).WillReturnRows(filmRows(fixtureFilms[0], fixtureFilms[2]))
+			},
+		},
+	})
+}
+
+var screeningColumns = []string{"id", "film_id", "venue", "starts_at", "ends_at", "capacity", "created_at", "updated_at"}
+
+func TestGoldenScreenings(t *testing.T) {
+	evening := time.Date(2025, 6, 1, 19, 30, 0, 0, time.UTC)
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "screenings_list", method: "GET", path: "/api/screenings?from=2025-06-01&to=2025-06-01", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "screenings" WHERE \(starts_at < \$1 AND ends_at > \$2\) AND film_id IN \(SELECT id FROM films WHERE organization_id = \$3\) ORDER BY starts_at, venue, id`).
+					WithArgs(time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), 1).
+					WillReturnRows(sqlmock.NewRows(screeningColumns).
+						AddRow(1, 2, "Hall 1", evening, evening.Add(175*time.Minute), 120, fixtureTime, fixtureTime).
+						AddRow(2, 1, "Hall 2", evening, evening.Add(142*time.Minute), 80, fixtureTime, fixtureTime))
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE id IN \(\$1,\$2\)`).WillReturnRows(filmRows(fixtureFilms[0], fixtureFilms[1]))
+			},
+		},
+		{
+			name: "screenings_list_invalid_range", method: "GET", path: "/api/screenings?from=2025-06-02&to=2025-06-01T00:00:00Z", token: fixtureUserToken,
+		},
+		{
+			name: "screenings_create", method: "POST", path: "/api/screenings", token: fixtureAdminToken,
+			body: `{"film_id":1,"venue":"Hall 1","starts_at":"2025-06-01T23:00:00Z","ends_at":"2025-06-02T01:30:00Z","capacity":120}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films" WHERE id = \$1 AND "films"\."organization_id" = \$2`).WithArgs(1, 1).WillReturnRows(countRows(1))
+				mock.ExpectQuery(`SELECT \* FROM "screenings" WHERE \(lower\(venue\) = lower\(\$1\) AND starts_at < \$2 AND ends_at > \$3 AND id <> \$4\) AND film_id IN \(SELECT id FROM films WHERE organization_id = \$5\) ORDER BY starts_at`).
+					WillReturnRows(sqlmock.NewRows(screeningColumns))
+				mock.ExpectQuery(`INSERT INTO "screenings"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectCommit()
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE id IN \(\$1\)`).WillReturnRows(filmRows(fixtureFilms[0]))
+			},
+			scrub: []string{"created_at", "updated_at"},
+		},
+		{
+			name: "screenings_create_overlap", method: "POST", path: "/api/screenings", token: fixtureAdminToken,
+			body: `{"film_id":1,"venue":"hall 1","starts_at":"2025-06-01T21:00:00Z","ends_at":"2025-06-01T23:30:00Z","capacity":120}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films" WHERE id = \$1 AND "films"\."organization_id" = \$2`).WithArgs(1, 1).WillReturnRows(countRows(1))
+				mock.ExpectQuery(`SELECT \* FROM "screenings" WHERE \(lower\(venue\) = lower\(\$1\) .*\) AND film_id IN \(SELECT id FROM films WHERE organization_id = \$5\)`).
+					WillReturnRows(sqlmock.NewRows(screeningColumns).AddRow(1, 2, "Hall 1", evening, evening.Add(175*time.Minute), 120, fixtureTime, fixtureTime))
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "screenings_create_invalid", method: "POST", path: "/api/screenings", token: fixtureAdminToken,
+			body: `{"film_id":1,"venue":" ","starts_at":"2025-06-01T21:00:00Z","ends_at":"2025-06-01T20:00:00Z","capacity":0}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "screenings_create_requires_admin", method: "POST", path: "/api/screenings", token: fixtureUserToken,
+			body: `{"film_id":1,"venue":"Hall 1","starts_at":"2025-06-01T23:00:00Z","ends_at":"2025-06-02T01:30:00Z","capacity":120}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+			},
+		},
+	})
+}
+
+var notificationColumns = []string{"id", "username", "type", "message", "film_id", "read_at", "created_at"}
+
+func TestGoldenNotifications(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "notifications_list", method: "GET", path: "/api/me/notifications", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "notifications" WHERE username = \$1 AND read_at IS NULL`).
+					WithArgs(fixtureUser.Username).WillReturnRows(countRows(1))
+				mock.ExpectQuery(`SELECT \* FROM "notifications" WHERE username = \$1 ORDER BY created_at DESC, id DESC LIMIT 100`).
+					WithArgs(fixtureUser.Username).
+					WillReturnRows(sqlmock.NewRows(notificationColumns).
+						AddRow(2, fixtureUser.Username, NotificationListFilmUpdated, "The Godfather, on your list Oscar night 2025, was updated", 2, nil, fixtureTime).
+						AddRow(1, fixtureUser.Username, NotificationListFilmDeleted, "Pulp Fiction, on your list Oscar night 2025, was removed from the catalog", 3, fixtureTime, fixtureTime.AddDate(0, 0, -1)))
+			},
+		},
+		{
+			name: "notifications_mark_read", method: "POST", path: "/api/me/notifications/2/read", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "notifications" WHERE id = \$1 AND username = \$2`).
+					WithArgs(2, fixtureUser.Username).
+					WillReturnRows(sqlmock.NewRows(notificationColumns).
+						AddRow(2, fixtureUser.Username, NotificationListFilmUpdated, "The Godfather, on your list Oscar night 2025, was updated", 2, nil, fixtureTime))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "notifications" SET "read_at"=\$1 WHERE "id" = \$2`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			scrub: []string{"read_at"},
+		},
+		{
+			name: "notifications_mark_read_not_found", method: "POST", path: "/api/me/notifications/9/read", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "notifications" WHERE id = \$1 AND username = \$2`).WillReturnRows(sqlmock.NewRows(notificationColumns))
+			},
+		},
+		{
+			name: "notifications_mark_all_read", method: "POST", path: "/api/me/notifications/read", token: fixtureUserToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "notifications" SET "read_at"=\$1 WHERE username = \$2 AND read_at IS NULL`).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+		},
+	})
+}
+
+var exportColumns = []string{"id", "mode", "since", "until", "rows", "files", "created_by", "created_at"}
+
+func TestGoldenExports(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "exports_list", method: "GET", path: "/api/exports", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "export_snapshots"`).
+					WillReturnRows(sqlmock.NewRows(exportColumns).
+						AddRow(2, "diff", fixtureTime.AddDate(0, 0, -1), fixtureTime, 1, `["manifest.json","films.ndjson"]`, "admin", fixtureTime).
+						AddRow(1, "full", nil, fixtureTime.AddDate(0, 0, -1), 3, `["manifest.json","films.ndjson"]`, "admin", fixtureTime.AddDate(0, 0, -1)))
+			},
+		},
+		{
+			name: "exports_create", method: "POST", path: "/api/exports", token: fixtureAdminToken,
+			body: `{"mode":"full"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "export_snapshots"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE created_at <= \$1`).WillReturnRows(filmRows(fixtureFilms...))
+				mock.ExpectExec(`UPDATE "export_snapshots" SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+			},
+			// Exports run up to the real clock
+			scrub: []string{"until"},
+		},
+		{
+			name: "exports_create_failed", method: "POST", path: "/api/exports", token: fixtureAdminToken,
+			body: `{"mode":"full"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "export_snapshots"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE created_at <= \$1`).WillReturnError(errors.New("connection reset"))
+				// The snapshot goes with its files
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "exports_diff_without_previous", method: "POST", path: "/api/exports", token: fixtureAdminToken,
+			body: `{"mode":"diff"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "export_snapshots" ORDER BY until DESC`).WillReturnRows(sqlmock.NewRows(exportColumns))
+			},
+		},
+		{
+			name: "exports_download", method: "GET", path: "/api/exports/1/files/films.ndjson", token: fixtureAdminToken,
+			setup: func(srv *Server) {
+				dir := filepath.Join(srv.exportService.dir, "1")
+				os.MkdirAll(dir, 0755)
+				os.WriteFile(filepath.Join(dir, exportFilmsFile), []byte(`{"id":1,"title":"The Shawshank Redemption"}`+"\n"), 0644)
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "export_snapshots" WHERE "export_snapshots"."id" = \$1`).
+					WillReturnRows(sqlmock.NewRows(exportColumns).
+						AddRow(1, "full", nil, fixtureTime, 1, `["manifest.json","films.ndjson"]`, "admin", fixtureTime))
+			},
+		},
+		{
+			name: "exports_invalid_mode", method: "POST", path: "/api/exports", token: fixtureAdminToken,
+			body: `{"mode":"partial"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+	})
+}
+
+var jobColumns = []string{"id", "name", "description", "cron", "timeout_seconds", "priority", "paused", "next_run_at", "last_run_at", "last_duration_ms", "last_error", "created_at", "updated_at"}
+
+func TestGoldenAdmin(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "admin_backup_export", method: "GET", path: "/api/admin/export", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT \* FROM "organizations" ORDER BY id`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "slug", "created_at", "updated_at"}).AddRow(1, "Default", "default", fixtureTime, fixtureTime))
+				// Passwords are left out by default
+				mock.ExpectQuery(`SELECT \* FROM "users" ORDER BY id`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "role", "organization_id"}).AddRow(2, "user1", "password123", "user", 1))
+				mock.ExpectQuery(`SELECT \* FROM "films" ORDER BY id`).WillReturnRows(filmRows(fixtureFilms[0]))
+				mock.ExpectQuery(`SELECT \* FROM "film_revisions" ORDER BY id`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "film_id", "version", "film", "replaced_by", "replaced_at"}).
+						AddRow(1, 1, 1, []byte(`{"title":"The Shawshank Redemption","director":"Frank Darabont","year":1994}`), 2, fixtureTime))
+				mock.ExpectQuery(`SELECT \* FROM "collections" ORDER BY id`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(`SELECT \* FROM "collection_films" ORDER BY collection_id, film_id`).WillReturnRows(sqlmock.NewRows([]string{"collection_id"}))
+				mock.ExpectQuery(`SELECT \* FROM "film_lists" ORDER BY id`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(`SELECT \* FROM "film_list_items" ORDER BY list_id, film_id`).WillReturnRows(sqlmock.NewRows([]string{"list_id"}))
+				mock.ExpectQuery(`SELECT \* FROM "copies" ORDER BY id`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(`SELECT \* FROM "loans" ORDER BY id`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(`SELECT \* FROM "screenings" ORDER BY id`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery(`SELECT \* FROM "film_views" ORDER BY film_id, day`).
+					WillReturnRows(sqlmock.NewRows([]string{"film_id", "day", "views"}).AddRow(1, fixtureTime, 40))
+				mock.ExpectCommit()
+				expectMeteringEvent(mock)
+			},
+			scrub: []string{"generated_at"},
+		},
+		{
+			name: "admin_backup_import_merge", method: "POST", path: "/api/admin/import", token: fixtureAdminToken,
+			body: `{"schema_version":1,"generated_at":"2025-01-15T09:00:00Z","passwords":false,"tables":["organizations","users","films"],"data":{` +
+				`"organizations":[{"id":1,"name":"Default","slug":"default"}],` +
+				`"users":[{"id":2,"username":"user1","role":"user","organization_id":1}],` +
+				`"films":[{"id":1,"title":"The Shawshank Redemption","director":"Frank Darabont","year":1994,"organization_id":1,"created_by":2}]}}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectExec(`INSERT INTO "organizations" \("id","name","slug"\) VALUES \(\$1,\$2,\$3\) ON CONFLICT \("id"\) DO UPDATE SET "name"="excluded"."name","slug"="excluded"."slug"`).
+					WithArgs(1, "Default", "default").WillReturnResult(sqlmock.NewResult(0, 1))
+				// Referenced keys are looked up among the stored rows too
+				mock.ExpectQuery(`SELECT "id" FROM "organizations"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				// Stored passwords are kept when the backup has none
+				mock.ExpectExec(`INSERT INTO "users" \("id","organization_id","password","role","username"\) VALUES \(\$1,\$2,\$3,\$4,\$5\) ON CONFLICT \("id"\) DO UPDATE SET "organization_id"="excluded"."organization_id","role"="excluded"."role","username"="excluded"."username"`).
+					WithArgs(2, 1, "!", "user", "user1").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`SELECT "id" FROM "users"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectExec(`INSERT INTO "films" .+ ON CONFLICT \("id"\) DO UPDATE SET`).WillReturnResult(sqlmock.NewResult(0, 1))
+				for _, table := range []string{"organizations", "users", "films", "film_revisions", "collections", "film_lists", "copies", "loans", "screenings"} {
+					mock.ExpectExec(`SELECT setval\(pg_get_serial_sequence\(\$1, 'id'\), coalesce\(max\(id\), 0\) \+ 1, false\) FROM ` + table).
+						WithArgs(table).WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "admin_backup_import_replace", method: "POST", path: "/api/admin/import?mode=replace", token: fixtureAdminToken,
+			header: map[string]string{"Content-Type": "application/x-ndjson"},
+			body: `{"schema_version":1,"generated_at":"2025-01-15T09:00:00Z","passwords":true,"tables":["organizations"]}` + "\n" +
+				`{"table":"organizations","row":{"id":1,"name":"Default","slug":"default"}}` + "\n" +
+				`{"end":true,"rows":1}` + "\n",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				for i := len(backupTables) - 1; i >= 0; i-- {
+					mock.ExpectExec(`DELETE FROM ` + backupTables[i].name).WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+				mock.ExpectExec(`INSERT INTO "organizations" \("id","name","slug"\) VALUES \(\$1,\$2,\$3\)$`).
+					WithArgs(1, "Default", "default").WillReturnResult(sqlmock.NewResult(0, 1))
+				for _, table := range []string{"organizations", "users", "films", "film_revisions", "collections", "film_lists", "copies", "loans", "screenings"} {
+					mock.ExpectExec(`SELECT setval`).WithArgs(table).WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "admin_backup_import_dangling_reference", method: "POST", path: "/api/admin/import?mode=replace", token: fixtureAdminToken,
+			header: map[string]string{"Content-Type": "application/x-ndjson"},
+			body: `{"schema_version":1,"generated_at":"2025-01-15T09:00:00Z","passwords":false,"tables":["films"]}` + "\n" +
+				`{"table":"films","row":{"id":1,"title":"The Shawshank Redemption","organization_id":7}}` + "\n",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				for i := len(backupTables) - 1; i >= 0; i-- {
+					mock.ExpectExec(`DELETE FROM ` + backupTables[i].name).WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "admin_backup_import_truncated", method: "POST", path: "/api/admin/import", token: fixtureAdminToken,
+			header: map[string]string{"Content-Type": "application/x-ndjson"},
+			body: `{"schema_version":1,"generated_at":"2025-01-15T09:00:00Z","passwords":false,"tables":["organizations"]}` + "\n" +
+				`{"table":"organizations","row":{"id":1,"name":"Default","slug":"default"}}` + "\n",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+			},
+		},
+		{
+			name: "admin_backup_import_mode_invalid", method: "POST", path: "/api/admin/import?mode=overwrite", token: fixtureAdminToken, body: `{}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "admin_backup_format_invalid", method: "GET", path: "/api/admin/export?format=csv", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "admin_stats", method: "GET", path: "/api/admin/stats", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT role, count\(\*\) AS count FROM "users"`).
+					WillReturnRows(sqlmock.NewRows([]string{"role", "count"}).AddRow("admin", 1).AddRow("user", 2))
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films" WHERE "films"."deleted_at" IS NULL`).WillReturnRows(countRows(3))
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films" WHERE deleted_at IS NOT NULL`).WillReturnRows(countRows(1))
+				mock.ExpectQuery(`SELECT date_trunc`).WillReturnRows(sqlmock.NewRows([]string{"day", "count"}))
+				mock.ExpectQuery(`SELECT username, sum\(quantity\) AS writes FROM "usage_rollups"`).
+					WillReturnRows(sqlmock.NewRows([]string{"username", "writes"}).AddRow("admin", 12).AddRow("user1", 3))
+			},
+			// The daily series covers the last 30 days before the real clock
+			scrub: []string{"generated_at", "day"},
+		},
+		{
+			name: "admin_stats_precomputed", method: "GET", path: "/api/admin/stats", token: fixtureAdminToken,
+			setup: func(srv *Server) {
+				srv.adminService.precomputed = &AdminStats{
+					Users:           UserStats{Total: 3, ByRole: map[string]int64{"admin": 1, "user": 2}},
+					Films:           FilmStats{Total: 3, Deleted: 1},
+					FilmsPerDay:     []DailyCount{{Day: "2025-01-15", Count: 2}},
+					TopContributors: []Contributor{{Username: "admin", Writes: 12}},
+					GeneratedAt:     time.Now(),
+				}
+			},
+			// Served without querying the database
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+			scrub: []string{"generated_at"},
+		},
+		{
+			name: "admin_queue", method: "GET", path: "/api/admin/queue", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "admin_metrics_history", method: "GET", path: "/api/admin/metrics/history?from=2025-01-15T00:00:00Z&to=2025-01-15T12:00:00Z", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "metrics_snapshots"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "period_start", "period_end", "requests", "client_errors", "server_errors", "error_rate", "active_users", "active_tokens", "films", "created_at"}).
+						AddRow(1, fixtureTime.Add(-time.Hour), fixtureTime, 1250, 12, 1, 0.0008, 8, 10, 3, fixtureTime))
+			},
+		},
+		{
+			name: "admin_read_only", method: "GET", path: "/api/admin/read-only", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "admin_read_only_enable", method: "PUT", path: "/api/admin/read-only", token: fixtureAdminToken,
+			body: `{"read_only":true}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "read_only_rejects_writes", method: "POST", path: "/api/films", token: fixtureUserToken,
+			body:  `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			setup: func(srv *Server) { srv.readOnly.Store(true) },
+		},
+		{
+			name: "demo_rejects_writes", method: "POST", path: "/api/films", token: fixtureUserToken,
+			body:  `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			setup: enableDemoMode,
+		},
+		{
+			name: "demo_rejects_admin_writes", method: "PUT", path: "/api/admin/read-only", token: fixtureAdminToken,
+			body:   `{"read_only":false}`,
+			header: map[string]string{"Accept-Language": "id"},
+			setup:  enableDemoMode,
+		},
+		{
+			name: "demo_allows_reads", method: "GET", path: "/api/admin/read-only", token: fixtureAdminToken,
+			setup: enableDemoMode,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "demo_rejects_backup_export", method: "GET", path: "/api/admin/export", token: fixtureAdminToken,
+			setup: enableDemoMode,
+		},
+		{
+			// The admin is also signed in with fixtureReaderToken
+			name: "demo_sessions_list", method: "GET", path: "/api/me/sessions", token: fixtureAdminToken,
+			header: map[string]string{"User-Agent": "golden-test"},
+			setup:  enableDemoMode,
+			scrub:  []string{"created_at", "last_used_at", "expires_at"},
+		},
+		{
+			name: "demo_allows_login", method: "POST", path: "/api/login",
+			body: `{"username":"admin","password":"admin123"}`,
+			setup: func(srv *Server) {
+				useMemoryStorage(srv)
+				enableDemoMode(srv)
+			},
+			scrub: []string{"token"},
+		},
+		{
+			name: "maintenance_enable", method: "PUT", path: "/api/admin/maintenance", token: fixtureAdminToken,
+			body: `{"enabled":true,"message":"Upgrading the database, back at 14:00 UTC"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "maintenance_invalid_retry_after", method: "PUT", path: "/api/admin/maintenance", token: fixtureAdminToken,
+			body: `{"enabled":true,"retry_after_seconds":-1}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "maintenance_rejects_writes", method: "POST", path: "/api/films", token: fixtureUserToken, header: map[string]string{"Accept-Language": "id"},
+			body:  `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			setup: func(srv *Server) { srv.maintenance.Store(&MaintenanceMode{Enabled: true, RetryAfterSeconds: 600}) },
+		},
+		{
+			name: "maintenance_rejects_writes_with_message", method: "DELETE", path: "/api/films/3", token: fixtureUserToken, header: map[string]string{"Accept-Language": "id"},
+			setup: func(srv *Server) {
+				srv.maintenance.Store(&MaintenanceMode{Enabled: true, Message: "Upgrading the database, back at 14:00 UTC", RetryAfterSeconds: 600})
+			},
+		},
+		{
+			// Read-only mode can still be switched off during maintenance
+			name: "maintenance_allows_read_only_switch", method: "PUT", path: "/api/admin/read-only", token: fixtureAdminToken,
+			body: `{"read_only":false}`,
+			setup: func(srv *Server) {
+				srv.readOnly.Store(true)
+				srv.maintenance.Store(&MaintenanceMode{Enabled: true, RetryAfterSeconds: 600})
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "admin_jobs", method: "GET", path: "/api/admin/jobs", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "scheduled_jobs" ORDER BY name`).
+					WillReturnRows(sqlmock.NewRows(jobColumns).
+						AddRow(1, "token-cleanup", "Remove expired login tokens", "*/15 * * * *", 60, "normal", false, fixtureTime.Add(15*time.Minute), fixtureTime, 3, "", fixtureTime, fixtureTime).
+						AddRow(2, "usage-rollup", "Refresh today's and yesterday's usage totals", "0 * * * *", 600, "low", true, nil, nil, 0, "", fixtureTime, fixtureTime))
+			},
+		},
+		{
+			name: "admin_jobs_invalid_priority", method: "PUT", path: "/api/admin/jobs/usage-rollup", token: fixtureAdminToken,
+			body: `{"priority":"urgent"}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "scheduled_jobs" WHERE name = \$1`).
+					WillReturnRows(sqlmock.NewRows(jobColumns).
+						AddRow(2, "usage-rollup", "Refresh today's and yesterday's usage totals", "0 * * * *", 600, "low", true, nil, nil, 0, "", fixtureTime, fixtureTime))
+			},
+		},
+		{
+			name: "admin_jobs_run_unknown", method: "POST", path: "/api/admin/jobs/reindex/run", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT \* FROM "scheduled_jobs" WHERE name = \$1`).WillReturnRows(sqlmock.NewRows(jobColumns))
+			},
+		},
+		{
+			name: "admin_usage", method: "GET", path: "/api/admin/usage?hours=48&limit=2", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT username, sum\(requests\) AS requests FROM "api_usages" WHERE hour >= \$1 GROUP BY "username" ORDER BY requests DESC, username LIMIT 2`).
+					WillReturnRows(sqlmock.NewRows([]string{"username", "requests"}).AddRow("user1", 52).AddRow("admin", 7))
+				mock.ExpectQuery(`SELECT username, endpoint, sum\(requests\) AS requests FROM "api_usages" WHERE hour >= \$1 AND username IN \(\$2,\$3\) GROUP BY username, endpoint ORDER BY requests DESC, endpoint`).
+					WithArgs(sqlmock.AnyArg(), "user1", "admin").
+					WillReturnRows(sqlmock.NewRows([]string{"username", "endpoint", "requests"}).
+						AddRow("user1", "GET /api/films", 40).
+						AddRow("user1", "GET /api/films/{id}", 12).
+						AddRow("admin", "GET /api/admin/stats", 7))
+			},
+		},
+		{
+			name: "admin_usage_invalid_limit", method: "GET", path: "/api/admin/usage?limit=0", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "admin_users_list", method: "GET", path: "/api/admin/users?search=user&role=user&page=1&page_size=1", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "users" WHERE \(username ILIKE \$1 OR email ILIKE \$2 OR display_name ILIKE \$3\) AND role = \$4 AND "users"."organization_id" = \$5 AND "users"."deleted_at" IS NULL`).
+					WithArgs("%user%", "%user%", "%user%", "user", fixtureTenant.OrganizationID).WillReturnRows(countRows(2))
+				mock.ExpectQuery(`SELECT \* FROM "users" WHERE \(username ILIKE \$1 OR email ILIKE \$2 OR display_name ILIKE \$3\) AND role = \$4 AND "users"."organization_id" = \$5 AND "users"."deleted_at" IS NULL ORDER BY username LIMIT 1`).
+					WithArgs("%user%", "%user%", "%user%", "user", fixtureTenant.OrganizationID).WillReturnRows(userRows(fixtureUser))
+			},
+		},
+		{
+			name: "admin_users_list_invalid_role", method: "GET", path: "/api/admin/users?role=owner", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "admin_users_deactivate", method: "POST", path: "/api/admin/users/user1/deactivate", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				expectTenantUser(mock, "user1", fixtureTenant.OrganizationID, fixtureUser)
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "users" SET "active"=\$1,"updated_at"=\$2 WHERE "users"."deleted_at" IS NULL AND "id" = \$3`).
+					WithArgs(false, sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "admin_users_deactivate_self", method: "POST", path: "/api/admin/users/admin/deactivate", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "admin_users_deactivate_unknown", method: "POST", path: "/api/admin/users/ghost/deactivate", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				expectTenantUser(mock, "ghost", fixtureTenant.OrganizationID)
+			},
+		},
+		{
+			// Admins only manage the users of their own organization
+			name: "admin_users_deactivate_other_organization", method: "POST", path: "/api/admin/users/user1/deactivate", token: "film-club-admin-token",
+			setup: func(srv *Server) {
+				srv.tokenStore.AddToken("film-club-admin-token", fixtureAdmin.Username, Tenant{OrganizationID: 2, Slug: "film-club"}, knownScopes)
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				expectTenantUser(mock, "user1", 2)
+			},
+		},
+		{
+			// Organizations and backups span every tenant, so an
+			// organization's own admins can't reach them
+			name: "orgs_list_organization_admin", method: "GET", path: "/api/orgs", token: "film-club-admin-token",
+			setup: func(srv *Server) {
+				srv.tokenStore.AddToken("film-club-admin-token", fixtureAdmin.Username, Tenant{OrganizationID: 2, Slug: "film-club"}, []string{scopeUsersAdmin})
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "admin_users_reactivate", method: "POST", path: "/api/admin/users/user1/reactivate", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				user := fixtureUser
+				user.Active = false
+				expectTenantUser(mock, "user1", fixtureTenant.OrganizationID, user)
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "users" SET "active"=\$1,"updated_at"=\$2 WHERE "users"."deleted_at" IS NULL AND "id" = \$3`).
+					WithArgs(true, sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "admin_flags", method: "GET", path: "/api/admin/flags", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "admin_flags_update", method: "PUT", path: "/api/admin/flags/enable_lending", token: fixtureAdminToken,
+			body: `{"enabled":false}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO "feature_flags" \("name","enabled","updated_by","updated_at"\) VALUES \(\$1,\$2,\$3,\$4\) ON CONFLICT \("name"\) DO UPDATE SET "enabled"="excluded"."enabled","updated_by"="excluded"."updated_by","updated_at"="excluded"."updated_at" RETURNING "id"`).
+					WithArgs("enable_lending", false, "admin", fixtureTime).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "admin_flags_update_missing_enabled", method: "PUT", path: "/api/admin/flags/enable_lending", token: fixtureAdminToken,
+			body: `{}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "admin_flags_update_unknown", method: "PUT", path: "/api/admin/flags/enable_reviews", token: fixtureAdminToken,
+			body: `{"enabled":true}`,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "feature_disabled", method: "GET", path: "/api/loans", token: fixtureUserToken,
+			setup: func(srv *Server) { srv.flagService.flags[FlagLending] = FeatureFlag{Name: FlagLending} },
+		},
+		{
+			name: "feature_disabled_public", method: "GET", path: "/api/shared/lists/abc123", accept: "application/json", header: map[string]string{"Accept-Language": "id"},
+			setup: func(srv *Server) { srv.flagService.flags[FlagSharedLists] = FeatureFlag{Name: FlagSharedLists} },
+		},
+	})
+}
+
+// expectFilmReset expects a reset to delete the rows kept per film and
+// trash the films of an organization, then seed The Godfather into it
+func expectFilmReset(mock sqlmock.Sqlmock, organizationID uint) {
+	for _, table := range filmDataTables {
+		mock.ExpectExec(`DELETE FROM "` + table + `" WHERE film_id IN \(SELECT id FROM films WHERE organization_id = \$1\)`).
+			WithArgs(organizationID).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec(`UPDATE "films" SET "deleted_at"=\$1 WHERE "films"."organization_id" = \$2 AND "films"."deleted_at" IS NULL`).
+		WithArgs(sqlmock.AnyArg(), organizationID).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectQuery(`INSERT INTO "films"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(4, 1))
+}
+
+// Resets seed the catalog from testdata/seeds: The Godfather and user1
+func TestGoldenAdminReset(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "admin_reset", method: "POST", path: "/api/admin/reset", token: fixtureAdminToken,
+			setup: enableReset,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				expectFilmReset(mock, fixtureTenant.OrganizationID)
+				mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE "organizations"."slug" = \$1`).WillReturnRows(organizationRows(fixtureOrganization))
+				expectUser(mock, fixtureUser)
+				mock.ExpectExec(`UPDATE "users" SET "role"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			// Only the films of the admin's organization are reset, and seed users stay as they are
+			name: "admin_reset_other_organization", method: "POST", path: "/api/admin/reset", token: "film-club-admin-token",
+			setup: func(srv *Server) {
+				enableReset(srv)
+				srv.tokenStore.AddToken("film-club-admin-token", fixtureAdmin.Username, Tenant{OrganizationID: 2, Slug: "film-club"}, knownScopes)
+			},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+				mock.ExpectBegin()
+				expectFilmReset(mock, 2)
+				mock.ExpectQuery(`SELECT \* FROM "organizations" WHERE "organizations"."slug" = \$1`).WillReturnRows(organizationRows(fixtureOrganization))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "admin_reset_disabled", method: "POST", path: "/api/admin/reset", token: fixtureAdminToken,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureAdmin)
+			},
+		},
+		{
+			name: "admin_reset_not_admin", method: "POST", path: "/api/admin/reset", token: fixtureUserToken,
+			setup: enableReset,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectUser(mock, fixtureUser)
+			},
+		},
+		{
+			name: "memory_admin_reset", method: "POST", path: "/api/admin/reset", token: fixtureAdminToken,
+			setup: func(srv *Server) {
+				useMemoryStorage(srv)
+				enableReset(srv)
+			},
+		},
+	})
+}
+
+// The spec, Swagger UI, and frontend are embedded files served verbatim, so
+// they have no golden files of their own
+func TestGoldenOperations(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{name: "readyz", method: "GET", path: "/readyz"},
+		{name: "readyz_warming_up", method: "GET", path: "/readyz", setup: func(srv *Server) { srv.ready.Store(false) }},
+		{name: "options_films", method: "OPTIONS", path: "/api/films"},
+		{name: "options_film", method: "OPTIONS", path: "/api/films/2"},
+		{
+			name: "options_preflight", method: "OPTIONS", path: "/api/films/2/revisions/1/revert",
+			header: map[string]string{"Origin": "https://films.example.com", "Access-Control-Request-Method": "POST"},
+		},
+		{
+			name: "options_feature_disabled", method: "OPTIONS", path: "/api/shared/lists/abc123",
+			setup: func(srv *Server) { srv.flagService.flags[FlagSharedLists] = FeatureFlag{Name: FlagSharedLists} },
+		},
+		{name: "options_readyz", method: "OPTIONS", path: "/readyz"},
+		{name: "method_not_allowed", method: "PATCH", path: "/api/films/2", token: fixtureUserToken},
+		{name: "method_not_allowed_login", method: "GET", path: "/api/login"},
+		{name: "path_trailing_slash", method: "GET", path: "/api/films/?page=2"},
+		{name: "path_duplicate_slashes", method: "GET", path: "/api//films//2"},
+		{name: "path_trailing_slash_write", method: "POST", path: "/api/logout/", token: fixtureUserToken},
+		{name: "path_unknown", method: "GET", path: "/api/films/2/cast", token: fixtureUserToken},
+		{name: "path_dot_segments", method: "GET", path: "/api/films/../admin/users", token: fixtureUserToken},
+	})
+}
+
+func TestGoldenMemoryStorage(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "memory_login", method: "POST", path: "/api/login", setup: useMemoryStorage,
+			body:  `{"username":"admin","password":"admin123"}`,
+			scrub: []string{"token"},
+		},
+		{
+			name: "memory_films_query_page", method: "GET", path: "/api/films?page=1&page_size=1&q=" + url.QueryEscape("genre:Drama OR genre:Crime"), token: fixtureUserToken,
+			setup: useMemoryStorage,
+		},
+		{name: "memory_film", method: "GET", path: "/api/films/2", token: fixtureUserToken, setup: useMemoryStorage},
+		{name: "memory_film_not_found", method: "GET", path: "/api/films/9", token: fixtureUserToken, setup: useMemoryStorage},
+		{name: "memory_films_changes", method: "GET", path: "/api/films/changes?since=2025-01-10T00:00:00Z", token: fixtureUserToken, setup: useMemoryStorage},
+		{name: "memory_films_revisions", method: "GET", path: "/api/films/2/revisions", token: fixtureUserToken, setup: useMemoryStorage},
+		{name: "memory_films_revert_revision_not_found", method: "POST", path: "/api/films/2/revisions/3/revert", token: fixtureUserToken, setup: useMemoryStorage},
+		{name: "memory_films_lookup", method: "GET", path: "/api/films?ids=3,9,1", token: fixtureUserToken, setup: useMemoryStorage},
+		{
+			name: "memory_film_duplicate", method: "POST", path: "/api/films", token: fixtureUserToken, setup: useMemoryStorage,
+			body: `{"title":"the godfather","director":"Francis Ford Coppola","year":1972,"genre":"Crime"}`,
+		},
+		{
+			name: "memory_films_put_create_id_out_of_range", method: "PUT", path: "/api/films/5000", token: fixtureUserToken, setup: useMemoryStorage,
+			body:   `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			header: map[string]string{"Prefer": "create-if-missing"},
+		},
+		{
+			name: "memory_films_put_create", method: "PUT", path: "/api/films/10", token: fixtureUserToken, setup: useMemoryStorage,
+			body:   `{"title":"Parasite","director":"Bong Joon-ho","year":2019,"genre":"Thriller"}`,
+			header: map[string]string{"Prefer": "create-if-missing"},
+			scrub:  []string{"created_at", "updated_at"},
+			expect: func(mock sqlmock.Sqlmock) {
+				expectMeteringEvent(mock)
+				expectMeteringEvent(mock)
+			},
+		},
+	})
+}
+
+// envelopeHeader opts into the response envelope with a fixed request ID
+var envelopeHeader = map[string]string{"API-Version": envelopeVersion, "X-Request-ID": "golden-request"}
+
+func TestGoldenEnvelope(t *testing.T) {
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "envelope_film", method: "GET", path: "/api/films/2", token: fixtureUserToken, header: envelopeHeader,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[1]))
+			},
+			scrub: []string{"duration_ms"},
+		},
+		{
+			name: "envelope_films_page", method: "GET", path: "/api/films?page=2&page_size=1", token: fixtureUserToken, header: envelopeHeader,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "films"`).WillReturnRows(countRows(3))
+				mock.ExpectQuery(`SELECT \* FROM "films" .* ORDER BY id LIMIT \d+ OFFSET \d+`).
+					WillReturnRows(filmRows(fixtureFilms[1]))
+			},
+			scrub: []string{"duration_ms"},
+		},
+		{
+			name: "envelope_not_found", method: "GET", path: "/api/films/99", token: fixtureUserToken, header: envelopeHeader,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+			},
+			scrub: []string{"duration_ms"},
+		},
+		{
+			name: "envelope_validation_error", method: "POST", path: "/api/films", token: fixtureUserToken, header: envelopeHeader,
+			body:  `{"title":"","director":"","year":2019,"genre":"Thriller"}`,
+			scrub: []string{"duration_ms"},
+		},
+		{
+			name: "envelope_unauthorized", method: "GET", path: "/api/films", header: envelopeHeader,
+			scrub: []string{"duration_ms"},
+		},
+		{
+			name: "envelope_xml_passthrough", method: "GET", path: "/api/films/1", token: fixtureUserToken, accept: "application/xml", header: envelopeHeader,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows(fixtureFilms[0]))
+			},
+		},
+	})
+}
+
+func TestGoldenLocalizedErrors(t *testing.T) {
+	indonesian := map[string]string{"Accept-Language": "id-ID,id;q=0.9,en;q=0.8"}
+	runGoldenCases(t, []goldenCase{
+		{
+			name: "i18n_not_found", method: "GET", path: "/api/films/99", token: fixtureUserToken, header: indonesian,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+			},
+		},
+		{
+			name: "i18n_not_found_xml", method: "GET", path: "/api/films/99", token: fixtureUserToken, accept: "application/xml", header: indonesian,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT \* FROM "films" WHERE "films"."id" = \$1`).WillReturnRows(filmRows())
+			},
+		},
+		{
+			name: "i18n_validation_error", method: "POST", path: "/api/films", token: fixtureUserToken, header: indonesian,
+			body: `{"title":"","director":"","year":2019,"genre":"Thriller"}`,
+		},
+		{
+			name: "i18n_invalid_page_size", method: "GET", path: "/api/films?page=1&page_size=500", token: fixtureUserToken, header: indonesian,
+		},
+		{
+			name: "i18n_scope_missing", method: "POST", path: "/api/films", token: fixtureReaderToken, header: indonesian,
+			body: `{"title":"Heat","director":"Michael Mann","year":1995,"genre":"Crime"}`,
+		},
+		{
+			name: "i18n_field_not_one_of", method: "POST", path: "/api/films", token: fixtureUserToken, header: indonesian,
+			body: `{"title":"Heat","director":"Michael Mann","year":1995,"genre":"Opera"}`,
+		},
+		{
+			name: "i18n_unsupported_language", method: "POST", path: "/api/login", header: map[string]string{"Accept-Language": "fr-FR, fr;q=0.9"},
+			body: `{"username":"admin"}`,
+		},
+	})
+}
@@ -0,0 +1,1246 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// tokenInfo holds the owner, organization, scopes, and expiry of an issued
+// token, and the client that last used it
+type tokenInfo struct {
+	username  string
+	tenant    Tenant
+	scopes    []string
+	expiry    time.Time
+	created   time.Time
+	lastUsed  time.Time
+	ip        string
+	userAgent string
+}
+
+// tokenStoreShards is how many independently locked maps hold the tokens.
+// Every authenticated request writes to the map of its token, so one map
+// behind one lock would serialize all of them.
+const tokenStoreShards = 64
+
+// tokenShard holds the tokens hashing to it
+type tokenShard struct {
+	mu     sync.RWMutex
+	tokens map[string]tokenInfo // token -> owner and expiry time
+}
+
+// TokenStore manages active tokens. A token only ever locks its own shard;
+// operations over all tokens lock one shard after the other, so they see
+// each shard consistent but not all of them at the same instant.
+type TokenStore struct {
+	config *liveConfig
+	shards [tokenStoreShards]tokenShard
+}
+
+// NewTokenStore creates a new token store issuing tokens with the auth
+// settings of config
+func NewTokenStore(config *liveConfig) *TokenStore {
+	ts := &TokenStore{config: config}
+	for i := range ts.shards {
+		ts.shards[i].tokens = make(map[string]tokenInfo)
+	}
+	return ts
+}
+
+// shard returns the shard of a token, by its FNV-1a hash
+func (ts *TokenStore) shard(token string) *tokenShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(token); i++ {
+		hash ^= uint32(token[i])
+		hash *= 16777619
+	}
+	return &ts.shards[hash%tokenStoreShards]
+}
+
+// GenerateToken creates a new random token
+func (ts *TokenStore) GenerateToken() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// AddToken adds a token for a user acting for an organization with the
+// given scopes and expiry time
+func (ts *TokenStore) AddToken(token, username string, tenant Tenant, scopes []string) {
+	now := time.Now()
+	info := tokenInfo{
+		username: username,
+		tenant:   tenant,
+		scopes:   scopes,
+		expiry:   now.Add(ts.config.Load().Auth.TokenTTL),
+		created:  now,
+		lastUsed: now,
+	}
+	shard := ts.shard(token)
+	shard.mu.Lock()
+	shard.tokens[token] = info
+	shard.mu.Unlock()
+}
+
+// Touch records that a client used a token, extending its expiry when
+// sliding expiration is on
+func (ts *TokenStore) Touch(token, ip, userAgent string) {
+	auth := ts.config.Load().Auth
+	shard := ts.shard(token)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	info, exists := shard.tokens[token]
+	if !exists {
+		return
+	}
+	info.lastUsed = time.Now()
+	info.ip = ip
+	info.userAgent = userAgent
+	if auth.SlidingExpiration {
+		info.expiry = info.lastUsed.Add(auth.TokenTTL)
+		if limit := info.created.Add(auth.MaxTokenLifetime); info.expiry.After(limit) {
+			info.expiry = limit
+		}
+	}
+	shard.tokens[token] = info
+}
+
+// ValidateToken checks if token is valid and not expired
+func (ts *TokenStore) ValidateToken(token string) bool {
+	_, valid := ts.Lookup(token)
+	return valid
+}
+
+// Lookup returns what a token was issued with, reporting false when the
+// token is unknown or expired. Expired tokens are removed on the way.
+func (ts *TokenStore) Lookup(token string) (tokenInfo, bool) {
+	shard := ts.shard(token)
+	shard.mu.RLock()
+	info, exists := shard.tokens[token]
+	shard.mu.RUnlock()
+	if !exists {
+		return tokenInfo{}, false
+	}
+	if time.Now().After(info.expiry) {
+		shard.expire(token)
+		return tokenInfo{}, false
+	}
+	return info, true
+}
+
+// expire removes a token found expired under the read lock. A concurrent
+// Touch may have extended it meanwhile, so it is checked again.
+func (shard *tokenShard) expire(token string) {
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if info, exists := shard.tokens[token]; exists && time.Now().After(info.expiry) {
+		delete(shard.tokens, token)
+	}
+}
+
+// GetUsername returns the user a token was issued to
+func (ts *TokenStore) GetUsername(token string) string {
+	info, _ := ts.Lookup(token)
+	return info.username
+}
+
+// GetTenant returns the organization a token acts for
+func (ts *TokenStore) GetTenant(token string) Tenant {
+	info, _ := ts.Lookup(token)
+	return info.tenant
+}
+
+// GetScopes returns the scopes a token carries
+func (ts *TokenStore) GetScopes(token string) []string {
+	info, _ := ts.Lookup(token)
+	return info.scopes
+}
+
+// CountActive returns the number of tokens that haven't expired
+func (ts *TokenStore) CountActive() int {
+	now := time.Now()
+	active := 0
+	for i := range ts.shards {
+		shard := &ts.shards[i]
+		shard.mu.RLock()
+		for _, info := range shard.tokens {
+			if now.Before(info.expiry) {
+				active++
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return active
+}
+
+// removeWhere removes the tokens matching a condition, shard by shard, and
+// returns how many were removed. It stops after the first one with once.
+func (ts *TokenStore) removeWhere(match func(token string, info tokenInfo) bool, once bool) int {
+	removed := 0
+	for i := range ts.shards {
+		shard := &ts.shards[i]
+		shard.mu.Lock()
+		for token, info := range shard.tokens {
+			if match(token, info) {
+				delete(shard.tokens, token)
+				removed++
+				if once {
+					break
+				}
+			}
+		}
+		shard.mu.Unlock()
+		if once && removed > 0 {
+			break
+		}
+	}
+	return removed
+}
+
+// PurgeExpired removes every expired token and returns how many were removed
+func (ts *TokenStore) PurgeExpired() int {
+	now := time.Now()
+	return ts.removeWhere(func(_ string, info tokenInfo) bool {
+		return now.After(info.expiry)
+	}, false)
+}
+
+// RemoveToken removes a token (for logout)
+func (ts *TokenStore) RemoveToken(token string) {
+	shard := ts.shard(token)
+	shard.mu.Lock()
+	delete(shard.tokens, token)
+	shard.mu.Unlock()
+}
+
+// Sessions returns the active tokens of a user as sessions, oldest first,
+// marking the one of the current token
+func (ts *TokenStore) Sessions(username, currentToken string) []Session {
+	now := time.Now()
+	sessions := []Session{}
+	for i := range ts.shards {
+		shard := &ts.shards[i]
+		shard.mu.RLock()
+		for token, info := range shard.tokens {
+			if info.username != username || now.After(info.expiry) {
+				continue
+			}
+			sessions = append(sessions, Session{
+				ID:         sessionID(token),
+				CreatedAt:  info.created,
+				LastUsedAt: info.lastUsed,
+				ExpiresAt:  info.expiry,
+				IP:         info.ip,
+				UserAgent:  info.userAgent,
+				Current:    token == currentToken,
+			})
+		}
+		shard.mu.RUnlock()
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].CreatedAt.Equal(sessions[j].CreatedAt) {
+			return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+	return sessions
+}
+
+// RemoveSession removes the token of a user's session, reporting false
+// when the user has no such session
+func (ts *TokenStore) RemoveSession(username, id string) bool {
+	return ts.removeWhere(func(token string, info tokenInfo) bool {
+		return info.username == username && sessionID(token) == id
+	}, true) > 0
+}
+
+// RemoveUserTokens removes every token issued to a user and returns how
+// many were removed
+func (ts *TokenStore) RemoveUserTokens(username string) int {
+	return ts.removeWhere(func(_ string, info tokenInfo) bool {
+		return info.username == username
+	}, false)
+}
+
+// RemoveAll removes every token and returns how many were removed
+func (ts *TokenStore) RemoveAll() int {
+	return ts.removeWhere(func(string, tokenInfo) bool {
+		return true
+	}, false)
+}
+
+// contextKey namespaces values stored in request contexts
+type contextKey string
+
+const (
+	usernameContextKey contextKey = "username"
+	tokenContextKey    contextKey = "token"
+)
+
+// CORS middleware
+func (s *Server) enableCORS(w http.ResponseWriter, r *http.Request) {
+	cfg := s.currentConfig()
+	if origin := cfg.AllowOrigin(r.Header.Get("Origin")); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if origin != "*" {
+			w.Header().Add("Vary", "Origin")
+		}
+	}
+	w.Header().Set("Access-Control-Allow-Headers", strings.Join(cfg.CORS.AllowedHeaders, ", "))
+	w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID")
+}
+
+// Authentication middleware
+func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.enableCORS(w, r)
+
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" {
+			writeResponse(w, r, http.StatusUnauthorized, ErrorResponse{Error: "Authorization header required", Code: "auth_header_required"})
+			return
+		}
+
+		// Check for Bearer token format
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			writeResponse(w, r, http.StatusUnauthorized, ErrorResponse{Error: "Invalid authorization header format", Code: "auth_header_invalid"})
+			return
+		}
+
+		// One lookup, so the owner, tenant, and scopes all come from the same token state
+		token := parts[1]
+		info, valid := s.tokenStore.Lookup(token)
+		if !valid {
+			writeResponse(w, r, http.StatusUnauthorized, ErrorResponse{Error: "Invalid or expired token", Code: "token_invalid"})
+			return
+		}
+
+		s.requestMetrics.seeUser(info.username)
+		s.usageCounter.Record(info.username, requestEndpoint(s.spec, r))
+		s.tokenStore.Touch(token, clientIP(r), r.UserAgent())
+		ctx := context.WithValue(r.Context(), usernameContextKey, info.username)
+		ctx = context.WithValue(ctx, tokenContextKey, token)
+		ctx = context.WithValue(ctx, tenantContextKey, info.tenant)
+		ctx = context.WithValue(ctx, scopesContextKey, info.scopes)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// Admin middleware, requires an authenticated user with the admin role and
+// a token with the users:admin scope
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return Chain(s.requireAuth, s.adminOnly)(next)
+}
+
+// adminOnly requires the admin role and the users:admin scope. It runs
+// after requireAuth.
+func (s *Server) adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return Chain(s.requireRole("admin"), requireScope(scopeUsersAdmin))(next)
+}
+
+// currentUsername returns the authenticated user of a request
+func currentUsername(r *http.Request) string {
+	username, _ := r.Context().Value(usernameContextKey).(string)
+	return username
+}
+
+// currentUser loads the authenticated user of a request. It answers the
+// request itself and returns false when the user can't be loaded.
+func (s *Server) currentUser(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	user, err := s.users.GetUserByUsername(currentUsername(r))
+	if err != nil {
+		// The token outlived its user
+		if err.Error() == "user not found" {
+			writeResponse(w, r, http.StatusUnauthorized, ErrorResponse{Error: "User no longer exists", Code: "user_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve user", Code: "user_retrieve_failed"})
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+// loginHandler handles user login
+func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	s.enableCORS(w, r)
+
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	var loginReq LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+
+	if loginReq.Username == "" || loginReq.Password == "" {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Username and password are required", Code: "credentials_required"})
+		return
+	}
+
+	// Clients guessing passwords have to wait longer with every failure,
+	// and are banned after too many
+	ip, guard := clientIP(r), s.currentConfig().Auth.LoginGuard
+	retryAfter, banned := s.loginGuard.Attempt(ip, loginReq.Username, guard)
+	if banned > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(banned.Seconds()))))
+		writeResponse(w, r, http.StatusTooManyRequests, ErrorResponse{Error: "Too many failed logins, try again later", Code: "login_banned"})
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writeResponse(w, r, http.StatusTooManyRequests, ErrorResponse{Error: "Too many failed logins, wait before trying again", Code: "login_delayed"})
+		return
+	}
+
+	user, valid := s.users.ValidateUser(loginReq.Username, loginReq.Password)
+	if !valid {
+		s.loginGuard.Fail(ip, loginReq.Username, guard)
+		writeResponse(w, r, http.StatusUnauthorized, ErrorResponse{Error: "Invalid credentials", Code: "credentials_invalid"})
+		return
+	}
+	s.loginGuard.Succeed(ip, loginReq.Username)
+	if !user.Active {
+		writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Account is deactivated", Code: "account_deactivated"})
+		return
+	}
+
+	// The token acts for the organization the user belongs to when logging in
+	tenant, err := s.users.TenantOf(user)
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve organization", Code: "organization_retrieve_failed"})
+		return
+	}
+
+	scopes, err := grantScopes(user, tenant, loginReq.Scopes)
+	if err != nil {
+		if err.Error() == "unknown scope" {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Unknown scope", Code: "scope_unknown"})
+		} else {
+			writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Scope not allowed for user", Code: "scope_not_allowed"})
+		}
+		return
+	}
+
+	// Generate token
+	token := s.tokenStore.GenerateToken()
+	s.tokenStore.AddToken(token, user.Username, tenant, scopes)
+
+	// A deactivation since the check above signed the user out before this
+	// token existed, so look again and take the token back
+	current, err := s.users.GetUserByUsername(user.Username)
+	if err != nil || !current.Active {
+		s.tokenStore.RemoveToken(token)
+		if err != nil {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve user", Code: "user_retrieve_failed"})
+		} else {
+			writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Account is deactivated", Code: "account_deactivated"})
+		}
+		return
+	}
+	s.tokenStore.Touch(token, clientIP(r), r.UserAgent())
+
+	response := LoginResponse{Token: token, Scopes: scopes}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// logoutHandler handles user logout
+func (s *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	s.enableCORS(w, r)
+
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		writeResponse(w, r, http.StatusUnauthorized, ErrorResponse{Error: "Authorization header required", Code: "auth_header_required"})
+		return
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		writeResponse(w, r, http.StatusUnauthorized, ErrorResponse{Error: "Invalid authorization header format", Code: "auth_header_invalid"})
+		return
+	}
+
+	token := parts[1]
+	s.tokenStore.RemoveToken(token)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(SuccessResponse{Message: "Logged out successfully"})
+}
+
+// getFilmsHandler handles getting all films
+func (s *Server) getFilmsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	query := r.URL.Query()
+	var filter *FilmQuery
+	if q := strings.TrimSpace(query.Get("q")); q != "" {
+		var err error
+		if filter, err = ParseFilmQuery(q); err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error(), Code: "invalid_query", Params: Params{"detail": err}})
+			return
+		}
+	}
+	includes, err := parseFilmIncludes(r)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if query.Has("ids") {
+		if filter != nil || query.Has("cursor") || query.Has("page") {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "ids can't be combined with q, page, or cursor", Code: "lookup_ids_combined"})
+			return
+		}
+		ids, err := parseFilmIDs(query.Get("ids"))
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, errorResponse(err))
+			return
+		}
+		s.lookupFilms(w, r, ids, includes)
+		return
+	}
+	if query.Has("cursor") || query.Has("page") {
+		s.getFilmsPageHandler(w, r, filter, includes)
+		return
+	}
+
+	films, err := shareRead(&s.filmReads, filmListKey(r), func() ([]Film, error) {
+		films, err := s.tenantFilms(r).GetAllFilms(filter)
+		if err == nil {
+			err = s.includeFilmRelations(includes, films)
+		}
+		return withFilmLinks(films), err
+	})
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve films", Code: "films_retrieve_failed"})
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, films)
+}
+
+// getFilmsPageHandler handles paginated film listings. ?page= selects offset
+// pagination, ?cursor= (empty for the first page) selects keyset pagination.
+func (s *Server) getFilmsPageHandler(w http.ResponseWriter, r *http.Request, filter *FilmQuery, includes map[string]bool) {
+	query := r.URL.Query()
+	pageSize, err := parsePageSize(query)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	response := FilmPage{PageSize: pageSize}
+	if query.Has("cursor") {
+		var cursor *FilmCursor
+		order := query.Get("order")
+		if value := query.Get("cursor"); value != "" {
+			cursor, err = DecodeFilmCursor(value)
+			if err != nil {
+				writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid cursor", Code: "invalid_cursor"})
+				return
+			}
+			order = cursor.Order
+		}
+		if order == "" {
+			order = cursorOrderID
+		}
+		if order != cursorOrderID && order != cursorOrderCreatedAt {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "order must be id or created_at", Code: "invalid_order"})
+			return
+		}
+
+		read, err := shareRead(&s.filmReads, filmListKey(r), func() (filmPageRead, error) {
+			films, next, err := s.tenantFilms(r).GetFilmsAfter(filter, cursor, order, pageSize)
+			if err == nil {
+				err = s.includeFilmRelations(includes, films)
+			}
+			return filmPageRead{films: withFilmLinks(films), next: next}, err
+		})
+		if err != nil {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve films", Code: "films_retrieve_failed"})
+			return
+		}
+		response.Data = read.films
+		if read.next != nil {
+			response.NextCursor = read.next.Encode()
+		}
+		response.Links = cursorPageLinks(r, read.next)
+	} else {
+		page, err := strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "page must be a positive integer", Code: "invalid_page"})
+			return
+		}
+
+		read, err := shareRead(&s.filmReads, filmListKey(r), func() (filmPageRead, error) {
+			films, total, err := s.tenantFilms(r).GetFilmsPage(filter, page, pageSize)
+			if err == nil {
+				err = s.includeFilmRelations(includes, films)
+			}
+			return filmPageRead{films: withFilmLinks(films), total: total}, err
+		})
+		if err != nil {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve films", Code: "films_retrieve_failed"})
+			return
+		}
+		response.Data = read.films
+		response.Page = page
+		response.Total = read.total
+		response.Links = offsetPageLinks(r, page, pageSize, read.total)
+	}
+
+	if response.Data == nil {
+		response.Data = []Film{}
+	}
+	writeResponse(w, r, http.StatusOK, response)
+}
+
+// getFilmHandler handles getting a single film
+func (s *Server) getFilmHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	// Extract ID from URL path
+	path := strings.TrimPrefix(r.URL.Path, "/api/films/")
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid film ID", Code: "invalid_film_id"})
+		return
+	}
+	includes, err := parseFilmIncludes(r)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	film, err := s.tenantFilms(r).GetFilmByID(uint(id))
+	if err != nil {
+		if err.Error() == "film not found" {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Film not found", Code: "film_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve film", Code: "film_retrieve_failed"})
+		}
+		return
+	}
+	films := []Film{*film}
+	if err := s.includeFilmRelations(includes, films); err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve film", Code: "film_retrieve_failed"})
+		return
+	}
+	film = &films[0]
+	s.viewCounter.Record(film.ID)
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, film.Version))
+	writeResponse(w, r, http.StatusOK, withLinks(film))
+}
+
+// addFilmHandler handles adding a new film
+func (s *Server) addFilmHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Failed to read request body", Code: "body_read_failed"})
+		return
+	}
+
+	// Replay the stored response when the client retries with the same Idempotency-Key.
+	// Keys are scoped to the user and their organization so clients can't collide
+	// with each other, whatever token they send. A claimed key is released again
+	// unless the film was created, so the client can retry.
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	var creator *User
+	completed := false
+	if idempotencyKey != "" {
+		var ok bool
+		if creator, ok = s.currentUser(w, r); !ok {
+			return
+		}
+		idempotencyKey = fmt.Sprintf("%d:%d:%s", currentTenant(r).OrganizationID, creator.ID, idempotencyKey)
+		stored, state := s.idempotencyStore.Begin(idempotencyKey, s.idempotencyStore.Fingerprint(body))
+		switch state {
+		case idempotencyReplay:
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.statusCode)
+			w.Write(stored.body)
+			return
+		case idempotencyInFlight:
+			writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "A request with this Idempotency-Key is already in progress", Code: "idempotency_key_in_progress"})
+			return
+		case idempotencyMismatch:
+			writeResponse(w, r, http.StatusUnprocessableEntity, ErrorResponse{Error: "Idempotency-Key was already used with a different request body", Code: "idempotency_key_reused"})
+			return
+		}
+		defer func() {
+			if !completed {
+				s.idempotencyStore.Release(idempotencyKey)
+			}
+		}()
+	}
+
+	var filmReq FilmRequest
+	if err := json.Unmarshal(body, &filmReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+
+	hc := HookContext{Action: ActionCreate, Request: r, Username: currentUsername(r)}
+	if err := s.plugins.runFilmPreValidate(hc, &filmReq); err != nil {
+		writeResponse(w, r, http.StatusUnprocessableEntity, errorResponse(err))
+		return
+	}
+
+	if validationErr := ValidateFilmRequest(&filmReq, s.currentConfig()); validationErr != nil {
+		writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: validationErr.Fields})
+		return
+	}
+
+	if creator == nil {
+		var ok bool
+		if creator, ok = s.currentUser(w, r); !ok {
+			return
+		}
+	}
+
+	newFilm, err := s.tenantFilms(r).CreateFilm(filmReq, creator)
+	if err != nil {
+		writeCreateFilmError(w, r, err)
+		return
+	}
+
+	response, err := json.Marshal(withLinks(newFilm))
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to encode film", Code: "film_encode_failed"})
+		return
+	}
+	if idempotencyKey != "" {
+		s.idempotencyStore.Complete(idempotencyKey, http.StatusCreated, response)
+		completed = true
+	}
+	s.meteringService.RecordRequest(r, MeterWrite, 1)
+	s.meteringService.RecordRequest(r, MeterStorageBytes, int64(len(response)))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(response)
+}
+
+// writeCreateFilmError answers with the status for an error creating a film
+func writeCreateFilmError(w http.ResponseWriter, r *http.Request, err error) {
+	var quotaErr *QuotaError
+	var dailyQuotaErr *DailyQuotaError
+	var hookErr *HookError
+	var duplicateErr *DuplicateFilmError
+	var rangeErr *FilmIDRangeError
+	if errors.As(err, &quotaErr) {
+		writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Film quota exceeded: " + quotaErr.Error(), Code: "film_quota_exceeded", Params: Params{"detail": quotaErr}})
+	} else if errors.As(err, &dailyQuotaErr) {
+		writeDailyQuotaExceeded(w, r, dailyQuotaErr)
+	} else if errors.As(err, &hookErr) {
+		writeResponse(w, r, http.StatusUnprocessableEntity, errorResponse(hookErr))
+	} else if errors.As(err, &duplicateErr) {
+		writeDuplicateFilm(w, r, duplicateErr)
+	} else if err.Error() == "film id taken" {
+		writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "Film ID is already taken", Code: "film_id_taken"})
+	} else if errors.As(err, &rangeErr) {
+		writeResponse(w, r, http.StatusUnprocessableEntity, ErrorResponse{Error: fmt.Sprintf("Film ID must be at most %d", rangeErr.Max), Code: "film_id_out_of_range", Params: Params{"max": rangeErr.Max}})
+	} else {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to create film", Code: "film_create_failed"})
+	}
+}
+
+// updateFilmHandler handles updating a film
+func (s *Server) updateFilmHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	// Extract ID from URL path
+	path := strings.TrimPrefix(r.URL.Path, "/api/films/")
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid film ID", Code: "invalid_film_id"})
+		return
+	}
+
+	var filmReq FilmRequest
+	if err := json.NewDecoder(r.Body).Decode(&filmReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+
+	// If-Match takes precedence over the version field of the body
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" {
+		version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`))
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid If-Match header", Code: "invalid_if_match"})
+			return
+		}
+		filmReq.Version = &version
+	}
+
+	hc := HookContext{Action: ActionUpdate, Request: r, Username: currentUsername(r)}
+	if err := s.plugins.runFilmPreValidate(hc, &filmReq); err != nil {
+		writeResponse(w, r, http.StatusUnprocessableEntity, errorResponse(err))
+		return
+	}
+
+	if validationErr := ValidateFilmRequest(&filmReq, s.currentConfig()); validationErr != nil {
+		writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: validationErr.Fields})
+		return
+	}
+
+	editor, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	updatedFilm, err := s.tenantFilms(r).UpdateFilm(uint(id), filmReq, editor)
+	if err != nil && err.Error() == "film not found" && s.createsOnPut(r, filmReq) {
+		s.createFilmOnPut(w, r, uint(id), filmReq, editor)
+		return
+	}
+	if err != nil {
+		writeUpdateFilmError(w, r, err)
+		return
+	}
+
+	s.meteringService.RecordRequest(r, MeterWrite, 1)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, updatedFilm.Version))
+	json.NewEncoder(w).Encode(withLinks(updatedFilm))
+}
+
+// preferCreateIfMissing is the Prefer token asking PUT to create missing films
+const preferCreateIfMissing = "create-if-missing"
+
+// createsOnPut reports whether a PUT to a missing film creates it: the
+// server or the client opted in, and the client doesn't expect a version of
+// the film to exist already
+func (s *Server) createsOnPut(r *http.Request, filmReq FilmRequest) bool {
+	if filmReq.Version != nil || r.Header.Get("If-Match") != "" {
+		return false
+	}
+	return s.cfg.Server.PutCreatesFilms || prefers(r, preferCreateIfMissing)
+}
+
+// prefers reports whether a request asks for a preference in its Prefer header
+func prefers(r *http.Request, preference string) bool {
+	for _, value := range r.Header.Values("Prefer") {
+		for _, token := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(token), "=")
+			if strings.EqualFold(strings.TrimSpace(name), preference) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// createFilmOnPut creates the film a PUT names when there is none, so sync
+// clients can mirror a catalog, IDs included, with PUT alone
+func (s *Server) createFilmOnPut(w http.ResponseWriter, r *http.Request, id uint, filmReq FilmRequest, creator *User) {
+	newFilm, err := s.tenantFilms(r).CreateFilmAt(id, filmReq, creator)
+	if err != nil {
+		writeCreateFilmError(w, r, err)
+		return
+	}
+
+	response, err := json.Marshal(withLinks(newFilm))
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to encode film", Code: "film_encode_failed"})
+		return
+	}
+	s.meteringService.RecordRequest(r, MeterWrite, 1)
+	s.meteringService.RecordRequest(r, MeterStorageBytes, int64(len(response)))
+
+	if prefers(r, preferCreateIfMissing) {
+		w.Header().Set("Preference-Applied", preferCreateIfMissing)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", filmPath(newFilm.ID))
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, newFilm.Version))
+	w.WriteHeader(http.StatusCreated)
+	w.Write(response)
+}
+
+// writeUpdateFilmError answers with the status for an error updating a film
+func writeUpdateFilmError(w http.ResponseWriter, r *http.Request, err error) {
+	var hookErr *HookError
+	var duplicateErr *DuplicateFilmError
+	var conflictErr *VersionConflictError
+	if errors.As(err, &hookErr) {
+		writeResponse(w, r, http.StatusUnprocessableEntity, errorResponse(hookErr))
+	} else if errors.As(err, &duplicateErr) {
+		writeDuplicateFilm(w, r, duplicateErr)
+	} else if errors.As(err, &conflictErr) {
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, conflictErr.Current.Version))
+		writeResponse(w, r, http.StatusConflict, VersionConflictResponse{
+			Error:   "Film was modified by another request",
+			Code:    "film_version_conflict",
+			Current: *withLinks(conflictErr.Current),
+		})
+	} else if err.Error() == "film not found" {
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Film not found", Code: "film_not_found"})
+	} else if err.Error() == "not the film creator" {
+		writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Only the creator of a film or an admin can change it", Code: "film_not_creator"})
+	} else {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update film", Code: "film_update_failed"})
+	}
+}
+
+// writeDuplicateFilm answers 409 with a pointer to the film that already exists
+func writeDuplicateFilm(w http.ResponseWriter, r *http.Request, duplicateErr *DuplicateFilmError) {
+	location := filmPath(duplicateErr.Existing.ID)
+	w.Header().Set("Location", location)
+	writeResponse(w, r, http.StatusConflict, ConflictResponse{
+		Error:      "Film already exists",
+		Code:       "film_exists",
+		ExistingID: duplicateErr.Existing.ID,
+		Location:   location,
+	})
+}
+
+// writeDailyQuotaExceeded answers 429 with the usage of a user out of daily
+// film quota, asking them to retry once it resets
+func writeDailyQuotaExceeded(w http.ResponseWriter, r *http.Request, quotaErr *DailyQuotaError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(quotaErr.RetryAfter.Seconds()))))
+	writeResponse(w, r, http.StatusTooManyRequests, ErrorResponse{Error: fmt.Sprintf("Daily film quota exceeded: %d of %d films already created today", quotaErr.Used, quotaErr.Limit), Code: "daily_film_quota_exceeded", Params: Params{"used": quotaErr.Used, "limit": quotaErr.Limit}})
+}
+
+// deleteFilmHandler handles deleting a film
+func (s *Server) deleteFilmHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	// Extract ID from URL path
+	path := strings.TrimPrefix(r.URL.Path, "/api/films/")
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid film ID", Code: "invalid_film_id"})
+		return
+	}
+
+	editor, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	err = s.tenantFilms(r).DeleteFilm(uint(id), editor)
+	if err != nil {
+		var hookErr *HookError
+		if errors.As(err, &hookErr) {
+			writeResponse(w, r, http.StatusUnprocessableEntity, errorResponse(hookErr))
+		} else if err.Error() == "film not found" {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Film not found", Code: "film_not_found"})
+		} else if err.Error() == "not the film creator" {
+			writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Only the creator of a film or an admin can change it", Code: "film_not_creator"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete film", Code: "film_delete_failed"})
+		}
+		return
+	}
+
+	s.meteringService.RecordRequest(r, MeterWrite, 1)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Route handler to distinguish between different endpoints (protected)
+func (s *Server) filmsHandler(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	if path == "/api/films" {
+		switch r.Method {
+		case "GET":
+			s.getFilmsHandler(w, r)
+		case "POST":
+			s.addFilmHandler(w, r)
+		default:
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		}
+	} else if path == "/api/films/batch" {
+		switch r.Method {
+		case "POST":
+			s.batchCreateFilmsHandler(w, r)
+		case "DELETE":
+			s.batchDeleteFilmsHandler(w, r)
+		default:
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		}
+	} else if path == "/api/films/changes" {
+		s.filmChangesHandler(w, r)
+	} else if path == "/api/films/lookup" {
+		s.lookupFilmsHandler(w, r)
+	} else if path == "/api/films/search" {
+		s.searchFilmsHandler(w, r)
+	} else if path == "/api/films/suggest" {
+		s.suggestFilmsHandler(w, r)
+	} else if path == "/api/films/most-viewed" {
+		s.mostViewedFilmsHandler(w, r)
+	} else if path == "/api/films/trending" {
+		s.trendingFilmsHandler(w, r)
+	} else if strings.HasPrefix(path, "/api/films/") && strings.HasSuffix(path, "/poster") {
+		s.filmPosterHandler(w, r)
+	} else if strings.HasPrefix(path, "/api/films/") && strings.HasSuffix(path, "/similar") {
+		s.similarFilmsHandler(w, r)
+	} else if strings.HasPrefix(path, "/api/films/") && strings.Contains(path, "/revisions") {
+		s.filmRevisionsHandler(w, r)
+	} else if strings.HasPrefix(path, "/api/films/") && strings.HasSuffix(path, "/copies") {
+		s.requireFlag(FlagLending)(s.filmCopiesHandler)(w, r)
+	} else if strings.HasPrefix(path, "/api/films/") {
+		switch r.Method {
+		case "GET":
+			s.getFilmHandler(w, r)
+		case "PUT":
+			s.updateFilmHandler(w, r)
+		case "DELETE":
+			s.deleteFilmHandler(w, r)
+		default:
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		}
+	} else {
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Not found", Code: "not_found"})
+	}
+}
+
+// swaggerHandler serves the swagger YAML file and UI
+func (s *Server) swaggerHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := s.currentConfig()
+	if r.URL.Path == "/swagger/" || r.URL.Path == "/swagger/index.html" {
+		// Serve Swagger UI HTML, loading the UI from a swagger-ui-dist copy
+		swaggerUIURL := strings.TrimSuffix(cfg.Server.SwaggerUIURL, "/")
+		html := `<!DOCTYPE html>
+<html>
+<head>
+    <title>API Documentation</title>
+    <link rel="stylesheet" type="text/css" href="` + swaggerUIURL + `/swagger-ui.css" />
+</head>
+<body>
+    <div id="swagger-ui"></div>
+    <script src="` + swaggerUIURL + `/swagger-ui-bundle.js"></script>
+    <script>
+        SwaggerUIBundle({
+            url: '/swagger.yaml',
+            dom_id: '#swagger-ui',
+            presets: [
+                SwaggerUIBundle.presets.apis,
+                SwaggerUIBundle.presets.standalone
+            ]
+        });
+    </script>
+</body>
+</html>`
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(html))
+	} else if r.URL.Path == "/swagger.yaml" {
+		// Serve the YAML file
+		yamlContent, err := readAsset(cfg.Server.AssetsDir, "swagger.yaml")
+		if err != nil {
+			http.Error(w, "Swagger YAML file not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-yaml")
+		w.Write(yamlContent)
+	} else {
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// shutdownTimeout bounds how long serve waits for open requests on shutdown
+const shutdownTimeout = 30 * time.Second
+
+// serve runs the API server with cfg, loaded from args, until SIGINT or
+// SIGTERM, then lets running requests finish and stops the background jobs
+func serve(cfg *Config, args []string) {
+	log.Printf("⚙️  Config: port=%s db=%s:%s/%s token_ttl=%s log_level=%s",
+		cfg.Server.Port, cfg.Database.Host, cfg.Database.Port, cfg.Database.DBName, cfg.Auth.TokenTTL, cfg.Logging.Level)
+	srv, err := New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Reload runtime settings on SIGHUP
+	stopReload := watchReload(srv, args)
+	defer stopReload()
+
+	// Alert admins about error-rate spikes
+	srv.anomalyMonitor.Start()
+
+	fmt.Printf("🎬 Film REST API Server starting on http://localhost:%s\n", cfg.Server.Port)
+	fmt.Println("🔐 Authentication Endpoints:")
+	fmt.Println("   POST   /api/login     - User login")
+	fmt.Println("   POST   /api/logout    - User logout")
+	fmt.Println("   POST   /api/logout/all - Revoke every token of the current user (requires auth)")
+	fmt.Println("   POST   /api/token/introspect - Describe a token issued by this server (requires auth)")
+	fmt.Println("   POST   /api/password-reset - Mail a password reset code")
+	fmt.Println("   POST   /api/password-reset/confirm - Set a new password with the code")
+	fmt.Println("📋 Protected API Endpoints:")
+	fmt.Println("   GET    /api/films     - Get all films (requires auth)")
+	fmt.Println("   POST   /api/films     - Add new film (requires auth)")
+	fmt.Println("   POST   /api/films/batch - Add several films (requires auth)")
+	fmt.Println("   DELETE /api/films/batch - Delete films by IDs or filter (requires auth)")
+	fmt.Println("   GET    /api/films/{id} - Get a film (requires auth)")
+	fmt.Println("   GET    /api/films/stream - Export the catalog as NDJSON, one film per line (requires auth)")
+	fmt.Println("   GET    /api/films/changes?since= - Films changed or deleted since a checkpoint, for offline sync (requires auth)")
+	fmt.Println("   POST   /api/films/lookup - Fetch films by ID list, also GET /api/films?ids= (requires auth)")
+	fmt.Println("   GET    /api/films/search?q= - Typo-tolerant film search (requires auth)")
+	fmt.Println("   GET    /api/films/suggest?q= - Title and director suggestions for typeahead (requires auth)")
+	fmt.Println("   GET    /api/films/most-viewed - Films viewed most in recent days (requires auth)")
+	fmt.Println("   GET    /api/films/trending - Films with the most recent views and loans (requires auth)")
+	fmt.Println("   GET    /api/films/{id}/similar - Films like this one (requires auth)")
+	fmt.Println("   GET    /api/films/{id}/copies - Physical copies and availability (requires auth)")
+	fmt.Println("   POST   /api/films/{id}/copies - Add a physical copy (admin)")
+	fmt.Println("   PUT    /api/films/{id} - Update film (requires auth)")
+	fmt.Println("   GET    /api/films/{id}/revisions - Earlier versions of a film, newest first (requires auth)")
+	fmt.Println("   POST   /api/films/{id}/revisions/{version}/revert - Restore an earlier version of a film (requires auth)")
+	fmt.Println("   DELETE /api/films/{id} - Delete film (requires auth)")
+	fmt.Println("   GET    /api/collections - List film collections (requires auth)")
+	fmt.Println("   POST   /api/collections - Add collection (admin)")
+	fmt.Println("   GET    /api/collections/{id} - Get a collection (requires auth)")
+	fmt.Println("   PUT    /api/collections/{id} - Update collection and its film order (admin)")
+	fmt.Println("   DELETE /api/collections/{id} - Delete collection (admin)")
+	fmt.Println("   GET    /api/lists     - Your film lists (requires auth)")
+	fmt.Println("   POST   /api/lists     - Create list (requires auth)")
+	fmt.Println("   GET    /api/lists/{id} - Get your list or a public one (requires auth)")
+	fmt.Println("   PUT    /api/lists/{id} - Rename list or change visibility (requires auth)")
+	fmt.Println("   DELETE /api/lists/{id} - Delete list (requires auth)")
+	fmt.Println("   POST   /api/lists/{id}/films - Add film to list (requires auth)")
+	fmt.Println("   PUT    /api/lists/{id}/films - Reorder list (requires auth)")
+	fmt.Println("   DELETE /api/lists/{id}/films/{film_id} - Remove film from list (requires auth)")
+	fmt.Println("   POST   /api/copies/{id}/borrow - Borrow a copy (requires auth)")
+	fmt.Println("   POST   /api/copies/{id}/return - Return a copy (requires auth)")
+	fmt.Println("   DELETE /api/copies/{id} - Remove a copy (admin)")
+	fmt.Println("   GET    /api/loans     - Your open loans, ?overdue=true for overdue ones (requires auth)")
+	fmt.Println("   GET    /api/screenings - Screening schedule, ?from=&to= (requires auth)")
+	fmt.Println("   GET    /api/screenings/{id} - Get screening (requires auth)")
+	fmt.Println("   POST   /api/screenings - Schedule a screening (admin)")
+	fmt.Println("   PUT    /api/screenings/{id} - Reschedule a screening (admin)")
+	fmt.Println("   DELETE /api/screenings/{id} - Cancel a screening (admin)")
+	fmt.Println("   GET    /api/usage     - Daily billable usage (requires auth)")
+	fmt.Println("   GET    /api/me        - Current user profile (requires auth)")
+	fmt.Println("   PUT    /api/me        - Update email, display name, avatar (requires auth)")
+	fmt.Println("   DELETE /api/me        - Delete your account, anonymizing your activity (requires auth)")
+	fmt.Println("   GET    /api/me/export - Download everything stored about you (requires auth)")
+	fmt.Println("   GET    /api/me/limits - How many films you may still create today (requires auth)")
+	fmt.Println("   POST   /api/me/email/verify - Confirm your email address with the mailed code (requires auth)")
+	fmt.Println("   GET    /api/me/sessions - Your signed-in devices (requires auth)")
+	fmt.Println("   DELETE /api/me/sessions/{id} - Sign a device out (requires auth)")
+	fmt.Println("   GET    /api/me/notifications - Your notifications, ?unread=true for unread ones (requires auth)")
+	fmt.Println("   POST   /api/me/notifications/{id}/read - Mark a notification as read (requires auth)")
+	fmt.Println("   POST   /api/me/notifications/read - Mark all notifications as read (requires auth)")
+	fmt.Println("🔗 Public Endpoints:")
+	fmt.Println("   GET    /api/shared/lists/{token} - Public film list")
+	fmt.Println("🛡️  Admin Endpoints:")
+	fmt.Println("   GET    /api/rules     - List scripted film rules")
+	fmt.Println("   POST   /api/rules     - Add film rule")
+	fmt.Println("   PUT    /api/rules/{id} - Update film rule")
+	fmt.Println("   DELETE /api/rules/{id} - Delete film rule")
+	fmt.Println("   POST   /api/rules/test - Dry-run a rule expression")
+	fmt.Println("   GET    /api/webhooks  - List webhook subscriptions")
+	fmt.Println("   POST   /api/webhooks  - Subscribe to film events")
+	fmt.Println("   PUT    /api/webhooks/{id} - Update subscription")
+	fmt.Println("   DELETE /api/webhooks/{id} - Delete subscription")
+	fmt.Println("   GET    /api/exports   - List catalog exports")
+	fmt.Println("   POST   /api/exports   - Create full or differential export")
+	fmt.Println("   GET    /api/exports/{id}/files/{name} - Download export file")
+	fmt.Println("   GET    /api/admin/stats - Dashboard statistics")
+	fmt.Println("   GET    /api/admin/users - User directory, ?search=, ?role=, ?page=")
+	fmt.Println("   POST   /api/admin/users/{username}/deactivate - Deactivate an account and sign it out everywhere")
+	fmt.Println("   POST   /api/admin/users/{username}/reactivate - Reactivate an account")
+	fmt.Println("   GET    /api/admin/export - Stream a backup of every organization, ?format=ndjson for gzipped NDJSON")
+	fmt.Println("   POST   /api/admin/import - Restore a backup, ?mode=replace to empty the tables first")
+	fmt.Println("   GET    /api/admin/queue - Job queue and worker metrics")
+	fmt.Println("   GET    /api/admin/metrics/history - Hourly metrics snapshots")
+	fmt.Println("   GET    /api/admin/loans - Who has which copies, ?overdue=true for overdue loans")
+	fmt.Println("   GET    /api/admin/read-only - Show read-only mode")
+	fmt.Println("   PUT    /api/admin/read-only - Switch read-only mode")
+	fmt.Println("   GET    /api/admin/maintenance - Show maintenance mode")
+	fmt.Println("   PUT    /api/admin/maintenance - Switch maintenance mode")
+	fmt.Println("   GET    /api/admin/jobs - List scheduled jobs")
+	fmt.Println("   PUT    /api/admin/jobs/{name} - Reschedule, pause, or resume a job")
+	fmt.Println("   POST   /api/admin/jobs/{name}/run - Run a job now")
+	fmt.Println("   POST   /api/admin/jobs/{name}/cancel - Cancel a running job")
+	fmt.Println("   GET    /api/admin/flags - List feature flags")
+	fmt.Println("   PUT    /api/admin/flags/{name} - Turn a feature on or off")
+	fmt.Println("   GET    /api/orgs      - List organizations")
+	fmt.Println("   POST   /api/orgs      - Create organization")
+	fmt.Println("   PUT    /api/orgs/{id} - Rename organization")
+	fmt.Println("   DELETE /api/orgs/{id} - Delete empty organization")
+	fmt.Println("   GET    /api/orgs/{id}/members - List organization members")
+	fmt.Println("   PUT    /api/orgs/{id}/members/{username} - Move a user into the organization")
+	fmt.Printf("📚 API Documentation: http://localhost:%s/swagger/\n", cfg.Server.Port)
+	fmt.Printf("🌐 Web Interface: http://localhost:%s\n", cfg.Server.Port)
+	fmt.Println("👤 Default users: admin/admin123, user1/password123, demo/demo456")
+	if cfg.Storage.Backend == storageMemory {
+		fmt.Println("🗄️  Storage: in memory, films and users only")
+	} else {
+		fmt.Println("🗄️  Database: PostgreSQL")
+	}
+
+	server := &http.Server{Addr: cfg.Addr(), Handler: srv}
+	if cfg.Server.H2C {
+		// Clients that know the server speaks HTTP/2 send its preface right
+		// away; everyone else keeps using HTTP/1.1 on the same port
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+		fmt.Println("🔀 HTTP/2 without TLS (h2c) enabled")
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		log.Println("🛑 Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Warning: Failed to finish open requests: %v", err)
+		}
+	}()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	if err := srv.Close(); err != nil {
+		log.Printf("Warning: Failed to close the database: %v", err)
+	}
+}
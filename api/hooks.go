@@ -0,0 +1,184 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// Actions reported to plugin hooks
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// HookContext describes the operation a hook is running for. Request and
+// Username are only set for hooks that run in the HTTP layer (pre-validate).
+type HookContext struct {
+	Action   string
+	Request  *http.Request
+	Username string
+}
+
+// FilmHooks are the lifecycle points a plugin can attach to for films.
+// Pre-validate may normalize the payload before the built-in validation,
+// pre-persist may adjust the record right before it is written, and
+// post-commit observes the stored record. Returning an error from the first
+// two rejects the operation.
+type FilmHooks struct {
+	PreValidate func(hc HookContext, filmReq *FilmRequest) error
+	PrePersist  func(hc HookContext, film *Film) error
+	PostCommit  func(hc HookContext, film *Film)
+}
+
+// UserHooks are the lifecycle points a plugin can attach to for users
+type UserHooks struct {
+	PreValidate func(hc HookContext, user *User) error
+	PrePersist  func(hc HookContext, user *User) error
+	PostCommit  func(hc HookContext, user *User)
+}
+
+// Plugin bundles the hooks contributed by one extension
+type Plugin struct {
+	Name  string
+	Films FilmHooks
+	Users UserHooks
+}
+
+// HookError is returned when a plugin rejects an operation
+type HookError struct {
+	Plugin string
+	Err    error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("rejected by plugin %s: %v", e.Plugin, e.Err)
+}
+
+func (e *HookError) ErrorCode() (string, Params) {
+	return "plugin_rejected", Params{"plugin": e.Plugin, "reason": e.Err}
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	compiledMu      sync.RWMutex
+	compiledPlugins []Plugin
+)
+
+// RegisterPlugin adds a plugin to every server. Compiled-in plugins call it
+// from init(), usually in a file guarded by a build tag so deployments opt in
+// with `go build -tags <name>`.
+func RegisterPlugin(p Plugin) {
+	compiledMu.Lock()
+	defer compiledMu.Unlock()
+	compiledPlugins = append(compiledPlugins, p)
+	log.Printf("🔌 Registered plugin %s", p.Name)
+}
+
+// Plugins are the plugins hooked into the film and user changes of one
+// server: the compiled-in ones and those the server adds itself, like its
+// film rules and webhooks
+type Plugins struct {
+	mu   sync.RWMutex
+	list []Plugin
+}
+
+// newPlugins returns the plugins of a new server, starting with the compiled-in ones
+func newPlugins() *Plugins {
+	compiledMu.RLock()
+	defer compiledMu.RUnlock()
+	return &Plugins{list: append([]Plugin(nil), compiledPlugins...)}
+}
+
+// Register adds a plugin to the server
+func (ps *Plugins) Register(p Plugin) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.list = append(ps.list, p)
+}
+
+// registered returns a snapshot of the plugins in registration order. A nil
+// set has none.
+func (ps *Plugins) registered() []Plugin {
+	if ps == nil {
+		return nil
+	}
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return append([]Plugin(nil), ps.list...)
+}
+
+// runFilmPreValidate runs the pre-validate hooks for a film payload
+func (ps *Plugins) runFilmPreValidate(hc HookContext, filmReq *FilmRequest) error {
+	for _, p := range ps.registered() {
+		if p.Films.PreValidate == nil {
+			continue
+		}
+		if err := p.Films.PreValidate(hc, filmReq); err != nil {
+			return &HookError{Plugin: p.Name, Err: err}
+		}
+	}
+	return nil
+}
+
+// runFilmPrePersist runs the pre-persist hooks for a film
+func (ps *Plugins) runFilmPrePersist(hc HookContext, film *Film) error {
+	for _, p := range ps.registered() {
+		if p.Films.PrePersist == nil {
+			continue
+		}
+		if err := p.Films.PrePersist(hc, film); err != nil {
+			return &HookError{Plugin: p.Name, Err: err}
+		}
+	}
+	return nil
+}
+
+// runFilmPostCommit runs the post-commit hooks for a film
+func (ps *Plugins) runFilmPostCommit(hc HookContext, film *Film) {
+	for _, p := range ps.registered() {
+		if p.Films.PostCommit != nil {
+			p.Films.PostCommit(hc, film)
+		}
+	}
+}
+
+// runUserPreValidate runs the pre-validate hooks for a user
+func (ps *Plugins) runUserPreValidate(hc HookContext, user *User) error {
+	for _, p := range ps.registered() {
+		if p.Users.PreValidate == nil {
+			continue
+		}
+		if err := p.Users.PreValidate(hc, user); err != nil {
+			return &HookError{Plugin: p.Name, Err: err}
+		}
+	}
+	return nil
+}
+
+// runUserPrePersist runs the pre-persist hooks for a user
+func (ps *Plugins) runUserPrePersist(hc HookContext, user *User) error {
+	for _, p := range ps.registered() {
+		if p.Users.PrePersist == nil {
+			continue
+		}
+		if err := p.Users.PrePersist(hc, user); err != nil {
+			return &HookError{Plugin: p.Name, Err: err}
+		}
+	}
+	return nil
+}
+
+// runUserPostCommit runs the post-commit hooks for a user
+func (ps *Plugins) runUserPostCommit(hc HookContext, user *User) {
+	for _, p := range ps.registered() {
+		if p.Users.PostCommit != nil {
+			p.Users.PostCommit(hc, user)
+		}
+	}
+}
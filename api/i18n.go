@@ -0,0 +1,183 @@
+package api
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+//go:embed i18n/*.json
+var translationFiles embed.FS
+
+// defaultLanguage is the language handlers write their messages in
+const defaultLanguage = "en"
+
+// translations holds the message of every error code, by language
+var translations = map[string]map[string]string{}
+
+// Params are the values filled into the {name} placeholders of a message
+type Params map[string]interface{}
+
+// CodedError is an error with a message for the client and the code that
+// translates it
+type CodedError struct {
+	Code    string
+	Params  Params
+	Message string
+}
+
+func (e *CodedError) Error() string {
+	return e.Message
+}
+
+func (e *CodedError) ErrorCode() (string, Params) {
+	return e.Code, e.Params
+}
+
+// errorCoder is implemented by errors whose message has a code
+type errorCoder interface {
+	ErrorCode() (string, Params)
+}
+
+// placeholderPattern finds the {name} placeholders of a message
+var placeholderPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+func init() {
+	if err := LoadTranslations(translationFiles, "i18n"); err != nil {
+		log.Fatalf("Failed to load translations: %v", err)
+	}
+}
+
+// LoadTranslations reads the bundles of a directory, one per language and
+// named after it, e.g. id.json. A bundle maps error codes to messages and
+// replaces the messages of the codes it defines.
+func LoadTranslations(fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		var bundle map[string]string
+		if err := json.Unmarshal(content, &bundle); err != nil {
+			return fmt.Errorf("invalid translation bundle %s: %v", file, err)
+		}
+		language := strings.ToLower(strings.TrimSuffix(path.Base(file), ".json"))
+		if translations[language] == nil {
+			translations[language] = make(map[string]string)
+		}
+		for code, message := range bundle {
+			translations[language][code] = message
+		}
+	}
+	return nil
+}
+
+// formatMessage returns the message of a code in a language with its params
+// filled in
+func formatMessage(language, code string, params Params) (string, bool) {
+	text, ok := translations[language][code]
+	if !ok {
+		return "", false
+	}
+	for name, value := range params {
+		text = strings.ReplaceAll(text, "{"+name+"}", fmt.Sprint(value))
+	}
+	return text, !placeholderPattern.MatchString(text)
+}
+
+// isCodeMessage reports whether message is the English message of a code
+func isCodeMessage(code string, params Params, message string) bool {
+	expected, ok := formatMessage(defaultLanguage, code, params)
+	return ok && expected == message
+}
+
+// translate returns an English message in another language. A message that
+// isn't the English message of its code, such as one an admin wrote, stays
+// as it is.
+func translate(language, code string, params Params, english string) string {
+	if code == "" || language == defaultLanguage || !isCodeMessage(code, params, english) {
+		return english
+	}
+	if localized, ok := formatMessage(language, code, params); ok {
+		return localized
+	}
+	return english
+}
+
+// errorResponse answers with the message of err, and its code when it has one
+func errorResponse(err error) ErrorResponse {
+	response := ErrorResponse{Error: err.Error()}
+	var coder errorCoder
+	if errors.As(err, &coder) {
+		response.Code, response.Params = coder.ErrorCode()
+	}
+	return response
+}
+
+// preferredLanguage picks the first language of Accept-Language with a bundle.
+// Regional variants fall back to their language, e.g. id-ID to id.
+func preferredLanguage(r *http.Request) string {
+	for _, tag := range acceptedValues(r.Header.Get("Accept-Language")) {
+		if tag == "*" {
+			break
+		}
+		if _, ok := translations[tag]; ok {
+			return tag
+		}
+		if base, _, _ := strings.Cut(tag, "-"); translations[base] != nil {
+			return base
+		}
+	}
+	return defaultLanguage
+}
+
+// localizeFields translates the messages of field errors
+func localizeFields(language string, fields []FieldError) []FieldError {
+	localized := make([]FieldError, len(fields))
+	for i, field := range fields {
+		localized[i] = field
+		localized[i].Message = translate(language, field.Code, field.Params, field.Message)
+	}
+	return localized
+}
+
+// localizeResponse translates the message of an error value into the
+// request's language. Other values are returned as they are.
+func localizeResponse(r *http.Request, w http.ResponseWriter, v interface{}) interface{} {
+	language := preferredLanguage(r)
+	switch response := v.(type) {
+	case ErrorResponse:
+		if response.Code != "" && !isCodeMessage(response.Code, response.Params, response.Error) {
+			// A message an admin wrote is in their language, not the client's
+			return v
+		}
+		response.Error = translate(language, response.Code, response.Params, response.Error)
+		v = response
+	case ValidationErrorResponse:
+		response.Error = translate(language, response.Code, nil, response.Error)
+		response.Fields = localizeFields(language, response.Fields)
+		v = response
+	case ConflictResponse:
+		response.Error = translate(language, response.Code, nil, response.Error)
+		v = response
+	case VersionConflictResponse:
+		response.Error = translate(language, response.Code, nil, response.Error)
+		v = response
+	default:
+		return v
+	}
+	w.Header().Set("Content-Language", language)
+	w.Header().Add("Vary", "Accept-Language")
+	return v
+}
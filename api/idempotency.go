@@ -0,0 +1,106 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// idempotencyTTL is how long a stored response can be replayed
+const idempotencyTTL = 24 * time.Hour
+
+// Possible outcomes when a request claims an idempotency key
+const (
+	idempotencyNew = iota
+	idempotencyInFlight
+	idempotencyReplay
+	idempotencyMismatch
+)
+
+// IdempotentResponse is a response recorded for an idempotency key
+type IdempotentResponse struct {
+	fingerprint string
+	done        bool
+	statusCode  int
+	body        []byte
+	expiry      time.Time
+}
+
+// IdempotencyStore remembers responses by Idempotency-Key header
+type IdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]*IdempotentResponse
+	lastSweep time.Time
+}
+
+// NewIdempotencyStore creates a new idempotency store
+func NewIdempotencyStore() *IdempotencyStore {
+	return &IdempotencyStore{
+		entries: make(map[string]*IdempotentResponse),
+	}
+}
+
+// Fingerprint hashes a request body so a reused key with a different payload can be detected
+func (is *IdempotencyStore) Fingerprint(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Begin claims a key for a request. It returns the stored response when the
+// key was already completed with the same payload.
+func (is *IdempotencyStore) Begin(key, fingerprint string) (*IdempotentResponse, int) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(is.lastSweep) > time.Minute {
+		for k, entry := range is.entries {
+			if now.After(entry.expiry) {
+				delete(is.entries, k)
+			}
+		}
+		is.lastSweep = now
+	}
+
+	entry, exists := is.entries[key]
+	if exists && now.After(entry.expiry) {
+		delete(is.entries, key)
+		exists = false
+	}
+	if !exists {
+		is.entries[key] = &IdempotentResponse{
+			fingerprint: fingerprint,
+			expiry:      now.Add(idempotencyTTL),
+		}
+		return nil, idempotencyNew
+	}
+
+	if entry.fingerprint != fingerprint {
+		return nil, idempotencyMismatch
+	}
+	if !entry.done {
+		return nil, idempotencyInFlight
+	}
+	return entry, idempotencyReplay
+}
+
+// Complete stores the response for a claimed key
+func (is *IdempotencyStore) Complete(key string, statusCode int, body []byte) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	entry, exists := is.entries[key]
+	if !exists {
+		return
+	}
+	entry.done = true
+	entry.statusCode = statusCode
+	entry.body = body
+}
+
+// Release forgets a claimed key so the client can retry (used on server errors)
+func (is *IdempotencyStore) Release(key string) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	delete(is.entries, key)
+}
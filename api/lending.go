@@ -0,0 +1,397 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// maxCopyLabelLength limits the label of a physical copy
+const maxCopyLabelLength = 100
+
+// LendingService handles physical copies and their loans
+type LendingService struct {
+	db     *gorm.DB
+	config *liveConfig
+	films  FilmRepository
+	// copies limits queries of copies and loans to the films of films
+	copies func(*gorm.DB) *gorm.DB
+}
+
+// NewLendingService creates a new lending service for the copies of films
+// of every organization, lending them on the terms of config
+func NewLendingService(db *gorm.DB, config *liveConfig, films FilmRepository) *LendingService {
+	return &LendingService{db: db, config: config, films: films, copies: anyTenant}
+}
+
+// ForTenant returns a lending service that only lends the copies of the
+// films of one organization
+func (ls *LendingService) ForTenant(tenant Tenant) *LendingService {
+	return &LendingService{db: ls.db, config: ls.config, films: ls.films.ForTenant(tenant), copies: tenantFilmScope(tenant.OrganizationID)}
+}
+
+// LoanLimitError reports a borrower who already has as many copies as allowed
+type LoanLimitError struct {
+	Max int
+}
+
+func (e *LoanLimitError) Error() string {
+	return fmt.Sprintf("You can borrow at most %d copies at a time", e.Max)
+}
+
+func (e *LoanLimitError) ErrorCode() (string, Params) {
+	return "loan_limit_reached", Params{"max": e.Max}
+}
+
+// markOverdue flags the loans that are past due at the given time
+func markOverdue(loans []Loan, now time.Time) {
+	for i := range loans {
+		loans[i].Overdue = loans[i].ReturnedAt == nil && now.After(loans[i].DueAt)
+	}
+}
+
+// GetCopies retrieves the copies of a film and whether each is available
+func (ls *LendingService) GetCopies(filmID uint) ([]Copy, error) {
+	if _, err := ls.films.GetFilmByID(filmID); err != nil {
+		return nil, err
+	}
+
+	var copies []Copy
+	if err := ls.db.Where("film_id = ?", filmID).Order("id").Find(&copies).Error; err != nil {
+		return nil, err
+	}
+	var loans []Loan
+	if err := ls.db.Where("film_id = ? AND returned_at IS NULL", filmID).Find(&loans).Error; err != nil {
+		return nil, err
+	}
+
+	dueAt := make(map[uint]time.Time, len(loans))
+	for _, loan := range loans {
+		dueAt[loan.CopyID] = loan.DueAt
+	}
+	for i := range copies {
+		if due, onLoan := dueAt[copies[i].ID]; onLoan {
+			copies[i].DueAt = &due
+		} else {
+			copies[i].Available = true
+		}
+	}
+	return copies, nil
+}
+
+// AddCopy adds a physical copy of a film
+func (ls *LendingService) AddCopy(filmID uint, label string) (*Copy, error) {
+	if _, err := ls.films.GetFilmByID(filmID); err != nil {
+		return nil, err
+	}
+	filmCopy := Copy{FilmID: filmID, Label: label, Available: true}
+	if err := ls.db.Create(&filmCopy).Error; err != nil {
+		return nil, err
+	}
+	return &filmCopy, nil
+}
+
+// DeleteCopy removes a copy that isn't out on loan. Its past loans are kept.
+func (ls *LendingService) DeleteCopy(id uint) error {
+	return ls.db.Transaction(func(tx *gorm.DB) error {
+		var onLoan int64
+		if err := tx.Model(&Loan{}).Scopes(ls.copies).Where("copy_id = ? AND returned_at IS NULL", id).Count(&onLoan).Error; err != nil {
+			return err
+		}
+		if onLoan > 0 {
+			return errors.New("copy on loan")
+		}
+		result := tx.Scopes(ls.copies).Delete(&Copy{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("copy not found")
+		}
+		return nil
+	})
+}
+
+// Borrow checks out a copy to a user until the end of the loan period
+func (ls *LendingService) Borrow(copyID uint, borrower string) (*Loan, error) {
+	cfg := ls.config.Load().Lending
+	var loan Loan
+	err := ls.db.Transaction(func(tx *gorm.DB) error {
+		var filmCopy Copy
+		if err := tx.Scopes(ls.copies).First(&filmCopy, copyID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("copy not found")
+			}
+			return err
+		}
+
+		var onLoan, borrowed int64
+		if err := tx.Model(&Loan{}).Where("copy_id = ? AND returned_at IS NULL", copyID).Count(&onLoan).Error; err != nil {
+			return err
+		}
+		if onLoan > 0 {
+			return errors.New("copy on loan")
+		}
+		if err := tx.Model(&Loan{}).Where("borrower = ? AND returned_at IS NULL", borrower).Count(&borrowed).Error; err != nil {
+			return err
+		}
+		if borrowed >= int64(cfg.MaxLoans) {
+			return &LoanLimitError{Max: cfg.MaxLoans}
+		}
+
+		now := time.Now().UTC()
+		loan = Loan{CopyID: filmCopy.ID, FilmID: filmCopy.FilmID, Borrower: borrower, BorrowedAt: now, DueAt: now.Add(cfg.LoanPeriod)}
+		return tx.Create(&loan).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+// Return closes the open loan of a copy. Only the borrower or an admin may return it.
+func (ls *LendingService) Return(copyID uint, username string, admin bool) (*Loan, error) {
+	var loan Loan
+	err := ls.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(ls.copies).Where("copy_id = ? AND returned_at IS NULL", copyID).First(&loan).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("copy not on loan")
+			}
+			return err
+		}
+		if loan.Borrower != username && !admin {
+			return errors.New("not the borrower")
+		}
+
+		now := time.Now().UTC()
+		loan.ReturnedAt = &now
+		return tx.Model(&loan).Update("returned_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+// GetOpenLoans retrieves the open loans of a borrower, or of everyone when
+// borrower is empty, oldest due first. overdueOnly leaves out those not yet due.
+func (ls *LendingService) GetOpenLoans(borrower string, overdueOnly bool) ([]Loan, error) {
+	now := time.Now().UTC()
+	query := ls.db.Scopes(ls.copies).Where("returned_at IS NULL")
+	if borrower != "" {
+		query = query.Where("borrower = ?", borrower)
+	}
+	if overdueOnly {
+		query = query.Where("due_at < ?", now)
+	}
+
+	var loans []Loan
+	if err := query.Order("due_at, id").Find(&loans).Error; err != nil {
+		return nil, err
+	}
+	markOverdue(loans, now)
+
+	// Show what was borrowed
+	if len(loans) > 0 {
+		ids := make([]uint, len(loans))
+		for i, loan := range loans {
+			ids[i] = loan.FilmID
+		}
+		var films []Film
+		if err := ls.db.Unscoped().Where("id IN ?", ids).Find(&films).Error; err != nil {
+			return nil, err
+		}
+		byID := make(map[uint]*Film, len(films))
+		for i := range films {
+			byID[films[i].ID] = withLinks(&films[i])
+		}
+		for i := range loans {
+			loans[i].Film = byID[loans[i].FilmID]
+		}
+	}
+	return loans, nil
+}
+
+// GetLoansByBorrower groups the open loans by borrower, for the admin view of
+// who has what
+func (ls *LendingService) GetLoansByBorrower(overdueOnly bool) ([]BorrowerLoans, error) {
+	loans, err := ls.GetOpenLoans("", overdueOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	borrowers := []BorrowerLoans{}
+	index := make(map[string]int)
+	for _, loan := range loans {
+		i, seen := index[loan.Borrower]
+		if !seen {
+			i = len(borrowers)
+			index[loan.Borrower] = i
+			borrowers = append(borrowers, BorrowerLoans{Borrower: loan.Borrower, Loans: []Loan{}})
+		}
+		borrowers[i].Loans = append(borrowers[i].Loans, loan)
+		if loan.Overdue {
+			borrowers[i].Overdue++
+		}
+	}
+	return borrowers, nil
+}
+
+// writeLendingError answers with the response for a lending service error
+func writeLendingError(w http.ResponseWriter, r *http.Request, err error, failure ErrorResponse) {
+	var limitErr *LoanLimitError
+	switch {
+	case errors.As(err, &limitErr):
+		writeResponse(w, r, http.StatusConflict, errorResponse(limitErr))
+	case err.Error() == "film not found":
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Film not found", Code: "film_not_found"})
+	case err.Error() == "copy not found":
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Copy not found", Code: "copy_not_found"})
+	case err.Error() == "copy on loan":
+		writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "Copy is out on loan", Code: "copy_on_loan"})
+	case err.Error() == "copy not on loan":
+		writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "Copy is not on loan", Code: "copy_not_on_loan"})
+	case err.Error() == "not the borrower":
+		writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Only the borrower or an admin can return a copy", Code: "return_not_allowed"})
+	default:
+		writeResponse(w, r, http.StatusInternalServerError, failure)
+	}
+}
+
+// filmCopiesHandler handles GET /api/films/{id}/copies, and POST for admins
+// to add a copy
+func (s *Server) filmCopiesHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/films/"), "/copies")
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid film ID", Code: "invalid_film_id"})
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		copies, err := s.tenantLending(r).GetCopies(uint(id))
+		if err != nil {
+			writeLendingError(w, r, err, ErrorResponse{Error: "Failed to retrieve copies", Code: "copies_retrieve_failed"})
+			return
+		}
+		if copies == nil {
+			copies = []Copy{}
+		}
+		writeResponse(w, r, http.StatusOK, copies)
+	case "POST":
+		if !s.users.IsAdmin(currentUsername(r)) {
+			writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Admin role required", Code: "admin_required"})
+			return
+		}
+		var copyReq CopyRequest
+		if err := json.NewDecoder(r.Body).Decode(&copyReq); err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+			return
+		}
+		copyReq.Label = strings.TrimSpace(copyReq.Label)
+		if copyReq.Label == "" {
+			writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: []FieldError{{Field: "label", Message: "is required", Code: "field_required"}}})
+			return
+		}
+		if utf8.RuneCountInString(copyReq.Label) > maxCopyLabelLength {
+			writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: []FieldError{{Field: "label", Message: fmt.Sprintf("must be at most %d characters", maxCopyLabelLength), Code: "field_too_long", Params: Params{"max": maxCopyLabelLength}}}})
+			return
+		}
+		filmCopy, err := s.tenantLending(r).AddCopy(uint(id), copyReq.Label)
+		if err != nil {
+			writeLendingError(w, r, err, ErrorResponse{Error: "Failed to add copy", Code: "copy_add_failed"})
+			return
+		}
+		writeResponse(w, r, http.StatusCreated, filmCopy)
+	default:
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+	}
+}
+
+// copiesHandler routes /api/copies/{id} (DELETE, admin only),
+// /api/copies/{id}/borrow, and /api/copies/{id}/return
+func (s *Server) copiesHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/copies/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 2 {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid copy ID", Code: "invalid_copy_id"})
+		return
+	}
+	username := currentUsername(r)
+
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	switch {
+	case action == "" && r.Method == "DELETE":
+		if !s.users.IsAdmin(username) {
+			writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Admin role required", Code: "admin_required"})
+			return
+		}
+		if err := s.tenantLending(r).DeleteCopy(uint(id)); err != nil {
+			writeLendingError(w, r, err, ErrorResponse{Error: "Failed to delete copy", Code: "copy_delete_failed"})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case action == "borrow" && r.Method == "POST":
+		loan, err := s.tenantLending(r).Borrow(uint(id), username)
+		if err != nil {
+			writeLendingError(w, r, err, ErrorResponse{Error: "Failed to borrow copy", Code: "copy_borrow_failed"})
+			return
+		}
+		writeResponse(w, r, http.StatusCreated, loan)
+	case action == "return" && r.Method == "POST":
+		loan, err := s.tenantLending(r).Return(uint(id), username, s.users.IsAdmin(username))
+		if err != nil {
+			writeLendingError(w, r, err, ErrorResponse{Error: "Failed to return copy", Code: "copy_return_failed"})
+			return
+		}
+		writeResponse(w, r, http.StatusOK, loan)
+	case action == "" || action == "borrow" || action == "return":
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+	default:
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Not found", Code: "not_found"})
+	}
+}
+
+// loansHandler handles GET /api/loans, the open loans of the current user.
+// ?overdue=true lists only those past due.
+func (s *Server) loansHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+	loans, err := s.tenantLending(r).GetOpenLoans(currentUsername(r), r.URL.Query().Get("overdue") == "true")
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve loans", Code: "loans_retrieve_failed"})
+		return
+	}
+	if loans == nil {
+		loans = []Loan{}
+	}
+	writeResponse(w, r, http.StatusOK, loans)
+}
+
+// adminLoansHandler handles GET /api/admin/loans, the open loans of every
+// user grouped by borrower. ?overdue=true lists only those past due.
+func (s *Server) adminLoansHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+	borrowers, err := s.tenantLending(r).GetLoansByBorrower(r.URL.Query().Get("overdue") == "true")
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve loans", Code: "loans_retrieve_failed"})
+		return
+	}
+	writeResponse(w, r, http.StatusOK, borrowers)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// filmPath returns the URL of a film resource
+func filmPath(id uint) string {
+	return fmt.Sprintf("/api/films/%d", id)
+}
+
+// withLinks fills in the links of a film so clients can follow them instead
+// of building URLs themselves
+func withLinks(film *Film) *Film {
+	path := filmPath(film.ID)
+	film.Links = &FilmLinks{
+		Self:   Link{Href: path},
+		Update: Link{Href: path, Method: "PUT"},
+		Delete: Link{Href: path, Method: "DELETE"},
+	}
+	if film.PosterKey != "" {
+		film.Links.Poster = &Link{Href: path + "/poster"}
+	}
+	return film
+}
+
+// withFilmLinks fills in the links of every film in a list
+func withFilmLinks(films []Film) []Film {
+	for i := range films {
+		withLinks(&films[i])
+	}
+	return films
+}
+
+// pageLink returns the URL of the current request with one query parameter
+// replaced, keeping the others (page_size, order) as they are
+func pageLink(r *http.Request, key, value string) *Link {
+	query := r.URL.Query()
+	query.Set(key, value)
+	return &Link{Href: r.URL.Path + "?" + query.Encode()}
+}
+
+// offsetPageLinks returns the links of a page of offset pagination
+func offsetPageLinks(r *http.Request, page, pageSize int, total int64) PageLinks {
+	links := PageLinks{Self: Link{Href: r.URL.RequestURI()}}
+	if int64(page)*int64(pageSize) < total {
+		links.Next = pageLink(r, "page", strconv.Itoa(page+1))
+	}
+	if page > 1 {
+		links.Prev = pageLink(r, "page", strconv.Itoa(page-1))
+	}
+	return links
+}
+
+// cursorPageLinks returns the links of a page of keyset pagination. Cursors
+// only lead forward, so there is no prev link.
+func cursorPageLinks(r *http.Request, next *FilmCursor) PageLinks {
+	links := PageLinks{Self: Link{Href: r.URL.RequestURI()}}
+	if next != nil {
+		links.Next = pageLink(r, "cursor", next.Encode())
+	}
+	return links
+}
@@ -0,0 +1,501 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// List limits
+const (
+	maxListNameLength        = 200
+	maxListDescriptionLength = 1000
+	maxListFilms             = 100
+)
+
+// sharedListsPath is where public lists are shared
+const sharedListsPath = "/api/shared/lists/"
+
+// ListService handles film list database operations
+type ListService struct {
+	db    *gorm.DB
+	films func(*gorm.DB) *gorm.DB
+}
+
+// NewListService creates a new list service for films of every organization
+func NewListService(db *gorm.DB) *ListService {
+	return &ListService{db: db, films: anyTenant}
+}
+
+// ForTenant returns a list service that only puts and shows the films of
+// one organization on lists
+func (ls *ListService) ForTenant(tenant Tenant) *ListService {
+	return &ListService{db: ls.db, films: tenantScope(tenant.OrganizationID)}
+}
+
+// listMember is a film and the list it was loaded for
+type listMember struct {
+	Film
+	ListID uint
+}
+
+// ValidateFilmListRequest trims a list payload in place and checks it.
+// It returns nil when the list is valid.
+func ValidateFilmListRequest(listReq *FilmListRequest) *ValidationError {
+	listReq.Name = strings.TrimSpace(listReq.Name)
+	listReq.Description = strings.TrimSpace(listReq.Description)
+
+	var fields []FieldError
+	if listReq.Name == "" {
+		fields = append(fields, FieldError{Field: "name", Message: "is required", Code: "field_required"})
+	} else if utf8.RuneCountInString(listReq.Name) > maxListNameLength {
+		fields = append(fields, FieldError{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxListNameLength), Code: "field_too_long", Params: Params{"max": maxListNameLength}})
+	}
+	if utf8.RuneCountInString(listReq.Description) > maxListDescriptionLength {
+		fields = append(fields, FieldError{Field: "description", Message: fmt.Sprintf("must be at most %d characters", maxListDescriptionLength), Code: "field_too_long", Params: Params{"max": maxListDescriptionLength}})
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// newShareToken returns the unguessable part of a share URL
+func newShareToken() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// GetLists retrieves the lists of a user with their films
+func (ls *ListService) GetLists(owner string) ([]FilmList, error) {
+	var lists []FilmList
+	if err := ls.db.Where("owner = ?", owner).Order("id").Find(&lists).Error; err != nil {
+		return nil, err
+	}
+	if err := ls.loadFilms(lists); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// GetList retrieves a list the viewer owns, or a public one
+func (ls *ListService) GetList(id uint, viewer string) (*FilmList, error) {
+	var list FilmList
+	if err := ls.db.First(&list, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("list not found")
+		}
+		return nil, err
+	}
+	// Private lists of others look like they don't exist
+	if list.Owner != viewer && !list.Public {
+		return nil, errors.New("list not found")
+	}
+	return ls.withFilms(list)
+}
+
+// GetSharedList retrieves a public list by its share token, with the films
+// of its owner's organization
+func (ls *ListService) GetSharedList(token string) (*FilmList, error) {
+	var list FilmList
+	if err := ls.db.Where("share_token = ? AND public = ?", token, true).First(&list).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("list not found")
+		}
+		return nil, err
+	}
+	var owner User
+	if err := ls.db.Select("organization_id").Where("username = ?", list.Owner).First(&owner).Error; err != nil {
+		return nil, err
+	}
+	return ls.ForTenant(Tenant{OrganizationID: owner.OrganizationID}).withFilms(list)
+}
+
+// withFilms returns a list with its films loaded
+func (ls *ListService) withFilms(list FilmList) (*FilmList, error) {
+	lists := []FilmList{list}
+	if err := ls.loadFilms(lists); err != nil {
+		return nil, err
+	}
+	return &lists[0], nil
+}
+
+// loadFilms fills in the films and share URLs of lists. Deleted films are left out.
+func (ls *ListService) loadFilms(lists []FilmList) error {
+	if len(lists) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(lists))
+	byID := make(map[uint]*FilmList, len(lists))
+	for i := range lists {
+		ids[i] = lists[i].ID
+		byID[lists[i].ID] = &lists[i]
+		lists[i].Films = []Film{}
+		if lists[i].Public {
+			lists[i].ShareURL = sharedListsPath + lists[i].ShareToken
+		}
+	}
+
+	var members []listMember
+	err := ls.db.Model(&Film{}).Scopes(ls.films).
+		Select("films.*, film_list_items.list_id").
+		Joins("JOIN film_list_items ON film_list_items.film_id = films.id").
+		Where("film_list_items.list_id IN ?", ids).
+		Order("film_list_items.list_id, film_list_items.position").
+		Find(&members).Error
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if list := byID[member.ListID]; list != nil {
+			list.Films = append(list.Films, *withLinks(&member.Film))
+		}
+	}
+	return nil
+}
+
+// ownedList loads a list for a change by its owner
+func ownedList(tx *gorm.DB, id uint, owner string) (*FilmList, error) {
+	var list FilmList
+	if err := tx.Where("owner = ?", owner).First(&list, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("list not found")
+		}
+		return nil, err
+	}
+	return &list, nil
+}
+
+// SaveList creates a list (id 0) or updates the name, description, and
+// visibility of one the owner has
+func (ls *ListService) SaveList(id uint, owner string, listReq FilmListRequest) (*FilmList, error) {
+	list := &FilmList{Owner: owner, ShareToken: newShareToken()}
+	if id != 0 {
+		var err error
+		if list, err = ownedList(ls.db, id, owner); err != nil {
+			return nil, err
+		}
+	}
+
+	list.Name = listReq.Name
+	list.Description = listReq.Description
+	list.Public = listReq.Public
+	if err := ls.db.Save(list).Error; err != nil {
+		return nil, err
+	}
+	return ls.withFilms(*list)
+}
+
+// DeleteList removes a list the owner has. Its films stay in the catalog.
+func (ls *ListService) DeleteList(id uint, owner string) error {
+	return ls.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := ownedList(tx, id, owner); err != nil {
+			return err
+		}
+		if err := tx.Where("list_id = ?", id).Delete(&FilmListItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&FilmList{}, id).Error
+	})
+}
+
+// AddFilm puts a film on a list at a position, moving the films from there on
+// down. Without a position, or past the end, the film goes last.
+func (ls *ListService) AddFilm(id uint, owner string, itemReq FilmListItemRequest) (*FilmList, error) {
+	var list *FilmList
+	err := ls.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if list, err = ownedList(tx, id, owner); err != nil {
+			return err
+		}
+
+		var film Film
+		if err := tx.Scopes(ls.films).Select("id").First(&film, itemReq.FilmID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &ValidationError{Fields: []FieldError{{Field: "film_id", Message: fmt.Sprintf("film %d does not exist", itemReq.FilmID), Code: "field_film_missing", Params: Params{"id": itemReq.FilmID}}}}
+			}
+			return err
+		}
+
+		var count, onList int64
+		if err := tx.Model(&FilmListItem{}).Where("list_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&FilmListItem{}).Where("list_id = ? AND film_id = ?", id, itemReq.FilmID).Count(&onList).Error; err != nil {
+			return err
+		}
+		if onList > 0 {
+			return errors.New("film already on list")
+		}
+		if count >= maxListFilms {
+			return errors.New("list full")
+		}
+
+		position := int(count) + 1
+		if itemReq.Position != nil && *itemReq.Position < position {
+			position = *itemReq.Position
+		}
+		err = tx.Model(&FilmListItem{}).
+			Where("list_id = ? AND position >= ?", id, position).
+			Update("position", gorm.Expr("position + 1")).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&FilmListItem{ListID: id, FilmID: itemReq.FilmID, Position: position}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ls.withFilms(*list)
+}
+
+// RemoveFilm takes a film off a list, moving the films after it up
+func (ls *ListService) RemoveFilm(id uint, owner string, filmID uint) error {
+	return ls.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := ownedList(tx, id, owner); err != nil {
+			return err
+		}
+
+		var item FilmListItem
+		if err := tx.Where("list_id = ? AND film_id = ?", id, filmID).First(&item).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("film not on list")
+			}
+			return err
+		}
+		if err := tx.Where("list_id = ? AND film_id = ?", id, filmID).Delete(&FilmListItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&FilmListItem{}).
+			Where("list_id = ? AND position > ?", id, item.Position).
+			Update("position", gorm.Expr("position - 1")).Error
+	})
+}
+
+// ReorderFilms puts the films of a list in a new order. The order must name
+// every film on the list exactly once.
+func (ls *ListService) ReorderFilms(id uint, owner string, filmIDs []uint) (*FilmList, error) {
+	var list *FilmList
+	err := ls.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if list, err = ownedList(tx, id, owner); err != nil {
+			return err
+		}
+
+		var current []uint
+		if err := tx.Model(&FilmListItem{}).Where("list_id = ?", id).Pluck("film_id", &current).Error; err != nil {
+			return err
+		}
+		onList := make(map[uint]bool, len(current))
+		for _, filmID := range current {
+			onList[filmID] = true
+		}
+		for _, filmID := range filmIDs {
+			if !onList[filmID] {
+				return &ValidationError{Fields: []FieldError{{Field: "film_ids", Message: "must name every film on the list exactly once", Code: "field_list_order"}}}
+			}
+			delete(onList, filmID)
+		}
+		if len(onList) > 0 || len(filmIDs) != len(current) {
+			return &ValidationError{Fields: []FieldError{{Field: "film_ids", Message: "must name every film on the list exactly once", Code: "field_list_order"}}}
+		}
+
+		if err := tx.Where("list_id = ?", id).Delete(&FilmListItem{}).Error; err != nil {
+			return err
+		}
+		if len(filmIDs) == 0 {
+			return nil
+		}
+		items := make([]FilmListItem, len(filmIDs))
+		for i, filmID := range filmIDs {
+			items[i] = FilmListItem{ListID: id, FilmID: filmID, Position: i + 1}
+		}
+		return tx.Create(&items).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ls.withFilms(*list)
+}
+
+// writeListError answers with the response for a list service error
+func writeListError(w http.ResponseWriter, r *http.Request, err error, failure ErrorResponse) {
+	var validationErr *ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: validationErr.Fields})
+	case err.Error() == "list not found":
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "List not found", Code: "list_not_found"})
+	case err.Error() == "film not on list":
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Film is not on the list", Code: "list_film_missing"})
+	case err.Error() == "film already on list":
+		writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "Film is already on the list", Code: "list_film_exists"})
+	case err.Error() == "list full":
+		writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("List is full, it holds at most %d films", maxListFilms), Code: "list_full", Params: Params{"max": maxListFilms}})
+	default:
+		writeResponse(w, r, http.StatusInternalServerError, failure)
+	}
+}
+
+// listsHandler routes /api/lists endpoints. Lists belong to the user who
+// created them; only public ones can be read by others.
+func (s *Server) listsHandler(w http.ResponseWriter, r *http.Request) {
+	owner := currentUsername(r)
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	if path == "/api/lists" {
+		switch r.Method {
+		case "GET":
+			lists, err := s.tenantLists(r).GetLists(owner)
+			if err != nil {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve lists", Code: "lists_retrieve_failed"})
+				return
+			}
+			if lists == nil {
+				lists = []FilmList{}
+			}
+			writeResponse(w, r, http.StatusOK, lists)
+		case "POST":
+			s.saveListHandler(w, r, 0)
+		default:
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		}
+		return
+	}
+
+	// /api/lists/{id}, /api/lists/{id}/films, or /api/lists/{id}/films/{film_id}
+	parts := strings.Split(strings.TrimPrefix(path, "/api/lists/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 3 || (len(parts) > 1 && parts[1] != "films") {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid list ID", Code: "invalid_list_id"})
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		switch r.Method {
+		case "GET":
+			list, err := s.tenantLists(r).GetList(uint(id), owner)
+			if err != nil {
+				writeListError(w, r, err, ErrorResponse{Error: "Failed to retrieve list", Code: "list_retrieve_failed"})
+				return
+			}
+			writeResponse(w, r, http.StatusOK, list)
+		case "PUT":
+			s.saveListHandler(w, r, uint(id))
+		case "DELETE":
+			if err := s.tenantLists(r).DeleteList(uint(id), owner); err != nil {
+				writeListError(w, r, err, ErrorResponse{Error: "Failed to delete list", Code: "list_delete_failed"})
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		}
+	case len(parts) == 2:
+		s.listFilmsHandler(w, r, uint(id))
+	default:
+		if r.Method != "DELETE" {
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+			return
+		}
+		filmID, err := strconv.Atoi(parts[2])
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid film ID", Code: "invalid_film_id"})
+			return
+		}
+		if err := s.tenantLists(r).RemoveFilm(uint(id), owner, uint(filmID)); err != nil {
+			writeListError(w, r, err, ErrorResponse{Error: "Failed to update list", Code: "list_update_failed"})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// saveListHandler creates a list (id 0) or updates an existing one
+func (s *Server) saveListHandler(w http.ResponseWriter, r *http.Request, id uint) {
+	var listReq FilmListRequest
+	if err := json.NewDecoder(r.Body).Decode(&listReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+	if validationErr := ValidateFilmListRequest(&listReq); validationErr != nil {
+		writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: validationErr.Fields})
+		return
+	}
+
+	list, err := s.tenantLists(r).SaveList(id, currentUsername(r), listReq)
+	if err != nil {
+		writeListError(w, r, err, ErrorResponse{Error: "Failed to save list", Code: "list_save_failed"})
+		return
+	}
+	status := http.StatusOK
+	if id == 0 {
+		status = http.StatusCreated
+	}
+	writeResponse(w, r, status, list)
+}
+
+// listFilmsHandler adds a film to a list (POST) or reorders its films (PUT)
+func (s *Server) listFilmsHandler(w http.ResponseWriter, r *http.Request, id uint) {
+	owner := currentUsername(r)
+	switch r.Method {
+	case "POST":
+		var itemReq FilmListItemRequest
+		if err := json.NewDecoder(r.Body).Decode(&itemReq); err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+			return
+		}
+		if itemReq.Position != nil && *itemReq.Position < 1 {
+			writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: []FieldError{{Field: "position", Message: "must be at least 1", Code: "field_below_minimum", Params: Params{"min": 1}}}})
+			return
+		}
+		list, err := s.tenantLists(r).AddFilm(id, owner, itemReq)
+		if err != nil {
+			writeListError(w, r, err, ErrorResponse{Error: "Failed to update list", Code: "list_update_failed"})
+			return
+		}
+		writeResponse(w, r, http.StatusOK, list)
+	case "PUT":
+		var orderReq FilmListOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&orderReq); err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+			return
+		}
+		list, err := s.tenantLists(r).ReorderFilms(id, owner, orderReq.FilmIDs)
+		if err != nil {
+			writeListError(w, r, err, ErrorResponse{Error: "Failed to update list", Code: "list_update_failed"})
+			return
+		}
+		writeResponse(w, r, http.StatusOK, list)
+	default:
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+	}
+}
+
+// sharedListHandler serves a public list at its share URL, without authentication
+func (s *Server) sharedListHandler(w http.ResponseWriter, r *http.Request) {
+	s.enableCORS(w, r)
+
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	list, err := s.listService.GetSharedList(strings.TrimPrefix(r.URL.Path, sharedListsPath))
+	if err != nil {
+		writeListError(w, r, err, ErrorResponse{Error: "Failed to retrieve list", Code: "list_retrieve_failed"})
+		return
+	}
+	writeResponse(w, r, http.StatusOK, list)
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loginFailures counts the failed logins of a client within the window.
+// next is when the client may try again, reserved by the last attempt.
+type loginFailures struct {
+	count int
+	last  time.Time
+	next  time.Time
+}
+
+// LoginGuard blunts password guessing on /api/login. Failed logins are
+// counted per IP and username: past a few, the pair has to wait before its
+// next attempt, twice as long after every failure, and attempts coming
+// sooner are turned away without checking the password. Failed logins from
+// an IP across all usernames, as in credential stuffing, ban the IP for a
+// while. This is separate from accounts: a user whose name is being
+// attacked can still log in from elsewhere. Counts are kept in memory, per
+// instance.
+type LoginGuard struct {
+	mu        sync.Mutex
+	pairs     map[string]*loginFailures // by IP and lowercase username
+	ips       map[string]*loginFailures
+	bans      map[string]time.Time // until when each IP is banned
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewLoginGuard creates a login guard without any failures
+func NewLoginGuard() *LoginGuard {
+	return &LoginGuard{
+		pairs: make(map[string]*loginFailures),
+		ips:   make(map[string]*loginFailures),
+		bans:  make(map[string]time.Time),
+		now:   time.Now,
+	}
+}
+
+// loginPair returns the key of an IP and username
+func loginPair(ip, username string) string {
+	return ip + "\x00" + strings.ToLower(username)
+}
+
+// allowlisted reports whether an IP is in the allowlist, as an address or
+// within a CIDR range
+func allowlisted(ip string, allowlist []string) bool {
+	addr := net.ParseIP(ip)
+	for _, entry := range allowlist {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if addr != nil && network.Contains(addr) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// sweep drops failures older than the window and expired bans, at most once
+// a minute. The caller holds the lock.
+func (lg *LoginGuard) sweep(now time.Time, window time.Duration) {
+	if now.Sub(lg.lastSweep) < time.Minute {
+		return
+	}
+	for key, failures := range lg.pairs {
+		if now.Sub(failures.last) > window {
+			delete(lg.pairs, key)
+		}
+	}
+	for ip, failures := range lg.ips {
+		if now.Sub(failures.last) > window {
+			delete(lg.ips, ip)
+		}
+	}
+	for ip, until := range lg.bans {
+		if !now.Before(until) {
+			delete(lg.bans, ip)
+		}
+	}
+	lg.lastSweep = now
+}
+
+// recent returns the failures counted under a key within the window. The
+// caller holds the lock.
+func recent(failures map[string]*loginFailures, key string, now time.Time, window time.Duration) *loginFailures {
+	counted, exists := failures[key]
+	if !exists || now.Sub(counted.last) > window {
+		counted = &loginFailures{}
+		failures[key] = counted
+	}
+	return counted
+}
+
+// loginDelay returns how long a pair with failures failed logins waits
+// before its next attempt: nothing before cfg.DelayAfter, then a second,
+// doubling with each further failure up to cfg.MaxDelay
+func loginDelay(failures int, cfg LoginGuardConfig) time.Duration {
+	if failures < cfg.DelayAfter {
+		return 0
+	}
+	var delay time.Duration
+	if doublings := failures - cfg.DelayAfter; doublings < 32 {
+		delay = time.Second << doublings
+	}
+	if delay == 0 || delay > cfg.MaxDelay {
+		delay = cfg.MaxDelay
+	}
+	return delay
+}
+
+// Attempt records a login attempt before its password is checked. It
+// returns how long the attempt has to wait before the pair may try again,
+// and for how much longer its IP is banned, if it is; the attempt may go
+// ahead only if both are zero. An attempt that goes ahead reserves the
+// delay its failure would earn, so concurrent attempts can't all slip
+// through before the first one fails.
+func (lg *LoginGuard) Attempt(ip, username string, cfg LoginGuardConfig) (retryAfter, banned time.Duration) {
+	if allowlisted(ip, cfg.Allowlist) {
+		return 0, 0
+	}
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+
+	now := lg.now()
+	lg.sweep(now, cfg.Window)
+	if until, exists := lg.bans[ip]; exists && now.Before(until) {
+		return 0, until.Sub(now)
+	}
+	key := loginPair(ip, username)
+	failures, exists := lg.pairs[key]
+	if exists && now.Sub(failures.last) > cfg.Window && !now.Before(failures.next) {
+		exists = false
+	}
+	if exists && now.Before(failures.next) {
+		return failures.next.Sub(now), 0
+	}
+	count := 0
+	if exists {
+		count = failures.count
+	}
+	if delay := loginDelay(count+1, cfg); delay > 0 {
+		if !exists {
+			failures = recent(lg.pairs, key, now, cfg.Window)
+			failures.last = now
+		}
+		failures.next = now.Add(delay)
+	}
+	return 0, 0
+}
+
+// Fail counts a failed login, banning the IP once it reaches cfg.BanAfter
+// failures within the window
+func (lg *LoginGuard) Fail(ip, username string, cfg LoginGuardConfig) {
+	if allowlisted(ip, cfg.Allowlist) {
+		return
+	}
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+
+	now := lg.now()
+	pair := recent(lg.pairs, loginPair(ip, username), now, cfg.Window)
+	pair.count++
+	pair.last = now
+	if next := now.Add(loginDelay(pair.count, cfg)); next.After(pair.next) {
+		pair.next = next
+	}
+	fromIP := recent(lg.ips, ip, now, cfg.Window)
+	fromIP.count++
+	fromIP.last = now
+	if cfg.BanAfter > 0 && fromIP.count >= cfg.BanAfter {
+		lg.bans[ip] = now.Add(cfg.BanDuration)
+		delete(lg.ips, ip)
+		log.Printf("🚫 Banned %s from logging in for %s after %d failed logins", ip, cfg.BanDuration, fromIP.count)
+	}
+}
+
+// Succeed forgets the failed logins for a username from an IP. Those from
+// the IP for other usernames still count towards a ban.
+func (lg *LoginGuard) Succeed(ip, username string) {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	delete(lg.pairs, loginPair(ip, username))
+}
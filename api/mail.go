@@ -0,0 +1,441 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed mail/*.tmpl
+var mailTemplateFiles embed.FS
+
+// mailTemplates render the emails. Each starts with a Subject: line and a
+// blank line before the body.
+var mailTemplates = template.Must(template.ParseFS(mailTemplateFiles, "mail/*.tmpl"))
+
+// Purposes of mailed codes
+const (
+	mailTokenVerifyEmail   = "verify_email"
+	mailTokenPasswordReset = "password_reset"
+)
+
+// Mail timing and limits
+const (
+	verifyEmailTTL   = 24 * time.Hour
+	passwordResetTTL = time.Hour
+	maxMailAttempts  = 5
+	mailBatchSize    = 50
+	digestPeriod     = 7 * 24 * time.Hour
+	maxDigestFilms   = 50
+)
+
+// Mailer sends a plain-text email
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// NewMailer returns an SMTP mailer, or one that only logs when no SMTP host
+// is configured
+func NewMailer(cfg MailConfig) Mailer {
+	if cfg.SMTPHost == "" {
+		return logMailer{}
+	}
+	return &SMTPMailer{cfg: cfg}
+}
+
+// SMTPMailer sends emails through an SMTP server, authenticating when a
+// username is configured
+type SMTPMailer struct {
+	cfg MailConfig
+}
+
+// Send delivers an email through the SMTP server
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", m.cfg.SMTPUsername, m.cfg.SMTPPassword, m.cfg.SMTPHost)
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&message, "To: %s\r\n", to)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	addr := net.JoinHostPort(m.cfg.SMTPHost, m.cfg.SMTPPort)
+	return smtp.SendMail(addr, auth, m.cfg.From, []string{to}, message.Bytes())
+}
+
+// logMailer stands in for SMTP in development. It logs who an email was for
+// and drops it.
+type logMailer struct{}
+
+func (logMailer) Send(to, subject, body string) error {
+	log.Printf("📧 Not sending %q to %s, no SMTP host configured", subject, to)
+	return nil
+}
+
+// MailService queues emails in the outbox and sends them in the background
+type MailService struct {
+	db     *gorm.DB
+	mailer Mailer
+
+	// sending keeps two runs from sending the same emails
+	sending sync.Mutex
+}
+
+// NewMailService creates a new mail service sending through a mailer
+func NewMailService(db *gorm.DB, mailer Mailer) *MailService {
+	return &MailService{db: db, mailer: mailer}
+}
+
+// renderMail renders a template into the subject and body of an email
+func renderMail(name string, data interface{}) (string, string, error) {
+	var out bytes.Buffer
+	if err := mailTemplates.ExecuteTemplate(&out, name+".tmpl", data); err != nil {
+		return "", "", err
+	}
+	header, body, found := strings.Cut(out.String(), "\n\n")
+	if !found || !strings.HasPrefix(header, "Subject: ") {
+		return "", "", fmt.Errorf("mail template %s has no subject line", name)
+	}
+	return strings.TrimPrefix(header, "Subject: "), body, nil
+}
+
+// Enqueue renders an email and puts it in the outbox
+func (ms *MailService) Enqueue(tx *gorm.DB, to, templateName string, data interface{}) error {
+	subject, body, err := renderMail(templateName, data)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&OutboxEmail{To: to, Subject: subject, Body: body, NextAttemptAt: time.Now().UTC()}).Error
+}
+
+// SendPending sends the emails in the outbox that are due. A failed email is
+// tried again after a delay growing with the square of its attempts, until it
+// runs out of attempts.
+func (ms *MailService) SendPending(ctx context.Context) error {
+	ms.sending.Lock()
+	defer ms.sending.Unlock()
+
+	var emails []OutboxEmail
+	err := ms.db.WithContext(ctx).
+		Where("sent_at IS NULL AND attempts < ? AND next_attempt_at <= ?", maxMailAttempts, time.Now().UTC()).
+		Order("id").
+		Limit(mailBatchSize).
+		Find(&emails).Error
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, email := range emails {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		now := time.Now().UTC()
+		updates := map[string]interface{}{"attempts": email.Attempts + 1}
+		if err := ms.mailer.Send(email.To, email.Subject, email.Body); err != nil {
+			failed++
+			updates["last_error"] = err.Error()
+			updates["next_attempt_at"] = now.Add(time.Duration((email.Attempts+1)*(email.Attempts+1)) * time.Minute)
+			log.Printf("Warning: Failed to send email %d (attempt %d/%d): %v", email.ID, email.Attempts+1, maxMailAttempts, err)
+		} else {
+			updates["sent_at"] = now
+		}
+		if err := ms.db.Model(&OutboxEmail{}).Where("id = ?", email.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d emails failed", failed, len(emails))
+	}
+	return nil
+}
+
+// hashMailToken returns the stored form of a mailed code
+func hashMailToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueToken replaces the codes a user has for a purpose with a new one
+func issueToken(tx *gorm.DB, username, purpose, email string, ttl time.Duration) (string, error) {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	token := hex.EncodeToString(bytes)
+
+	if err := tx.Where("username = ? AND purpose = ?", username, purpose).Delete(&MailToken{}).Error; err != nil {
+		return "", err
+	}
+	mailToken := MailToken{
+		Hash:      hashMailToken(token),
+		Username:  username,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: time.Now().UTC().Add(ttl),
+	}
+	if err := tx.Create(&mailToken).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// redeemToken uses up a code, returning what it was issued for. Expired and
+// unknown codes are rejected alike.
+func redeemToken(tx *gorm.DB, token, purpose string) (*MailToken, error) {
+	var mailToken MailToken
+	err := tx.Where("hash = ? AND purpose = ?", hashMailToken(token), purpose).First(&mailToken).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("invalid token")
+		}
+		return nil, err
+	}
+	if time.Now().UTC().After(mailToken.ExpiresAt) {
+		return nil, errors.New("invalid token")
+	}
+	if err := tx.Delete(&mailToken).Error; err != nil {
+		return nil, err
+	}
+	return &mailToken, nil
+}
+
+// displayName is how emails greet a user
+func displayName(user *User) string {
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+	return user.Username
+}
+
+// SendVerification mails a user a code confirming their email address
+func (ms *MailService) SendVerification(user *User) error {
+	if user.Email == nil {
+		return nil
+	}
+	return WithTransaction(ms.db, func(tx *gorm.DB) error {
+		return ms.queueVerification(tx, user)
+	})
+}
+
+// queueVerification issues a verification code for the email address of a
+// user and queues the email carrying it, in the transaction of tx
+func (ms *MailService) queueVerification(tx *gorm.DB, user *User) error {
+	token, err := issueToken(tx, user.Username, mailTokenVerifyEmail, *user.Email, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	return ms.Enqueue(tx, *user.Email, "verify_email", map[string]interface{}{
+		"Name":      displayName(user),
+		"Email":     *user.Email,
+		"Token":     token,
+		"ExpiresIn": "24 hours",
+	})
+}
+
+// VerifyEmail confirms the email address of a user with a mailed code. The
+// code only confirms the address it was sent to.
+func (ms *MailService) VerifyEmail(username, token string) error {
+	return ms.db.Transaction(func(tx *gorm.DB) error {
+		mailToken, err := redeemToken(tx, token, mailTokenVerifyEmail)
+		if err != nil {
+			return err
+		}
+		if mailToken.Username != username {
+			return errors.New("invalid token")
+		}
+		result := tx.Model(&User{}).
+			Where("username = ? AND email = ?", username, mailToken.Email).
+			Update("email_verified", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("invalid token")
+		}
+		return nil
+	})
+}
+
+// RequestPasswordReset mails a reset code to the user with a verified email
+// address. Unknown addresses are ignored, so callers can't tell which exist.
+func (ms *MailService) RequestPasswordReset(email string) error {
+	var user User
+	err := ms.db.Where("email = ? AND email_verified = ?", email, true).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return ms.db.Transaction(func(tx *gorm.DB) error {
+		token, err := issueToken(tx, user.Username, mailTokenPasswordReset, email, passwordResetTTL)
+		if err != nil {
+			return err
+		}
+		return ms.Enqueue(tx, email, "password_reset", map[string]interface{}{
+			"Name":      displayName(&user),
+			"Username":  user.Username,
+			"Token":     token,
+			"ExpiresIn": "1 hour",
+		})
+	})
+}
+
+// ResetPassword sets a new password with a mailed reset code
+func (ms *MailService) ResetPassword(token, password string) error {
+	return ms.db.Transaction(func(tx *gorm.DB) error {
+		mailToken, err := redeemToken(tx, token, mailTokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&User{}).Where("username = ?", mailToken.Username).Update("password", password)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("invalid token")
+		}
+		return nil
+	})
+}
+
+// SendDigests mails the films added in the past week to every user who
+// turned the digest on and verified their email address. Nothing is sent in
+// a week without new films.
+func (ms *MailService) SendDigests(ctx context.Context) error {
+	since := time.Now().UTC().Add(-digestPeriod)
+	var films []Film
+	if err := ms.db.WithContext(ctx).Where("created_at >= ?", since).Order("created_at, id").Limit(maxDigestFilms).Find(&films).Error; err != nil {
+		return err
+	}
+	if len(films) == 0 {
+		return nil
+	}
+
+	var users []User
+	if err := ms.db.WithContext(ctx).Where("digest = ? AND email_verified = ? AND email IS NOT NULL", true, true).Find(&users).Error; err != nil {
+		return err
+	}
+	for i := range users {
+		err := ms.Enqueue(ms.db.WithContext(ctx), *users[i].Email, "film_digest", map[string]interface{}{
+			"Name":  displayName(&users[i]),
+			"Since": since,
+			"Films": films,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(users) > 0 {
+		log.Printf("📧 Queued the film digest for %d users", len(users))
+	}
+	return nil
+}
+
+// verifyEmailHandler handles POST /api/me/email/verify
+func (s *Server) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+	var verifyReq EmailVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&verifyReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+	if verifyReq.Token == "" {
+		writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: []FieldError{{Field: "token", Message: "is required", Code: "field_required"}}})
+		return
+	}
+
+	if err := s.mailService.VerifyEmail(currentUsername(r), verifyReq.Token); err != nil {
+		if err.Error() == "invalid token" {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid or expired code", Code: "mail_code_invalid"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to verify email", Code: "email_verify_failed"})
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// passwordResetHandler handles POST /api/password-reset, mailing a reset
+// code. It answers 202 whether or not the address belongs to a user.
+func (s *Server) passwordResetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+	var resetReq PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&resetReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+	resetReq.Email = strings.TrimSpace(resetReq.Email)
+	if resetReq.Email == "" {
+		writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: []FieldError{{Field: "email", Message: "is required", Code: "field_required"}}})
+		return
+	}
+
+	if err := s.mailService.RequestPasswordReset(resetReq.Email); err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to request password reset", Code: "password_reset_request_failed"})
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// passwordResetConfirmHandler handles POST /api/password-reset/confirm
+func (s *Server) passwordResetConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+	var confirmReq PasswordResetConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&confirmReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+	var fields []FieldError
+	if confirmReq.Token == "" {
+		fields = append(fields, FieldError{Field: "token", Message: "is required", Code: "field_required"})
+	}
+	if confirmReq.Password == "" {
+		fields = append(fields, FieldError{Field: "password", Message: "is required", Code: "field_required"})
+	}
+	if len(fields) > 0 {
+		writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: fields})
+		return
+	}
+
+	if err := s.mailService.ResetPassword(confirmReq.Token, confirmReq.Password); err != nil {
+		if err.Error() == "invalid token" {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid or expired code", Code: "mail_code_invalid"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset password", Code: "password_reset_failed"})
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maintenanceMessage is what mutations get in maintenance mode unless an
+// admin gave a message of their own
+const maintenanceMessage = "The API is under maintenance, try again later"
+
+// maintenanceExempt are the mutating endpoints that keep working during
+// maintenance, like admins switching it off again
+var maintenanceExempt = map[string]bool{
+	"/api/login":             true,
+	"/api/logout":            true,
+	"/api/admin/maintenance": true,
+	// Admins may end read-only mode during maintenance
+	"/api/admin/read-only": true,
+	"/api/films/lookup":    true,
+}
+
+// maintenanceFromConfig returns the maintenance mode to start in
+func maintenanceFromConfig(cfg *Config) *MaintenanceMode {
+	if !cfg.Server.Maintenance {
+		return nil
+	}
+	return &MaintenanceMode{
+		Enabled:           true,
+		Message:           cfg.Server.MaintenanceMessage,
+		RetryAfterSeconds: int(cfg.Server.MaintenanceRetryAfter / time.Second),
+	}
+}
+
+// currentMaintenance returns the maintenance mode, disabled when off
+func (s *Server) currentMaintenance() MaintenanceMode {
+	if mode := s.maintenance.Load(); mode != nil {
+		return *mode
+	}
+	return MaintenanceMode{}
+}
+
+// rejectWritesInMaintenance answers mutations with 503 during maintenance,
+// while reads keep working. A message set by an admin is sent as is, in
+// their language, with the code the default message has.
+func (s *Server) rejectWritesInMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode := s.maintenance.Load()
+		if mode != nil && isMutation(r.Method) && !maintenanceExempt[r.URL.Path] {
+			response := ErrorResponse{Error: maintenanceMessage, Code: "maintenance"}
+			if mode.Message != "" {
+				response.Error = mode.Message
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(mode.RetryAfterSeconds))
+			writeResponse(w, r, http.StatusServiceUnavailable, response)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maintenanceHandler shows or switches maintenance mode (admin only)
+func (s *Server) maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var modeReq MaintenanceMode
+		if err := json.NewDecoder(r.Body).Decode(&modeReq); err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+			return
+		}
+		if modeReq.RetryAfterSeconds < 0 {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "retry_after_seconds must not be negative", Code: "maintenance_retry_after_negative"})
+			return
+		}
+
+		var mode *MaintenanceMode
+		if modeReq.Enabled {
+			if modeReq.RetryAfterSeconds == 0 {
+				modeReq.RetryAfterSeconds = int(s.currentConfig().Server.MaintenanceRetryAfter / time.Second)
+			}
+			mode = &modeReq
+		}
+		if previous := s.maintenance.Swap(mode); (previous != nil) != modeReq.Enabled {
+			log.Printf("⚠️  Maintenance mode %s by %s", map[bool]string{true: "enabled", false: "disabled"}[modeReq.Enabled], currentUsername(r))
+		}
+	default:
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, s.currentMaintenance())
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// newUserProfile builds the public profile of a user
+func newUserProfile(user *User) UserProfile {
+	profile := UserProfile{
+		ID:             user.ID,
+		Username:       user.Username,
+		Role:           user.Role,
+		Active:         user.Active,
+		DisplayName:    user.DisplayName,
+		AvatarURL:      user.AvatarURL,
+		Digest:         user.Digest,
+		EmailVerified:  user.EmailVerified,
+		OrganizationID: user.OrganizationID,
+		CreatedAt:      user.CreatedAt,
+	}
+	if user.Email != nil {
+		profile.Email = *user.Email
+	}
+	return profile
+}
+
+// meHandler routes /api/me by method
+func (s *Server) meHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		s.getMeHandler(w, r)
+	case "PUT":
+		s.updateMeHandler(w, r)
+	case "DELETE":
+		s.deleteMeHandler(w, r)
+	default:
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+	}
+}
+
+// getMeHandler returns the profile of the authenticated user
+func (s *Server) getMeHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := s.users.GetUserByUsername(currentUsername(r))
+	if err != nil {
+		// The token outlived its user
+		if err.Error() == "user not found" {
+			writeResponse(w, r, http.StatusUnauthorized, ErrorResponse{Error: "User no longer exists", Code: "user_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve user", Code: "user_retrieve_failed"})
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserProfile(user))
+}
+
+// updateMeHandler updates the profile fields of the authenticated user
+func (s *Server) updateMeHandler(w http.ResponseWriter, r *http.Request) {
+	var profileReq ProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&profileReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+
+	if validationErr := ValidateProfileRequest(&profileReq); validationErr != nil {
+		writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: validationErr.Fields})
+		return
+	}
+
+	user, err := s.userService.UpdateProfile(currentUsername(r), profileReq)
+	if err != nil {
+		var hookErr *HookError
+		if errors.As(err, &hookErr) {
+			writeResponse(w, r, http.StatusUnprocessableEntity, errorResponse(hookErr))
+		} else if err.Error() == "email already in use" {
+			writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "Email already in use", Code: "email_in_use"})
+		} else if err.Error() == "user not found" {
+			writeResponse(w, r, http.StatusUnauthorized, ErrorResponse{Error: "User no longer exists", Code: "user_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update profile", Code: "profile_update_failed"})
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserProfile(user))
+}
+
+// deleteMeHandler deletes the account of the authenticated user and signs
+// it out everywhere
+func (s *Server) deleteMeHandler(w http.ResponseWriter, r *http.Request) {
+	username := currentUsername(r)
+	if err := s.userService.DeleteAccount(username); err != nil {
+		switch err.Error() {
+		case "user not found":
+			writeResponse(w, r, http.StatusUnauthorized, ErrorResponse{Error: "User no longer exists", Code: "user_not_found"})
+		case "last admin":
+			writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "The last admin can't delete their account", Code: "last_admin_delete"})
+		case "copies still borrowed":
+			writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "Return borrowed copies before deleting your account", Code: "account_has_loans"})
+		default:
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete account", Code: "account_delete_failed"})
+		}
+		return
+	}
+
+	s.tokenStore.RemoveUserTokens(username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// meLimitsHandler handles GET /api/me/limits, reporting how much of their
+// limits the authenticated user used
+func (s *Server) meLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	films, err := DailyFilmUsage(s.currentConfig(), s.tenantFilms(r), user, s.db.NowFunc())
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve limits", Code: "limits_retrieve_failed"})
+		return
+	}
+	writeResponse(w, r, http.StatusOK, UserLimits{FilmsPerDay: *films})
+}
+
+// exportMeHandler handles GET /api/me/export, sending the authenticated user
+// everything stored about them as a JSON file
+func (s *Server) exportMeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	username := currentUsername(r)
+	data, err := s.userService.ExportAccount(username)
+	if err != nil {
+		if err.Error() == "user not found" {
+			writeResponse(w, r, http.StatusUnauthorized, ErrorResponse{Error: "User no longer exists", Code: "user_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to export account data", Code: "account_export_failed"})
+		}
+		return
+	}
+	data.Sessions = s.sessions(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="account.json"`)
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,691 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// memoryTenant is the only organization of the memory backend
+var memoryTenant = Tenant{OrganizationID: 1, Slug: defaultTenant}
+
+// memoryNow returns the current time as the database would store it
+func memoryNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// memoryFilms is the film table the repositories of every organization share
+type memoryFilms struct {
+	mu        sync.RWMutex
+	films     map[uint]Film
+	revisions map[uint][]FilmRevision
+	nextID    uint
+}
+
+// MemoryFilmRepository keeps the film catalog in memory, for handler tests
+// and demos without a database. Films are gone on restart, and deleted films
+// are removed at once instead of going to the trash.
+type MemoryFilmRepository struct {
+	table   *memoryFilms
+	tenant  Tenant
+	scoped  bool
+	config  *liveConfig
+	plugins *Plugins
+}
+
+// NewMemoryFilmRepository creates an empty catalog spanning every
+// organization. It checks quotas with the settings of config and runs the
+// hooks of plugins.
+func NewMemoryFilmRepository(config *liveConfig, plugins *Plugins) *MemoryFilmRepository {
+	return &MemoryFilmRepository{
+		table:   &memoryFilms{films: make(map[uint]Film), revisions: make(map[uint][]FilmRevision)},
+		config:  config,
+		plugins: plugins,
+	}
+}
+
+// ForTenant returns the repository of the films of one organization
+func (m *MemoryFilmRepository) ForTenant(tenant Tenant) FilmRepository {
+	return &MemoryFilmRepository{table: m.table, tenant: tenant, scoped: true, config: m.config, plugins: m.plugins}
+}
+
+// visible reports whether a film belongs to the organization of the repository
+func (m *MemoryFilmRepository) visible(film *Film) bool {
+	return !m.scoped || film.OrganizationID == m.tenant.OrganizationID
+}
+
+// list returns the visible films matching a query, ordered by ID. The caller
+// holds the lock.
+func (m *MemoryFilmRepository) list(query *FilmQuery) []Film {
+	films := make([]Film, 0)
+	for _, film := range m.table.films {
+		if m.visible(&film) && query.matches(&film) {
+			films = append(films, film)
+		}
+	}
+	sort.Slice(films, func(i, j int) bool { return films[i].ID < films[j].ID })
+	return films
+}
+
+// get returns a visible film by ID. The caller holds the lock.
+func (m *MemoryFilmRepository) get(id uint) (*Film, error) {
+	film, exists := m.table.films[id]
+	if !exists || !m.visible(&film) {
+		return nil, errors.New("film not found")
+	}
+	return &film, nil
+}
+
+// findConflict returns the film a request refers to, matched by external ID
+// first and by natural key otherwise, ignoring excludeID. The caller holds
+// the lock.
+func (m *MemoryFilmRepository) findConflict(filmReq FilmRequest, excludeID uint) *Film {
+	films := m.list(nil)
+	if filmReq.ExternalID != "" {
+		for i := range films {
+			if films[i].ID != excludeID && films[i].ExternalID != nil && *films[i].ExternalID == filmReq.ExternalID {
+				return &films[i]
+			}
+		}
+	}
+	title, director := normalizeFilmKey(filmReq.Title), normalizeFilmKey(filmReq.Director)
+	for i := range films {
+		if films[i].ID != excludeID && normalizeFilmKey(films[i].Title) == title &&
+			films[i].Year == filmReq.Year && normalizeFilmKey(films[i].Director) == director {
+			return &films[i]
+		}
+	}
+	return nil
+}
+
+// add stores new films, assigning their IDs, version, and timestamps. The
+// caller holds the lock.
+func (m *MemoryFilmRepository) add(films []Film) {
+	now := memoryNow()
+	for i := range films {
+		if films[i].ID == 0 {
+			m.table.nextID++
+			films[i].ID = m.table.nextID
+		}
+		m.table.nextID = max(m.table.nextID, films[i].ID)
+		films[i].Version = 1
+		films[i].CreatedAt, films[i].UpdatedAt = now, now
+		m.table.films[films[i].ID] = films[i]
+	}
+}
+
+// GetAllFilms retrieves all films matching a query (nil for all)
+func (m *MemoryFilmRepository) GetAllFilms(query *FilmQuery) ([]Film, error) {
+	m.table.mu.RLock()
+	defer m.table.mu.RUnlock()
+	return m.list(query), nil
+}
+
+// GetFilmsPage retrieves one page of the films matching a query, ordered by ID, with the total count
+func (m *MemoryFilmRepository) GetFilmsPage(query *FilmQuery, page, pageSize int) ([]Film, int64, error) {
+	m.table.mu.RLock()
+	defer m.table.mu.RUnlock()
+	films := m.list(query)
+	start := min((page-1)*pageSize, len(films))
+	end := min(start+pageSize, len(films))
+	return films[start:end], int64(len(films)), nil
+}
+
+// GetFilmsAfter retrieves up to limit films following a cursor (keyset pagination).
+// A nil cursor starts from the beginning. The returned cursor is nil on the last page.
+func (m *MemoryFilmRepository) GetFilmsAfter(filter *FilmQuery, cursor *FilmCursor, order string, limit int) ([]Film, *FilmCursor, error) {
+	m.table.mu.RLock()
+	defer m.table.mu.RUnlock()
+	films := m.list(filter)
+	if order == cursorOrderCreatedAt {
+		sort.SliceStable(films, func(i, j int) bool { return films[i].CreatedAt.Before(films[j].CreatedAt) })
+	}
+
+	page := make([]Film, 0, limit+1)
+	for _, film := range films {
+		if cursor != nil {
+			if order == cursorOrderCreatedAt {
+				if c := film.CreatedAt.Compare(cursor.CreatedAt); c < 0 || (c == 0 && film.ID <= cursor.ID) {
+					continue
+				}
+			} else if film.ID <= cursor.ID {
+				continue
+			}
+		}
+		if page = append(page, film); len(page) > limit {
+			break
+		}
+	}
+	page, next := trimPage(page, order, limit)
+	return page, next, nil
+}
+
+// GetFilmByID retrieves a film by ID
+func (m *MemoryFilmRepository) GetFilmByID(id uint) (*Film, error) {
+	m.table.mu.RLock()
+	defer m.table.mu.RUnlock()
+	return m.get(id)
+}
+
+// GetFilmsByIDs returns the films among ids that exist
+func (m *MemoryFilmRepository) GetFilmsByIDs(ids []uint) ([]Film, error) {
+	m.table.mu.RLock()
+	defer m.table.mu.RUnlock()
+	films := make([]Film, 0, len(ids))
+	for _, id := range ids {
+		if film, err := m.get(id); err == nil {
+			films = append(films, *film)
+		}
+	}
+	return films, nil
+}
+
+// FindConflict returns the stored film a record refers to, matched by external
+// ID first and by natural key otherwise, ignoring excludeID
+func (m *MemoryFilmRepository) FindConflict(filmReq FilmRequest, excludeID uint) (*Film, error) {
+	m.table.mu.RLock()
+	defer m.table.mu.RUnlock()
+	return m.findConflict(filmReq, excludeID), nil
+}
+
+// CreateFilm creates a new film owned by its creator
+func (m *MemoryFilmRepository) CreateFilm(filmReq FilmRequest, creator *User) (*Film, error) {
+	return m.createFilm(0, filmReq, creator)
+}
+
+// CreateFilmAt creates a new film owned by its creator under a chosen ID
+func (m *MemoryFilmRepository) CreateFilmAt(id uint, filmReq FilmRequest, creator *User) (*Film, error) {
+	return m.createFilm(id, filmReq, creator)
+}
+
+// createFilm creates a film under an ID, or the next free one for 0
+func (m *MemoryFilmRepository) createFilm(id uint, filmReq FilmRequest, creator *User) (*Film, error) {
+	m.table.mu.RLock()
+	existing := m.findConflict(filmReq, 0)
+	count := int64(len(m.list(nil)))
+	m.table.mu.RUnlock()
+	if existing != nil {
+		return nil, &DuplicateFilmError{Existing: existing}
+	}
+	plan := GetTenantPlan(Organization{Slug: m.tenant.Slug}, m.config.Load().Quota)
+	if err := checkQuota(m.tenant.Slug, plan, count, 1); err != nil {
+		return nil, err
+	}
+	if err := checkDailyQuota(m.config.Load(), m, creator, 1, memoryNow()); err != nil {
+		return nil, err
+	}
+
+	film := newFilm(filmReq, creator, m.tenant.OrganizationID)
+	film.ID = id
+	hc := HookContext{Action: ActionCreate}
+	if err := m.plugins.runFilmPrePersist(hc, &film); err != nil {
+		return nil, err
+	}
+
+	// Check again, like the unique index, in case a concurrent create won
+	m.table.mu.Lock()
+	if existing := m.findConflict(filmReq, 0); existing != nil {
+		m.table.mu.Unlock()
+		return nil, &DuplicateFilmError{Existing: existing}
+	}
+	// IDs are shared by all organizations, like the primary key
+	if _, taken := m.table.films[id]; taken {
+		m.table.mu.Unlock()
+		return nil, errors.New("film id taken")
+	}
+	if id != 0 {
+		var maxID uint
+		for other := range m.table.films {
+			maxID = max(maxID, other)
+		}
+		if err := checkFilmID(id, maxID); err != nil {
+			m.table.mu.Unlock()
+			return nil, err
+		}
+	}
+	films := []Film{film}
+	m.add(films)
+	m.table.mu.Unlock()
+
+	NotifyQuotaUsage(m.config.Load().Alerts, m.tenant.Slug, plan, count, count+1)
+	m.plugins.runFilmPostCommit(hc, &films[0])
+	return &films[0], nil
+}
+
+// CreateFilms creates several films owned by their creator at once
+func (m *MemoryFilmRepository) CreateFilms(filmReqs []FilmRequest, creator *User) ([]Film, error) {
+	m.table.mu.RLock()
+	count := int64(len(m.list(nil)))
+	m.table.mu.RUnlock()
+	plan := GetTenantPlan(Organization{Slug: m.tenant.Slug}, m.config.Load().Quota)
+	if err := checkQuota(m.tenant.Slug, plan, count, int64(len(filmReqs))); err != nil {
+		return nil, err
+	}
+	if err := checkDailyQuota(m.config.Load(), m, creator, int64(len(filmReqs)), memoryNow()); err != nil {
+		return nil, err
+	}
+
+	hc := HookContext{Action: ActionCreate}
+	films := make([]Film, len(filmReqs))
+	for i, filmReq := range filmReqs {
+		films[i] = newFilm(filmReq, creator, m.tenant.OrganizationID)
+		if err := m.plugins.runFilmPrePersist(hc, &films[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	m.table.mu.Lock()
+	m.add(films)
+	m.table.mu.Unlock()
+
+	NotifyQuotaUsage(m.config.Load().Alerts, m.tenant.Slug, plan, count, count+int64(len(films)))
+	for i := range films {
+		m.plugins.runFilmPostCommit(hc, &films[i])
+	}
+	return films, nil
+}
+
+// CountCreatedSince counts the films a user created since a time. Deleted
+// films are gone, so unlike in the database they no longer count.
+func (m *MemoryFilmRepository) CountCreatedSince(userID uint, since time.Time) (int64, error) {
+	m.table.mu.RLock()
+	defer m.table.mu.RUnlock()
+	var count int64
+	for _, film := range m.list(nil) {
+		if film.CreatedBy != nil && *film.CreatedBy == userID && !film.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// UpdateFilm updates an existing film the editor may change
+func (m *MemoryFilmRepository) UpdateFilm(id uint, filmReq FilmRequest, editor *User) (*Film, error) {
+	film, err := m.GetFilmByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !canEditFilm(editor, film) {
+		return nil, errors.New("not the film creator")
+	}
+	if filmReq.Version != nil && *filmReq.Version != film.Version {
+		return nil, &VersionConflictError{Current: film}
+	}
+	if existing, _ := m.FindConflict(filmReq, id); existing != nil {
+		return nil, &DuplicateFilmError{Existing: existing}
+	}
+
+	applyFilmRequest(film, filmReq)
+	hc := HookContext{Action: ActionUpdate}
+	if err := m.plugins.runFilmPrePersist(hc, film); err != nil {
+		return nil, err
+	}
+
+	// Only write over the version we read, so a concurrent update can't be lost
+	m.table.mu.Lock()
+	current, err := m.get(id)
+	if err != nil {
+		m.table.mu.Unlock()
+		return nil, err
+	}
+	if current.Version != film.Version {
+		m.table.mu.Unlock()
+		return nil, &VersionConflictError{Current: current}
+	}
+	film.Version++
+	film.UpdatedAt = memoryNow()
+	m.table.revisions[id] = append(m.table.revisions[id], newFilmRevision(current, editor, film.UpdatedAt))
+	m.table.films[id] = *film
+	m.table.mu.Unlock()
+
+	m.plugins.runFilmPostCommit(hc, film)
+	return film, nil
+}
+
+// SetPoster stores the blob key of the poster of a film the editor may change
+func (m *MemoryFilmRepository) SetPoster(id uint, key string, editor *User) (*Film, string, error) {
+	m.table.mu.Lock()
+	defer m.table.mu.Unlock()
+	film, err := m.get(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if !canEditFilm(editor, film) {
+		return nil, "", errors.New("not the film creator")
+	}
+	previous := film.PosterKey
+	film.PosterKey, film.PosterSizes = key, ""
+	film.UpdatedAt = memoryNow()
+	m.table.films[id] = *film
+	return film, previous, nil
+}
+
+// SetPosterSizes records the thumbnails stored for the poster under a key
+func (m *MemoryFilmRepository) SetPosterSizes(id uint, key string, sizes []string) (bool, error) {
+	m.table.mu.Lock()
+	defer m.table.mu.Unlock()
+	film, exists := m.table.films[id]
+	if !exists || film.PosterKey != key {
+		return false, nil
+	}
+	film.PosterSizes = strings.Join(sizes, ",")
+	m.table.films[id] = film
+	return true, nil
+}
+
+// DeleteFilm removes a film the editor may change
+func (m *MemoryFilmRepository) DeleteFilm(id uint, editor *User) error {
+	film, err := m.GetFilmByID(id)
+	if err != nil {
+		return err
+	}
+	if !canEditFilm(editor, film) {
+		return errors.New("not the film creator")
+	}
+
+	hc := HookContext{Action: ActionDelete}
+	if err := m.plugins.runFilmPrePersist(hc, film); err != nil {
+		return err
+	}
+
+	m.table.mu.Lock()
+	_, err = m.get(id)
+	if err == nil {
+		delete(m.table.films, id)
+		delete(m.table.revisions, id)
+	}
+	m.table.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	m.plugins.runFilmPostCommit(hc, film)
+	return nil
+}
+
+// DeleteFilms removes the films matching an ID list or filter at once. Only
+// post-commit hooks run for bulk deletes. Films the editor may not change are
+// left alone.
+func (m *MemoryFilmRepository) DeleteFilms(ids []uint, filter *FilmFilter, editor *User) (int64, error) {
+	if len(ids) == 0 && (filter == nil || (filter.Genre == "" && filter.Director == "" && filter.Year == 0)) {
+		return 0, ErrBatchSelectorRequired
+	}
+	selected := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	m.table.mu.Lock()
+	var deleted []Film
+	for _, film := range m.list(nil) {
+		if len(ids) > 0 && !selected[film.ID] {
+			continue
+		}
+		if filter != nil && ((filter.Genre != "" && film.Genre != filter.Genre) ||
+			(filter.Director != "" && film.Director != filter.Director) ||
+			(filter.Year != 0 && film.Year != filter.Year)) {
+			continue
+		}
+		if !canEditFilm(editor, &film) {
+			continue
+		}
+		delete(m.table.films, film.ID)
+		delete(m.table.revisions, film.ID)
+		deleted = append(deleted, film)
+	}
+	m.table.mu.Unlock()
+
+	hc := HookContext{Action: ActionDelete}
+	for i := range deleted {
+		m.plugins.runFilmPostCommit(hc, &deleted[i])
+	}
+	return int64(len(deleted)), nil
+}
+
+// MemoryUserRepository keeps user accounts in memory, all in one organization
+type MemoryUserRepository struct {
+	mu      sync.RWMutex
+	users   map[string]User
+	nextID  uint
+	plugins *Plugins
+}
+
+// NewMemoryUserRepository creates a repository without users running the
+// hooks of plugins
+func NewMemoryUserRepository(plugins *Plugins) *MemoryUserRepository {
+	return &MemoryUserRepository{users: make(map[string]User), plugins: plugins}
+}
+
+// GetUserByUsername retrieves a user by username
+func (m *MemoryUserRepository) GetUserByUsername(username string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, exists := m.users[username]
+	if !exists {
+		return nil, errors.New("user not found")
+	}
+	return &user, nil
+}
+
+// IsAdmin reports whether a user has the admin role
+func (m *MemoryUserRepository) IsAdmin(username string) bool {
+	user, err := m.GetUserByUsername(username)
+	return err == nil && user.Role == "admin"
+}
+
+// ValidateUser validates user credentials and returns the user they belong to
+func (m *MemoryUserRepository) ValidateUser(username, password string) (*User, bool) {
+	user, err := m.GetUserByUsername(username)
+	if err != nil || user.Password == unusablePassword || user.Password != password {
+		return nil, false
+	}
+	return user, true
+}
+
+// TenantOf returns the organization a user acts for
+func (m *MemoryUserRepository) TenantOf(user *User) (Tenant, error) {
+	if user.OrganizationID != memoryTenant.OrganizationID {
+		return Tenant{}, errors.New("organization not found")
+	}
+	return memoryTenant, nil
+}
+
+// CreateUser creates a new user
+func (m *MemoryUserRepository) CreateUser(username, password string) (*User, error) {
+	user := User{
+		Username:       username,
+		Password:       password,
+		Role:           "user",
+		Active:         true,
+		OrganizationID: memoryTenant.OrganizationID,
+	}
+
+	hc := HookContext{Action: ActionCreate}
+	if err := m.plugins.runUserPreValidate(hc, &user); err != nil {
+		return nil, err
+	}
+	if err := m.plugins.runUserPrePersist(hc, &user); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	if _, exists := m.users[user.Username]; exists {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("user %s already exists", user.Username)
+	}
+	m.nextID++
+	user.ID = m.nextID
+	user.CreatedAt = memoryNow()
+	user.UpdatedAt = user.CreatedAt
+	m.users[user.Username] = user
+	m.mu.Unlock()
+
+	m.plugins.runUserPostCommit(hc, &user)
+	return &user, nil
+}
+
+// update changes a stored user
+func (m *MemoryUserRepository) update(username string, change func(user *User) error) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, exists := m.users[username]
+	if !exists {
+		return nil, errors.New("user not found")
+	}
+	if err := change(&user); err != nil {
+		return nil, err
+	}
+	user.UpdatedAt = memoryNow()
+	m.users[username] = user
+	return &user, nil
+}
+
+// SetRole changes the role of a user
+func (m *MemoryUserRepository) SetRole(username, role string) error {
+	_, err := m.update(username, func(user *User) error {
+		user.Role = role
+		return nil
+	})
+	return err
+}
+
+// SetPassword replaces the password of a user
+func (m *MemoryUserRepository) SetPassword(username, password string) error {
+	_, err := m.update(username, func(user *User) error {
+		user.Password = password
+		return nil
+	})
+	return err
+}
+
+// SetActive deactivates or reactivates a user of an organization. Its last
+// active admin can't be deactivated, so someone is always left to reactivate
+// accounts.
+func (m *MemoryUserRepository) SetActive(organizationID uint, username string, active bool) (*User, error) {
+	return m.update(username, func(user *User) error {
+		if user.OrganizationID != organizationID {
+			return errors.New("user not found")
+		}
+		if !active && user.Active && user.Role == "admin" {
+			admins := 0
+			for _, other := range m.users {
+				if other.OrganizationID == organizationID && other.Role == "admin" && other.Active {
+					admins++
+				}
+			}
+			if admins <= 1 {
+				return errors.New("last admin")
+			}
+		}
+		user.Active = active
+		return nil
+	})
+}
+
+// GetUsersPage retrieves one page of the users of an organization ordered by
+// username, with the total count. search matches part of the username, email,
+// or display name; an empty search or role matches every user.
+func (m *MemoryUserRepository) GetUsersPage(organizationID uint, search, role string, page, pageSize int) ([]User, int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	search = strings.ToLower(search)
+	users := make([]User, 0)
+	for _, user := range m.users {
+		if user.OrganizationID != organizationID || (role != "" && user.Role != role) {
+			continue
+		}
+		if search != "" {
+			email := ""
+			if user.Email != nil {
+				email = *user.Email
+			}
+			if !strings.Contains(strings.ToLower(user.Username), search) &&
+				!strings.Contains(strings.ToLower(email), search) &&
+				!strings.Contains(strings.ToLower(user.DisplayName), search) {
+				continue
+			}
+		}
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	start := min((page-1)*pageSize, len(users))
+	end := min(start+pageSize, len(users))
+	return users[start:end], int64(len(users)), nil
+}
+
+// seedMemory loads the seed files of dir into the memory repositories, like
+// SeedDatabase does for the database. With reset the films are emptied
+// first, as POST /api/admin/reset does; IDs keep counting up, so seeded films
+// never take the ID of a deleted one. Seed users that exist already only get
+// their role back.
+func seedMemory(films *MemoryFilmRepository, users *MemoryUserRepository, dir string, reset bool) (int, int, error) {
+	data, err := LoadSeeds(dir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load seed files: %v", err)
+	}
+	seeded, err := data.ResolveFilms()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for i := range seeded {
+		seeded[i].OrganizationID = memoryTenant.OrganizationID
+	}
+	films.table.mu.Lock()
+	if reset {
+		films.table.films = make(map[uint]Film)
+		films.table.revisions = make(map[uint][]FilmRevision)
+	}
+	films.add(seeded)
+	films.table.mu.Unlock()
+
+	for _, seed := range data.Users {
+		if _, err := users.GetUserByUsername(seed.Username); err != nil {
+			if _, err := users.CreateUser(seed.Username, seed.Password); err != nil {
+				return 0, 0, fmt.Errorf("failed to seed user %s: %v", seed.Username, err)
+			}
+		}
+		role := seed.Role
+		if role == "" {
+			role = "user"
+		}
+		if err := users.SetRole(seed.Username, role); err != nil {
+			return 0, 0, err
+		}
+	}
+	log.Printf("✅ Loaded %d films and %d users into memory from %s/", len(seeded), len(data.Users), dir)
+	return len(seeded), len(data.Users), nil
+}
+
+// errNoDatabase is what the services that need PostgreSQL, like lists,
+// lending, and search, answer with the memory backend
+var errNoDatabase = errors.New("not available with the memory storage backend")
+
+// noDatabase is a database/sql connector that never connects
+type noDatabase struct{}
+
+func (noDatabase) Connect(context.Context) (driver.Conn, error) { return nil, errNoDatabase }
+func (noDatabase) Driver() driver.Driver                        { return noDatabase{} }
+func (noDatabase) Open(string) (driver.Conn, error)             { return nil, errNoDatabase }
+
+// openWithoutDatabase returns a database handle for the memory backend on
+// which every query fails with errNoDatabase
+func openWithoutDatabase() (*gorm.DB, error) {
+	return gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(noDatabase{})}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Billable operations recorded by the metering service
+const (
+	MeterWrite        = "write"
+	MeterExport       = "export"
+	MeterStorageBytes = "storage_bytes"
+)
+
+// MeteringService records billable operations and rolls them up per day
+type MeteringService struct {
+	db *gorm.DB
+}
+
+// NewMeteringService creates a new metering service
+func NewMeteringService(db *gorm.DB) *MeteringService {
+	return &MeteringService{db: db}
+}
+
+// Record stores a billable operation. Failures are logged rather than
+// returned so metering never breaks the request being billed.
+func (ms *MeteringService) Record(tenant, username, operation string, quantity int64) {
+	event := MeteringEvent{
+		Tenant:    tenant,
+		Username:  username,
+		Operation: operation,
+		Quantity:  quantity,
+	}
+	// Without a database, as with the memory storage backend, usage isn't metered
+	if err := ms.db.Create(&event).Error; err != nil && !errors.Is(err, errNoDatabase) {
+		log.Printf("Warning: Failed to record %s usage for %s: %v", operation, username, err)
+	}
+}
+
+// RecordRequest stores a billable operation for the authenticated user of a request
+func (ms *MeteringService) RecordRequest(r *http.Request, operation string, quantity int64) {
+	tenant := currentTenant(r).Slug
+	if tenant == "" {
+		tenant = defaultTenant
+	}
+	ms.Record(tenant, currentUsername(r), operation, quantity)
+}
+
+// RollupDay recomputes the usage totals of a single day from the recorded events
+func (ms *MeteringService) RollupDay(ctx context.Context, day time.Time) error {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 1)
+
+	return ms.db.WithContext(ctx).Exec(`
+		INSERT INTO usage_rollups (tenant, username, operation, day, quantity, created_at, updated_at)
+		SELECT tenant, username, operation, ?, SUM(quantity), NOW(), NOW()
+		FROM metering_events
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY tenant, username, operation
+		ON CONFLICT (tenant, username, operation, day)
+		DO UPDATE SET quantity = EXCLUDED.quantity, updated_at = NOW()`,
+		start, start, end).Error
+}
+
+// RollupRecent refreshes today's and yesterday's totals. It runs as the usage-rollup scheduled job.
+func (ms *MeteringService) RollupRecent(ctx context.Context) error {
+	now := time.Now().UTC()
+	for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+		if err := ms.RollupDay(ctx, day); err != nil {
+			return fmt.Errorf("failed to roll up usage for %s: %v", day.Format("2006-01-02"), err)
+		}
+	}
+	return nil
+}
+
+// GetUsage returns the daily usage totals in [from, to], optionally filtered
+func (ms *MeteringService) GetUsage(from, to time.Time, tenant, username, operation string) ([]UsageRollup, error) {
+	query := ms.db.Where("day >= ? AND day <= ?", from, to)
+	if tenant != "" {
+		query = query.Where("tenant = ?", tenant)
+	}
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	if operation != "" {
+		query = query.Where("operation = ?", operation)
+	}
+
+	var usage []UsageRollup
+	err := query.Order("day, tenant, username, operation").Find(&usage).Error
+	return usage, err
+}
+
+// usageHandler returns daily usage totals for billing systems
+func (s *Server) usageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	query := r.URL.Query()
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -30)
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid from date, expected YYYY-MM-DD", Code: "invalid_from_date"})
+			return
+		}
+		from = parsed
+	}
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid to date, expected YYYY-MM-DD", Code: "invalid_to_date"})
+			return
+		}
+		to = parsed
+	}
+
+	usage, err := s.meteringService.GetUsage(from, to, query.Get("tenant"), query.Get("username"), query.Get("operation"))
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve usage", Code: "usage_retrieve_failed"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
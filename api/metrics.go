@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// metricsHistoryDays is how far back the metrics history reaches by default
+const metricsHistoryDays = 7
+
+// requestCounters counts requests and the users making them since the last snapshot
+type requestCounters struct {
+	mu           sync.Mutex
+	since        time.Time
+	requests     int64
+	clientErrors int64
+	serverErrors int64
+	users        map[string]bool
+}
+
+// newRequestCounters starts counting requests now
+func newRequestCounters() *requestCounters {
+	return &requestCounters{since: time.Now().UTC(), users: make(map[string]bool)}
+}
+
+// record counts a finished request by its status code
+func (rc *requestCounters) record(status int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests++
+	if status >= 500 {
+		rc.serverErrors++
+	} else if status >= 400 {
+		rc.clientErrors++
+	}
+}
+
+// seeUser marks a user as active in the current period
+func (rc *requestCounters) seeUser(username string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.users[username] = true
+}
+
+// take returns the counts since the last call and starts a new period
+func (rc *requestCounters) take(now time.Time) MetricsSnapshot {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	snapshot := MetricsSnapshot{
+		PeriodStart:  rc.since,
+		PeriodEnd:    now,
+		Requests:     rc.requests,
+		ClientErrors: rc.clientErrors,
+		ServerErrors: rc.serverErrors,
+		ActiveUsers:  int64(len(rc.users)),
+	}
+	rc.since = now
+	rc.requests, rc.clientErrors, rc.serverErrors = 0, 0, 0
+	rc.users = make(map[string]bool)
+	return snapshot
+}
+
+// statusRecorder remembers the status code a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before writing it
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to flush streams
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// countRequests counts every request and its outcome for the metrics snapshots and the anomaly monitor
+func (s *Server) countRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		s.requestMetrics.record(recorder.status)
+		s.anomalyMonitor.record(r.URL.Path, recorder.status)
+	})
+}
+
+// MetricsService stores periodic snapshots of key metrics for deployments without Prometheus
+type MetricsService struct {
+	db       *gorm.DB
+	tokens   *TokenStore
+	requests *requestCounters
+}
+
+// NewMetricsService creates a new metrics service taking snapshots of the
+// counts of requests
+func NewMetricsService(db *gorm.DB, tokens *TokenStore, requests *requestCounters) *MetricsService {
+	return &MetricsService{db: db, tokens: tokens, requests: requests}
+}
+
+// Snapshot stores the request counts since the previous snapshot together with
+// the current catalog size and login tokens
+func (ms *MetricsService) Snapshot(ctx context.Context) error {
+	snapshot := ms.requests.take(time.Now().UTC())
+	if snapshot.Requests > 0 {
+		snapshot.ErrorRate = float64(snapshot.ServerErrors) / float64(snapshot.Requests)
+	}
+	snapshot.ActiveTokens = int64(ms.tokens.CountActive())
+	if err := ms.db.WithContext(ctx).Model(&Film{}).Count(&snapshot.Films).Error; err != nil {
+		return err
+	}
+	return ms.db.WithContext(ctx).Create(&snapshot).Error
+}
+
+// GetHistory retrieves the snapshots taken between from and to, oldest first
+func (ms *MetricsService) GetHistory(from, to time.Time) ([]MetricsSnapshot, error) {
+	var snapshots []MetricsSnapshot
+	err := ms.db.Where("period_end >= ? AND period_end <= ?", from, to).Order("period_end").Find(&snapshots).Error
+	return snapshots, err
+}
+
+// metricsHistoryHandler returns stored metrics snapshots for trend charts (admin only)
+func (s *Server) metricsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	query := r.URL.Query()
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -metricsHistoryDays)
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid from time, expected RFC 3339", Code: "invalid_from_time"})
+			return
+		}
+		from = parsed
+	}
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid to time, expected RFC 3339", Code: "invalid_to_time"})
+			return
+		}
+		to = parsed
+	}
+
+	snapshots, err := s.metricsService.GetHistory(from, to)
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve metrics history", Code: "metrics_history_retrieve_failed"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
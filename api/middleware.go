@@ -0,0 +1,120 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Middleware wraps a handler with a policy, e.g. authentication or a role
+// check, answering the request itself when the policy rejects it
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
+// Chain composes middleware into one, the first running outermost, so
+// Chain(s.requireAuth, s.requireRole("admin")) authenticates before checking the role
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// requireRole requires the authenticated user to have a role. It runs after
+// requireAuth.
+func (s *Server) requireRole(role string) Middleware {
+	message := strings.ToUpper(role[:1]) + role[1:] + " role required"
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			user, err := s.users.GetUserByUsername(currentUsername(r))
+			if err != nil || user.Role != role {
+				writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: message, Code: role + "_required"})
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// forWrites applies a policy to every method but GET and HEAD, letting reads
+// through unchecked
+func forWrites(policy Middleware) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		write := policy(next)
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "GET" || r.Method == "HEAD" {
+				next(w, r)
+			} else {
+				write(w, r)
+			}
+		}
+	}
+}
+
+// requireScope requires the token of the request to carry a scope. It runs
+// after requireAuth.
+func requireScope(scope string) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !hasScope(r, scope) {
+				writeMissingScope(w, r, scope)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// rateWindow counts the requests of one client in the current window
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// rateLimit allows each client the requests per window limits returns,
+// counted by user once authenticated and by address otherwise. Limits are
+// read on every request, so a reloaded configuration applies at once. Every
+// route it is declared on counts on its own.
+func rateLimit(limits func() (int, time.Duration)) Middleware {
+	var mu sync.Mutex
+	windows := make(map[string]*rateWindow)
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			key := currentUsername(r)
+			if key == "" {
+				key = "ip:" + clientIP(r)
+			}
+			limit, per := limits()
+			now := time.Now()
+
+			mu.Lock()
+			window := windows[key]
+			if window == nil || now.Sub(window.start) >= per {
+				// Forget clients whose windows ended before starting a new one
+				for k, old := range windows {
+					if now.Sub(old.start) >= per {
+						delete(windows, k)
+					}
+				}
+				window = &rateWindow{start: now}
+				windows[key] = window
+			}
+			window.count++
+			allowed := window.count <= limit
+			retryAfter := window.start.Add(per).Sub(now)
+			mu.Unlock()
+
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				writeResponse(w, r, http.StatusTooManyRequests, ErrorResponse{Error: "Too many requests, try again later", Code: "rate_limited"})
+				return
+			}
+			next(w, r)
+		}
+	}
+}
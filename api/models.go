@@ -0,0 +1,908 @@
+package api
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Film represents a movie with its details and standard database columns
+// @Description Film information
+type Film struct {
+	ID             uint            `json:"id" xml:"id" gorm:"primarykey" example:"1"`
+	Title          string          `json:"title" xml:"title" gorm:"not null" example:"The Shawshank Redemption"`
+	Director       string          `json:"director" xml:"director" gorm:"not null" example:"Frank Darabont"`
+	Year           int             `json:"year" xml:"year" gorm:"not null" example:"1994"`
+	Genre          string          `json:"genre" xml:"genre" example:"Drama"`
+	ExternalID     *string         `json:"external_id,omitempty" xml:"external_id,omitempty" gorm:"uniqueIndex:idx_films_org_external_id,priority:2" example:"imdb:tt0111161"`
+	RuntimeMinutes int             `json:"runtime_minutes,omitempty" xml:"runtime_minutes,omitempty" gorm:"not null;default:0" example:"142"`
+	Synopsis       string          `json:"synopsis,omitempty" xml:"synopsis,omitempty" gorm:"type:text;not null;default:''" example:"Two imprisoned men bond over a number of years."`
+	Language       string          `json:"language,omitempty" xml:"language,omitempty" gorm:"size:3;not null;default:''" example:"en"`    // ISO 639 code
+	Country        string          `json:"country,omitempty" xml:"country,omitempty" gorm:"size:2;not null;default:''" example:"US"`      // ISO 3166-1 alpha-2 code
+	AgeRating      string          `json:"age_rating,omitempty" xml:"age_rating,omitempty" gorm:"size:8;not null;default:''" example:"R"` // MPAA rating
+	IMDbID         string          `json:"imdb_id,omitempty" xml:"imdb_id,omitempty" gorm:"column:imdb_id;size:12;not null;default:''" example:"tt0111161"`
+	TrailerURL     string          `json:"trailer_url,omitempty" xml:"trailer_url,omitempty" gorm:"size:500;not null;default:''" example:"https://www.youtube.com/watch?v=PLl99DlL6b4"`
+	ExternalLinks  []ExternalLink  `json:"external_links,omitempty" xml:"external_link,omitempty" gorm:"type:jsonb;serializer:json"`
+	PosterKey      string          `json:"-" xml:"-" gorm:"size:255;not null;default:''"` // blob of the poster, linked as _links.poster
+	PosterSizes    string          `json:"-" xml:"-" gorm:"size:64;not null;default:''"`  // comma-separated thumbnails stored next to the poster
+	Version        int             `json:"version" xml:"version" gorm:"not null;default:1" example:"1"`
+	CreatedBy      *uint           `json:"created_by,omitempty" xml:"created_by,omitempty" gorm:"index" example:"2"`
+	OrganizationID uint            `json:"-" xml:"-" gorm:"uniqueIndex:idx_films_org_external_id,priority:1"` // catalog the film belongs to
+	CreatedAt      time.Time       `json:"created_at" xml:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at" xml:"updated_at"`
+	DeletedAt      gorm.DeletedAt  `json:"-" xml:"-" gorm:"index"`
+	Collection     *FilmCollection `json:"collection,omitempty" xml:"collection,omitempty" gorm:"-"`      // with ?include=collection
+	Views          *int64          `json:"views,omitempty" xml:"views,omitempty" gorm:"-" example:"1024"` // with ?include=views and on most viewed films
+	Links          *FilmLinks      `json:"_links,omitempty" xml:"links,omitempty" gorm:"-"`
+}
+
+// ExternalLink points to a page about a film on another site
+// @Description External link
+type ExternalLink struct {
+	Label string `json:"label" xml:"label,attr" example:"Wikipedia"`
+	URL   string `json:"url" xml:"url,attr" example:"https://en.wikipedia.org/wiki/The_Shawshank_Redemption"`
+}
+
+// FilmCollection is the collection a film belongs to and its place in it
+// @Description Film collection membership
+type FilmCollection struct {
+	ID       uint   `json:"id" xml:"id" example:"1"`
+	Name     string `json:"name" xml:"name" example:"The Dark Knight Trilogy"`
+	Position int    `json:"position" xml:"position" example:"2"`
+}
+
+// Link points to a related resource or to an action on a resource
+// @Description Hypermedia link
+type Link struct {
+	Href   string `json:"href" xml:"href,attr" example:"/api/films/1"`
+	Method string `json:"method,omitempty" xml:"method,attr,omitempty" example:"PUT"` // omitted for GET
+}
+
+// FilmLinks are the links of a film resource
+// @Description Film links
+type FilmLinks struct {
+	Self   Link  `json:"self" xml:"self"`
+	Update Link  `json:"update" xml:"update"`
+	Delete Link  `json:"delete" xml:"delete"`
+	Poster *Link `json:"poster,omitempty" xml:"poster,omitempty"` // only for films with a poster
+}
+
+// PageLinks are the links of a page of a collection
+// @Description Pagination links
+type PageLinks struct {
+	Self Link  `json:"self" xml:"self"`
+	Next *Link `json:"next,omitempty" xml:"next,omitempty"`
+	Prev *Link `json:"prev,omitempty" xml:"prev,omitempty"`
+}
+
+// User represents a user from database with standard columns
+// @Description User information
+type User struct {
+	ID             uint           `json:"id" gorm:"primarykey"`
+	Username       string         `json:"username" gorm:"uniqueIndex;not null"`
+	Password       string         `json:"-" gorm:"not null"` // Hide password in JSON responses
+	Role           string         `json:"role" gorm:"not null;default:user"`
+	Active         bool           `json:"active" gorm:"not null;default:true"` // Deactivated users can't sign in
+	Email          *string        `json:"email" gorm:"uniqueIndex"`
+	EmailVerified  bool           `json:"email_verified" gorm:"not null;default:false"`
+	DisplayName    string         `json:"display_name"`
+	AvatarURL      string         `json:"avatar_url"`
+	Digest         bool           `json:"digest" gorm:"not null;default:false"`
+	OrganizationID uint           `json:"organization_id" gorm:"index"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// UserProfile represents the public profile of a user
+// @Description User profile
+type UserProfile struct {
+	ID             uint      `json:"id" example:"1"`
+	Username       string    `json:"username" example:"admin"`
+	Role           string    `json:"role" example:"admin"`
+	Active         bool      `json:"active" example:"true"`
+	Email          string    `json:"email,omitempty" example:"admin@example.com"`
+	EmailVerified  bool      `json:"email_verified" example:"true"`
+	DisplayName    string    `json:"display_name,omitempty" example:"Site Admin"`
+	AvatarURL      string    `json:"avatar_url,omitempty" example:"https://example.com/avatars/admin.png"`
+	Digest         bool      `json:"digest" example:"false"`
+	OrganizationID uint      `json:"organization_id" example:"1"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ProfileRequest represents profile update request. Empty fields are cleared.
+// @Description Profile update payload
+type ProfileRequest struct {
+	Email       string `json:"email" example:"admin@example.com"`
+	DisplayName string `json:"display_name" example:"Site Admin"`
+	AvatarURL   string `json:"avatar_url" example:"https://example.com/avatars/admin.png"`
+	Digest      bool   `json:"digest" example:"false"`
+}
+
+// AccountData is everything stored about a user, as exported for them
+// @Description Personal data export
+type AccountData struct {
+	ExportedAt    time.Time      `json:"exported_at"`
+	Profile       UserProfile    `json:"profile"`
+	Lists         []FilmList     `json:"lists"`
+	Loans         []Loan         `json:"loans"`
+	Notifications []Notification `json:"notifications"`
+	Usage         []UsageRollup  `json:"usage"`
+	FilmsAdded    []Film         `json:"films_added"`
+	Sessions      []Session      `json:"sessions"`
+}
+
+// Organization is a team sharing the deployment, with its own users and catalog
+// @Description Organization
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	Name      string    `json:"name" gorm:"not null" example:"Default"`
+	Slug      string    `json:"slug" gorm:"uniqueIndex;not null" example:"default"`
+	Plan      string    `json:"plan,omitempty" gorm:"not null;default:''" example:"pro"` // empty for the deployment's PLAN
+	MaxFilms  *int64    `json:"max_films,omitempty" example:"500"`                       // overrides the plan's limit
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrganizationRequest represents organization create or update request.
+// The slug is set on create and never changes.
+// @Description Organization payload
+type OrganizationRequest struct {
+	Name     string `json:"name" example:"Film Club"`
+	Slug     string `json:"slug,omitempty" example:"film-club"`
+	Plan     string `json:"plan,omitempty" example:"pro"`
+	MaxFilms *int64 `json:"max_films,omitempty" example:"500"`
+}
+
+// EmailVerifyRequest confirms an email address with the code mailed to it
+// @Description Email verification payload
+type EmailVerifyRequest struct {
+	Token string `json:"token" example:"3f5c0d1e9a7b4c2d"`
+}
+
+// PasswordResetRequest asks for a password reset code
+// @Description Password reset request payload
+type PasswordResetRequest struct {
+	Email string `json:"email" example:"user1@example.com"`
+}
+
+// PasswordResetConfirmRequest sets a new password with a reset code
+// @Description Password reset confirmation payload
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token" example:"3f5c0d1e9a7b4c2d"`
+	Password string `json:"password" example:"correct horse battery staple"`
+}
+
+// LoginRequest represents login request payload
+// @Description Login request payload
+type LoginRequest struct {
+	Username string `json:"username" example:"admin"`
+	Password string `json:"password" example:"admin123"`
+	// Scopes limits the token, every scope the user may hold when empty
+	Scopes []string `json:"scopes,omitempty" example:"films:read"`
+}
+
+// LoginResponse represents login response
+// @Description Login response with token
+type LoginResponse struct {
+	Token  string   `json:"token" example:"abc123def456"`
+	Scopes []string `json:"scopes" example:"films:read"`
+}
+
+// IntrospectionRequest names the token to introspect
+// @Description Token introspection request
+type IntrospectionRequest struct {
+	Token string `json:"token" example:"abc123def456"`
+}
+
+// IntrospectionResponse describes a token, in the style of RFC 7662. Only
+// active is set for unknown and expired tokens.
+// @Description Token introspection response
+type IntrospectionResponse struct {
+	Active       bool   `json:"active" example:"true"`
+	Username     string `json:"username,omitempty" example:"admin"`
+	Scope        string `json:"scope,omitempty" example:"films:read films:write"`
+	Organization string `json:"organization,omitempty" example:"default"`
+	TokenType    string `json:"token_type,omitempty" example:"Bearer"`
+	Exp          int64  `json:"exp,omitempty" example:"1736931600"`
+}
+
+// Session is an active login token of the current user, as seen by them
+// @Description Signed-in device
+type Session struct {
+	ID         string    `json:"id" example:"3f2a9c1d8e7b6a50"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	IP         string    `json:"ip" example:"203.0.113.7"`
+	UserAgent  string    `json:"user_agent" example:"Mozilla/5.0"`
+	// Current marks the session of the token sending the request
+	Current bool `json:"current" example:"true"`
+}
+
+// FilmRequest represents film creation/update request
+// @Description Film request payload
+type FilmRequest struct {
+	Title    string `json:"title" example:"The Shawshank Redemption"`
+	Director string `json:"director" example:"Frank Darabont"`
+	Year     int    `json:"year" example:"1994"`
+	Genre    string `json:"genre" example:"Drama"`
+	// ExternalID matches imported films to existing ones; it is never cleared by an update
+	ExternalID string `json:"external_id,omitempty" example:"imdb:tt0111161"`
+	// The metadata fields keep their stored value when omitted from an update; an empty value clears them
+	RuntimeMinutes *int            `json:"runtime_minutes,omitempty" example:"142"`
+	Synopsis       *string         `json:"synopsis,omitempty" example:"Two imprisoned men bond over a number of years."`
+	Language       *string         `json:"language,omitempty" example:"en"`
+	Country        *string         `json:"country,omitempty" example:"US"`
+	AgeRating      *string         `json:"age_rating,omitempty" example:"R"`
+	IMDbID         *string         `json:"imdb_id,omitempty" example:"tt0111161"`
+	TrailerURL     *string         `json:"trailer_url,omitempty" example:"https://www.youtube.com/watch?v=PLl99DlL6b4"`
+	ExternalLinks  *[]ExternalLink `json:"external_links,omitempty"`
+	// Version is the version the client last saw; updates fail with 409 when it is stale
+	Version *int `json:"version,omitempty" example:"1"`
+}
+
+// BatchItemResult reports the outcome of one item in a batch request
+// @Description Result of a single batch item
+type BatchItemResult struct {
+	Index  int          `json:"index" example:"0"`
+	ID     uint         `json:"id,omitempty" example:"6"`
+	Action string       `json:"action,omitempty" example:"created"`
+	Error  string       `json:"error,omitempty" example:"Validation failed"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// BatchCreateResponse represents the result of a bulk film creation
+// @Description Bulk creation result
+type BatchCreateResponse struct {
+	Strategy string            `json:"strategy" example:"skip"`
+	Created  int               `json:"created" example:"2"`
+	Updated  int               `json:"updated" example:"0"`
+	Skipped  int               `json:"skipped" example:"0"`
+	Failed   int               `json:"failed" example:"1"`
+	Results  []BatchItemResult `json:"results"`
+}
+
+// FilmPage represents a paginated list of films
+// @Description Paginated film list
+type FilmPage struct {
+	Data       []Film    `json:"data" xml:"data>film"`
+	Page       int       `json:"page,omitempty" xml:"page,omitempty" example:"1"`
+	PageSize   int       `json:"page_size" xml:"page_size" example:"20"`
+	Total      int64     `json:"total,omitempty" xml:"total,omitempty" example:"5"`
+	NextCursor string    `json:"next_cursor,omitempty" xml:"next_cursor,omitempty" example:"eyJvIjoiaWQiLCJpZCI6MjB9"`
+	Links      PageLinks `json:"_links" xml:"links"`
+}
+
+// UserPage represents a page of the user directory
+// @Description Paginated user list
+type UserPage struct {
+	Data     []UserProfile `json:"data" xml:"data>user"`
+	Page     int           `json:"page" xml:"page" example:"1"`
+	PageSize int           `json:"page_size" xml:"page_size" example:"20"`
+	Total    int64         `json:"total" xml:"total" example:"5"`
+	Links    PageLinks     `json:"_links" xml:"links"`
+}
+
+// FilmFilter selects films by their attributes
+// @Description Film filter
+type FilmFilter struct {
+	Genre    string `json:"genre,omitempty" example:"Drama"`
+	Director string `json:"director,omitempty" example:"Frank Darabont"`
+	Year     int    `json:"year,omitempty" example:"1994"`
+}
+
+// FilmRevision is a film as it was before an update replaced it. Film holds
+// every field an update can change, so reverting is an update with it.
+// @Description Earlier version of a film
+type FilmRevision struct {
+	ID         uint        `json:"-" xml:"-" gorm:"primarykey"`
+	FilmID     uint        `json:"film_id" xml:"film_id" gorm:"not null;uniqueIndex:idx_film_revisions_film_version,priority:1" example:"2"`
+	Version    int         `json:"version" xml:"version" gorm:"not null;uniqueIndex:idx_film_revisions_film_version,priority:2" example:"3"`
+	Film       FilmRequest `json:"film" xml:"film" gorm:"type:jsonb;serializer:json"`
+	ReplacedBy *uint       `json:"replaced_by,omitempty" xml:"replaced_by,omitempty" example:"2"` // user whose update replaced it
+	ReplacedAt time.Time   `json:"replaced_at" xml:"replaced_at"`
+}
+
+// FilmLookupRequest names the films to fetch in one request
+// @Description Film lookup by ID list
+type FilmLookupRequest struct {
+	IDs []uint `json:"ids" example:"1,5,9"`
+}
+
+// FilmLookupResponse lists the films found in the order they were asked for,
+// and the IDs that don't match a film
+// @Description Films fetched by ID list
+type FilmLookupResponse struct {
+	Data    []Film `json:"data" xml:"data>film"`
+	Missing []uint `json:"missing" xml:"missing>id" example:"9"`
+}
+
+// BatchDeleteRequest represents a bulk delete by ID list or filter
+// @Description Bulk delete request payload
+type BatchDeleteRequest struct {
+	IDs    []uint      `json:"ids,omitempty"`
+	Filter *FilmFilter `json:"filter,omitempty"`
+}
+
+// BatchDeleteResponse represents the result of a bulk delete
+// @Description Bulk delete result
+type BatchDeleteResponse struct {
+	Deleted int64 `json:"deleted" example:"3"`
+}
+
+// ErrorResponse represents error response
+// @Description Error response
+type ErrorResponse struct {
+	Error  string `json:"error" xml:"error" example:"Invalid request"`
+	Code   string `json:"code,omitempty" xml:"code,omitempty" example:"invalid_json"`
+	Params Params `json:"-" xml:"-" swaggerignore:"true"`
+}
+
+// ValidationErrorResponse represents a validation failure with field-level details
+// @Description Validation error response
+type ValidationErrorResponse struct {
+	Error  string       `json:"error" xml:"error" example:"Validation failed"`
+	Code   string       `json:"code,omitempty" xml:"code,omitempty" example:"validation_failed"`
+	Fields []FieldError `json:"fields" xml:"fields>error"`
+}
+
+// ConflictResponse represents a conflict with an existing film
+// @Description Conflict response pointing to the existing record
+type ConflictResponse struct {
+	Error      string `json:"error" example:"Film already exists"`
+	Code       string `json:"code,omitempty" example:"film_exists"`
+	ExistingID uint   `json:"existing_id" example:"1"`
+	Location   string `json:"location" example:"/api/films/1"`
+}
+
+// VersionConflictResponse represents an update based on a stale film version
+// @Description Version conflict response with the current film
+type VersionConflictResponse struct {
+	Error   string `json:"error" example:"Film was modified by another request"`
+	Code    string `json:"code,omitempty" example:"film_version_conflict"`
+	Current Film   `json:"current"`
+}
+
+// SuccessResponse represents success response
+// @Description Success response
+type SuccessResponse struct {
+	Message string `json:"message" example:"Operation completed successfully"`
+}
+
+// MeteringEvent records a single billable operation
+// @Description Billable operation record
+type MeteringEvent struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	Tenant    string    `json:"tenant" gorm:"not null;index:idx_metering_events_tenant_created"`
+	Username  string    `json:"username" gorm:"not null"`
+	Operation string    `json:"operation" gorm:"not null"`
+	Quantity  int64     `json:"quantity" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"index:idx_metering_events_tenant_created"`
+}
+
+// UsageRollup holds the daily total of an operation per tenant and user
+// @Description Daily usage totals
+type UsageRollup struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	Tenant    string    `json:"tenant" gorm:"not null;uniqueIndex:idx_usage_rollups_key"`
+	Username  string    `json:"username" gorm:"not null;uniqueIndex:idx_usage_rollups_key"`
+	Operation string    `json:"operation" gorm:"not null;uniqueIndex:idx_usage_rollups_key"`
+	Day       time.Time `json:"day" gorm:"type:date;not null;uniqueIndex:idx_usage_rollups_key"`
+	Quantity  int64     `json:"quantity" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// APIUsage holds the number of requests a user made to one endpoint in one hour
+type APIUsage struct {
+	Username string    `gorm:"primaryKey"`
+	Endpoint string    `gorm:"primaryKey"`
+	Hour     time.Time `gorm:"primaryKey"`
+	Requests int64     `gorm:"not null"`
+}
+
+// EndpointUsage is the number of requests made to one endpoint
+// @Description Requests to an endpoint
+type EndpointUsage struct {
+	Endpoint string `json:"endpoint" example:"GET /api/films/{id}"`
+	Requests int64  `json:"requests" example:"120"`
+}
+
+// HourlyUsage is the number of requests made in one hour
+// @Description Requests in an hour
+type HourlyUsage struct {
+	Hour     time.Time `json:"hour" example:"2025-01-15T09:00:00Z"`
+	Requests int64     `json:"requests" example:"42"`
+}
+
+// UsageReport sums the API requests of a user since a time
+// @Description API usage of a user
+type UsageReport struct {
+	Since     time.Time       `json:"since" example:"2025-01-14T10:00:00Z"`
+	Requests  int64           `json:"requests" example:"512"`
+	Endpoints []EndpointUsage `json:"endpoints"`
+	Hours     []HourlyUsage   `json:"hours"`
+}
+
+// UserUsage sums the API requests of one user, for the admin roll-up
+// @Description API usage of a user in the admin roll-up
+type UserUsage struct {
+	Username  string          `json:"username" example:"user1"`
+	Requests  int64           `json:"requests" example:"512"`
+	Endpoints []EndpointUsage `json:"endpoints" gorm:"-"`
+}
+
+// FilmView holds the number of views of a film on one day
+type FilmView struct {
+	FilmID uint      `gorm:"primaryKey;autoIncrement:false"`
+	Day    time.Time `gorm:"type:date;primaryKey"`
+	Views  int64     `gorm:"not null"`
+}
+
+// FilmRule is an admin-defined rule evaluated on film create and update.
+// Validate rules must evaluate to true, enrich rules return a map of fields to set.
+// @Description Scripted film rule
+type FilmRule struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	Name       string    `json:"name" gorm:"not null" example:"No far-future releases"`
+	Kind       string    `json:"kind" gorm:"not null;default:validate" example:"validate"`
+	Expression string    `json:"expression" gorm:"not null" example:"year <= now.year + 1 || role == \"admin\""`
+	Message    string    `json:"message" example:"Year must not be more than one year ahead"`
+	Enabled    bool      `json:"enabled" gorm:"not null;default:true"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// FilmRuleRequest represents rule creation/update request
+// @Description Film rule request payload
+type FilmRuleRequest struct {
+	Name       string `json:"name" example:"No far-future releases"`
+	Kind       string `json:"kind" example:"validate"`
+	Expression string `json:"expression" example:"year <= now.year + 1 || role == \"admin\""`
+	Message    string `json:"message" example:"Year must not be more than one year ahead"`
+	Enabled    *bool  `json:"enabled,omitempty" example:"true"`
+}
+
+// RuleTestRequest represents a dry run of a rule against a sample film
+// @Description Rule dry-run request payload
+type RuleTestRequest struct {
+	Kind       string      `json:"kind" example:"validate"`
+	Expression string      `json:"expression" example:"year <= now.year + 1 || role == \"admin\""`
+	Film       FilmRequest `json:"film"`
+	Action     string      `json:"action" example:"create"`
+	Role       string      `json:"role" example:"user"`
+}
+
+// RuleTestResponse represents the outcome of a rule dry run
+// @Description Rule dry-run result
+type RuleTestResponse struct {
+	Passed bool         `json:"passed" example:"true"`
+	Result interface{}  `json:"result"`
+	Film   *FilmRequest `json:"film,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// Collection groups films into an ordered series, such as a franchise
+// @Description Film collection
+type Collection struct {
+	ID             uint      `json:"id" xml:"id" gorm:"primarykey"`
+	Name           string    `json:"name" xml:"name" gorm:"not null" example:"The Dark Knight Trilogy"` // unique per organization, ignoring case
+	Description    string    `json:"description" xml:"description" example:"Christopher Nolan's Batman films"`
+	Films          []Film    `json:"films" xml:"films>film" gorm:"-"` // in collection order
+	OrganizationID uint      `json:"-" xml:"-" gorm:"index"`          // organization the collection belongs to
+	CreatedAt      time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" xml:"updated_at"`
+}
+
+// CollectionFilm places a film in a collection. A film belongs to at most one collection.
+type CollectionFilm struct {
+	CollectionID uint `gorm:"primaryKey"`
+	FilmID       uint `gorm:"primaryKey;uniqueIndex"`
+	Position     int  `gorm:"not null"`
+}
+
+// CollectionRequest represents collection creation/update request
+// @Description Collection request payload
+type CollectionRequest struct {
+	Name        string `json:"name" example:"The Dark Knight Trilogy"`
+	Description string `json:"description" example:"Christopher Nolan's Batman films"`
+	FilmIDs     []uint `json:"film_ids" example:"7,8,9"` // in collection order; replaces the films on update
+}
+
+// FilmList is a user's named, ordered list of films. Public lists have a
+// share URL anyone can read them at.
+// @Description Film list
+type FilmList struct {
+	ID          uint      `json:"id" xml:"id" gorm:"primarykey"`
+	Owner       string    `json:"owner" xml:"owner" gorm:"not null;index" example:"user1"`
+	Name        string    `json:"name" xml:"name" gorm:"not null" example:"Oscar night 2025"`
+	Description string    `json:"description" xml:"description" example:"Best picture nominees"`
+	Public      bool      `json:"public" xml:"public" gorm:"not null;default:false"`
+	ShareToken  string    `json:"-" xml:"-" gorm:"uniqueIndex;not null"`
+	ShareURL    string    `json:"share_url,omitempty" xml:"share_url,omitempty" gorm:"-" example:"/api/shared/lists/9f86d081884c7d65"`
+	Films       []Film    `json:"films" xml:"films>film" gorm:"-"`
+	CreatedAt   time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" xml:"updated_at"`
+}
+
+// FilmListItem places a film on a list
+type FilmListItem struct {
+	ListID   uint `gorm:"primaryKey"`
+	FilmID   uint `gorm:"primaryKey"`
+	Position int  `gorm:"not null"`
+}
+
+// FilmListRequest represents list creation/update request
+// @Description Film list request payload
+type FilmListRequest struct {
+	Name        string `json:"name" example:"Oscar night 2025"`
+	Description string `json:"description" example:"Best picture nominees"`
+	Public      bool   `json:"public" example:"false"`
+}
+
+// FilmListItemRequest adds a film to a list
+// @Description List item request payload
+type FilmListItemRequest struct {
+	FilmID   uint `json:"film_id" example:"1"`
+	Position *int `json:"position,omitempty" example:"1"` // 1 for the top; the end of the list when omitted
+}
+
+// FilmListOrderRequest reorders the films of a list
+// @Description List order request payload
+type FilmListOrderRequest struct {
+	FilmIDs []uint `json:"film_ids" example:"3,1,2"` // every film on the list, in the new order
+}
+
+// Copy is a physical copy of a film that users can borrow
+// @Description Physical copy
+type Copy struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	FilmID    uint       `json:"film_id" gorm:"not null;index" example:"1"`
+	Label     string     `json:"label" gorm:"not null" example:"DVD #2"`
+	Available bool       `json:"available" gorm:"-"`
+	DueAt     *time.Time `json:"due_at,omitempty" gorm:"-"` // while borrowed
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// CopyRequest represents copy creation request
+// @Description Copy request payload
+type CopyRequest struct {
+	Label string `json:"label" example:"DVD #2"`
+}
+
+// Loan records a user borrowing a copy. A loan is open until the copy is returned.
+// @Description Loan
+type Loan struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	CopyID     uint       `json:"copy_id" gorm:"not null;index" example:"3"`
+	FilmID     uint       `json:"film_id" gorm:"not null" example:"1"`
+	Borrower   string     `json:"borrower" gorm:"not null;index" example:"user1"`
+	BorrowedAt time.Time  `json:"borrowed_at"`
+	DueAt      time.Time  `json:"due_at" gorm:"not null;index"`
+	ReturnedAt *time.Time `json:"returned_at,omitempty"`
+	Overdue    bool       `json:"overdue" gorm:"-"`
+	Film       *Film      `json:"film,omitempty" gorm:"-"`
+}
+
+// BorrowerLoans lists the open loans of one user, for the admin view
+// @Description Open loans of a user
+type BorrowerLoans struct {
+	Borrower string `json:"borrower" example:"user1"`
+	Overdue  int    `json:"overdue" example:"1"`
+	Loans    []Loan `json:"loans"`
+}
+
+// Screening is a showing of a film at a venue. Screenings at the same venue
+// can't overlap.
+// @Description Screening
+type Screening struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	FilmID    uint      `json:"film_id" gorm:"not null;index" example:"1"`
+	Venue     string    `json:"venue" gorm:"not null;index" example:"Hall 1"`
+	StartsAt  time.Time `json:"starts_at" gorm:"not null;index" example:"2025-06-01T19:30:00Z"`
+	EndsAt    time.Time `json:"ends_at" gorm:"not null" example:"2025-06-01T22:00:00Z"`
+	Capacity  int       `json:"capacity" gorm:"not null" example:"120"`
+	Film      *Film     `json:"film,omitempty" gorm:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ScreeningRequest represents screening creation/update request
+// @Description Screening request payload
+type ScreeningRequest struct {
+	FilmID   uint      `json:"film_id" example:"1"`
+	Venue    string    `json:"venue" example:"Hall 1"`
+	StartsAt time.Time `json:"starts_at" example:"2025-06-01T19:30:00Z"`
+	EndsAt   time.Time `json:"ends_at" example:"2025-06-01T22:00:00Z"`
+	Capacity int       `json:"capacity" example:"120"`
+}
+
+// Notification tells a user about something that happened to a film they follow
+// @Description In-app notification
+type Notification struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	Username  string     `json:"-" gorm:"not null;index"`
+	Type      string     `json:"type" gorm:"not null" example:"list_film_updated"`
+	Message   string     `json:"message" gorm:"not null" example:"The Godfather, on your list Oscar night 2025, was updated"`
+	FilmID    *uint      `json:"film_id,omitempty" example:"2"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// NotificationList is a page of notifications and how many are unread in all
+// @Description Notifications of the current user
+type NotificationList struct {
+	Unread        int64          `json:"unread" example:"3"`
+	Notifications []Notification `json:"notifications"`
+}
+
+// OutboxEmail is an email waiting to be sent. Failed sends are retried with
+// a growing delay until they succeed or run out of attempts.
+type OutboxEmail struct {
+	ID            uint   `gorm:"primarykey"`
+	To            string `gorm:"not null"`
+	Subject       string `gorm:"not null"`
+	Body          string `gorm:"not null"`
+	Attempts      int    `gorm:"not null;default:0"`
+	LastError     string
+	NextAttemptAt time.Time  `gorm:"not null;index"`
+	SentAt        *time.Time `gorm:"index"`
+	CreatedAt     time.Time
+}
+
+// MailToken is a single-use code mailed to a user. Only its hash is stored.
+type MailToken struct {
+	Hash      string    `gorm:"primaryKey"`
+	Username  string    `gorm:"not null;index"`
+	Purpose   string    `gorm:"not null"`
+	Email     string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+// WebhookFilters restricts deliveries to films matching any of the listed values
+// @Description Webhook delivery filters
+type WebhookFilters struct {
+	Genres    []string `json:"genres,omitempty" example:"Documentary"`
+	Directors []string `json:"directors,omitempty" example:"Christopher Nolan"`
+}
+
+// Webhook is a subscription delivering film events to an external URL
+// @Description Webhook subscription
+type Webhook struct {
+	ID        uint           `json:"id" gorm:"primarykey"`
+	URL       string         `json:"url" gorm:"not null" example:"https://example.com/hooks/films"`
+	Secret    string         `json:"-"`
+	Events    []string       `json:"events" gorm:"serializer:json" example:"film.created"`
+	Filters   WebhookFilters `json:"filters" gorm:"serializer:json"`
+	Active    bool           `json:"active" gorm:"not null;default:true"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// WebhookRequest represents webhook creation/update request
+// @Description Webhook request payload
+type WebhookRequest struct {
+	URL     string         `json:"url" example:"https://example.com/hooks/films"`
+	Secret  string         `json:"secret" example:"s3cret"`
+	Events  []string       `json:"events" example:"film.created"`
+	Filters WebhookFilters `json:"filters"`
+	Active  *bool          `json:"active,omitempty" example:"true"`
+}
+
+// WebhookEvent is the payload delivered to webhook subscribers
+// @Description Webhook event payload
+type WebhookEvent struct {
+	Event     string    `json:"event" example:"film.created"`
+	Film      Film      `json:"film"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ExportSnapshot records a generated export so differential exports know where the last one stopped
+// @Description Export snapshot
+type ExportSnapshot struct {
+	ID        uint       `json:"id" gorm:"primarykey"`
+	Mode      string     `json:"mode" gorm:"not null" example:"diff"`
+	Since     *time.Time `json:"since,omitempty"`
+	Until     time.Time  `json:"until" gorm:"not null;index"`
+	Rows      int64      `json:"rows" example:"42"`
+	Files     []string   `json:"files" gorm:"serializer:json" example:"films.ndjson"`
+	CreatedBy string     `json:"created_by" example:"admin"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ExportRequest represents export generation request
+// @Description Export request payload
+type ExportRequest struct {
+	Mode  string     `json:"mode" example:"diff"`
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// ExportRecord is one line of an exported films file. Deleted films are exported as tombstones.
+// @Description Exported film record
+type ExportRecord struct {
+	Film
+	Deleted   bool       `json:"deleted"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ExportManifestFile describes one data file of an export
+// @Description Export file entry
+type ExportManifestFile struct {
+	Name   string `json:"name" example:"films.ndjson"`
+	Rows   int64  `json:"rows" example:"42"`
+	Bytes  int64  `json:"bytes" example:"8192"`
+	SHA256 string `json:"sha256" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+}
+
+// ExportManifest is written next to the data files of every export so consumers
+// can verify them before loading
+// @Description Export manifest
+type ExportManifest struct {
+	SchemaVersion int                  `json:"schema_version" example:"1"`
+	ExportID      uint                 `json:"export_id" example:"3"`
+	Mode          string               `json:"mode" example:"diff"`
+	Since         *time.Time           `json:"since,omitempty"`
+	Until         time.Time            `json:"until"`
+	CreatedBy     string               `json:"created_by" example:"admin"`
+	GeneratedAt   time.Time            `json:"generated_at"`
+	Files         []ExportManifestFile `json:"files"`
+}
+
+// ScheduledJob is a background job with its cron schedule and last outcome
+// @Description Scheduled job
+type ScheduledJob struct {
+	ID             uint       `json:"-" gorm:"primarykey"`
+	Name           string     `json:"name" gorm:"uniqueIndex;not null" example:"usage-rollup"`
+	Description    string     `json:"description" example:"Refresh daily usage totals"`
+	Cron           string     `json:"cron" gorm:"not null" example:"0 * * * *"`
+	TimeoutSeconds int        `json:"timeout_seconds" gorm:"not null;default:0" example:"300"`
+	Priority       string     `json:"priority" gorm:"not null;default:normal" example:"low"`
+	Paused         bool       `json:"paused" example:"false"`
+	Running        bool       `json:"running" gorm:"-" example:"false"` // queued or running
+	NextRunAt      *time.Time `json:"next_run_at"`
+	LastRunAt      *time.Time `json:"last_run_at"`
+	LastDurationMs int64      `json:"last_duration_ms" example:"120"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// FeatureFlag turns a feature on or off at runtime. Only flags an admin
+// toggled are stored; the others have their default.
+// @Description Feature flag
+type FeatureFlag struct {
+	ID          uint       `json:"-" gorm:"primarykey"`
+	Name        string     `json:"name" gorm:"uniqueIndex;not null" example:"enable_lending"`
+	Description string     `json:"description" gorm:"-" example:"Lend film copies and show who has them"`
+	Enabled     bool       `json:"enabled" gorm:"not null" example:"false"`
+	Default     bool       `json:"default" gorm:"-" example:"true"`
+	UpdatedBy   string     `json:"updated_by,omitempty" example:"admin"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// FeatureFlagRequest turns a feature flag on or off
+// @Description Feature flag update payload
+type FeatureFlagRequest struct {
+	Enabled *bool `json:"enabled" example:"false"`
+}
+
+// UserLimits reports how much of their limits a user used
+// @Description Usage of the limits of the authenticated user
+type UserLimits struct {
+	FilmsPerDay UsageLimit `json:"films_per_day"`
+}
+
+// UsageLimit is the usage of one limit. A limit of 0 means unlimited.
+// @Description Usage of a limit
+type UsageLimit struct {
+	Limit     int64     `json:"limit" example:"20"`
+	Used      int64     `json:"used" example:"3"`
+	Remaining *int64    `json:"remaining,omitempty" example:"17"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+// MaintenanceMode tells whether the server rejects mutations for maintenance,
+// with what message, and when clients should retry
+// @Description Maintenance mode state
+type MaintenanceMode struct {
+	Enabled           bool   `json:"enabled" example:"true"`
+	Message           string `json:"message,omitempty" example:"Upgrading the database, back at 14:00 UTC"`
+	RetryAfterSeconds int    `json:"retry_after_seconds,omitempty" example:"600"`
+}
+
+// ReadOnlyMode tells whether the server rejects mutations
+// @Description Read-only mode state
+type ReadOnlyMode struct {
+	ReadOnly bool `json:"read_only" example:"false"`
+}
+
+// MetricsSnapshot holds key metrics for one period, usually an hour
+// @Description Historical metrics snapshot
+type MetricsSnapshot struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	PeriodStart  time.Time `json:"period_start"`
+	PeriodEnd    time.Time `json:"period_end" gorm:"index;not null"`
+	Requests     int64     `json:"requests" example:"1250"`
+	ClientErrors int64     `json:"client_errors" example:"12"`
+	ServerErrors int64     `json:"server_errors" example:"1"`
+	ErrorRate    float64   `json:"error_rate" example:"0.0008"` // server errors per request
+	ActiveUsers  int64     `json:"active_users" example:"8"`
+	ActiveTokens int64     `json:"active_tokens" example:"10"`
+	Films        int64     `json:"films" example:"420"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ScheduledJobRequest represents a job schedule change. Omitted fields are kept.
+// @Description Scheduled job update payload
+type ScheduledJobRequest struct {
+	Cron           *string `json:"cron,omitempty" example:"*/30 * * * *"`
+	TimeoutSeconds *int    `json:"timeout_seconds,omitempty" example:"300"`
+	Priority       *string `json:"priority,omitempty" example:"high"`
+	Paused         *bool   `json:"paused,omitempty" example:"true"`
+}
+
+// UserStats counts users by role
+// @Description User counts
+type UserStats struct {
+	Total  int64            `json:"total" example:"3"`
+	ByRole map[string]int64 `json:"by_role"`
+}
+
+// FilmStats counts films in the catalog
+// @Description Film counts
+type FilmStats struct {
+	Total   int64 `json:"total" example:"5"`
+	Deleted int64 `json:"deleted" example:"1"`
+}
+
+// DailyCount is a count for one UTC day
+// @Description Count per day
+type DailyCount struct {
+	Day   string `json:"day" example:"2025-01-15"`
+	Count int64  `json:"count" example:"4"`
+}
+
+// Contributor is a user ranked by the number of writes
+// @Description Top contributor
+type Contributor struct {
+	Username string `json:"username" example:"admin"`
+	Writes   int64  `json:"writes" example:"12"`
+}
+
+// AdminStats represents the admin dashboard statistics
+// @Description Admin dashboard statistics
+type AdminStats struct {
+	Users           UserStats     `json:"users"`
+	ActiveTokens    int           `json:"active_tokens" example:"2"`
+	Films           FilmStats     `json:"films"`
+	FilmsPerDay     []DailyCount  `json:"films_per_day"`
+	TopContributors []Contributor `json:"top_contributors"`
+	GeneratedAt     time.Time     `json:"generated_at"`
+}
+
+// QueueMetrics describes the background job worker pool and its queue
+// @Description Job queue metrics
+type QueueMetrics struct {
+	Workers    int                    `json:"workers" example:"2"`
+	Busy       int                    `json:"busy" example:"1"`
+	MinWorkers int                    `json:"min_workers" example:"1"`
+	MaxWorkers int                    `json:"max_workers" example:"4"`
+	Depth      int                    `json:"depth" example:"0"`
+	Capacity   int                    `json:"capacity" example:"300"`
+	Submitted  int64                  `json:"submitted" example:"42"`
+	Rejected   int64                  `json:"rejected" example:"0"`
+	Completed  int64                  `json:"completed" example:"41"`
+	Queues     []PriorityQueueMetrics `json:"queues"`
+}
+
+// PriorityQueueMetrics describes the queue of one job priority
+// @Description Per-priority job queue metrics
+type PriorityQueueMetrics struct {
+	Priority  string `json:"priority" example:"high"`
+	Depth     int    `json:"depth" example:"0"`
+	Capacity  int    `json:"capacity" example:"100"`
+	Submitted int64  `json:"submitted" example:"30"`
+	Rejected  int64  `json:"rejected" example:"0"`
+}
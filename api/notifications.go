@@ -0,0 +1,178 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxNotifications is how many of the newest notifications a listing returns
+const maxNotifications = 100
+
+// Notification types
+const (
+	NotificationListFilmUpdated = "list_film_updated"
+	NotificationListFilmDeleted = "list_film_deleted"
+)
+
+// NotificationService stores in-app notifications and creates them from events
+type NotificationService struct {
+	db *gorm.DB
+}
+
+// NewNotificationService creates a new notification service
+func NewNotificationService(db *gorm.DB) *NotificationService {
+	return &NotificationService{db: db}
+}
+
+// Subscribe creates notifications for the events users are told about
+func (ns *NotificationService) Subscribe(bus *EventBus) {
+	bus.Subscribe(EventFilmUpdated, func(event Event) {
+		ns.notifyListOwners(event.Film, NotificationListFilmUpdated, "was updated")
+	})
+	bus.Subscribe(EventFilmDeleted, func(event Event) {
+		ns.notifyListOwners(event.Film, NotificationListFilmDeleted, "was removed from the catalog")
+	})
+}
+
+// notifyListOwners tells everyone who has a film on one of their lists what
+// happened to it, once per user however many of their lists have it
+func (ns *NotificationService) notifyListOwners(film *Film, notificationType, what string) {
+	var owners []struct {
+		Owner string
+		Name  string
+	}
+	err := ns.db.Table("film_lists").
+		Select("film_lists.owner, min(film_lists.name) AS name").
+		Joins("JOIN film_list_items ON film_list_items.list_id = film_lists.id").
+		Where("film_list_items.film_id = ?", film.ID).
+		Group("film_lists.owner").
+		Scan(&owners).Error
+	if err != nil {
+		log.Printf("Warning: Failed to find lists with film %d: %v", film.ID, err)
+		return
+	}
+	if len(owners) == 0 {
+		return
+	}
+
+	filmID := film.ID
+	notifications := make([]Notification, len(owners))
+	for i, owner := range owners {
+		notifications[i] = Notification{
+			Username: owner.Owner,
+			Type:     notificationType,
+			Message:  fmt.Sprintf("%s, on your list %s, %s", film.Title, owner.Name, what),
+			FilmID:   &filmID,
+		}
+	}
+	if err := ns.db.Create(&notifications).Error; err != nil {
+		log.Printf("Warning: Failed to store notifications for film %d: %v", film.ID, err)
+	}
+}
+
+// GetNotifications retrieves the newest notifications of a user and how many
+// are unread. unreadOnly leaves out those already read.
+func (ns *NotificationService) GetNotifications(username string, unreadOnly bool) (*NotificationList, error) {
+	list := NotificationList{Notifications: []Notification{}}
+	if err := ns.db.Model(&Notification{}).Where("username = ? AND read_at IS NULL", username).Count(&list.Unread).Error; err != nil {
+		return nil, err
+	}
+
+	query := ns.db.Where("username = ?", username)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+	if err := query.Order("created_at DESC, id DESC").Limit(maxNotifications).Find(&list.Notifications).Error; err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// MarkRead marks a notification of a user as read. Marking one twice keeps
+// the first time it was read.
+func (ns *NotificationService) MarkRead(username string, id uint) (*Notification, error) {
+	var notification Notification
+	if err := ns.db.Where("id = ? AND username = ?", id, username).First(&notification).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("notification not found")
+		}
+		return nil, err
+	}
+	if notification.ReadAt != nil {
+		return &notification, nil
+	}
+
+	now := time.Now().UTC()
+	if err := ns.db.Model(&notification).Update("read_at", now).Error; err != nil {
+		return nil, err
+	}
+	notification.ReadAt = &now
+	return &notification, nil
+}
+
+// MarkAllRead marks every unread notification of a user as read
+func (ns *NotificationService) MarkAllRead(username string) error {
+	return ns.db.Model(&Notification{}).
+		Where("username = ? AND read_at IS NULL", username).
+		Update("read_at", time.Now().UTC()).Error
+}
+
+// notificationsHandler routes /api/me/notifications,
+// /api/me/notifications/read, and /api/me/notifications/{id}/read
+func (s *Server) notificationsHandler(w http.ResponseWriter, r *http.Request) {
+	username := currentUsername(r)
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/me/notifications"), "/")
+
+	switch {
+	case path == "":
+		if r.Method != "GET" {
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+			return
+		}
+		list, err := s.notificationService.GetNotifications(username, r.URL.Query().Get("unread") == "true")
+		if err != nil {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve notifications", Code: "notifications_retrieve_failed"})
+			return
+		}
+		writeResponse(w, r, http.StatusOK, list)
+	case path == "/read":
+		if r.Method != "POST" {
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+			return
+		}
+		if err := s.notificationService.MarkAllRead(username); err != nil {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to mark notifications as read", Code: "notifications_mark_read_failed"})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasSuffix(path, "/read"):
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/read"))
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid notification ID", Code: "invalid_notification_id"})
+			return
+		}
+		if r.Method != "POST" {
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+			return
+		}
+		notification, err := s.notificationService.MarkRead(username, uint(id))
+		if err != nil {
+			if err.Error() == "notification not found" {
+				writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Notification not found", Code: "notification_not_found"})
+			} else {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to mark notification as read", Code: "notification_mark_read_failed"})
+			}
+			return
+		}
+		writeResponse(w, r, http.StatusOK, notification)
+	default:
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Not found", Code: "not_found"})
+	}
+}
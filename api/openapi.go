@@ -0,0 +1,465 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIRoute is a path of the spec split into segments; "{name}" segments are parameters
+type openAPIRoute struct {
+	segments []string
+	item     map[string]interface{}
+}
+
+// literals counts the fixed segments of a route, so /films/batch beats /films/{id}
+func (route openAPIRoute) literals() int {
+	count := 0
+	for _, segment := range route.segments {
+		if !strings.HasPrefix(segment, "{") {
+			count++
+		}
+	}
+	return count
+}
+
+// OpenAPISpec is the parsed swagger.yaml, served as JSON and used to validate requests
+type OpenAPISpec struct {
+	doc      map[string]interface{}
+	json     []byte
+	basePath string
+	routes   []openAPIRoute
+}
+
+// LoadOpenAPISpec parses the bundled OpenAPI 3 document, or the one in
+// assetsDir when set
+func LoadOpenAPISpec(assetsDir string) (*OpenAPISpec, error) {
+	content, err := readAsset(assetsDir, "swagger.yaml")
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+	spec := &OpenAPISpec{doc: doc}
+	if spec.json, err = json.Marshal(doc); err != nil {
+		return nil, fmt.Errorf("failed to encode OpenAPI document: %v", err)
+	}
+
+	if servers, ok := doc["servers"].([]interface{}); ok && len(servers) > 0 {
+		if server, ok := servers[0].(map[string]interface{}); ok {
+			spec.basePath, _ = server["url"].(string)
+		}
+	}
+	paths, _ := doc["paths"].(map[string]interface{})
+	for template, item := range paths {
+		if item, ok := item.(map[string]interface{}); ok {
+			spec.routes = append(spec.routes, openAPIRoute{segments: strings.Split(strings.Trim(template, "/"), "/"), item: item})
+		}
+	}
+	sort.SliceStable(spec.routes, func(i, j int) bool { return spec.routes[i].literals() > spec.routes[j].literals() })
+	return spec, nil
+}
+
+// match finds the path item of a request path and its path parameters
+func (spec *OpenAPISpec) match(path string) (map[string]interface{}, map[string]string, bool) {
+	route, params, ok := spec.route(path)
+	if !ok {
+		return nil, nil, false
+	}
+	return route.item, params, true
+}
+
+// template returns the path template a request path matches, like
+// /api/films/{id} for /api/films/2
+func (spec *OpenAPISpec) template(path string) (string, bool) {
+	route, _, ok := spec.route(path)
+	if !ok {
+		return "", false
+	}
+	return spec.basePath + "/" + strings.Join(route.segments, "/"), true
+}
+
+// route finds the route of a request path and its path parameters
+func (spec *OpenAPISpec) route(path string) (*openAPIRoute, map[string]string, bool) {
+	if !strings.HasPrefix(path, spec.basePath+"/") {
+		return nil, nil, false
+	}
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(path, spec.basePath), "/"), "/")
+	for _, route := range spec.routes {
+		if len(route.segments) != len(segments) {
+			continue
+		}
+		params := make(map[string]string)
+		matched := true
+		for i, segment := range route.segments {
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				params[strings.Trim(segment, "{}")] = segments[i]
+			} else if segment != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return &route, params, true
+		}
+	}
+	return nil, nil, false
+}
+
+// methodOrder is the order methods are listed in Allow headers
+var methodOrder = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// allowedMethods lists the methods the spec documents for a request path,
+// OPTIONS included, or reports false for paths it doesn't describe
+func (spec *OpenAPISpec) allowedMethods(path string) ([]string, bool) {
+	item, _, ok := spec.match(path)
+	if !ok {
+		return nil, false
+	}
+	var methods []string
+	for _, method := range methodOrder {
+		if _, ok := item[strings.ToLower(method)]; ok {
+			methods = append(methods, method)
+		}
+	}
+	return append(methods, "OPTIONS"), true
+}
+
+// resolve follows a local $ref like #/components/schemas/Film
+func (spec *OpenAPISpec) resolve(node map[string]interface{}) map[string]interface{} {
+	for depth := 0; depth < 10; depth++ {
+		ref, ok := node["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return node
+		}
+		var current interface{} = spec.doc
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			object, _ := current.(map[string]interface{})
+			current = object[part]
+		}
+		resolved, ok := current.(map[string]interface{})
+		if !ok {
+			return node
+		}
+		node = resolved
+	}
+	return node
+}
+
+// ValidateRequest checks the parameters and JSON body of a request against its
+// operation in the spec. Requests for unknown paths or methods are left to the handlers.
+func (spec *OpenAPISpec) ValidateRequest(r *http.Request, body []byte) []FieldError {
+	item, pathParams, ok := spec.match(r.URL.Path)
+	if !ok {
+		return nil
+	}
+	operation, ok := item[strings.ToLower(r.Method)].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var errs []FieldError
+	var parameters []interface{}
+	if shared, ok := item["parameters"].([]interface{}); ok {
+		parameters = append(parameters, shared...)
+	}
+	if own, ok := operation["parameters"].([]interface{}); ok {
+		parameters = append(parameters, own...)
+	}
+	query := r.URL.Query()
+	for _, raw := range parameters {
+		param, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		param = spec.resolve(param)
+		name, _ := param["name"].(string)
+		in, _ := param["in"].(string)
+		var value string
+		var present bool
+		switch in {
+		case "path":
+			value, present = pathParams[name]
+		case "query":
+			present = query.Has(name)
+			value = query.Get(name)
+		case "header":
+			value = r.Header.Get(name)
+			present = value != ""
+		default:
+			continue
+		}
+		field := in + "." + name
+		if !present {
+			if required, _ := param["required"].(bool); required {
+				errs = append(errs, FieldError{Field: field, Message: "is required", Code: "field_required"})
+			}
+			continue
+		}
+		schema, _ := param["schema"].(map[string]interface{})
+		if schema != nil {
+			errs = append(errs, spec.validateParameter(spec.resolve(schema), value, field)...)
+		}
+	}
+
+	requestBody, ok := operation["requestBody"].(map[string]interface{})
+	if !ok {
+		return errs
+	}
+	requestBody = spec.resolve(requestBody)
+	if len(bytes.TrimSpace(body)) == 0 {
+		if required, _ := requestBody["required"].(bool); required {
+			errs = append(errs, FieldError{Field: "body", Message: "is required", Code: "field_required"})
+		}
+		return errs
+	}
+	content, _ := requestBody["content"].(map[string]interface{})
+	media, _ := content["application/json"].(map[string]interface{})
+	schema, _ := media["schema"].(map[string]interface{})
+	if schema == nil {
+		return errs
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		// Malformed JSON is reported by the handler itself
+		return errs
+	}
+	return append(errs, spec.validateValue(schema, value, "")...)
+}
+
+// validateParameter converts a parameter from its text form and validates it
+func (spec *OpenAPISpec) validateParameter(schema map[string]interface{}, value, field string) []FieldError {
+	switch schema["type"] {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return []FieldError{{Field: field, Message: "must be an integer", Code: "field_not_integer"}}
+		}
+		return spec.validateValue(schema, json.Number(value), field)
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return []FieldError{{Field: field, Message: "must be a number", Code: "field_not_number"}}
+		}
+		return spec.validateValue(schema, json.Number(value), field)
+	case "boolean":
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return []FieldError{{Field: field, Message: "must be a boolean", Code: "field_not_boolean"}}
+		}
+		return spec.validateValue(schema, parsed, field)
+	}
+	return spec.validateValue(schema, value, field)
+}
+
+// joinField appends a property or index to a field path
+func joinField(field, part string) string {
+	if field == "" {
+		return part
+	}
+	if strings.HasPrefix(part, "[") {
+		return field + part
+	}
+	return field + "." + part
+}
+
+// fieldName is how a field is reported; the body itself is "body"
+func fieldName(field string) string {
+	if field == "" {
+		return "body"
+	}
+	return field
+}
+
+// validateValue validates a decoded JSON value against a schema
+func (spec *OpenAPISpec) validateValue(schema map[string]interface{}, value interface{}, field string) []FieldError {
+	schema = spec.resolve(schema)
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable || schema["type"] == nil {
+			return nil
+		}
+		return []FieldError{{Field: fieldName(field), Message: "must not be null", Code: "field_not_null"}}
+	}
+
+	if options, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, option := range options {
+			if option, ok := option.(map[string]interface{}); ok && len(spec.validateValue(option, value, field)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return []FieldError{{Field: fieldName(field), Message: "must match exactly one of the allowed shapes", Code: "field_shape_mismatch"}}
+		}
+		return nil
+	}
+
+	var errs []FieldError
+	fail := func(code string, params Params, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: fieldName(field), Message: fmt.Sprintf(format, args...), Code: code, Params: params})
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			fail("field_not_object", nil, "must be an object")
+			return errs
+		}
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if name, ok := name.(string); ok {
+					if _, present := object[name]; !present {
+						errs = append(errs, FieldError{Field: joinField(field, name), Message: "is required", Code: "field_required"})
+					}
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				errs = append(errs, spec.validateValue(property, object[name], joinField(field, name))...)
+			}
+		}
+		return errs
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			fail("field_not_array", nil, "must be an array")
+			return errs
+		}
+		if limit, ok := schemaNumber(schema, "minItems"); ok && float64(len(array)) < limit {
+			fail("field_too_few_items", Params{"min": limit}, "must have at least %v items", limit)
+		}
+		if limit, ok := schemaNumber(schema, "maxItems"); ok && float64(len(array)) > limit {
+			fail("field_too_many_items", Params{"max": limit}, "must have at most %v items", limit)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, element := range array {
+				errs = append(errs, spec.validateValue(items, element, joinField(field, fmt.Sprintf("[%d]", i)))...)
+			}
+		}
+		return errs
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			fail("field_not_string", nil, "must be a string")
+			return errs
+		}
+		length := float64(utf8.RuneCountInString(text))
+		if limit, ok := schemaNumber(schema, "minLength"); ok && length < limit {
+			fail("field_too_short", Params{"min": limit}, "must be at least %v characters", limit)
+		}
+		if limit, ok := schemaNumber(schema, "maxLength"); ok && length > limit {
+			fail("field_too_long", Params{"max": limit}, "must be at most %v characters", limit)
+		}
+		switch schema["format"] {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, text); err != nil {
+				fail("field_not_datetime", nil, "must be an RFC 3339 date-time")
+			}
+		case "date":
+			if _, err := time.Parse("2006-01-02", text); err != nil {
+				fail("field_not_date", nil, "must be a date (YYYY-MM-DD)")
+			}
+		}
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		parsed, err := number.Float64()
+		if !ok || err != nil || (schema["type"] == "integer" && strings.ContainsAny(number.String(), ".eE")) {
+			if schema["type"] == "integer" {
+				fail("field_not_integer", nil, "must be an integer")
+			} else {
+				fail("field_not_number", nil, "must be a number")
+			}
+			return errs
+		}
+		if limit, ok := schemaNumber(schema, "minimum"); ok && parsed < limit {
+			fail("field_below_minimum", Params{"min": limit}, "must be at least %v", limit)
+		}
+		if limit, ok := schemaNumber(schema, "maximum"); ok && parsed > limit {
+			fail("field_above_maximum", Params{"max": limit}, "must be at most %v", limit)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("field_not_boolean", nil, "must be a boolean")
+			return errs
+		}
+	}
+
+	if options, ok := schema["enum"].([]interface{}); ok {
+		allowed := make([]string, len(options))
+		found := false
+		for i, option := range options {
+			allowed[i] = fmt.Sprint(option)
+			if allowed[i] == fmt.Sprint(value) {
+				found = true
+			}
+		}
+		if !found {
+			fail("field_not_one_of", Params{"values": strings.Join(allowed, ", ")}, "must be one of %s", strings.Join(allowed, ", "))
+		}
+	}
+	return errs
+}
+
+// schemaNumber reads a numeric schema keyword
+func schemaNumber(schema map[string]interface{}, keyword string) (float64, bool) {
+	switch value := schema[keyword].(type) {
+	case int:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
+
+// validateRequests rejects requests that don't match the OpenAPI spec with a
+// 400 listing every offending field
+func validateRequests(spec *OpenAPISpec, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		if r.Body != nil && isMutation(r.Method) {
+			var err error
+			body, err = io.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Failed to read request body", Code: "body_read_failed"})
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		if errs := spec.ValidateRequest(r, body); len(errs) > 0 {
+			writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Request does not match the API specification", Code: "spec_mismatch", Fields: errs})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// openAPIJSONHandler serves the OpenAPI 3 document as JSON
+func (s *Server) openAPIJSONHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.spec.json)
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// specialRoutes are the routes outside the API, which the spec doesn't describe
+var specialRoutes = map[string][]string{
+	"/swagger/":     {"GET", "OPTIONS"},
+	"/swagger.yaml": {"GET", "OPTIONS"},
+	"/openapi.json": {"GET", "OPTIONS"},
+	"/readyz":       {"GET", "OPTIONS"},
+}
+
+// routeMethods lists the methods a request path allows, or reports false for
+// paths no route serves
+func routeMethods(spec *OpenAPISpec, path string) ([]string, bool) {
+	if methods, ok := specialRoutes[path]; ok {
+		return methods, true
+	}
+	if strings.HasPrefix(path, "/swagger/") {
+		return specialRoutes["/swagger/"], true
+	}
+	if spec == nil {
+		return nil, false
+	}
+	return spec.allowedMethods(path)
+}
+
+// allowRecorder adds the Allow header to 405 responses
+type allowRecorder struct {
+	http.ResponseWriter
+	allow string
+}
+
+// WriteHeader sets Allow before a 405 goes out
+func (ar *allowRecorder) WriteHeader(status int) {
+	if status == http.StatusMethodNotAllowed {
+		ar.Header().Set("Allow", ar.allow)
+	}
+	ar.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to flush streams
+func (ar *allowRecorder) Unwrap() http.ResponseWriter {
+	return ar.ResponseWriter
+}
+
+// answerOptions answers OPTIONS for every route with the methods it allows,
+// before authentication, so browsers can always preflight. Preflights are
+// cached for the configured CORS max age. Responses with 405 get the same
+// Allow list, so handlers only need to check for the methods they serve.
+func (s *Server) answerOptions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods, ok := routeMethods(s.spec, r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allow := strings.Join(methods, ", ")
+		if r.Method != "OPTIONS" {
+			next.ServeHTTP(&allowRecorder{ResponseWriter: w, allow: allow}, r)
+			return
+		}
+
+		s.enableCORS(w, r)
+		w.Header().Set("Allow", allow)
+		w.Header().Set("Access-Control-Allow-Methods", allow)
+		if r.Header.Get("Access-Control-Request-Method") != "" {
+			if maxAge := s.currentConfig().CORS.MaxAge; maxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,421 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Organization limits
+const (
+	maxOrganizationNameLength = 100
+	maxOrganizationSlugLength = 50
+)
+
+// organizationSlugPattern allows lowercase words joined by hyphens
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Tenant is the organization a request acts for, fixed when its token is issued
+type Tenant struct {
+	OrganizationID uint
+	Slug           string
+}
+
+const tenantContextKey contextKey = "tenant"
+
+// currentTenant returns the organization of the authenticated user of a request
+func currentTenant(r *http.Request) Tenant {
+	tenant, _ := r.Context().Value(tenantContextKey).(Tenant)
+	return tenant
+}
+
+// tenantScope limits a query to the rows of one organization
+func tenantScope(organizationID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "organization_id"}, Value: organizationID})
+	}
+}
+
+// tenantFilmScope limits a query of rows that belong to a film, such as
+// copies or screenings, to the films of one organization
+func tenantFilmScope(organizationID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("film_id IN (SELECT id FROM films WHERE organization_id = ?)", organizationID)
+	}
+}
+
+// anyTenant leaves a query spanning every organization
+func anyTenant(db *gorm.DB) *gorm.DB {
+	return db
+}
+
+// tenantFilms returns the film repository for the catalog of the organization a request acts for
+func (s *Server) tenantFilms(r *http.Request) FilmRepository {
+	return s.films.ForTenant(currentTenant(r))
+}
+
+// tenantLists returns the list service for the films of the organization a
+// request acts for
+func (s *Server) tenantLists(r *http.Request) *ListService {
+	return s.listService.ForTenant(currentTenant(r))
+}
+
+// tenantCollections returns the collection service for the films of the
+// organization a request acts for
+func (s *Server) tenantCollections(r *http.Request) *CollectionService {
+	return s.collectionService.ForTenant(currentTenant(r))
+}
+
+// tenantScreenings returns the screening service for the films of the
+// organization a request acts for
+func (s *Server) tenantScreenings(r *http.Request) *ScreeningService {
+	return s.screeningService.ForTenant(currentTenant(r))
+}
+
+// tenantLending returns the lending service for the copies of the films of
+// the organization a request acts for
+func (s *Server) tenantLending(r *http.Request) *LendingService {
+	return s.lendingService.ForTenant(currentTenant(r))
+}
+
+// tenantCatalog returns the film service for the catalog of the organization
+// a request acts for, for the queries only the database answers: search,
+// similar films, and view counts
+func (s *Server) tenantCatalog(r *http.Request) *FilmService {
+	return s.filmService.inTenant(currentTenant(r))
+}
+
+// ensureDefaultOrganization returns the organization users and films belong
+// to until they are moved, creating it the first time
+func ensureDefaultOrganization(db *gorm.DB) (*Organization, error) {
+	var organization Organization
+	err := db.Where(Organization{Slug: defaultTenant}).Attrs(Organization{Name: "Default"}).FirstOrCreate(&organization).Error
+	if err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+// OrganizationService handles organizations and their members
+type OrganizationService struct {
+	db    *gorm.DB
+	users UserRepository
+}
+
+// NewOrganizationService creates a new organization service
+func NewOrganizationService(db *gorm.DB, users UserRepository) *OrganizationService {
+	return &OrganizationService{db: db, users: users}
+}
+
+// ValidateOrganizationRequest trims an organization payload in place and
+// checks it. The slug is only checked when creating. It returns nil when the
+// organization is valid.
+func ValidateOrganizationRequest(organizationReq *OrganizationRequest, creating bool) *ValidationError {
+	organizationReq.Name = strings.TrimSpace(organizationReq.Name)
+	organizationReq.Slug = strings.TrimSpace(organizationReq.Slug)
+	organizationReq.Plan = strings.TrimSpace(organizationReq.Plan)
+
+	var fields []FieldError
+	if organizationReq.Name == "" {
+		fields = append(fields, FieldError{Field: "name", Message: "is required", Code: "field_required"})
+	} else if utf8.RuneCountInString(organizationReq.Name) > maxOrganizationNameLength {
+		fields = append(fields, FieldError{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxOrganizationNameLength), Code: "field_too_long", Params: Params{"max": maxOrganizationNameLength}})
+	}
+
+	if creating {
+		if organizationReq.Slug == "" {
+			fields = append(fields, FieldError{Field: "slug", Message: "is required", Code: "field_required"})
+		} else if len(organizationReq.Slug) > maxOrganizationSlugLength {
+			fields = append(fields, FieldError{Field: "slug", Message: fmt.Sprintf("must be at most %d characters", maxOrganizationSlugLength), Code: "field_too_long", Params: Params{"max": maxOrganizationSlugLength}})
+		} else if !organizationSlugPattern.MatchString(organizationReq.Slug) {
+			fields = append(fields, FieldError{Field: "slug", Message: "must be lowercase letters and digits separated by hyphens", Code: "field_invalid_slug"})
+		}
+	}
+
+	if _, exists := plans[organizationReq.Plan]; organizationReq.Plan != "" && !exists {
+		fields = append(fields, FieldError{Field: "plan", Message: "must be one of free, pro, enterprise", Code: "field_not_one_of", Params: Params{"values": "free, pro, enterprise"}})
+	}
+	if organizationReq.MaxFilms != nil && *organizationReq.MaxFilms < 0 {
+		fields = append(fields, FieldError{Field: "max_films", Message: "must be at least 0", Code: "field_below_minimum", Params: Params{"min": 0}})
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// GetOrganizations retrieves every organization
+func (orgs *OrganizationService) GetOrganizations() ([]Organization, error) {
+	var organizations []Organization
+	err := orgs.db.Order("id").Find(&organizations).Error
+	return organizations, err
+}
+
+// GetOrganization retrieves an organization by ID
+func (orgs *OrganizationService) GetOrganization(id uint) (*Organization, error) {
+	var organization Organization
+	if err := orgs.db.First(&organization, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("organization not found")
+		}
+		return nil, err
+	}
+	return &organization, nil
+}
+
+// slugTaken reports whether an organization already uses a slug
+func (orgs *OrganizationService) slugTaken(slug string) (bool, error) {
+	var count int64
+	err := orgs.db.Model(&Organization{}).Where("slug = ?", slug).Count(&count).Error
+	return count > 0, err
+}
+
+// CreateOrganization creates an organization with an unused slug
+func (orgs *OrganizationService) CreateOrganization(organizationReq OrganizationRequest) (*Organization, error) {
+	if taken, err := orgs.slugTaken(organizationReq.Slug); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, errors.New("slug already in use")
+	}
+
+	organization := Organization{Name: organizationReq.Name, Slug: organizationReq.Slug, Plan: organizationReq.Plan, MaxFilms: organizationReq.MaxFilms}
+	if err := orgs.db.Create(&organization).Error; err != nil {
+		// Lost a race for the unique slug index
+		if taken, _ := orgs.slugTaken(organization.Slug); taken {
+			return nil, errors.New("slug already in use")
+		}
+		return nil, err
+	}
+	return &organization, nil
+}
+
+// UpdateOrganization changes the name and plan of an organization. The slug
+// never changes.
+func (orgs *OrganizationService) UpdateOrganization(id uint, organizationReq OrganizationRequest) (*Organization, error) {
+	organization, err := orgs.GetOrganization(id)
+	if err != nil {
+		return nil, err
+	}
+	organization.Name = organizationReq.Name
+	organization.Plan = organizationReq.Plan
+	organization.MaxFilms = organizationReq.MaxFilms
+	if err := orgs.db.Model(organization).Select("name", "plan", "max_films", "updated_at").Updates(organization).Error; err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+// DeleteOrganization removes an organization without users or films. The
+// default organization stays.
+func (orgs *OrganizationService) DeleteOrganization(id uint) error {
+	organization, err := orgs.GetOrganization(id)
+	if err != nil {
+		return err
+	}
+	if organization.Slug == defaultTenant {
+		return errors.New("default organization")
+	}
+
+	return orgs.db.Transaction(func(tx *gorm.DB) error {
+		// Deleted rows still point at the organization
+		var users, films int64
+		if err := tx.Unscoped().Model(&User{}).Where("organization_id = ?", id).Count(&users).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&Film{}).Where("organization_id = ?", id).Count(&films).Error; err != nil {
+			return err
+		}
+		if users > 0 || films > 0 {
+			return errors.New("organization not empty")
+		}
+		return tx.Delete(&Organization{}, id).Error
+	})
+}
+
+// GetMembers retrieves the users of an organization
+func (orgs *OrganizationService) GetMembers(id uint) ([]User, error) {
+	if _, err := orgs.GetOrganization(id); err != nil {
+		return nil, err
+	}
+	var users []User
+	err := orgs.db.Where("organization_id = ?", id).Order("username").Find(&users).Error
+	return users, err
+}
+
+// AddMember moves a user into an organization and reports whether they
+// were in another one before. Their films stay in the catalog they were
+// created in.
+func (orgs *OrganizationService) AddMember(id uint, username string) (*User, bool, error) {
+	if _, err := orgs.GetOrganization(id); err != nil {
+		return nil, false, err
+	}
+	user, err := orgs.users.GetUserByUsername(username)
+	if err != nil {
+		return nil, false, err
+	}
+	if user.OrganizationID == id {
+		return user, false, nil
+	}
+	if err := orgs.db.Model(user).Update("organization_id", id).Error; err != nil {
+		return nil, false, err
+	}
+	user.OrganizationID = id
+	return user, true, nil
+}
+
+// organizationsHandler routes /api/orgs, /api/orgs/{id},
+// /api/orgs/{id}/members, and /api/orgs/{id}/members/{username}
+func (s *Server) organizationsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/orgs"), "/")
+	if path == "" {
+		switch r.Method {
+		case "GET":
+			organizations, err := s.organizationService.GetOrganizations()
+			if err != nil {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve organizations", Code: "organizations_retrieve_failed"})
+				return
+			}
+			if organizations == nil {
+				organizations = []Organization{}
+			}
+			writeResponse(w, r, http.StatusOK, organizations)
+		case "POST":
+			s.saveOrganizationHandler(w, r, 0)
+		default:
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		}
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 3)
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid organization ID", Code: "invalid_organization_id"})
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		s.organizationHandler(w, r, uint(id))
+	case parts[1] != "members":
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Not found", Code: "not_found"})
+	case len(parts) == 2:
+		if r.Method != "GET" {
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+			return
+		}
+		members, err := s.organizationService.GetMembers(uint(id))
+		if err != nil {
+			writeOrganizationError(w, r, err, ErrorResponse{Error: "Failed to retrieve members", Code: "members_retrieve_failed"})
+			return
+		}
+		profiles := make([]UserProfile, len(members))
+		for i := range members {
+			profiles[i] = newUserProfile(&members[i])
+		}
+		writeResponse(w, r, http.StatusOK, profiles)
+	default:
+		if r.Method != "PUT" {
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+			return
+		}
+		user, moved, err := s.organizationService.AddMember(uint(id), parts[2])
+		if err != nil {
+			writeOrganizationError(w, r, err, ErrorResponse{Error: "Failed to add member", Code: "member_add_failed"})
+			return
+		}
+		// Tokens act for the organization they were issued in, so a moved
+		// user signs in again to act for the new one
+		if moved {
+			s.tokenStore.RemoveUserTokens(user.Username)
+		}
+		writeResponse(w, r, http.StatusOK, newUserProfile(user))
+	}
+}
+
+// organizationHandler handles /api/orgs/{id} by method
+func (s *Server) organizationHandler(w http.ResponseWriter, r *http.Request, id uint) {
+	switch r.Method {
+	case "GET":
+		organization, err := s.organizationService.GetOrganization(id)
+		if err != nil {
+			writeOrganizationError(w, r, err, ErrorResponse{Error: "Failed to retrieve organization", Code: "organization_retrieve_failed"})
+			return
+		}
+		writeResponse(w, r, http.StatusOK, organization)
+	case "PUT":
+		s.saveOrganizationHandler(w, r, id)
+	case "DELETE":
+		if err := s.organizationService.DeleteOrganization(id); err != nil {
+			switch err.Error() {
+			case "default organization":
+				writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "The default organization can't be deleted", Code: "organization_default_delete"})
+			case "organization not empty":
+				writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "Organization still has users or films", Code: "organization_not_empty"})
+			default:
+				writeOrganizationError(w, r, err, ErrorResponse{Error: "Failed to delete organization", Code: "organization_delete_failed"})
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+	}
+}
+
+// saveOrganizationHandler creates an organization (id 0) or updates an existing one
+func (s *Server) saveOrganizationHandler(w http.ResponseWriter, r *http.Request, id uint) {
+	var organizationReq OrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&organizationReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+
+	if validationErr := ValidateOrganizationRequest(&organizationReq, id == 0); validationErr != nil {
+		writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: validationErr.Fields})
+		return
+	}
+
+	if id == 0 {
+		organization, err := s.organizationService.CreateOrganization(organizationReq)
+		if err != nil {
+			if err.Error() == "slug already in use" {
+				writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "Organization slug already in use", Code: "organization_slug_taken"})
+			} else {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save organization", Code: "organization_save_failed"})
+			}
+			return
+		}
+		writeResponse(w, r, http.StatusCreated, organization)
+		return
+	}
+
+	organization, err := s.organizationService.UpdateOrganization(id, organizationReq)
+	if err != nil {
+		writeOrganizationError(w, r, err, ErrorResponse{Error: "Failed to save organization", Code: "organization_save_failed"})
+		return
+	}
+	writeResponse(w, r, http.StatusOK, organization)
+}
+
+// writeOrganizationError answers a failed organization operation, with
+// fallback as the response to unexpected errors
+func writeOrganizationError(w http.ResponseWriter, r *http.Request, err error, fallback ErrorResponse) {
+	switch err.Error() {
+	case "organization not found":
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Organization not found", Code: "organization_not_found"})
+	case "user not found":
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "User not found", Code: "user_unknown"})
+	default:
+		writeResponse(w, r, http.StatusInternalServerError, fallback)
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// methodOverrideHeader tunnels a method through proxies that only pass GET and POST
+const methodOverrideHeader = "X-HTTP-Method-Override"
+
+// overridableMethods are the methods a POST may be turned into
+var overridableMethods = map[string]bool{"PUT": true, "PATCH": true, "DELETE": true}
+
+// overrideMethods serves POST requests carrying X-HTTP-Method-Override as
+// the method it names, so clients behind restrictive proxies can still
+// update and delete. The header is ignored on other methods, which can't
+// tunnel a write through a safe method.
+func overrideMethods(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		override := r.Header.Get(methodOverrideHeader)
+		if r.Method != "POST" || override == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		method := strings.ToUpper(strings.TrimSpace(override))
+		if !overridableMethods[method] {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "X-HTTP-Method-Override must be PUT, PATCH, or DELETE", Code: "method_override_invalid"})
+			return
+		}
+		r = r.Clone(r.Context())
+		r.Method = method
+		r.Header.Del(methodOverrideHeader)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Page size limits for paginated listings
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Orders supported by cursor pagination
+const (
+	cursorOrderID        = "id"
+	cursorOrderCreatedAt = "created_at"
+)
+
+// FilmCursor is the position after the last film of a keyset page.
+// Clients receive it base64 encoded and must treat it as opaque.
+type FilmCursor struct {
+	Order     string    `json:"o"`
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"t,omitempty"`
+}
+
+// Encode returns the opaque representation of the cursor
+func (c FilmCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeFilmCursor parses an opaque cursor returned by a previous page
+func DecodeFilmCursor(value string) (*FilmCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cursor FilmCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	if cursor.Order != cursorOrderID && cursor.Order != cursorOrderCreatedAt {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// parsePageSize reads page_size from the query, falling back to the default
+func parsePageSize(query url.Values) (int, error) {
+	value := query.Get("page_size")
+	if value == "" {
+		return defaultPageSize, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 1 || size > maxPageSize {
+		return 0, &CodedError{Code: "invalid_page_size", Params: Params{"min": 1, "max": maxPageSize}, Message: "page_size must be between 1 and 100"}
+	}
+	return size, nil
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+)
+
+// cleanPath collapses duplicate slashes and drops a trailing slash. It
+// reports false for paths with . or .. segments, which no route has.
+func cleanPath(path string) (string, bool) {
+	segments := strings.Split(path, "/")
+	clean := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		switch segment {
+		case "":
+			continue
+		case ".", "..":
+			return "", false
+		}
+		clean = append(clean, segment)
+	}
+	return "/" + strings.Join(clean, "/"), true
+}
+
+// normalizePaths gives every API route one path. Reads of /api/films/ or
+// /api//films are redirected to /api/films, so caches and clients see one
+// URL; writes are served as if sent to it, since clients don't reliably
+// repeat a body after a redirect. Paths no route serves answer 404 before
+// reaching a handler, so they don't end up in one that doesn't expect them.
+func normalizePaths(spec *OpenAPISpec, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ok := cleanPath(r.URL.Path)
+		if ok && path != "/api" && !strings.HasPrefix(path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok && spec != nil {
+			_, ok = spec.allowedMethods(path)
+		}
+		if !ok {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Not found", Code: "not_found"})
+			return
+		}
+		if path == r.URL.Path {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method == "GET" || r.Method == "HEAD" {
+			target := path
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		r = r.Clone(r.Context())
+		r.URL.Path, r.URL.RawPath = path, ""
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,23 @@
+//go:build plugin_auditlog
+
+package api
+
+import "log"
+
+// The audit log plugin is an example of a compiled-in plugin. Enable it with
+// `go build -tags plugin_auditlog` (or `make build TAGS=plugin_auditlog`).
+func init() {
+	RegisterPlugin(Plugin{
+		Name: "auditlog",
+		Films: FilmHooks{
+			PostCommit: func(hc HookContext, film *Film) {
+				log.Printf("📝 Audit: film %d %s", film.ID, hc.Action)
+			},
+		},
+		Users: UserHooks{
+			PostCommit: func(hc HookContext, user *User) {
+				log.Printf("📝 Audit: user %s %s", user.Username, hc.Action)
+			},
+		},
+	})
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxPosterBytes is the largest poster accepted for upload
+const maxPosterBytes = 5 << 20
+
+// posterExtensions maps the sniffed content types posters may have to the
+// extension of their blob key
+var posterExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// posterKey returns a new blob key for a poster of a film. Every upload gets
+// its own key, so a replaced poster never lingers in caches or under an
+// outstanding presigned URL.
+func posterKey(id uint, ext string) string {
+	token := make([]byte, 8)
+	rand.Read(token)
+	return fmt.Sprintf("posters/%d/%s%s", id, hex.EncodeToString(token), ext)
+}
+
+// posterETag returns the entity tag of the poster under a key, which only
+// ever holds one poster
+func posterETag(key string) string {
+	return `"` + strings.TrimSuffix(path.Base(key), path.Ext(key)) + `"`
+}
+
+// writePosterError answers a failed poster change
+func writePosterError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err.Error() {
+	case "film not found":
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Film not found", Code: "film_not_found"})
+	case "not the film creator":
+		writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Only the creator of a film or an admin can change it", Code: "film_not_creator"})
+	default:
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update poster", Code: "poster_update_failed"})
+	}
+}
+
+// filmPosterHandler handles GET, PUT and DELETE /api/films/{id}/poster
+func (s *Server) filmPosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/films/"), "/poster"))
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid film ID", Code: "invalid_film_id"})
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.getPosterHandler(w, r, uint(id))
+	case "PUT":
+		s.putPosterHandler(w, r, uint(id))
+	case "DELETE":
+		s.deletePosterHandler(w, r, uint(id))
+	default:
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+	}
+}
+
+// getPosterHandler sends clients to a presigned URL of the poster of a film
+// when the blob store hands them out, and streams it otherwise. With ?size=
+// it serves a thumbnail, or the poster while there is none of that size.
+func (s *Server) getPosterHandler(w http.ResponseWriter, r *http.Request, id uint) {
+	size := r.URL.Query().Get("size")
+	if size != "" && !validPosterSize(size) {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "size must be one of " + strings.Join(posterSizeNames(), ", "), Code: "poster_size_invalid", Params: Params{"values": strings.Join(posterSizeNames(), ", ")}})
+		return
+	}
+	film, err := s.tenantFilms(r).GetFilmByID(id)
+	if err != nil {
+		if err.Error() == "film not found" {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Film not found", Code: "film_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve film", Code: "film_retrieve_failed"})
+		}
+		return
+	}
+	if film.PosterKey == "" {
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Film has no poster", Code: "poster_missing"})
+		return
+	}
+	key := film.PosterKey
+	if size != "" && hasPosterSize(film, size) {
+		key = thumbnailKey(key, size)
+	}
+
+	location, err := s.blobs.PresignGet(r.Context(), key, s.cfg.Blobs.PresignTTL)
+	if err != nil {
+		log.Printf("Warning: Failed to presign poster of film %d: %v", id, err)
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve poster", Code: "poster_retrieve_failed"})
+		return
+	}
+	if location != "" {
+		// The URL expires, so the redirect itself must not be cached
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, location, http.StatusFound)
+		return
+	}
+
+	etag := posterETag(key)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	body, info, err := s.blobs.Get(r.Context(), key)
+	if err != nil {
+		w.Header().Del("ETag")
+		w.Header().Del("Cache-Control")
+		if errors.Is(err, errBlobNotFound) {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Film has no poster", Code: "poster_missing"})
+		} else {
+			log.Printf("Warning: Failed to read poster of film %d: %v", id, err)
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve poster", Code: "poster_retrieve_failed"})
+		}
+		return
+	}
+	defer body.Close()
+	w.Header().Set("Content-Type", info.ContentType)
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, body)
+}
+
+// putPosterHandler uploads the poster of a film, replacing any it had, and
+// queues its thumbnails. The type is sniffed from the image itself, not
+// taken from Content-Type.
+func (s *Server) putPosterHandler(w http.ResponseWriter, r *http.Request, id uint) {
+	editor, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	films := s.tenantFilms(r)
+	film, err := films.GetFilmByID(id)
+	if err == nil && !canEditFilm(editor, film) {
+		err = errors.New("not the film creator")
+	}
+	if err != nil {
+		writePosterError(w, r, err)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPosterBytes))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeResponse(w, r, http.StatusRequestEntityTooLarge, ErrorResponse{Error: "Poster must not be larger than 5 MB", Code: "poster_too_large"})
+		} else {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Failed to read poster", Code: "poster_read_failed"})
+		}
+		return
+	}
+	ext, ok := posterExtensions[http.DetectContentType(data)]
+	if !ok {
+		writeResponse(w, r, http.StatusUnsupportedMediaType, ErrorResponse{Error: "Poster must be a JPEG, PNG, or WebP image", Code: "poster_type_invalid"})
+		return
+	}
+
+	key := posterKey(id, ext)
+	if err := s.blobs.Put(r.Context(), key, bytes.NewReader(data), int64(len(data))); err != nil {
+		log.Printf("Warning: Failed to store poster of film %d: %v", id, err)
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to store poster", Code: "poster_store_failed"})
+		return
+	}
+	film, previous, err := films.SetPoster(id, key, editor)
+	if err != nil {
+		s.deletePoster(r.Context(), key)
+		writePosterError(w, r, err)
+		return
+	}
+	if previous != "" {
+		s.deletePoster(r.Context(), previous)
+	}
+	s.queuePosterThumbnails(films, id, key, data)
+
+	s.meteringService.RecordRequest(r, MeterWrite, 1)
+	s.meteringService.RecordRequest(r, MeterStorageBytes, int64(len(data)))
+	writeResponse(w, r, http.StatusOK, withLinks(film))
+}
+
+// deletePosterHandler removes the poster of a film
+func (s *Server) deletePosterHandler(w http.ResponseWriter, r *http.Request, id uint) {
+	editor, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	_, previous, err := s.tenantFilms(r).SetPoster(id, "", editor)
+	if err != nil {
+		writePosterError(w, r, err)
+		return
+	}
+	if previous == "" {
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Film has no poster", Code: "poster_missing"})
+		return
+	}
+	s.deletePoster(r.Context(), previous)
+
+	s.meteringService.RecordRequest(r, MeterWrite, 1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deletePoster removes a poster no film refers to anymore, with its
+// thumbnails. A failure only leaves blobs behind, so it is logged, not
+// returned.
+func (s *Server) deletePoster(ctx context.Context, key string) {
+	keys := []string{key}
+	for _, size := range posterSizes {
+		keys = append(keys, thumbnailKey(key, size.Name))
+	}
+	for _, key := range keys {
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			log.Printf("Warning: Failed to delete poster %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIPContextKey holds the client address resolveClientIP found
+const clientIPContextKey contextKey = "client_ip"
+
+// resolveClientIP records the address of the client behind trusted proxies,
+// for clientIP. Trusted proxies are read per request, so SIGHUP reloads
+// apply at once.
+func (s *Server) resolveClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := forwardedClientIP(r, s.currentConfig().Proxy.Trusted)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPContextKey, ip)))
+	})
+}
+
+// forwardedClientIP returns the address a request came from. Only when the
+// peer is a trusted proxy is X-Forwarded-For followed, from the right, past
+// every trusted proxy to the first address that isn't one; anything left of
+// that was sent by the client and could be made up.
+func forwardedClientIP(r *http.Request, trusted []string) string {
+	ip := remoteIP(r)
+	if !allowlisted(ip, trusted) {
+		return ip
+	}
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !allowlisted(ip, trusted) {
+			break
+		}
+	}
+	return ip
+}
@@ -0,0 +1,488 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Film query limits, so one request can't build an arbitrarily large statement
+const (
+	maxQueryLength     = 500
+	maxQueryConditions = 20
+	maxQueryDepth      = 5
+)
+
+// queryFieldKind is how a field's values are parsed and compared
+type queryFieldKind int
+
+const (
+	queryText queryFieldKind = iota
+	queryNumber
+	queryTime
+)
+
+// queryFields maps the fields of the query language to their columns
+var queryFields = map[string]queryFieldKind{
+	"title":           queryText,
+	"director":        queryText,
+	"genre":           queryText,
+	"external_id":     queryText,
+	"synopsis":        queryText,
+	"language":        queryText,
+	"country":         queryText,
+	"age_rating":      queryText,
+	"imdb_id":         queryText,
+	"id":              queryNumber,
+	"year":            queryNumber,
+	"runtime_minutes": queryNumber,
+	"version":         queryNumber,
+	"created_at":      queryTime,
+	"updated_at":      queryTime,
+}
+
+// queryOperators are tried longest first, so >= isn't read as >
+var queryOperators = []string{">=", "<=", "!=", "!:", "!~", ":", "=", "~", ">", "<"}
+
+// FilmQuery is a parsed ?q= filter: an SQL condition over the films table
+// with its values bound as parameters, and the same condition as a predicate
+// for films held in memory
+type FilmQuery struct {
+	sql   string
+	args  []interface{}
+	match func(film *Film) bool
+}
+
+// scope restricts a statement to the films matching the query; a nil query matches all
+func (q *FilmQuery) scope(db *gorm.DB) *gorm.DB {
+	if q == nil {
+		return db
+	}
+	return db.Where(q.sql, q.args...)
+}
+
+// matches reports whether a film satisfies the query; a nil query matches all
+func (q *FilmQuery) matches(film *Film) bool {
+	return q == nil || q.match(film)
+}
+
+// ParseFilmQuery parses the film query language, e.g.
+//
+//	year>=1990 AND genre:Drama AND director~nolan
+//	(genre:Drama OR genre:Crime) NOT title~"part ii"
+//
+// Conditions are field, operator, and value; a value with spaces is quoted.
+// AND binds tighter than OR, and conditions next to each other are ANDed.
+func ParseFilmQuery(input string) (*FilmQuery, error) {
+	if len(input) > maxQueryLength {
+		return nil, fmt.Errorf("must be at most %d characters", maxQueryLength)
+	}
+	p := &queryParser{input: input}
+	query, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos+1)
+	}
+	return query, nil
+}
+
+// queryParser is a recursive-descent parser over the query string
+type queryParser struct {
+	input      string
+	pos        int
+	conditions int
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// keyword consumes a keyword such as AND when it comes next, in any case
+func (p *queryParser) keyword(word string) bool {
+	p.skipSpace()
+	end := p.pos + len(word)
+	if end > len(p.input) || !strings.EqualFold(p.input[p.pos:end], word) {
+		return false
+	}
+	if end < len(p.input) && !unicode.IsSpace(rune(p.input[end])) && p.input[end] != '(' {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+// atEnd reports whether the current group ends here
+func (p *queryParser) atEnd() bool {
+	p.skipSpace()
+	return p.pos >= len(p.input) || p.input[p.pos] == ')'
+}
+
+func (p *queryParser) parseOr(depth int) (*FilmQuery, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = orQuery(left, right)
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd(depth int) (*FilmQuery, error) {
+	left, err := p.parseFactor(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if !p.keyword("AND") {
+			// A condition right after another one is ANDed too
+			if p.atEnd() || p.peekKeyword("OR") {
+				return left, nil
+			}
+		}
+		right, err := p.parseFactor(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = andQuery(left, right)
+	}
+}
+
+// orQuery matches the films either query matches
+func orQuery(left, right *FilmQuery) *FilmQuery {
+	return &FilmQuery{
+		sql:   "(" + left.sql + " OR " + right.sql + ")",
+		args:  append(left.args, right.args...),
+		match: func(film *Film) bool { return left.match(film) || right.match(film) },
+	}
+}
+
+// andQuery matches the films both queries match
+func andQuery(left, right *FilmQuery) *FilmQuery {
+	return &FilmQuery{
+		sql:   "(" + left.sql + " AND " + right.sql + ")",
+		args:  append(left.args, right.args...),
+		match: func(film *Film) bool { return left.match(film) && right.match(film) },
+	}
+}
+
+// peekKeyword reports whether a keyword comes next without consuming it
+func (p *queryParser) peekKeyword(word string) bool {
+	pos := p.pos
+	found := p.keyword(word)
+	p.pos = pos
+	return found
+}
+
+func (p *queryParser) parseFactor(depth int) (*FilmQuery, error) {
+	if p.keyword("NOT") {
+		inner, err := p.parseFactor(depth)
+		if err != nil {
+			return nil, err
+		}
+		return &FilmQuery{
+			sql:   "NOT (" + inner.sql + ")",
+			args:  inner.args,
+			match: func(film *Film) bool { return !inner.match(film) },
+		}, nil
+	}
+
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == '(' {
+		if depth >= maxQueryDepth {
+			return nil, fmt.Errorf("must nest at most %d groups", maxQueryDepth)
+		}
+		p.pos++
+		inner, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.skipSpace(); p.pos >= len(p.input) || p.input[p.pos] != ')' {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return inner, nil
+	}
+	return p.parseCondition()
+}
+
+// parseCondition parses field, operator, and value
+func (p *queryParser) parseCondition() (*FilmQuery, error) {
+	if p.conditions++; p.conditions > maxQueryConditions {
+		return nil, fmt.Errorf("must have at most %d conditions", maxQueryConditions)
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] == '_' || unicode.IsLetter(rune(p.input[p.pos]))) {
+		p.pos++
+	}
+	field := strings.ToLower(p.input[start:p.pos])
+	if field == "" {
+		if p.pos >= len(p.input) {
+			return nil, fmt.Errorf("expected a condition at the end")
+		}
+		return nil, fmt.Errorf("expected a condition at position %d", p.pos+1)
+	}
+	kind, ok := queryFields[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %s", field)
+	}
+
+	op := ""
+	for _, candidate := range queryOperators {
+		if strings.HasPrefix(p.input[p.pos:], candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return nil, fmt.Errorf("expected an operator after %s", field)
+	}
+	p.pos += len(op)
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case queryNumber:
+		return numberCondition(field, op, value)
+	case queryTime:
+		return timeCondition(field, op, value)
+	default:
+		return textCondition(field, op, value)
+	}
+}
+
+// parseValue reads a quoted string or a bare word
+func (p *queryParser) parseValue() (string, error) {
+	if p.pos < len(p.input) && p.input[p.pos] == '"' {
+		var value strings.Builder
+		for p.pos++; p.pos < len(p.input); p.pos++ {
+			switch c := p.input[p.pos]; {
+			case c == '\\' && p.pos+1 < len(p.input):
+				p.pos++
+				value.WriteByte(p.input[p.pos])
+			case c == '"':
+				p.pos++
+				return value.String(), nil
+			default:
+				value.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("missing closing quote")
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && !unicode.IsSpace(rune(p.input[p.pos])) && p.input[p.pos] != '(' && p.input[p.pos] != ')' {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", fmt.Errorf("expected a value at position %d", p.pos+1)
+	}
+	return p.input[start:p.pos], nil
+}
+
+// textCondition compares a text column, ignoring case
+func textCondition(field, op, value string) (*FilmQuery, error) {
+	lowered := strings.ToLower(value)
+	switch op {
+	case ":", "=":
+		return &FilmQuery{
+			sql:   "lower(" + field + ") = lower(?)",
+			args:  []interface{}{value},
+			match: func(film *Film) bool { return strings.ToLower(filmText(film, field)) == lowered },
+		}, nil
+	case "!=", "!:":
+		return &FilmQuery{
+			sql:   "lower(" + field + ") <> lower(?)",
+			args:  []interface{}{value},
+			match: func(film *Film) bool { return strings.ToLower(filmText(film, field)) != lowered },
+		}, nil
+	case "~":
+		return &FilmQuery{
+			sql:   field + " ILIKE ?",
+			args:  []interface{}{"%" + escapeLike(value) + "%"},
+			match: func(film *Film) bool { return strings.Contains(strings.ToLower(filmText(film, field)), lowered) },
+		}, nil
+	case "!~":
+		return &FilmQuery{
+			sql:   field + " NOT ILIKE ?",
+			args:  []interface{}{"%" + escapeLike(value) + "%"},
+			match: func(film *Film) bool { return !strings.Contains(strings.ToLower(filmText(film, field)), lowered) },
+		}, nil
+	}
+	return nil, fmt.Errorf("%s can't be compared with %s", field, op)
+}
+
+// escapeLike makes a value match literally inside a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// numberCondition compares an integer column; a:b..c selects a range
+func numberCondition(field, op, value string) (*FilmQuery, error) {
+	if low, high, isRange := strings.Cut(value, ".."); isRange && (op == ":" || op == "=") {
+		from, errFrom := strconv.Atoi(low)
+		to, errTo := strconv.Atoi(high)
+		if errFrom != nil || errTo != nil {
+			return nil, fmt.Errorf("%s needs a number range like 1990..1999", field)
+		}
+		return &FilmQuery{
+			sql:  field + " BETWEEN ? AND ?",
+			args: []interface{}{from, to},
+			match: func(film *Film) bool {
+				number := filmNumber(film, field)
+				return number >= from && number <= to
+			},
+		}, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s needs a number", field)
+	}
+	switch op {
+	case ":", "=":
+		op = "="
+	case "!=", "!:":
+		op = "<>"
+	case "~", "!~":
+		return nil, fmt.Errorf("%s can't be compared with %s", field, op)
+	}
+	return &FilmQuery{
+		sql:   field + " " + op + " ?",
+		args:  []interface{}{number},
+		match: func(film *Film) bool { return compared(op, cmp.Compare(filmNumber(film, field), number)) },
+	}, nil
+}
+
+// timeCondition compares a timestamp column with an RFC 3339 time or a
+// date. A date covers its whole day in UTC, so created_at:2025-01-15 matches
+// the films created that day and created_at>2025-01-15 those after it.
+func timeCondition(field, op, value string) (*FilmQuery, error) {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		switch op {
+		case ":", "=":
+			op = "="
+		case "!=", "!:":
+			op = "<>"
+		case "~", "!~":
+			return nil, fmt.Errorf("%s can't be compared with %s", field, op)
+		}
+		return timeComparison(field, op, at), nil
+	}
+
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("%s needs an RFC 3339 time or a date (YYYY-MM-DD)", field)
+	}
+	next := day.AddDate(0, 0, 1)
+	switch op {
+	case ":", "=":
+		return andQuery(timeComparison(field, ">=", day), timeComparison(field, "<", next)), nil
+	case "!=", "!:":
+		return orQuery(timeComparison(field, "<", day), timeComparison(field, ">=", next)), nil
+	case ">":
+		return timeComparison(field, ">=", next), nil
+	case ">=":
+		return timeComparison(field, ">=", day), nil
+	case "<":
+		return timeComparison(field, "<", day), nil
+	case "<=":
+		return timeComparison(field, "<", next), nil
+	}
+	return nil, fmt.Errorf("%s can't be compared with %s", field, op)
+}
+
+// timeComparison compares a timestamp column with a time using an SQL operator
+func timeComparison(field, op string, at time.Time) *FilmQuery {
+	return &FilmQuery{
+		sql:   field + " " + op + " ?",
+		args:  []interface{}{at},
+		match: func(film *Film) bool { return compared(op, filmTime(film, field).Compare(at)) },
+	}
+}
+
+// compared reports whether the result of comparing a film's value with a
+// query value, -1, 0, or +1, satisfies an SQL operator
+func compared(op string, result int) bool {
+	switch op {
+	case "=":
+		return result == 0
+	case "<>":
+		return result != 0
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	}
+	return false
+}
+
+// filmText returns the value of a text field of a film, empty when unset
+func filmText(film *Film, field string) string {
+	switch field {
+	case "title":
+		return film.Title
+	case "director":
+		return film.Director
+	case "genre":
+		return film.Genre
+	case "external_id":
+		if film.ExternalID != nil {
+			return *film.ExternalID
+		}
+	case "synopsis":
+		return film.Synopsis
+	case "language":
+		return film.Language
+	case "country":
+		return film.Country
+	case "age_rating":
+		return film.AgeRating
+	case "imdb_id":
+		return film.IMDbID
+	}
+	return ""
+}
+
+// filmNumber returns the value of a number field of a film
+func filmNumber(film *Film, field string) int {
+	switch field {
+	case "id":
+		return int(film.ID)
+	case "year":
+		return film.Year
+	case "runtime_minutes":
+		return film.RuntimeMinutes
+	case "version":
+		return film.Version
+	}
+	return 0
+}
+
+// filmTime returns the value of a timestamp field of a film
+func filmTime(film *Film, field string) time.Time {
+	if field == "updated_at" {
+		return film.UpdatedAt
+	}
+	return film.CreatedAt
+}
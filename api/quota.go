@@ -0,0 +1,182 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// defaultTenant is the slug of the organization users and films belong to until moved elsewhere
+const defaultTenant = "default"
+
+// quotaAlertRatio is the share of the limit at which admins are notified
+const quotaAlertRatio = 0.8
+
+// ErrQuotaExceeded is returned when a create would push a tenant past its plan limit
+var ErrQuotaExceeded = errors.New("film quota exceeded")
+
+// Plan describes the catalog limits of a hosting plan
+type Plan struct {
+	Name     string
+	MaxFilms int64 // 0 means unlimited
+}
+
+// plans lists the available hosting plans
+var plans = map[string]Plan{
+	"free":       {Name: "free", MaxFilms: 100},
+	"pro":        {Name: "pro", MaxFilms: 10000},
+	"enterprise": {Name: "enterprise", MaxFilms: 0},
+}
+
+// GetTenantPlan returns the plan of an organization, with its MaxFilms
+// overriding the limit. Organizations without a plan of their own get the
+// configured one, with CatalogMaxFilms overriding its limit.
+func GetTenantPlan(organization Organization, quota QuotaConfig) Plan {
+	name := organization.Plan
+	if name == "" {
+		name = quota.Plan
+	}
+	plan, exists := plans[name]
+	if !exists {
+		log.Printf("Warning: unknown plan %q for tenant %s, falling back to enterprise", name, organization.Slug)
+		plan = plans["enterprise"]
+	}
+	if organization.MaxFilms != nil {
+		plan.MaxFilms = *organization.MaxFilms
+	} else if quota.CatalogMaxFilms != nil && organization.Plan == "" {
+		plan.MaxFilms = *quota.CatalogMaxFilms
+	}
+	return plan
+}
+
+// tenantPlan looks up the plan of the organization a tenant acts for. The
+// plan is read on every check, so a changed plan applies without a new login.
+func tenantPlan(db *gorm.DB, tenant Tenant, quota QuotaConfig) (Plan, error) {
+	var organization Organization
+	if err := db.Session(&gorm.Session{NewDB: true}).First(&organization, tenant.OrganizationID).Error; err != nil {
+		return Plan{}, err
+	}
+	return GetTenantPlan(organization, quota), nil
+}
+
+// QuotaError carries the plan details for a rejected create
+type QuotaError struct {
+	Tenant  string
+	Plan    Plan
+	Current int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s plan allows %d films and tenant %s already has %d", e.Plan.Name, e.Plan.MaxFilms, e.Tenant, e.Current)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// CheckCatalogQuota verifies a tenant can add n films and returns the current
+// count and the plan it was checked against
+func CheckCatalogQuota(db *gorm.DB, tenant Tenant, quota QuotaConfig, n int64) (int64, Plan, error) {
+	plan, err := tenantPlan(db, tenant, quota)
+	if err != nil {
+		return 0, Plan{}, err
+	}
+	var count int64
+	if err := db.Model(&Film{}).Count(&count).Error; err != nil {
+		return 0, Plan{}, err
+	}
+	return count, plan, checkQuota(tenant.Slug, plan, count, n)
+}
+
+// checkQuota returns a QuotaError when a tenant holding count films can't add n more
+func checkQuota(tenant string, plan Plan, count, n int64) error {
+	if plan.MaxFilms > 0 && count+n > plan.MaxFilms {
+		return &QuotaError{Tenant: tenant, Plan: plan, Current: count}
+	}
+	return nil
+}
+
+// NotifyQuotaUsage alerts admins when a tenant crosses the alert threshold of its plan
+func NotifyQuotaUsage(alerts AlertsConfig, tenant string, plan Plan, before, after int64) {
+	if plan.MaxFilms == 0 {
+		return
+	}
+
+	threshold := int64(float64(plan.MaxFilms) * quotaAlertRatio)
+	if before < threshold && after >= threshold {
+		alertAdmins(alerts, fmt.Sprintf("Tenant %s is using %d of %d films allowed by the %s plan", tenant, after, plan.MaxFilms, plan.Name))
+	}
+}
+
+// ErrDailyQuotaExceeded is returned when a create would push a user past the
+// films they may create a day
+var ErrDailyQuotaExceeded = errors.New("daily film quota exceeded")
+
+// DailyQuotaError carries the usage of a user whose create was rejected
+type DailyQuotaError struct {
+	Limit      int64
+	Used       int64
+	ResetsAt   time.Time
+	RetryAfter time.Duration
+}
+
+func (e *DailyQuotaError) Error() string {
+	return fmt.Sprintf("%d of %d films already created today", e.Used, e.Limit)
+}
+
+func (e *DailyQuotaError) Unwrap() error {
+	return ErrDailyQuotaExceeded
+}
+
+// dailyFilmLimit returns how many films a user may create a day, 0 for no
+// limit. Admins and imports without a creator have none.
+func dailyFilmLimit(cfg *Config, user *User) int64 {
+	if user == nil || user.Role == "admin" {
+		return 0
+	}
+	return cfg.Quota.DailyFilms
+}
+
+// quotaDay returns when the quota day holding t started and when it resets.
+// Quota days are UTC days.
+func quotaDay(t time.Time) (time.Time, time.Time) {
+	start := t.UTC().Truncate(24 * time.Hour)
+	return start, start.Add(24 * time.Hour)
+}
+
+// checkDailyQuota returns a DailyQuotaError when a user can't create n more
+// films on the day of now. Nothing is counted for users without a limit.
+func checkDailyQuota(cfg *Config, films FilmRepository, user *User, n int64, now time.Time) error {
+	limit := dailyFilmLimit(cfg, user)
+	if limit == 0 {
+		return nil
+	}
+	start, reset := quotaDay(now)
+	used, err := films.CountCreatedSince(user.ID, start)
+	if err != nil {
+		return err
+	}
+	if used+n > limit {
+		return &DailyQuotaError{Limit: limit, Used: used, ResetsAt: reset, RetryAfter: reset.Sub(now)}
+	}
+	return nil
+}
+
+// DailyFilmUsage returns how much of their daily film limit a user used on
+// the day of now
+func DailyFilmUsage(cfg *Config, films FilmRepository, user *User, now time.Time) (*UsageLimit, error) {
+	start, reset := quotaDay(now)
+	used, err := films.CountCreatedSince(user.ID, start)
+	if err != nil {
+		return nil, err
+	}
+	usage := &UsageLimit{Limit: dailyFilmLimit(cfg, user), Used: used, ResetsAt: reset}
+	if usage.Limit > 0 {
+		remaining := max(usage.Limit-used, 0)
+		usage.Remaining = &remaining
+	}
+	return usage, nil
+}
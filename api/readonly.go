@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// readOnlyExempt are the mutating endpoints that keep working in read-only
+// mode: logins only touch the in-memory token store, and admins must be able
+// to switch the mode off again
+var readOnlyExempt = map[string]bool{
+	"/api/login":           true,
+	"/api/logout":          true,
+	"/api/admin/read-only": true,
+	// Admins may end maintenance while read-only
+	"/api/admin/maintenance": true,
+	// Looking films up only reads, it is a POST for long ID lists
+	"/api/films/lookup": true,
+}
+
+// isMutation reports whether a request method changes data
+func isMutation(method string) bool {
+	return method == "POST" || method == "PUT" || method == "PATCH" || method == "DELETE"
+}
+
+// rejectWritesWhenReadOnly answers mutations with 503 while the server is read-only
+func (s *Server) rejectWritesWhenReadOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.readOnly.Load() && isMutation(r.Method) && !readOnlyExempt[r.URL.Path] {
+			w.Header().Set("Retry-After", "300")
+			writeResponse(w, r, http.StatusServiceUnavailable, ErrorResponse{Error: "Server is in read-only mode", Code: "read_only"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readOnlyHandler shows or switches read-only mode (admin only)
+func (s *Server) readOnlyHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var modeReq ReadOnlyMode
+		if err := json.NewDecoder(r.Body).Decode(&modeReq); err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+			return
+		}
+		if s.readOnly.Swap(modeReq.ReadOnly) != modeReq.ReadOnly {
+			log.Printf("⚠️  Read-only mode %s by %s", map[bool]string{true: "enabled", false: "disabled"}[modeReq.ReadOnly], currentUsername(r))
+		}
+	default:
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReadOnlyMode{ReadOnly: s.readOnly.Load()})
+}
@@ -0,0 +1,67 @@
+package api
+
+import "time"
+
+// FilmRepository stores the film catalog. FilmService keeps it in the
+// database and MemoryFilmRepository in memory; the film handlers only use
+// this interface, so they run against either.
+type FilmRepository interface {
+	// ForTenant returns the repository of the films of one organization
+	ForTenant(tenant Tenant) FilmRepository
+	GetAllFilms(query *FilmQuery) ([]Film, error)
+	GetFilmsPage(query *FilmQuery, page, pageSize int) ([]Film, int64, error)
+	GetFilmsAfter(filter *FilmQuery, cursor *FilmCursor, order string, limit int) ([]Film, *FilmCursor, error)
+	GetFilmByID(id uint) (*Film, error)
+	// GetFilmsByIDs returns the films among ids that exist, in no particular order
+	GetFilmsByIDs(ids []uint) ([]Film, error)
+	FindConflict(filmReq FilmRequest, excludeID uint) (*Film, error)
+	CreateFilm(filmReq FilmRequest, creator *User) (*Film, error)
+	// CreateFilmAt creates a film under an ID the client chose, failing
+	// with "film id taken" if any film, deleted or of another organization,
+	// has it, and with a FilmIDRangeError if it is more than maxFilmIDGap
+	// past the highest ID
+	CreateFilmAt(id uint, filmReq FilmRequest, creator *User) (*Film, error)
+	CreateFilms(filmReqs []FilmRequest, creator *User) ([]Film, error)
+	UpdateFilm(id uint, filmReq FilmRequest, editor *User) (*Film, error)
+	DeleteFilm(id uint, editor *User) error
+	// SetPoster stores the blob key of the poster of a film the editor may
+	// change, "" to remove it, and returns the film and the key it replaced
+	SetPoster(id uint, key string, editor *User) (*Film, string, error)
+	// SetPosterSizes records the thumbnails stored for the poster under a
+	// key, reporting false if the film has no such poster anymore
+	SetPosterSizes(id uint, key string, sizes []string) (bool, error)
+	DeleteFilms(ids []uint, filter *FilmFilter, editor *User) (int64, error)
+	// GetChanges returns up to limit films changed after a sync position and
+	// no later than until, oldest change first, with tombstones of deleted films
+	GetChanges(after SyncCursor, until time.Time, limit int) ([]Film, error)
+	// GetRevisions returns the earlier versions of a film, newest first
+	GetRevisions(filmID uint) ([]FilmRevision, error)
+	// GetRevision returns an earlier version of a film
+	GetRevision(filmID uint, version int) (*FilmRevision, error)
+	// CountCreatedSince counts the films a user created since a time
+	CountCreatedSince(userID uint, since time.Time) (int64, error)
+}
+
+// UserRepository stores user accounts. UserService keeps them in the database
+// and MemoryUserRepository in memory. Operations reaching into the rest of
+// the database, like deleting or exporting an account, stay on UserService.
+type UserRepository interface {
+	GetUserByUsername(username string) (*User, error)
+	IsAdmin(username string) bool
+	ValidateUser(username, password string) (*User, bool)
+	// TenantOf returns the organization a user acts for
+	TenantOf(user *User) (Tenant, error)
+	CreateUser(username, password string) (*User, error)
+	SetRole(username, role string) error
+	SetPassword(username, password string) error
+	// SetActive and GetUsersPage only see the users of one organization
+	SetActive(organizationID uint, username string, active bool) (*User, error)
+	GetUsersPage(organizationID uint, search, role string, page, pageSize int) ([]User, int64, error)
+}
+
+var (
+	_ FilmRepository = (*FilmService)(nil)
+	_ FilmRepository = (*MemoryFilmRepository)(nil)
+	_ UserRepository = (*UserService)(nil)
+	_ UserRepository = (*MemoryUserRepository)(nil)
+)
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+// filmDataTables are the tables kept per film that POST /api/admin/reset
+// empties for the films it deletes
+var filmDataTables = []string{
+	"film_revisions",
+	"film_views",
+	"collection_films",
+	"film_list_items",
+	"loans",
+	"copies",
+	"screenings",
+}
+
+// ResetResult reports what a reset seeded
+// @Description Admin reset result
+type ResetResult struct {
+	Films int `json:"films" example:"10"`
+	Users int `json:"users" example:"2"`
+}
+
+// ResetDatabase deletes the films of one organization and seeds its catalog
+// again from the seed files of dir, in one transaction, so a reset that
+// fails leaves the catalog as it was. Other organizations are untouched. The
+// films go to the trash like any deleted film, so delta sync clients get a
+// tombstone for each, and the seeded films get new IDs. Users are kept; in
+// the default organization, which the seed users belong to, they get their
+// role back like on every seeding.
+func ResetDatabase(db *gorm.DB, tenant Tenant, dir string) (*ResetResult, error) {
+	data, err := LoadSeeds(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load seed files: %v", err)
+	}
+	films, err := data.ResolveFilms()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range data.Users {
+		if user.Username == "" || user.Password == "" {
+			return nil, errors.New("seed users need a username and a password")
+		}
+	}
+
+	var result ResetResult
+	err = WithTransaction(db, func(tx *gorm.DB) error {
+		for _, table := range filmDataTables {
+			if err := tx.Table(table).Scopes(tenantFilmScope(tenant.OrganizationID)).Delete(nil).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Scopes(tenantScope(tenant.OrganizationID)).Delete(&Film{}).Error; err != nil {
+			return err
+		}
+
+		for i := range films {
+			films[i].OrganizationID = tenant.OrganizationID
+		}
+		if len(films) > 0 {
+			if err := tx.Create(&films).Error; err != nil {
+				return fmt.Errorf("failed to seed films: %v", err)
+			}
+		}
+		result.Films = len(films)
+
+		organization, err := ensureDefaultOrganization(tx)
+		if err != nil {
+			return err
+		}
+		if organization.ID != tenant.OrganizationID {
+			return nil
+		}
+		result.Users = len(data.Users)
+		return seedUsers(tx, organization.ID, data.Users)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// resetHandler handles POST /api/admin/reset, putting the catalog of the
+// admin's organization back to the seed data for demos and workshops. It
+// deletes every film of the organization, so it only works where the operator
+// enabled it with ALLOW_RESET.
+func (s *Server) resetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+	if !s.cfg.Server.AllowReset {
+		writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Reset is disabled, set ALLOW_RESET to enable it", Code: "reset_disabled"})
+		return
+	}
+
+	var result *ResetResult
+	var err error
+	if films, ok := s.films.(*MemoryFilmRepository); ok {
+		result = &ResetResult{}
+		result.Films, result.Users, err = seedMemory(films, s.users.(*MemoryUserRepository), s.cfg.Storage.SeedsDir, true)
+	} else {
+		result, err = ResetDatabase(s.db, currentTenant(r), s.cfg.Storage.SeedsDir)
+	}
+	if err != nil {
+		log.Printf("Warning: Reset failed: %v", err)
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to reset", Code: "reset_failed"})
+		return
+	}
+	log.Printf("🌱 %s reset the catalog to %d seeded films", currentUsername(r), result.Films)
+	writeResponse(w, r, http.StatusOK, result)
+}
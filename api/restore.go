@@ -0,0 +1,438 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Import modes
+const (
+	ImportModeMerge   = "merge"
+	ImportModeReplace = "replace"
+)
+
+// restoreBatchSize is how many rows are inserted per statement
+const restoreBatchSize = 500
+
+// unusablePassword is stored for users restored without a password. Sign in
+// never accepts it, so the user has to reset the password first.
+const unusablePassword = "!"
+
+// backupReference is a column of a backup table holding a key of another
+// table
+type backupReference struct {
+	column string
+	table  string
+	key    string
+}
+
+// backupReferences lists the references checked when restoring each table
+var backupReferences = map[string][]backupReference{
+	"users":            {{"organization_id", "organizations", "id"}},
+	"films":            {{"organization_id", "organizations", "id"}, {"created_by", "users", "id"}},
+	"film_revisions":   {{"film_id", "films", "id"}, {"replaced_by", "users", "id"}},
+	"collection_films": {{"collection_id", "collections", "id"}, {"film_id", "films", "id"}},
+	"film_lists":       {{"owner", "users", "username"}},
+	"film_list_items":  {{"list_id", "film_lists", "id"}, {"film_id", "films", "id"}},
+	"copies":           {{"film_id", "films", "id"}},
+	"loans":            {{"copy_id", "copies", "id"}, {"film_id", "films", "id"}, {"borrower", "users", "username"}},
+	"screenings":       {{"film_id", "films", "id"}},
+	"film_views":       {{"film_id", "films", "id"}},
+}
+
+// ImportResult reports what a restore wrote
+// @Description Backup import result
+type ImportResult struct {
+	Mode   string           `json:"mode" example:"merge"`
+	Rows   int64            `json:"rows" example:"1234"`
+	Tables map[string]int64 `json:"tables"`
+}
+
+// invalidBackup reports a backup that can't be restored
+func invalidBackup(format string, args ...interface{}) error {
+	return errors.New("invalid backup: " + fmt.Sprintf(format, args...))
+}
+
+// backupRestorer writes the rows of a backup to the database, checking that
+// every reference points at a row of the backup or, when merging, at a row
+// already stored. It is the backupWriter the backup readers feed.
+type backupRestorer struct {
+	tx        *gorm.DB
+	mode      string
+	passwords bool
+	table     int
+	batch     []map[string]interface{}
+	keys      map[string]map[string]bool // by table.column
+	loaded    map[string]bool            // table.column keys loaded from the database
+	result    ImportResult
+}
+
+func (br *backupRestorer) Header(header BackupHeader) error {
+	if header.SchemaVersion != backupSchemaVersion {
+		return invalidBackup("schema version %d is not supported, expected %d", header.SchemaVersion, backupSchemaVersion)
+	}
+	br.passwords = header.Passwords
+	if br.mode != ImportModeReplace {
+		return nil
+	}
+	for i := len(backupTables) - 1; i >= 0; i-- {
+		if err := br.tx.Exec("DELETE FROM " + backupTables[i].name).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (br *backupRestorer) Row(table string, row map[string]interface{}) error {
+	if br.table < 0 || backupTables[br.table].name != table {
+		if err := br.flush(); err != nil {
+			return err
+		}
+		next := backupTableIndex(table)
+		if next < 0 {
+			return invalidBackup("unknown table %s", table)
+		}
+		if next < br.table {
+			return invalidBackup("table %s comes after tables referring to it", table)
+		}
+		br.table = next
+	}
+
+	for column, value := range row {
+		if number, ok := value.(json.Number); ok {
+			row[column] = jsonNumberValue(number)
+		}
+	}
+	for _, ref := range backupReferences[table] {
+		value, ok := row[ref.column]
+		if !ok || value == nil {
+			continue
+		}
+		known, err := br.known(ref.table, ref.key, fmt.Sprint(value))
+		if err != nil {
+			return err
+		}
+		if !known {
+			return invalidBackup("%s row %d: %s %v matches no %s", table, br.result.Tables[table]+int64(len(br.batch))+1, ref.column, value, ref.table)
+		}
+	}
+	for _, column := range backupTables[br.table].primaryKey {
+		if row[column] == nil {
+			return invalidBackup("%s row %d: %s is missing", table, br.result.Tables[table]+int64(len(br.batch))+1, column)
+		}
+	}
+	if table == "users" && (!br.passwords || row["password"] == nil) {
+		row["password"] = unusablePassword
+	}
+
+	for _, key := range []string{"id", "username"} {
+		if value, ok := row[key]; ok {
+			br.remember(table, key, fmt.Sprint(value))
+		}
+	}
+	br.batch = append(br.batch, row)
+	if len(br.batch) >= restoreBatchSize {
+		return br.flush()
+	}
+	return nil
+}
+
+func (br *backupRestorer) Close(rows int64) error {
+	if err := br.flush(); err != nil {
+		return err
+	}
+	if rows != br.result.Rows {
+		return invalidBackup("the trailer counts %d rows but the backup holds %d", rows, br.result.Rows)
+	}
+	// Rows keep their IDs, so new rows must be numbered after them
+	for _, table := range backupTables {
+		if len(table.primaryKey) != 1 || table.primaryKey[0] != "id" {
+			continue
+		}
+		err := br.tx.Exec(`SELECT setval(pg_get_serial_sequence(?, 'id'), coalesce(max(id), 0) + 1, false) FROM `+table.name, table.name).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush inserts the pending rows of the current table. Merging updates rows
+// with the same primary key, but keeps stored passwords the backup lacks.
+func (br *backupRestorer) flush() error {
+	if len(br.batch) == 0 {
+		return nil
+	}
+	table := backupTables[br.table]
+	query := br.tx.Table(table.name)
+	if br.mode == ImportModeMerge {
+		var columns []string
+		for column := range br.batch[0] {
+			if slices.Contains(table.primaryKey, column) || (column == "password" && !br.passwords) {
+				continue
+			}
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		conflict := clause.OnConflict{DoNothing: len(columns) == 0, DoUpdates: clause.AssignmentColumns(columns)}
+		for _, column := range table.primaryKey {
+			conflict.Columns = append(conflict.Columns, clause.Column{Name: column})
+		}
+		query = query.Clauses(conflict)
+	}
+	if err := query.Create(br.batch).Error; err != nil {
+		return err
+	}
+	br.result.Tables[table.name] += int64(len(br.batch))
+	br.result.Rows += int64(len(br.batch))
+	br.batch = nil
+	return nil
+}
+
+// remember records a key of a restored row for the references to it
+func (br *backupRestorer) remember(table, key, value string) {
+	name := table + "." + key
+	if br.keys[name] == nil {
+		br.keys[name] = make(map[string]bool)
+	}
+	br.keys[name][value] = true
+}
+
+// known reports whether a key was restored or, when merging, is stored.
+// Stored keys are loaded the first time a table is referred to.
+func (br *backupRestorer) known(table, key, value string) (bool, error) {
+	name := table + "." + key
+	if br.mode == ImportModeMerge && !br.loaded[name] {
+		var stored []string
+		if err := br.tx.Table(table).Pluck(key, &stored).Error; err != nil {
+			return false, err
+		}
+		br.loaded[name] = true
+		for _, s := range stored {
+			br.remember(table, key, s)
+		}
+	}
+	return br.keys[name][value], nil
+}
+
+// backupTableIndex returns the position of a table in backupTables, or -1
+func backupTableIndex(name string) int {
+	for i, table := range backupTables {
+		if table.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// jsonNumberValue converts a number of a backup to an integer when it is one
+func jsonNumberValue(number json.Number) interface{} {
+	if i, err := number.Int64(); err == nil {
+		return i
+	}
+	if f, err := number.Float64(); err == nil {
+		return f
+	}
+	return number.String()
+}
+
+// readJSONBackup feeds a backup in the JSON format to a backupWriter. The
+// rows are decoded one at a time, so the document never sits in memory
+// as a whole.
+func readJSONBackup(r io.Reader, bw backupWriter) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+
+	fields := make(map[string]json.RawMessage)
+	var rows int64
+	started := false
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return invalidBackup("%v", err)
+		}
+		key, _ := token.(string)
+		if key != "data" {
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return invalidBackup("%v", err)
+			}
+			fields[key] = value
+			continue
+		}
+
+		// The header fields come before the data
+		var header BackupHeader
+		encoded, _ := json.Marshal(fields)
+		if err := json.Unmarshal(encoded, &header); err != nil {
+			return invalidBackup("%v", err)
+		}
+		if err := bw.Header(header); err != nil {
+			return err
+		}
+		started = true
+
+		if err := expectDelim(decoder, '{'); err != nil {
+			return err
+		}
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return invalidBackup("%v", err)
+			}
+			table, _ := token.(string)
+			if err := expectDelim(decoder, '['); err != nil {
+				return err
+			}
+			for decoder.More() {
+				var row map[string]interface{}
+				if err := decoder.Decode(&row); err != nil {
+					return invalidBackup("%v", err)
+				}
+				if err := bw.Row(table, row); err != nil {
+					return err
+				}
+				rows++
+			}
+			if err := expectDelim(decoder, ']'); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(decoder, '}'); err != nil {
+			return err
+		}
+	}
+	if err := expectDelim(decoder, '}'); err != nil {
+		return err
+	}
+	if !started {
+		return invalidBackup("data is missing")
+	}
+	return bw.Close(rows)
+}
+
+// expectDelim reads a JSON delimiter of a backup
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return invalidBackup("%v", err)
+	}
+	if token != delim {
+		return invalidBackup("expected %v, found %v", delim, token)
+	}
+	return nil
+}
+
+// readNDJSONBackup feeds a backup in the NDJSON format to a backupWriter. A
+// backup without its trailer line was cut short and is rejected.
+func readNDJSONBackup(r io.Reader, bw backupWriter) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var header BackupHeader
+	if err := decoder.Decode(&header); err != nil {
+		return invalidBackup("%v", err)
+	}
+	if err := bw.Header(header); err != nil {
+		return err
+	}
+	for {
+		var line BackupLine
+		if err := decoder.Decode(&line); err != nil {
+			if errors.Is(err, io.EOF) {
+				return invalidBackup("the trailer line is missing, the backup was cut short")
+			}
+			return invalidBackup("%v", err)
+		}
+		if line.End {
+			return bw.Close(line.Rows)
+		}
+		if err := bw.Row(line.Table, line.Row); err != nil {
+			return err
+		}
+	}
+}
+
+// RestoreBackup writes a backup in one transaction, so a backup that fails
+// halfway changes nothing. Merging adds the rows and updates those with the
+// same primary key; replacing empties the backup tables first.
+func (es *ExportService) RestoreBackup(r io.Reader, ndjson bool, mode string) (*ImportResult, error) {
+	restorer := &backupRestorer{
+		mode:   mode,
+		table:  -1,
+		keys:   make(map[string]map[string]bool),
+		loaded: make(map[string]bool),
+		result: ImportResult{Mode: mode, Tables: make(map[string]int64)},
+	}
+	err := es.db.Transaction(func(tx *gorm.DB) error {
+		restorer.tx = tx
+		if ndjson {
+			return readNDJSONBackup(r, restorer)
+		}
+		return readJSONBackup(r, restorer)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &restorer.result, nil
+}
+
+// backupImportHandler handles POST /api/admin/import, restoring a backup
+// made by GET /api/admin/export
+func (s *Server) backupImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = ImportModeMerge
+	}
+	if mode != ImportModeMerge && mode != ImportModeReplace {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "mode must be merge or replace", Code: "import_mode_invalid"})
+		return
+	}
+
+	// Gzipped backups are NDJSON, as written by ?format=ndjson
+	body := bufio.NewReader(r.Body)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	ndjson := mediaType == "application/x-ndjson"
+	var reader io.Reader = body
+	if magic, _ := body.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid backup: " + err.Error(), Code: "backup_invalid", Params: Params{"detail": err}})
+			return
+		}
+		defer gz.Close()
+		reader, ndjson = gz, true
+	}
+
+	result, err := s.exportService.RestoreBackup(reader, ndjson, mode)
+	if err != nil {
+		if detail, ok := strings.CutPrefix(err.Error(), "invalid backup: "); ok {
+			writeResponse(w, r, http.StatusUnprocessableEntity, ErrorResponse{Error: "Invalid backup: " + detail, Code: "backup_invalid", Params: Params{"detail": detail}})
+		} else {
+			log.Printf("Warning: Backup import failed: %v", err)
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to restore backup", Code: "backup_restore_failed"})
+		}
+		return
+	}
+	writeResponse(w, r, http.StatusOK, result)
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// filmSnapshot returns a request that sets every field of a film an update
+// can change. The film is a copy, so later changes to the original don't
+// show through the pointers.
+func filmSnapshot(film Film) FilmRequest {
+	snapshot := FilmRequest{
+		Title:          film.Title,
+		Director:       film.Director,
+		Year:           film.Year,
+		Genre:          film.Genre,
+		RuntimeMinutes: &film.RuntimeMinutes,
+		Synopsis:       &film.Synopsis,
+		Language:       &film.Language,
+		Country:        &film.Country,
+		AgeRating:      &film.AgeRating,
+		IMDbID:         &film.IMDbID,
+		TrailerURL:     &film.TrailerURL,
+	}
+	if film.ExternalID != nil {
+		snapshot.ExternalID = *film.ExternalID
+	}
+	links := append([]ExternalLink{}, film.ExternalLinks...)
+	snapshot.ExternalLinks = &links
+	return snapshot
+}
+
+// newFilmRevision returns the revision keeping a film as it is before an
+// editor's update replaces it
+func newFilmRevision(film *Film, editor *User, now time.Time) FilmRevision {
+	return FilmRevision{
+		FilmID:     film.ID,
+		Version:    film.Version,
+		Film:       filmSnapshot(*film),
+		ReplacedBy: creatorID(editor),
+		ReplacedAt: now,
+	}
+}
+
+// GetRevisions returns the earlier versions of a film, newest first
+func (fs *FilmService) GetRevisions(filmID uint) ([]FilmRevision, error) {
+	var revisions []FilmRevision
+	err := fs.db.Session(&gorm.Session{NewDB: true}).
+		Where("film_id = ?", filmID).Order("version DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+// GetRevision returns an earlier version of a film
+func (fs *FilmService) GetRevision(filmID uint, version int) (*FilmRevision, error) {
+	var revision FilmRevision
+	err := fs.db.Session(&gorm.Session{NewDB: true}).
+		Where("film_id = ? AND version = ?", filmID, version).First(&revision).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("revision not found")
+		}
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// GetRevisions returns the earlier versions of a film, newest first
+func (m *MemoryFilmRepository) GetRevisions(filmID uint) ([]FilmRevision, error) {
+	m.table.mu.RLock()
+	defer m.table.mu.RUnlock()
+	stored := m.table.revisions[filmID]
+	revisions := make([]FilmRevision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		revisions = append(revisions, stored[i])
+	}
+	return revisions, nil
+}
+
+// GetRevision returns an earlier version of a film
+func (m *MemoryFilmRepository) GetRevision(filmID uint, version int) (*FilmRevision, error) {
+	m.table.mu.RLock()
+	defer m.table.mu.RUnlock()
+	for _, revision := range m.table.revisions[filmID] {
+		if revision.Version == version {
+			return &revision, nil
+		}
+	}
+	return nil, errors.New("revision not found")
+}
+
+// filmRevisionsHandler handles GET /api/films/{id}/revisions and
+// POST /api/films/{id}/revisions/{version}/revert
+func (s *Server) filmRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/films/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || id < 1 {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid film ID", Code: "invalid_film_id"})
+		return
+	}
+
+	switch {
+	case len(parts) == 2:
+		if r.Method != "GET" {
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+			return
+		}
+		s.listFilmRevisions(w, r, uint(id))
+	case len(parts) == 4 && parts[3] == "revert":
+		if r.Method != "POST" {
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+			return
+		}
+		version, err := strconv.Atoi(parts[2])
+		if err != nil || version < 1 {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid revision", Code: "revision_invalid"})
+			return
+		}
+		s.revertFilm(w, r, uint(id), version)
+	default:
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Not found", Code: "not_found"})
+	}
+}
+
+// listFilmRevisions answers with the earlier versions of a film, newest first
+func (s *Server) listFilmRevisions(w http.ResponseWriter, r *http.Request, id uint) {
+	films := s.tenantFilms(r)
+	if _, err := films.GetFilmByID(id); err != nil {
+		if err.Error() == "film not found" {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Film not found", Code: "film_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve film revisions", Code: "revisions_retrieve_failed"})
+		}
+		return
+	}
+
+	revisions, err := films.GetRevisions(id)
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve film revisions", Code: "revisions_retrieve_failed"})
+		return
+	}
+	if revisions == nil {
+		revisions = []FilmRevision{}
+	}
+	writeResponse(w, r, http.StatusOK, revisions)
+}
+
+// revertFilm writes an earlier version of a film over the current one. It is
+// an update like any other, so the version it replaces becomes a revision too
+// and the revert can be undone.
+func (s *Server) revertFilm(w http.ResponseWriter, r *http.Request, id uint, version int) {
+	films := s.tenantFilms(r)
+	current, err := films.GetFilmByID(id)
+	if err != nil {
+		if err.Error() == "film not found" {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Film not found", Code: "film_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update film", Code: "film_update_failed"})
+		}
+		return
+	}
+	revision, err := films.GetRevision(id, version)
+	if err != nil {
+		if err.Error() == "revision not found" {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Revision not found", Code: "revision_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update film", Code: "film_update_failed"})
+		}
+		return
+	}
+
+	// The rules may have changed since, so the old version must still be valid
+	filmReq := revision.Film
+	filmReq.Version = &current.Version
+	if validationErr := ValidateFilmRequest(&filmReq, s.currentConfig()); validationErr != nil {
+		writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: validationErr.Fields})
+		return
+	}
+
+	editor, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	updatedFilm, err := films.UpdateFilm(id, filmReq, editor)
+	if err != nil {
+		writeUpdateFilmError(w, r, err)
+		return
+	}
+
+	s.meteringService.RecordRequest(r, MeterWrite, 1)
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(updatedFilm.Version)))
+	writeResponse(w, r, http.StatusOK, withLinks(updatedFilm))
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// dumpRateLimit returns the limit of the routes dumping whole datasets, per
+// client, from the live configuration so a reload applies at once
+func (s *Server) dumpRateLimit() (int, time.Duration) {
+	quota := s.currentConfig().Quota
+	return quota.DumpRequests, quota.DumpWindow
+}
+
+// route declares a path, its handler, and the policy guarding it. A nil
+// policy leaves the route public.
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+	policy  Middleware
+}
+
+// routes returns the routing table. Policies with state, like rate limits,
+// are created anew for every call.
+func (s *Server) routes() []route {
+	authenticated := Middleware(s.requireAuth)
+	// account guards the user's own data: any token reads it, changing it
+	// takes account:write
+	account := Chain(authenticated, requireWriteScope(scopeAccountWrite))
+	films := Middleware(s.requireFilmScopes)
+	admin := Middleware(s.requireAdmin)
+	// deployment reaches into every organization, so an organization's own
+	// admins don't get it
+	deployment := Chain(admin, requireScope(scopeDeploymentAdmin))
+	// collections are shared by the organization: any token reads them,
+	// only admins change them
+	collections := Chain(authenticated, forWrites(s.adminOnly))
+	lending := Chain(account, s.requireFlag(FlagLending))
+	screenings := Chain(account, s.requireFlag(FlagScreenings))
+	passwordReset := s.requireFlag(FlagPasswordReset)
+
+	return []route{
+		{"/api/login", s.loginHandler, nil},
+		{"/api/logout", s.logoutHandler, nil},
+		{"/api/logout/all", s.logoutAllHandler, account},
+		{"/api/token/introspect", s.introspectHandler, authenticated},
+		{"/api/password-reset", s.passwordResetHandler, passwordReset},
+		{"/api/password-reset/confirm", s.passwordResetConfirmHandler, passwordReset},
+		{"/api/films", s.filmsHandler, films},
+		{"/api/films/", s.filmsHandler, films},
+		{"/api/films/stream", s.streamFilmsHandler, Chain(films, rateLimit(s.dumpRateLimit))},
+		{"/api/collections", s.collectionsHandler, collections},
+		{"/api/collections/", s.collectionsHandler, collections},
+		{"/api/lists", s.listsHandler, account},
+		{"/api/lists/", s.listsHandler, account},
+		{sharedListsPath, s.sharedListHandler, s.requireFlag(FlagSharedLists)},
+		{"/api/copies/", s.copiesHandler, lending},
+		{"/api/loans", s.loansHandler, lending},
+		{"/api/screenings", s.screeningsHandler, screenings},
+		{"/api/screenings/", s.screeningsHandler, screenings},
+		{"/api/usage", s.usageHandler, authenticated},
+		{"/api/me", s.meHandler, account},
+		{"/api/me/export", s.exportMeHandler, Chain(authenticated, rateLimit(s.dumpRateLimit))},
+		{"/api/me/limits", s.meLimitsHandler, authenticated},
+		{"/api/me/usage", s.meUsageHandler, authenticated},
+		{"/api/me/email/verify", s.verifyEmailHandler, account},
+		{"/api/me/sessions", s.sessionsHandler, account},
+		{"/api/me/sessions/", s.sessionsHandler, account},
+		{"/api/me/notifications", s.notificationsHandler, account},
+		{"/api/me/notifications/", s.notificationsHandler, account},
+		{"/api/rules", s.rulesHandler, admin},
+		{"/api/rules/", s.rulesHandler, admin},
+		{"/api/webhooks", s.webhooksHandler, admin},
+		{"/api/webhooks/", s.webhooksHandler, admin},
+		{"/api/exports", s.exportsHandler, admin},
+		{"/api/exports/", s.exportsHandler, admin},
+		{"/api/admin/stats", s.adminStatsHandler, admin},
+		{"/api/admin/users", s.adminUsersHandler, admin},
+		{"/api/admin/users/", s.adminUsersHandler, admin},
+		{"/api/admin/export", s.backupExportHandler, Chain(deployment, rateLimit(s.dumpRateLimit))},
+		{"/api/admin/import", s.backupImportHandler, Chain(deployment, rateLimit(s.dumpRateLimit))},
+		{"/api/admin/tokens/purge", s.purgeTokensHandler, deployment},
+		{"/api/admin/queue", s.queueMetricsHandler, admin},
+		{"/api/admin/metrics/history", s.metricsHistoryHandler, admin},
+		{"/api/admin/usage", s.adminUsageHandler, admin},
+		{"/api/admin/loans", s.adminLoansHandler, Chain(admin, s.requireFlag(FlagLending))},
+		{"/api/admin/read-only", s.readOnlyHandler, admin},
+		{"/api/admin/maintenance", s.maintenanceHandler, admin},
+		{"/api/admin/reset", s.resetHandler, admin},
+		{"/api/admin/jobs", s.jobsHandler, admin},
+		{"/api/admin/jobs/", s.jobsHandler, admin},
+		{"/api/admin/flags", s.flagsHandler, admin},
+		{"/api/admin/flags/", s.flagsHandler, admin},
+		{"/api/orgs", s.organizationsHandler, deployment},
+		{"/api/orgs/", s.organizationsHandler, deployment},
+		{"/swagger/", s.swaggerHandler, nil},
+		{"/swagger.yaml", s.swaggerHandler, nil},
+		{"/openapi.json", s.openAPIJSONHandler, nil},
+		{"/readyz", s.readyzHandler, nil},
+	}
+}
@@ -0,0 +1,395 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"gorm.io/gorm"
+)
+
+// Kinds of film rules
+const (
+	RuleKindValidate = "validate"
+	RuleKindEnrich   = "enrich"
+)
+
+// compiledRule is a stored rule with its compiled program
+type compiledRule struct {
+	rule    FilmRule
+	program *vm.Program
+}
+
+// RuleService stores admin-defined film rules and evaluates them
+type RuleService struct {
+	db    *gorm.DB
+	users UserRepository
+	mu    sync.RWMutex
+	rules []compiledRule
+}
+
+// NewRuleService creates a new rule service
+func NewRuleService(db *gorm.DB, users UserRepository) *RuleService {
+	return &RuleService{db: db, users: users}
+}
+
+// ruleEnv builds the variables available to rule expressions
+func ruleEnv(filmReq FilmRequest, action, username, role string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"title":    filmReq.Title,
+		"director": filmReq.Director,
+		"year":     filmReq.Year,
+		"genre":    filmReq.Genre,
+		"action":   action,
+		"username": username,
+		"role":     role,
+		"now": map[string]interface{}{
+			"year":  now.Year(),
+			"month": int(now.Month()),
+			"day":   now.Day(),
+		},
+	}
+}
+
+// compileRule compiles an expression for the given rule kind
+func compileRule(kind, expression string) (*vm.Program, error) {
+	env := ruleEnv(FilmRequest{}, "", "", "")
+	switch kind {
+	case RuleKindValidate:
+		return expr.Compile(expression, expr.Env(env), expr.AsBool())
+	case RuleKindEnrich:
+		return expr.Compile(expression, expr.Env(env))
+	default:
+		return nil, &CodedError{Code: "rule_kind_invalid", Message: "kind must be validate or enrich"}
+	}
+}
+
+// applyRule runs a compiled rule against a film payload. Enrich rules update
+// filmReq in place; validate rules return an error when they evaluate to false.
+func applyRule(program *vm.Program, kind string, filmReq *FilmRequest, env map[string]interface{}) (interface{}, error) {
+	result, err := expr.Run(program, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == RuleKindValidate {
+		if passed, _ := result.(bool); !passed {
+			return result, errRuleFailed
+		}
+		return result, nil
+	}
+
+	fields, ok := result.(map[string]interface{})
+	if !ok {
+		return result, errors.New("enrich rule must return a map of fields")
+	}
+	for field, value := range fields {
+		switch field {
+		case "title", "director", "genre":
+			text, ok := value.(string)
+			if !ok {
+				return result, fmt.Errorf("enrich rule returned a non-string %s", field)
+			}
+			switch field {
+			case "title":
+				filmReq.Title = text
+			case "director":
+				filmReq.Director = text
+			case "genre":
+				filmReq.Genre = text
+			}
+		case "year":
+			year, ok := value.(int)
+			if !ok {
+				return result, errors.New("enrich rule returned a non-integer year")
+			}
+			filmReq.Year = year
+		default:
+			return result, fmt.Errorf("enrich rule returned unknown field %s", field)
+		}
+	}
+	return result, nil
+}
+
+// errRuleFailed marks a validate rule that evaluated to false
+var errRuleFailed = errors.New("rule failed")
+
+// Reload recompiles the enabled rules from the database
+func (rs *RuleService) Reload() error {
+	var rules []FilmRule
+	if err := rs.db.Where("enabled = ?", true).Order("id").Find(&rules).Error; err != nil {
+		return err
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		program, err := compileRule(rule.Kind, rule.Expression)
+		if err != nil {
+			log.Printf("Warning: Skipping film rule %d (%s): %v", rule.ID, rule.Name, err)
+			continue
+		}
+		compiled = append(compiled, compiledRule{rule: rule, program: program})
+	}
+
+	rs.mu.Lock()
+	rs.rules = compiled
+	rs.mu.Unlock()
+	return nil
+}
+
+// Evaluate applies every enabled rule to a film payload
+func (rs *RuleService) Evaluate(hc HookContext, filmReq *FilmRequest) error {
+	rs.mu.RLock()
+	rules := rs.rules
+	rs.mu.RUnlock()
+	if len(rules) == 0 {
+		return nil
+	}
+
+	role := ""
+	if user, err := rs.users.GetUserByUsername(hc.Username); err == nil {
+		role = user.Role
+	}
+
+	for _, cr := range rules {
+		env := ruleEnv(*filmReq, hc.Action, hc.Username, role)
+		if _, err := applyRule(cr.program, cr.rule.Kind, filmReq, env); err != nil {
+			if errors.Is(err, errRuleFailed) && cr.rule.Message != "" {
+				return errors.New(cr.rule.Message)
+			}
+			return fmt.Errorf("rule %q: %v", cr.rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// Plugin exposes the rules as a pre-validate hook
+func (rs *RuleService) Plugin() Plugin {
+	return Plugin{
+		Name: "rules",
+		Films: FilmHooks{
+			PreValidate: rs.Evaluate,
+		},
+	}
+}
+
+// GetRules retrieves all rules
+func (rs *RuleService) GetRules() ([]FilmRule, error) {
+	var rules []FilmRule
+	err := rs.db.Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// CreateRule validates and stores a new rule
+func (rs *RuleService) CreateRule(ruleReq FilmRuleRequest) (*FilmRule, error) {
+	if _, err := compileRule(ruleReq.Kind, ruleReq.Expression); err != nil {
+		return nil, &RuleCompileError{Err: err}
+	}
+
+	rule := FilmRule{
+		Name:       ruleReq.Name,
+		Kind:       ruleReq.Kind,
+		Expression: ruleReq.Expression,
+		Message:    ruleReq.Message,
+		Enabled:    ruleReq.Enabled == nil || *ruleReq.Enabled,
+	}
+	if err := rs.db.Create(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, rs.Reload()
+}
+
+// UpdateRule validates and updates an existing rule
+func (rs *RuleService) UpdateRule(id uint, ruleReq FilmRuleRequest) (*FilmRule, error) {
+	if _, err := compileRule(ruleReq.Kind, ruleReq.Expression); err != nil {
+		return nil, &RuleCompileError{Err: err}
+	}
+
+	var rule FilmRule
+	if err := rs.db.First(&rule, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("rule not found")
+		}
+		return nil, err
+	}
+
+	rule.Name = ruleReq.Name
+	rule.Kind = ruleReq.Kind
+	rule.Expression = ruleReq.Expression
+	rule.Message = ruleReq.Message
+	if ruleReq.Enabled != nil {
+		rule.Enabled = *ruleReq.Enabled
+	}
+	if err := rs.db.Save(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, rs.Reload()
+}
+
+// DeleteRule removes a rule
+func (rs *RuleService) DeleteRule(id uint) error {
+	result := rs.db.Delete(&FilmRule{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("rule not found")
+	}
+	return rs.Reload()
+}
+
+// RuleCompileError is returned when a rule expression doesn't compile
+type RuleCompileError struct {
+	Err error
+}
+
+func (e *RuleCompileError) Error() string {
+	return "invalid expression: " + e.Err.Error()
+}
+
+func (e *RuleCompileError) ErrorCode() (string, Params) {
+	return "rule_expression_invalid", Params{"detail": e.Err}
+}
+
+// rulesHandler routes /api/rules endpoints (admin only)
+func (s *Server) rulesHandler(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	if path == "/api/rules" {
+		switch r.Method {
+		case "GET":
+			rules, err := s.ruleService.GetRules()
+			if err != nil {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve rules", Code: "rules_retrieve_failed"})
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rules)
+		case "POST":
+			s.saveRuleHandler(w, r, 0)
+		default:
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		}
+		return
+	}
+
+	if path == "/api/rules/test" {
+		if r.Method != "POST" {
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+			return
+		}
+		testRuleHandler(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(path, "/api/rules/"))
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid rule ID", Code: "invalid_rule_id"})
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		s.saveRuleHandler(w, r, uint(id))
+	case "DELETE":
+		if err := s.ruleService.DeleteRule(uint(id)); err != nil {
+			if err.Error() == "rule not found" {
+				writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Rule not found", Code: "rule_not_found"})
+			} else {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete rule", Code: "rule_delete_failed"})
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+	}
+}
+
+// saveRuleHandler creates a rule (id 0) or updates an existing one
+func (s *Server) saveRuleHandler(w http.ResponseWriter, r *http.Request, id uint) {
+	var ruleReq FilmRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&ruleReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+
+	if ruleReq.Kind == "" {
+		ruleReq.Kind = RuleKindValidate
+	}
+	if ruleReq.Name == "" || ruleReq.Expression == "" {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Name and expression are required", Code: "rule_fields_required"})
+		return
+	}
+
+	var rule *FilmRule
+	var err error
+	if id == 0 {
+		rule, err = s.ruleService.CreateRule(ruleReq)
+	} else {
+		rule, err = s.ruleService.UpdateRule(id, ruleReq)
+	}
+	if err != nil {
+		var compileErr *RuleCompileError
+		if errors.As(err, &compileErr) {
+			writeResponse(w, r, http.StatusBadRequest, errorResponse(compileErr))
+		} else if err.Error() == "rule not found" {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Rule not found", Code: "rule_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save rule", Code: "rule_save_failed"})
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if id == 0 {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(rule)
+}
+
+// testRuleHandler evaluates an expression against a sample film without storing it
+func testRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var testReq RuleTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&testReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+
+	if testReq.Kind == "" {
+		testReq.Kind = RuleKindValidate
+	}
+	if testReq.Action == "" {
+		testReq.Action = ActionCreate
+	}
+
+	program, err := compileRule(testReq.Kind, testReq.Expression)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "invalid expression: " + err.Error(), Code: "rule_expression_invalid", Params: Params{"detail": err}})
+		return
+	}
+
+	filmReq := testReq.Film
+	env := ruleEnv(filmReq, testReq.Action, currentUsername(r), testReq.Role)
+	result, err := applyRule(program, testReq.Kind, &filmReq, env)
+
+	response := RuleTestResponse{Passed: err == nil, Result: result}
+	if testReq.Kind == RuleKindEnrich {
+		response.Film = &filmReq
+	}
+	if err != nil && !errors.Is(err, errRuleFailed) {
+		response.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
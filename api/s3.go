@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3UnsignedPayload signs requests without hashing their body, so uploads
+// are streamed instead of read twice
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3BlobStore keeps blobs in a bucket of S3 or an S3-compatible service like
+// MinIO, signing requests with AWS Signature Version 4. Downloads go
+// straight from the bucket to clients through presigned URLs.
+type S3BlobStore struct {
+	cfg    S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3BlobStore creates a blob store on a bucket
+func NewS3BlobStore(cfg S3Config) *S3BlobStore {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	return &S3BlobStore{cfg: cfg, client: &http.Client{Timeout: time.Minute}, now: time.Now}
+}
+
+// objectURL returns the URL of the object of a key: endpoint/bucket/key with
+// path-style addressing, as MinIO needs, or bucket.endpoint/key
+func (ss *S3BlobStore) objectURL(key string) (*url.URL, error) {
+	if !validBlobKey(key) {
+		return nil, fmt.Errorf("invalid blob key %q", key)
+	}
+	endpoint, err := url.Parse(ss.cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %v", err)
+	}
+	objectPath := "/" + key
+	if ss.cfg.PathStyle {
+		objectPath = "/" + ss.cfg.Bucket + objectPath
+	} else {
+		endpoint.Host = ss.cfg.Bucket + "." + endpoint.Host
+	}
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + objectPath
+	return endpoint, nil
+}
+
+// s3Escape percent-encodes everything but the unreserved characters of RFC
+// 3986, as signatures expect; slashes are kept when encoding paths
+func s3Escape(value string, path bool) string {
+	var escaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' || path && c == '/' {
+			escaped.WriteByte(c)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+// canonicalQuery encodes query parameters sorted by name, as signatures expect
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(name, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signature computes the Signature Version 4 signature of a request:
+// headers are the signed headers, by lowercase name, and scope the
+// credential scope of the day of now
+func (ss *S3BlobStore) signature(method string, target *url.URL, headers map[string]string, payload string, now time.Time) (signedHeaders, signature string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders = strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		s3Escape(target.Path, true),
+		canonicalQuery(target.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payload,
+	}, "\n")
+	hashedRequest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		ss.scope(now),
+		hex.EncodeToString(hashedRequest[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+ss.cfg.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, ss.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// scope returns the credential scope of signatures made on the day of now
+func (ss *S3BlobStore) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + ss.cfg.Region + "/s3/aws4_request"
+}
+
+// do sends a signed request for the object of a key
+func (ss *S3BlobStore) do(ctx context.Context, method, key string, body io.Reader, size int64) (*http.Response, error) {
+	target, err := ss.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	now := ss.now().UTC()
+	headers := map[string]string{
+		"host":                 target.Host,
+		"x-amz-content-sha256": s3UnsignedPayload,
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+	if body != nil {
+		req.ContentLength = size
+		headers["content-type"] = blobContentType(key)
+	}
+	signedHeaders, signature := ss.signature(method, target, headers, s3UnsignedPayload, now)
+	for name, value := range headers {
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		ss.cfg.AccessKeyID, ss.scope(now), signedHeaders, signature))
+	return ss.client.Do(req)
+}
+
+// s3Error turns an unexpected response into an error, with the start of the
+// XML error document S3 sends
+func s3Error(method, key string, resp *http.Response) error {
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("S3 %s %s: %s: %s", method, key, resp.Status, strings.TrimSpace(string(detail)))
+}
+
+// Put uploads a blob with a single PUT; blobs are small enough, like
+// posters, not to need multipart uploads
+func (ss *S3BlobStore) Put(ctx context.Context, key string, body io.Reader, size int64) error {
+	resp, err := ss.do(ctx, "PUT", key, body, size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("PUT", key, resp)
+	}
+	return nil
+}
+
+// Get downloads a blob
+func (ss *S3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	resp, err := ss.do(ctx, "GET", key, nil, 0)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, BlobInfo{}, errBlobNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, BlobInfo{}, s3Error("GET", key, resp)
+	}
+	info := BlobInfo{ContentType: resp.Header.Get("Content-Type"), Size: resp.ContentLength}
+	if info.ContentType == "" {
+		info.ContentType = blobContentType(key)
+	}
+	return resp.Body, info, nil
+}
+
+// Delete removes a blob; S3 answers 204 whether or not it existed
+func (ss *S3BlobStore) Delete(ctx context.Context, key string) error {
+	resp, err := ss.do(ctx, "DELETE", key, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error("DELETE", key, resp)
+	}
+	return nil
+}
+
+// PresignGet returns a URL that downloads a blob without credentials until
+// ttl passes, signed in its query string. Signing is local, so the URL is
+// handed out without asking the bucket whether the blob exists.
+func (ss *S3BlobStore) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	target, err := ss.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	now := ss.now().UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", ss.cfg.AccessKeyID+"/"+ss.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	target.RawQuery = canonicalQuery(query)
+
+	_, signature := ss.signature("GET", target, map[string]string{"host": target.Host}, s3UnsignedPayload, now)
+	target.RawQuery += "&X-Amz-Signature=" + signature
+	return target.String(), nil
+}
@@ -0,0 +1,456 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// schedulerTick is how often the scheduler looks for due jobs
+const schedulerTick = 30 * time.Second
+
+// JobFunc is the work done by a scheduled job. It must return soon after ctx
+// is done, which happens when the job times out or is cancelled.
+type JobFunc func(ctx context.Context) error
+
+// registeredJob is a job known to this process
+type registeredJob struct {
+	description     string
+	defaultCron     string
+	defaultTimeout  time.Duration
+	defaultPriority Priority
+	run             JobFunc
+	running         bool
+	cancel          context.CancelFunc
+}
+
+// Scheduler queues registered jobs on the worker pool following cron schedules
+// stored in the database, so admins can pause, trigger, and reschedule them at runtime
+type Scheduler struct {
+	db       *gorm.DB
+	pool     *WorkerPool
+	config   *liveConfig
+	readOnly *atomic.Bool
+	mu       sync.Mutex
+	jobs     map[string]*registeredJob
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewScheduler creates a new scheduler running jobs on a worker pool with the
+// schedules of config. Nothing runs while readOnly is set.
+func NewScheduler(db *gorm.DB, pool *WorkerPool, config *liveConfig, readOnly *atomic.Bool) *Scheduler {
+	return &Scheduler{db: db, pool: pool, config: config, readOnly: readOnly, jobs: make(map[string]*registeredJob)}
+}
+
+// parseCron parses a standard five-field cron expression or a descriptor like @hourly
+func parseCron(expr string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, &CodedError{Code: "job_cron_invalid", Params: Params{"detail": err}, Message: "invalid cron expression: " + err.Error()}
+	}
+	return schedule, nil
+}
+
+// nextRun returns the next time a cron expression fires after from
+func nextRun(expr string, from time.Time) (*time.Time, error) {
+	schedule, err := parseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	next := schedule.Next(from).UTC()
+	return &next, nil
+}
+
+// Register adds a job. The default schedule, timeout, and priority are only used
+// the first time the job is stored; a zero timeout lets the job run until it returns.
+// A schedule in the jobs config replaces the stored one at every start.
+func (s *Scheduler) Register(name, description, defaultCron string, defaultTimeout time.Duration, defaultPriority Priority, run JobFunc) {
+	if _, err := parseCron(defaultCron); err != nil {
+		log.Fatalf("Invalid default schedule for job %s: %v", name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[name] = &registeredJob{
+		description:     description,
+		defaultCron:     defaultCron,
+		defaultTimeout:  defaultTimeout,
+		defaultPriority: defaultPriority,
+		run:             run,
+	}
+}
+
+// Start stores missing jobs and runs due jobs in the background
+func (s *Scheduler) Start() error {
+	now := time.Now().UTC()
+	schedules := s.config.Load().Jobs.Schedules
+	for name := range schedules {
+		if _, ok := s.jobs[name]; !ok {
+			log.Printf("Warning: Ignoring the configured schedule of unknown job %s", name)
+		}
+	}
+
+	for name, job := range s.jobs {
+		configured, hasSchedule := schedules[name]
+		var stored ScheduledJob
+		err := s.db.Where("name = ?", name).First(&stored).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			cronExpr := job.defaultCron
+			if hasSchedule {
+				cronExpr = configured
+			}
+			next, _ := nextRun(cronExpr, now)
+			stored = ScheduledJob{
+				Name:           name,
+				Description:    job.description,
+				Cron:           cronExpr,
+				TimeoutSeconds: int(job.defaultTimeout / time.Second),
+				Priority:       job.defaultPriority.String(),
+				NextRunAt:      next,
+			}
+			if err := s.db.Create(&stored).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// Keep descriptions current and recompute schedules missed while the server was down
+		updates := map[string]interface{}{"description": job.description}
+		if hasSchedule && configured != stored.Cron {
+			updates["cron"] = configured
+			stored.Cron = configured
+			stored.NextRunAt = nil
+		}
+		if !stored.Paused && (stored.NextRunAt == nil || stored.NextRunAt.Before(now)) {
+			next, err := nextRun(stored.Cron, now)
+			if err != nil {
+				log.Printf("Warning: Job %s has an invalid schedule: %v", name, err)
+			} else {
+				updates["next_run_at"] = next
+			}
+		}
+		if err := s.db.Model(&stored).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	s.stop, s.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.runDue(time.Now().UTC())
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops running due jobs and cancels the jobs still running. It does
+// nothing when the scheduler never started.
+func (s *Scheduler) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.cancel != nil {
+			job.cancel()
+		}
+	}
+}
+
+// runDue starts every active job whose next run has passed. Nothing runs in
+// read-only mode, since jobs write to the database.
+func (s *Scheduler) runDue(now time.Time) {
+	if s.readOnly.Load() {
+		return
+	}
+	var due []ScheduledJob
+	if err := s.db.Where("paused = ? AND next_run_at <= ?", false, now).Find(&due).Error; err != nil {
+		log.Printf("Warning: Failed to load due jobs: %v", err)
+		return
+	}
+	for _, stored := range due {
+		next, err := nextRun(stored.Cron, now)
+		if err != nil {
+			log.Printf("Warning: Job %s has an invalid schedule: %v", stored.Name, err)
+			continue
+		}
+		if err := s.db.Model(&stored).Update("next_run_at", next).Error; err != nil {
+			log.Printf("Warning: Failed to reschedule job %s: %v", stored.Name, err)
+			continue
+		}
+		if err := s.start(stored); errors.Is(err, ErrQueueSaturated) {
+			log.Printf("Warning: Skipped run of job %s: %v", stored.Name, err)
+		}
+	}
+}
+
+// start queues a job on the worker pool unless it is unknown or already queued or running
+func (s *Scheduler) start(stored ScheduledJob) error {
+	name := stored.Name
+	// Cancelling works while the job waits in the queue, the timeout only counts once it runs
+	queueCtx, cancel := context.WithCancel(context.Background())
+
+	s.mu.Lock()
+	job, exists := s.jobs[name]
+	if !exists {
+		s.mu.Unlock()
+		cancel()
+		return errors.New("job not found")
+	}
+	if job.running {
+		s.mu.Unlock()
+		cancel()
+		return errors.New("job already running")
+	}
+	job.running = true
+	job.cancel = cancel
+	s.mu.Unlock()
+
+	priority, err := parsePriority(stored.Priority)
+	if err != nil {
+		priority = job.defaultPriority
+	}
+	err = s.pool.Submit(name, priority, func() {
+		ctx, stop := queueCtx, context.CancelFunc(func() {})
+		if stored.TimeoutSeconds > 0 {
+			ctx, stop = context.WithTimeout(queueCtx, time.Duration(stored.TimeoutSeconds)*time.Second)
+		}
+		defer stop()
+
+		started := time.Now().UTC()
+		err := job.run(ctx)
+		// Report why the context ended rather than the error it caused inside the job
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			err = fmt.Errorf("timed out after %ds", stored.TimeoutSeconds)
+		case errors.Is(ctx.Err(), context.Canceled) && err != nil:
+			err = errors.New("cancelled")
+		}
+		cancel()
+		lastError := ""
+		if err != nil {
+			lastError = err.Error()
+			log.Printf("Warning: Job %s failed: %v", name, err)
+		}
+
+		s.mu.Lock()
+		job.running = false
+		job.cancel = nil
+		s.mu.Unlock()
+
+		s.db.Model(&ScheduledJob{}).Where("name = ?", name).Updates(map[string]interface{}{
+			"last_run_at":      started,
+			"last_duration_ms": time.Since(started).Milliseconds(),
+			"last_error":       lastError,
+		})
+	})
+	if err != nil {
+		cancel()
+		s.mu.Lock()
+		job.running = false
+		job.cancel = nil
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// withRunning fills in the running flag of stored jobs
+func (s *Scheduler) withRunning(jobs []ScheduledJob) []ScheduledJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range jobs {
+		if job, exists := s.jobs[jobs[i].Name]; exists {
+			jobs[i].Running = job.running
+		}
+	}
+	return jobs
+}
+
+// GetJobs retrieves all scheduled jobs
+func (s *Scheduler) GetJobs() ([]ScheduledJob, error) {
+	var jobs []ScheduledJob
+	if err := s.db.Order("name").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return s.withRunning(jobs), nil
+}
+
+// GetJob retrieves a scheduled job by name
+func (s *Scheduler) GetJob(name string) (*ScheduledJob, error) {
+	var job ScheduledJob
+	err := s.db.Where("name = ?", name).First(&job).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("job not found")
+		}
+		return nil, err
+	}
+	job = s.withRunning([]ScheduledJob{job})[0]
+	return &job, nil
+}
+
+// UpdateJob changes the schedule of a job and pauses or resumes it
+func (s *Scheduler) UpdateJob(name string, jobReq ScheduledJobRequest) (*ScheduledJob, error) {
+	job, err := s.GetJob(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if jobReq.Cron != nil {
+		if _, err := parseCron(*jobReq.Cron); err != nil {
+			return nil, err
+		}
+		job.Cron = *jobReq.Cron
+	}
+	if jobReq.TimeoutSeconds != nil {
+		if *jobReq.TimeoutSeconds < 0 {
+			return nil, &CodedError{Code: "job_timeout_negative", Message: "timeout_seconds must not be negative"}
+		}
+		job.TimeoutSeconds = *jobReq.TimeoutSeconds
+	}
+	if jobReq.Priority != nil {
+		if _, err := parsePriority(*jobReq.Priority); err != nil {
+			return nil, err
+		}
+		job.Priority = *jobReq.Priority
+	}
+	if jobReq.Paused != nil {
+		job.Paused = *jobReq.Paused
+	}
+
+	// Paused jobs have no next run, resumed or rescheduled jobs start counting from now
+	job.NextRunAt = nil
+	if !job.Paused {
+		job.NextRunAt, _ = nextRun(job.Cron, time.Now().UTC())
+	}
+
+	err = s.db.Model(job).Select("cron", "timeout_seconds", "priority", "paused", "next_run_at", "updated_at").Updates(job).Error
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// TriggerJob runs a job now, even when it is paused
+func (s *Scheduler) TriggerJob(name string) error {
+	job, err := s.GetJob(name)
+	if err != nil {
+		return err
+	}
+	return s.start(*job)
+}
+
+// CancelJob asks a running job to stop. The job stops once it notices its context is done.
+func (s *Scheduler) CancelJob(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, exists := s.jobs[name]
+	if !exists {
+		return errors.New("job not found")
+	}
+	if !job.running {
+		return errors.New("job not running")
+	}
+	job.cancel()
+	return nil
+}
+
+// jobsHandler routes /api/admin/jobs endpoints (admin only)
+func (s *Server) jobsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/jobs"), "/")
+
+	if path == "" {
+		if r.Method != "GET" {
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+			return
+		}
+		jobs, err := s.scheduler.GetJobs()
+		if err != nil {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve jobs", Code: "jobs_retrieve_failed"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jobs)
+		return
+	}
+
+	// /api/admin/jobs/{name}, /api/admin/jobs/{name}/run, or /api/admin/jobs/{name}/cancel
+	name, action, _ := strings.Cut(path, "/")
+	var job *ScheduledJob
+	var err error
+	switch {
+	case action == "" && r.Method == "GET":
+		job, err = s.scheduler.GetJob(name)
+	case action == "" && r.Method == "PUT":
+		var jobReq ScheduledJobRequest
+		if err := json.NewDecoder(r.Body).Decode(&jobReq); err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+			return
+		}
+		job, err = s.scheduler.UpdateJob(name, jobReq)
+	case action == "run" && r.Method == "POST":
+		if err = s.scheduler.TriggerJob(name); err == nil {
+			job, err = s.scheduler.GetJob(name)
+		}
+	case action == "cancel" && r.Method == "POST":
+		if err = s.scheduler.CancelJob(name); err == nil {
+			job, err = s.scheduler.GetJob(name)
+		}
+	case action == "" || action == "run" || action == "cancel":
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	default:
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Not found", Code: "not_found"})
+		return
+	}
+
+	if err != nil {
+		if err.Error() == "job not found" {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Job not found", Code: "job_not_found"})
+		} else if err.Error() == "job already running" {
+			writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "Job already running", Code: "job_already_running"})
+		} else if errors.Is(err, ErrQueueSaturated) {
+			w.Header().Set("Retry-After", "30")
+			writeResponse(w, r, http.StatusTooManyRequests, ErrorResponse{Error: "Job queue is full, try again later", Code: "job_queue_full"})
+		} else if err.Error() == "job not running" {
+			writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "Job not running", Code: "job_not_running"})
+		} else if strings.HasPrefix(err.Error(), "invalid cron expression") || strings.HasPrefix(err.Error(), "timeout_seconds") || strings.HasPrefix(err.Error(), "invalid priority") {
+			writeResponse(w, r, http.StatusBadRequest, errorResponse(err))
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update job", Code: "job_update_failed"})
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if action == "run" || action == "cancel" {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	json.NewEncoder(w).Encode(job)
+}
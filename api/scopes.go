@@ -0,0 +1,100 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Token scopes, each granting access to a group of routes
+const (
+	scopeFilmsRead    = "films:read"
+	scopeFilmsWrite   = "films:write"
+	scopeAccountWrite = "account:write"
+	scopeUsersAdmin   = "users:admin"
+	// scopeDeploymentAdmin reaches across organizations, like backups and
+	// managing the organizations themselves
+	scopeDeploymentAdmin = "deployment:admin"
+)
+
+// knownScopes lists every scope a token can carry
+var knownScopes = []string{scopeFilmsRead, scopeFilmsWrite, scopeAccountWrite, scopeUsersAdmin, scopeDeploymentAdmin}
+
+const scopesContextKey contextKey = "scopes"
+
+// grantScopes returns the scopes of a token issued to user, acting for
+// tenant, for the requested scopes. Requesting none grants every scope the
+// user may hold; users:admin is held by admins only, and deployment:admin by
+// the admins of the default organization, which runs the deployment.
+func grantScopes(user *User, tenant Tenant, requested []string) ([]string, error) {
+	allowed := make([]string, 0, len(knownScopes))
+	for _, scope := range knownScopes {
+		if scope == scopeUsersAdmin && user.Role != "admin" {
+			continue
+		}
+		if scope == scopeDeploymentAdmin && (user.Role != "admin" || tenant.Slug != defaultTenant) {
+			continue
+		}
+		allowed = append(allowed, scope)
+	}
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+
+	granted := make([]string, 0, len(requested))
+	for _, scope := range requested {
+		if !containsScope(knownScopes, scope) {
+			return nil, errors.New("unknown scope")
+		}
+		if !containsScope(allowed, scope) {
+			return nil, errors.New("scope not allowed")
+		}
+		if !containsScope(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	return granted, nil
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// currentScopes returns the scopes of the token of a request
+func currentScopes(r *http.Request) []string {
+	scopes, _ := r.Context().Value(scopesContextKey).([]string)
+	return scopes
+}
+
+// hasScope reports whether the token of a request carries a scope
+func hasScope(r *http.Request, scope string) bool {
+	return containsScope(currentScopes(r), scope)
+}
+
+// writeMissingScope answers a request whose token lacks a scope
+func writeMissingScope(w http.ResponseWriter, r *http.Request, scope string) {
+	writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Token lacks the " + scope + " scope", Code: "scope_missing", Params: Params{"scope": scope}})
+}
+
+// requireFilmScopes requires films:read for reads and films:write for
+// every other method. A lookup only reads, though it is a POST.
+func (s *Server) requireFilmScopes(next http.HandlerFunc) http.HandlerFunc {
+	read, write := requireScope(scopeFilmsRead)(next), requireScope(scopeFilmsWrite)(next)
+	return s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" || r.Method == "HEAD" || r.URL.Path == "/api/films/lookup" {
+			read(w, r)
+		} else {
+			write(w, r)
+		}
+	})
+}
+
+// requireWriteScope requires a scope for every method but GET and HEAD, for
+// routes whose reads any valid token may make
+func requireWriteScope(scope string) Middleware {
+	return forWrites(requireScope(scope))
+}
@@ -0,0 +1,359 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// Screening validation limits
+const (
+	maxVenueLength        = 100
+	maxScreeningCapacity  = 100000
+	defaultScreeningRange = 7 * 24 * time.Hour
+)
+
+// ScreeningService handles the screening schedule
+type ScreeningService struct {
+	db         *gorm.DB
+	films      func(*gorm.DB) *gorm.DB
+	screenings func(*gorm.DB) *gorm.DB
+}
+
+// NewScreeningService creates a new screening service for films of every
+// organization
+func NewScreeningService(db *gorm.DB) *ScreeningService {
+	return &ScreeningService{db: db, films: anyTenant, screenings: anyTenant}
+}
+
+// ForTenant returns a screening service that only schedules and shows the
+// films of one organization
+func (ss *ScreeningService) ForTenant(tenant Tenant) *ScreeningService {
+	return &ScreeningService{
+		db:         ss.db,
+		films:      tenantScope(tenant.OrganizationID),
+		screenings: tenantFilmScope(tenant.OrganizationID),
+	}
+}
+
+// ScreeningConflictError reports a screening that overlaps another at the same venue
+type ScreeningConflictError struct {
+	ID       uint
+	Venue    string
+	StartsAt time.Time
+}
+
+func (e *ScreeningConflictError) Error() string {
+	return fmt.Sprintf("Overlaps screening %d at %s starting %s", e.ID, e.Venue, e.StartsAt.UTC().Format(time.RFC3339))
+}
+
+func (e *ScreeningConflictError) ErrorCode() (string, Params) {
+	return "screening_conflict", Params{"id": e.ID, "venue": e.Venue, "starts_at": e.StartsAt.UTC().Format(time.RFC3339)}
+}
+
+// ValidateScreeningRequest trims a screening payload in place and checks it.
+// It returns nil when the screening is valid.
+func ValidateScreeningRequest(screeningReq *ScreeningRequest) *ValidationError {
+	screeningReq.Venue = strings.TrimSpace(screeningReq.Venue)
+
+	var fields []FieldError
+	if screeningReq.FilmID == 0 {
+		fields = append(fields, FieldError{Field: "film_id", Message: "is required", Code: "field_required"})
+	}
+
+	if screeningReq.Venue == "" {
+		fields = append(fields, FieldError{Field: "venue", Message: "is required", Code: "field_required"})
+	} else if utf8.RuneCountInString(screeningReq.Venue) > maxVenueLength {
+		fields = append(fields, FieldError{Field: "venue", Message: fmt.Sprintf("must be at most %d characters", maxVenueLength), Code: "field_too_long", Params: Params{"max": maxVenueLength}})
+	}
+
+	if screeningReq.StartsAt.IsZero() {
+		fields = append(fields, FieldError{Field: "starts_at", Message: "is required", Code: "field_required"})
+	}
+	if screeningReq.EndsAt.IsZero() {
+		fields = append(fields, FieldError{Field: "ends_at", Message: "is required", Code: "field_required"})
+	} else if !screeningReq.StartsAt.IsZero() && !screeningReq.EndsAt.After(screeningReq.StartsAt) {
+		fields = append(fields, FieldError{Field: "ends_at", Message: "must be after starts_at", Code: "field_not_after", Params: Params{"field": "starts_at"}})
+	}
+
+	if screeningReq.Capacity < 1 || screeningReq.Capacity > maxScreeningCapacity {
+		fields = append(fields, FieldError{Field: "capacity", Message: fmt.Sprintf("must be between 1 and %d", maxScreeningCapacity), Code: "field_out_of_range", Params: Params{"min": 1, "max": maxScreeningCapacity}})
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// GetScreenings retrieves the screenings running at any time between from
+// and to, earliest first
+func (ss *ScreeningService) GetScreenings(from, to time.Time) ([]Screening, error) {
+	var screenings []Screening
+	err := ss.db.Scopes(ss.screenings).Where("starts_at < ? AND ends_at > ?", to, from).
+		Order("starts_at, venue, id").
+		Find(&screenings).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := ss.attachFilms(screenings); err != nil {
+		return nil, err
+	}
+	return screenings, nil
+}
+
+// GetScreeningByID retrieves a screening by ID
+func (ss *ScreeningService) GetScreeningByID(id uint) (*Screening, error) {
+	var screening Screening
+	if err := ss.db.Scopes(ss.screenings).First(&screening, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("screening not found")
+		}
+		return nil, err
+	}
+	screenings := []Screening{screening}
+	if err := ss.attachFilms(screenings); err != nil {
+		return nil, err
+	}
+	return &screenings[0], nil
+}
+
+// attachFilms embeds the film shown at each screening
+func (ss *ScreeningService) attachFilms(screenings []Screening) error {
+	if len(screenings) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(screenings))
+	for i, screening := range screenings {
+		ids[i] = screening.FilmID
+	}
+	var films []Film
+	if err := ss.db.Unscoped().Where("id IN ?", ids).Find(&films).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]*Film, len(films))
+	for i := range films {
+		byID[films[i].ID] = withLinks(&films[i])
+	}
+	for i := range screenings {
+		screenings[i].Film = byID[screenings[i].FilmID]
+	}
+	return nil
+}
+
+// SaveScreening creates a screening (id 0) or replaces an existing one,
+// refusing one that overlaps another screening at the same venue
+func (ss *ScreeningService) SaveScreening(id uint, screeningReq ScreeningRequest) (*Screening, error) {
+	var screening Screening
+	err := ss.db.Transaction(func(tx *gorm.DB) error {
+		if id != 0 {
+			if err := tx.Scopes(ss.screenings).First(&screening, id).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return errors.New("screening not found")
+				}
+				return err
+			}
+		}
+
+		var films int64
+		if err := tx.Model(&Film{}).Scopes(ss.films).Where("id = ?", screeningReq.FilmID).Count(&films).Error; err != nil {
+			return err
+		}
+		if films == 0 {
+			return &ValidationError{Fields: []FieldError{{Field: "film_id", Message: fmt.Sprintf("film %d does not exist", screeningReq.FilmID), Code: "field_film_missing", Params: Params{"id": screeningReq.FilmID}}}}
+		}
+
+		var overlapping Screening
+		err := tx.Scopes(ss.screenings).Where("lower(venue) = lower(?) AND starts_at < ? AND ends_at > ? AND id <> ?",
+			screeningReq.Venue, screeningReq.EndsAt, screeningReq.StartsAt, id).
+			Order("starts_at").
+			First(&overlapping).Error
+		if err == nil {
+			return &ScreeningConflictError{ID: overlapping.ID, Venue: overlapping.Venue, StartsAt: overlapping.StartsAt}
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		screening.FilmID = screeningReq.FilmID
+		screening.Venue = screeningReq.Venue
+		screening.StartsAt = screeningReq.StartsAt.UTC()
+		screening.EndsAt = screeningReq.EndsAt.UTC()
+		screening.Capacity = screeningReq.Capacity
+		return tx.Save(&screening).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	screenings := []Screening{screening}
+	if err := ss.attachFilms(screenings); err != nil {
+		return nil, err
+	}
+	return &screenings[0], nil
+}
+
+// DeleteScreening removes a screening from the schedule
+func (ss *ScreeningService) DeleteScreening(id uint) error {
+	result := ss.db.Scopes(ss.screenings).Delete(&Screening{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("screening not found")
+	}
+	return nil
+}
+
+// parseScheduleTime reads a from or to bound of the schedule, an RFC 3339
+// time or a date. A to date includes its whole day.
+func parseScheduleTime(value string, end bool) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// screeningsHandler routes /api/screenings endpoints. Anyone signed in can
+// read the schedule; only admins change it.
+func (s *Server) screeningsHandler(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	if r.Method != "GET" && !s.users.IsAdmin(currentUsername(r)) {
+		writeResponse(w, r, http.StatusForbidden, ErrorResponse{Error: "Admin role required", Code: "admin_required"})
+		return
+	}
+
+	if path == "/api/screenings" {
+		switch r.Method {
+		case "GET":
+			s.getScreeningsHandler(w, r)
+		case "POST":
+			s.saveScreeningHandler(w, r, 0)
+		default:
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(path, "/api/screenings/"))
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid screening ID", Code: "invalid_screening_id"})
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		screening, err := s.tenantScreenings(r).GetScreeningByID(uint(id))
+		if err != nil {
+			if err.Error() == "screening not found" {
+				writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Screening not found", Code: "screening_not_found"})
+			} else {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve screening", Code: "screening_retrieve_failed"})
+			}
+			return
+		}
+		writeResponse(w, r, http.StatusOK, screening)
+	case "PUT":
+		s.saveScreeningHandler(w, r, uint(id))
+	case "DELETE":
+		if err := s.tenantScreenings(r).DeleteScreening(uint(id)); err != nil {
+			if err.Error() == "screening not found" {
+				writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Screening not found", Code: "screening_not_found"})
+			} else {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete screening", Code: "screening_delete_failed"})
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+	}
+}
+
+// getScreeningsHandler handles GET /api/screenings?from=&to=, the schedule
+// for a calendar view. It defaults to the week starting today.
+func (s *Server) getScreeningsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from := time.Now().UTC().Truncate(24 * time.Hour)
+	if value := query.Get("from"); value != "" {
+		parsed, err := parseScheduleTime(value, false)
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid from, expected an RFC 3339 time or a date (YYYY-MM-DD)", Code: "screening_invalid_from"})
+			return
+		}
+		from = parsed
+	}
+	to := from.Add(defaultScreeningRange)
+	if value := query.Get("to"); value != "" {
+		parsed, err := parseScheduleTime(value, true)
+		if err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid to, expected an RFC 3339 time or a date (YYYY-MM-DD)", Code: "screening_invalid_to"})
+			return
+		}
+		to = parsed
+	}
+	if !to.After(from) {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "to must be after from", Code: "range_to_before_from"})
+		return
+	}
+
+	screenings, err := s.tenantScreenings(r).GetScreenings(from, to)
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve screenings", Code: "screenings_retrieve_failed"})
+		return
+	}
+	if screenings == nil {
+		screenings = []Screening{}
+	}
+	writeResponse(w, r, http.StatusOK, screenings)
+}
+
+// saveScreeningHandler creates a screening (id 0) or updates an existing one
+func (s *Server) saveScreeningHandler(w http.ResponseWriter, r *http.Request, id uint) {
+	var screeningReq ScreeningRequest
+	if err := json.NewDecoder(r.Body).Decode(&screeningReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+
+	if validationErr := ValidateScreeningRequest(&screeningReq); validationErr != nil {
+		writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: validationErr.Fields})
+		return
+	}
+
+	screening, err := s.tenantScreenings(r).SaveScreening(id, screeningReq)
+	if err != nil {
+		var validationErr *ValidationError
+		var conflictErr *ScreeningConflictError
+		switch {
+		case errors.As(err, &validationErr):
+			writeResponse(w, r, http.StatusBadRequest, ValidationErrorResponse{Error: "Validation failed", Code: "validation_failed", Fields: validationErr.Fields})
+		case errors.As(err, &conflictErr):
+			writeResponse(w, r, http.StatusConflict, errorResponse(conflictErr))
+		case err.Error() == "screening not found":
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Screening not found", Code: "screening_not_found"})
+		default:
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save screening", Code: "screening_save_failed"})
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if id == 0 {
+		status = http.StatusCreated
+	}
+	writeResponse(w, r, status, screening)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// Search limits
+const (
+	defaultSearchLimit  = 20
+	maxSearchLimit      = 100
+	maxSearchTermLength = 200
+)
+
+// FilmSearchResult is a film and how closely it matches the search, from 0 to 1
+// @Description Ranked search result
+type FilmSearchResult struct {
+	Film
+	Score float64 `json:"score" xml:"score" example:"0.62"`
+}
+
+// FilmSearchResponse lists the films matching a search, best match first
+// @Description Fuzzy search results
+type FilmSearchResponse struct {
+	Query     string             `json:"query" xml:"query" example:"Shawshenk Redemtion"`
+	Threshold float64            `json:"threshold" xml:"threshold" example:"0.3"`
+	Data      []FilmSearchResult `json:"data" xml:"data>film"`
+}
+
+// SearchFilms finds films whose title or director resembles the search term,
+// tolerating typos. Films scoring below the threshold are left out. The score
+// is the pg_trgm word similarity of the term to the title or the director,
+// whichever is higher.
+func (fs *FilmService) SearchFilms(term string, threshold float64, limit int) ([]FilmSearchResult, error) {
+	var results []FilmSearchResult
+	err := fs.db.Transaction(func(tx *gorm.DB) error {
+		// The <% operator, which the trigram indexes serve, matches at this threshold
+		err := tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)",
+			strconv.FormatFloat(threshold, 'f', -1, 64)).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Film{}).
+			Select("films.*, GREATEST(word_similarity(?, title), word_similarity(?, director)) AS score", term, term).
+			Where("? <% title OR ? <% director", term, term).
+			Order("score DESC, id").
+			Limit(limit).
+			Find(&results).Error
+	})
+	return results, err
+}
+
+// searchFilmsHandler handles fuzzy film search
+func (s *Server) searchFilmsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	query := r.URL.Query()
+	term := strings.TrimSpace(query.Get("q"))
+	if term == "" || utf8.RuneCountInString(term) > maxSearchTermLength {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "q must be between 1 and 200 characters", Code: "search_term_invalid", Params: Params{"min": 1, "max": 200}})
+		return
+	}
+	limit := defaultSearchLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxSearchLimit {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "limit must be between 1 and 100", Code: "limit_invalid", Params: Params{"min": 1, "max": 100}})
+			return
+		}
+		limit = parsed
+	}
+
+	threshold := s.currentConfig().Search.SimilarityThreshold
+	results, err := s.tenantCatalog(r).SearchFilms(term, threshold, limit)
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to search films", Code: "search_failed"})
+		return
+	}
+	for i := range results {
+		withLinks(&results[i].Film)
+	}
+	if results == nil {
+		results = []FilmSearchResult{}
+	}
+
+	writeResponse(w, r, http.StatusOK, FilmSearchResponse{Query: term, Threshold: threshold, Data: results})
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// SeedRef is a named entity other seed entries can refer to by key
+type SeedRef struct {
+	Key  string `yaml:"key" json:"key"`
+	Name string `yaml:"name" json:"name"`
+}
+
+// SeedFilm is a film entry. Director and genre are keys of the directors and genres lists.
+type SeedFilm struct {
+	Title    string `yaml:"title" json:"title"`
+	Director string `yaml:"director" json:"director"`
+	Year     int    `yaml:"year" json:"year"`
+	Genre    string `yaml:"genre" json:"genre"`
+}
+
+// SeedUser is a user entry. The password is only used when the user is created.
+type SeedUser struct {
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+	Role     string `yaml:"role" json:"role"`
+}
+
+// SeedData is the content of one seed file, or of all files merged
+type SeedData struct {
+	Genres    []SeedRef  `yaml:"genres" json:"genres"`
+	Directors []SeedRef  `yaml:"directors" json:"directors"`
+	Films     []SeedFilm `yaml:"films" json:"films"`
+	Users     []SeedUser `yaml:"users" json:"users"`
+}
+
+// LoadSeeds reads and merges every YAML and JSON file of a directory in name order
+func LoadSeeds(dir string) (*SeedData, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if !entry.IsDir() && (ext == ".yaml" || ext == ".yml" || ext == ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	merged := &SeedData{}
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		var data SeedData
+		if strings.EqualFold(filepath.Ext(name), ".json") {
+			err = json.Unmarshal(content, &data)
+		} else {
+			err = yaml.Unmarshal(content, &data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse seed file %s: %v", name, err)
+		}
+
+		merged.Genres = append(merged.Genres, data.Genres...)
+		merged.Directors = append(merged.Directors, data.Directors...)
+		merged.Films = append(merged.Films, data.Films...)
+		merged.Users = append(merged.Users, data.Users...)
+	}
+	return merged, nil
+}
+
+// refIndex maps the keys of a reference list to their names
+func refIndex(kind string, refs []SeedRef) (map[string]string, error) {
+	index := make(map[string]string, len(refs))
+	for _, ref := range refs {
+		if ref.Key == "" || ref.Name == "" {
+			return nil, fmt.Errorf("%s entries need a key and a name", kind)
+		}
+		if _, exists := index[ref.Key]; exists {
+			return nil, fmt.Errorf("duplicate %s key %q", kind, ref.Key)
+		}
+		index[ref.Key] = ref.Name
+	}
+	return index, nil
+}
+
+// ResolveFilms turns film entries into films, replacing director and genre keys with names
+func (sd *SeedData) ResolveFilms() ([]Film, error) {
+	directors, err := refIndex("director", sd.Directors)
+	if err != nil {
+		return nil, err
+	}
+	genres, err := refIndex("genre", sd.Genres)
+	if err != nil {
+		return nil, err
+	}
+
+	films := make([]Film, 0, len(sd.Films))
+	for _, entry := range sd.Films {
+		if entry.Title == "" || entry.Year == 0 {
+			return nil, errors.New("seed films need a title and a year")
+		}
+		director, exists := directors[entry.Director]
+		if !exists {
+			return nil, fmt.Errorf("film %q references unknown director %q", entry.Title, entry.Director)
+		}
+		genre := ""
+		if entry.Genre != "" {
+			if genre, exists = genres[entry.Genre]; !exists {
+				return nil, fmt.Errorf("film %q references unknown genre %q", entry.Title, entry.Genre)
+			}
+		}
+		films = append(films, Film{Title: entry.Title, Director: director, Year: entry.Year, Genre: genre})
+	}
+	return films, nil
+}
+
+// ApplySeeds upserts the seed data into the default organization in one
+// transaction. Films are matched by title, year, and director, users by
+// username, so running it again only brings seeded records back in line with
+// the files.
+func ApplySeeds(db *gorm.DB, data *SeedData) (int, int, error) {
+	films, err := data.ResolveFilms()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, user := range data.Users {
+		if user.Username == "" || user.Password == "" {
+			return 0, 0, errors.New("seed users need a username and a password")
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Seeds go to the default organization
+		organization, err := ensureDefaultOrganization(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, film := range films {
+			// Deleted films count as existing so seeding doesn't bring them back
+			var existing Film
+			err := tx.Unscoped().Where("organization_id = ? AND title = ? AND year = ? AND director = ?", organization.ID, film.Title, film.Year, film.Director).First(&existing).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				film.OrganizationID = organization.ID
+				if err := tx.Create(&film).Error; err != nil {
+					return fmt.Errorf("failed to seed film %q: %v", film.Title, err)
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if existing.Genre == film.Genre {
+				continue
+			}
+			// Bump the version so clients holding the old one re-fetch before updating
+			err = tx.Unscoped().Model(&existing).Updates(map[string]interface{}{
+				"genre":   film.Genre,
+				"version": gorm.Expr("version + 1"),
+			}).Error
+			if err != nil {
+				return fmt.Errorf("failed to seed film %q: %v", film.Title, err)
+			}
+		}
+
+		return seedUsers(tx, organization.ID, data.Users)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(films), len(data.Users), nil
+}
+
+// seedUsers creates the seed users missing from an organization and gives
+// the existing ones their seeded role back
+func seedUsers(tx *gorm.DB, organizationID uint, seeds []SeedUser) error {
+	for _, seed := range seeds {
+		role := seed.Role
+		if role == "" {
+			role = "user"
+		}
+
+		var existing User
+		err := tx.Where("username = ?", seed.Username).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			user := User{Username: seed.Username, Password: seed.Password, Role: role, Active: true, OrganizationID: organizationID}
+			if err := tx.Create(&user).Error; err != nil {
+				return fmt.Errorf("failed to seed user %s: %v", seed.Username, err)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&existing).Update("role", role).Error; err != nil {
+			return fmt.Errorf("failed to seed user %s: %v", seed.Username, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,338 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+// Server is one instance of the API: its configuration, database, the
+// services on it, and the handlers using them. Instances share nothing but
+// the compiled-in plugins, so a process can run several side by side.
+type Server struct {
+	cfg *Config
+	// config is the configuration in use, swapped as a whole on reload
+	config              *liveConfig
+	db                  *gorm.DB
+	plugins             *Plugins
+	spec                *OpenAPISpec
+	workerPool          *WorkerPool
+	eventBus            *EventBus
+	films               FilmRepository
+	users               UserRepository
+	filmService         *FilmService
+	userService         *UserService
+	organizationService *OrganizationService
+	tokenStore          *TokenStore
+	idempotencyStore    *IdempotencyStore
+	meteringService     *MeteringService
+	ruleService         *RuleService
+	webhookService      *WebhookService
+	collectionService   *CollectionService
+	listService         *ListService
+	lendingService      *LendingService
+	screeningService    *ScreeningService
+	notificationService *NotificationService
+	mailService         *MailService
+	exportService       *ExportService
+	adminService        *AdminService
+	metricsService      *MetricsService
+	viewCounter         *ViewCounter
+	usageCounter        *UsageCounter
+	trendingService     *TrendingService
+	scheduler           *Scheduler
+	flagService         *FlagService
+	blobs               BlobStore
+	loginGuard          *LoginGuard
+	requestMetrics      *requestCounters
+	anomalyMonitor      *AnomalyMonitor
+	// filmReads lets concurrent identical film listings share one query
+	filmReads singleflight.Group
+	// readOnly rejects mutations while set, e.g. during a failover to a read replica
+	readOnly atomic.Bool
+	// maintenance is the maintenance mode of the server; nil is off
+	maintenance atomic.Pointer[MaintenanceMode]
+	// ready is set once the server has warmed up and can take traffic
+	ready atomic.Bool
+
+	// handler is what ServeHTTP serves, built by New
+	handler http.Handler
+	// ctx is cancelled by Close to stop background work like the warm-up
+	ctx        context.Context
+	cancel     context.CancelFunc
+	background sync.WaitGroup
+	// ownsDB is set when the server opened its database and closes it on Close
+	ownsDB bool
+}
+
+// NewServer creates the services of a server on a database. Nothing runs in
+// the background until Start except the minimum workers of the worker pool,
+// which Close stops. With the memory storage backend films and users start
+// out empty in memory.
+func NewServer(cfg *Config, db *gorm.DB) *Server {
+	s := &Server{cfg: cfg, config: newLiveConfig(cfg), db: db, plugins: newPlugins()}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.readOnly.Store(cfg.Server.ReadOnly)
+	s.maintenance.Store(maintenanceFromConfig(cfg))
+	s.requestMetrics = newRequestCounters()
+	s.anomalyMonitor = NewAnomalyMonitor(s.config)
+	s.workerPool = NewWorkerPool()
+	s.eventBus = NewEventBus(s.workerPool)
+	s.tokenStore = NewTokenStore(s.config)
+	s.idempotencyStore = NewIdempotencyStore()
+	s.filmService = NewFilmService(db, s.config, s.plugins)
+	s.listService = NewListService(db)
+	s.mailService = NewMailService(db, NewMailer(cfg.Mail))
+	s.userService = NewUserService(db, s.listService, s.mailService, s.plugins)
+	s.films, s.users = s.filmService, s.userService
+	if cfg.Storage.Backend == storageMemory {
+		s.films, s.users = NewMemoryFilmRepository(s.config, s.plugins), NewMemoryUserRepository(s.plugins)
+	}
+	s.organizationService = NewOrganizationService(db, s.users)
+	s.meteringService = NewMeteringService(db)
+	s.ruleService = NewRuleService(db, s.users)
+	s.webhookService = NewWebhookService(db, s.workerPool)
+	s.collectionService = NewCollectionService(db)
+	s.lendingService = NewLendingService(db, s.config, s.films)
+	s.screeningService = NewScreeningService(db)
+	s.notificationService = NewNotificationService(db)
+	s.exportService = NewExportService(db, cfg.Server.ExportDir)
+	s.adminService = NewAdminService(db, s.tokenStore)
+	s.metricsService = NewMetricsService(db, s.tokenStore, s.requestMetrics)
+	s.viewCounter = NewViewCounter(db)
+	s.usageCounter = NewUsageCounter(db)
+	s.trendingService = NewTrendingService(db)
+	s.scheduler = NewScheduler(db, s.workerPool, s.config, &s.readOnly)
+	s.flagService = NewFlagService(db)
+	s.blobs = NewBlobStore(cfg.Blobs)
+	s.loginGuard = NewLoginGuard()
+	return s
+}
+
+// currentConfig returns the configuration the server runs with
+func (s *Server) currentConfig() *Config {
+	return s.config.Load()
+}
+
+// New returns the film API as a server that other Go programs can mount as a
+// handler in their own servers or tests. It gets the database ready the same
+// way serve does: it connects, migrates and seeds unless cfg is read-only,
+// and starts the background jobs. With the memory storage backend it loads
+// the seeds into memory instead and needs no database. Close stops the
+// server's background jobs and closes its database.
+func New(cfg *Config) (*Server, error) {
+	if cfg.Storage.Backend == storageMemory {
+		return newMemory(cfg)
+	}
+
+	db, err := ConnectDatabase(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	// Run migrations, unless the database may be a read-only replica
+	if cfg.Server.ReadOnly {
+		log.Println("⚠️  Starting in read-only mode: skipping migrations and seeding")
+	} else if err := MigrateDatabase(db); err != nil {
+		closeDatabase(db)
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	// Initialize services
+	s := NewServer(cfg, db)
+	s.ownsDB = true
+
+	// Seed database with initial films and users
+	if !cfg.Server.ReadOnly {
+		if err := SeedDatabase(db, cfg.Storage.SeedsDir); err != nil {
+			log.Printf("Warning: Failed to seed database: %v", err)
+		}
+	}
+
+	// Load the API spec served at /openapi.json and used for request validation
+	if s.spec, err = LoadOpenAPISpec(cfg.Server.AssetsDir); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to load OpenAPI spec: %v", err)
+	}
+
+	// Load the film rules and start background jobs
+	s.Start()
+
+	// Warm up in the background; /readyz reports ready once done
+	if cfg.Server.Warmup {
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			s.warmUp()
+		}()
+	} else {
+		s.ready.Store(true)
+	}
+	s.handler = s.Handler()
+	return s, nil
+}
+
+// newMemory returns the film API with films and users in memory and no
+// database. There is nothing to warm up, and film rules, webhooks, events,
+// and background jobs stay off since they are kept in the database.
+func newMemory(cfg *Config) (*Server, error) {
+	db, err := openWithoutDatabase()
+	if err != nil {
+		return nil, err
+	}
+	s := NewServer(cfg, db)
+	log.Println("⚠️  Keeping films and users in memory: features that need PostgreSQL answer 500")
+	if _, _, err := seedMemory(s.films.(*MemoryFilmRepository), s.users.(*MemoryUserRepository), cfg.Storage.SeedsDir, false); err != nil {
+		log.Printf("Warning: Failed to seed memory: %v", err)
+	}
+
+	if s.spec, err = LoadOpenAPISpec(cfg.Server.AssetsDir); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to load OpenAPI spec: %v", err)
+	}
+	s.ready.Store(true)
+	s.handler = s.Handler()
+	return s, nil
+}
+
+// ServeHTTP serves a request with the routes and middleware New set up
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Close stops the background work of a server: the scheduler and the jobs
+// it runs, the anomaly monitor, a warm-up still running, and the worker
+// pool. A server from New also closes its database. Requests still being
+// served are for the caller to drain first, e.g. with http.Server.Shutdown.
+func (s *Server) Close() error {
+	s.cancel()
+	s.scheduler.Stop()
+	s.anomalyMonitor.Stop()
+	s.background.Wait()
+	s.workerPool.Stop()
+	if !s.ownsDB {
+		return nil
+	}
+	return closeDatabase(s.db)
+}
+
+// closeDatabase closes the connections of a database
+func closeDatabase(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// Start loads the film rules and feature flags, hooks the rules, webhooks, and events into film
+// and user changes, and starts the background jobs
+func (s *Server) Start() {
+	if err := s.ruleService.Reload(); err != nil {
+		log.Printf("Warning: Failed to load film rules: %v", err)
+	}
+	if err := s.flagService.Reload(); err != nil {
+		log.Printf("Warning: Failed to load feature flags: %v", err)
+	}
+	s.plugins.Register(s.ruleService.Plugin())
+	s.plugins.Register(s.webhookService.Plugin())
+	s.plugins.Register(s.eventBus.Plugin())
+	s.notificationService.Subscribe(s.eventBus)
+
+	s.registerJobs()
+	if err := s.scheduler.Start(); err != nil {
+		log.Printf("Warning: Failed to start scheduler: %v", err)
+	}
+}
+
+// registerJobs registers the background jobs with their default schedules
+func (s *Server) registerJobs() {
+	s.scheduler.Register("usage-rollup", "Refresh today's and yesterday's usage totals", "0 * * * *", 10*time.Minute, PriorityLow, s.meteringService.RollupRecent)
+	s.scheduler.Register("token-cleanup", "Remove expired login tokens", "*/15 * * * *", time.Minute, PriorityNormal, func(ctx context.Context) error {
+		if purged := s.tokenStore.PurgeExpired(); purged > 0 {
+			log.Printf("🧹 Removed %d expired tokens", purged)
+		}
+		return nil
+	})
+	s.scheduler.Register("mail-outbox", "Send queued emails and retry failed ones", "* * * * *", 5*time.Minute, PriorityNormal, s.mailService.SendPending)
+	s.scheduler.Register("film-digest", "Email the films added this week to users who turned the digest on", "0 8 * * 1", 10*time.Minute, PriorityLow, s.mailService.SendDigests)
+	s.scheduler.Register("metrics-snapshot", "Store a snapshot of request, error, catalog, and user metrics", "0 * * * *", time.Minute, PriorityLow, s.metricsService.Snapshot)
+	s.scheduler.Register("trash-purge", "Permanently remove films deleted longer ago than the trash retention", "30 3 * * *", 10*time.Minute, PriorityLow, func(ctx context.Context) error {
+		retention := s.currentConfig().Jobs.TrashRetention
+		if retention == 0 {
+			return nil
+		}
+		purged, posters, err := s.filmService.PurgeDeleted(ctx, time.Now().Add(-retention))
+		if purged > 0 {
+			log.Printf("🗑️  Purged %d deleted films", purged)
+		}
+		for _, key := range posters {
+			s.deletePoster(ctx, key)
+		}
+		return err
+	})
+	s.scheduler.Register("account-purge", "Permanently remove accounts deleted longer ago than the account retention", "45 3 * * *", 10*time.Minute, PriorityLow, func(ctx context.Context) error {
+		retention := s.currentConfig().Jobs.AccountRetention
+		if retention == 0 {
+			return nil
+		}
+		purged, err := s.userService.PurgeDeleted(ctx, time.Now().Add(-retention))
+		if purged > 0 {
+			log.Printf("🗑️  Purged %d deleted accounts", purged)
+		}
+		return err
+	})
+	s.scheduler.Register("flag-reload", "Pick up feature flags toggled on other instances", "* * * * *", time.Minute, PriorityNormal, func(ctx context.Context) error {
+		return s.flagService.Reload()
+	})
+	s.scheduler.Register("view-flush", "Add the film views counted in memory to the daily totals", "* * * * *", time.Minute, PriorityNormal, s.viewCounter.Flush)
+	s.scheduler.Register("api-usage-flush", "Add the API requests counted in memory to the hourly usage totals", "* * * * *", time.Minute, PriorityNormal, s.usageCounter.Flush)
+	s.scheduler.Register("api-usage-purge", "Remove hourly API usage older than the usage retention", "15 4 * * *", 10*time.Minute, PriorityLow, func(ctx context.Context) error {
+		retention := s.currentConfig().Jobs.UsageRetention
+		if retention == 0 {
+			return nil
+		}
+		purged, err := s.usageCounter.Purge(ctx, time.Now().Add(-retention))
+		if purged > 0 {
+			log.Printf("🗑️  Purged %d hours of API usage", purged)
+		}
+		return err
+	})
+	s.scheduler.Register("trending", "Rank the films trending in each organization", "*/10 * * * *", 2*time.Minute, PriorityLow, s.trendingService.Recompute)
+	s.scheduler.Register("stats-precompute", "Compute the admin dashboard statistics ahead of requests", "*/5 * * * *", 2*time.Minute, PriorityLow, s.adminService.Precompute)
+}
+
+// Handler registers the routing table on a fresh mux, with the SPA serving
+// every other path, and wraps it in the middleware the server runs with
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range s.routes() {
+		handler := rt.handler
+		if rt.policy != nil {
+			handler = rt.policy(handler)
+		}
+		mux.HandleFunc(rt.pattern, handler)
+	}
+	mux.Handle("/", NewSPAHandler(s.cfg.Server.AssetsDir))
+
+	var handler http.Handler = mux
+	if s.cfg.Server.ValidateRequests {
+		handler = validateRequests(s.spec, handler)
+	}
+	handler = s.rejectWritesWhenReadOnly(s.rejectWritesInMaintenance(s.answerOptions(handler)))
+	if s.cfg.Server.DemoMode {
+		handler = rejectWritesInDemo(handler)
+	}
+	handler = normalizePaths(s.spec, handler)
+	if s.cfg.Server.MethodOverride {
+		handler = overrideMethods(handler)
+	}
+	return s.resolveClientIP(s.logRequests(s.countRequests(envelopeResponses(handler))))
+}
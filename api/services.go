@@ -0,0 +1,1007 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FilmService handles film-related database operations
+type FilmService struct {
+	db      *gorm.DB
+	tenant  Tenant
+	config  *liveConfig
+	plugins *Plugins
+}
+
+// NewFilmService creates a new film service spanning every organization. It
+// checks quotas with the settings of config and runs the hooks of plugins.
+func NewFilmService(db *gorm.DB, config *liveConfig, plugins *Plugins) *FilmService {
+	return &FilmService{db: db, config: config, plugins: plugins}
+}
+
+// ForTenant returns the repository of the films of one organization
+func (fs *FilmService) ForTenant(tenant Tenant) FilmRepository {
+	return fs.inTenant(tenant)
+}
+
+// inTenant returns a film service that only sees and creates the films of
+// one organization
+func (fs *FilmService) inTenant(tenant Tenant) *FilmService {
+	return &FilmService{
+		db:      fs.db.Scopes(tenantScope(tenant.OrganizationID)).Session(&gorm.Session{}),
+		tenant:  tenant,
+		config:  fs.config,
+		plugins: fs.plugins,
+	}
+}
+
+// GetAllFilms retrieves all films matching a query (nil for all) from database
+func (fs *FilmService) GetAllFilms(query *FilmQuery) ([]Film, error) {
+	var films []Film
+	err := fs.db.Scopes(query.scope).Find(&films).Error
+	return films, err
+}
+
+// GetFilmsPage retrieves one page of the films matching a query, ordered by ID, with the total count
+func (fs *FilmService) GetFilmsPage(query *FilmQuery, page, pageSize int) ([]Film, int64, error) {
+	var total int64
+	if err := fs.db.Model(&Film{}).Scopes(query.scope).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var films []Film
+	err := fs.db.Scopes(query.scope).Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&films).Error
+	return films, total, err
+}
+
+// GetFilmsAfter retrieves up to limit films following a cursor (keyset pagination).
+// A nil cursor starts from the beginning. The returned cursor is nil on the last page.
+func (fs *FilmService) GetFilmsAfter(filter *FilmQuery, cursor *FilmCursor, order string, limit int) ([]Film, *FilmCursor, error) {
+	query := fs.db.Scopes(filter.scope).Limit(limit + 1)
+	if order == cursorOrderCreatedAt {
+		query = query.Order("created_at, id")
+		if cursor != nil {
+			query = query.Where("(created_at, id) > (?, ?)", cursor.CreatedAt, cursor.ID)
+		}
+	} else {
+		query = query.Order("id")
+		if cursor != nil {
+			query = query.Where("id > ?", cursor.ID)
+		}
+	}
+
+	var films []Film
+	if err := query.Find(&films).Error; err != nil {
+		return nil, nil, err
+	}
+	films, next := trimPage(films, order, limit)
+	return films, next, nil
+}
+
+// trimPage cuts the films read for a keyset page, one more than limit if
+// there are, to the page and returns the cursor of the next page, nil on the
+// last page
+func trimPage(films []Film, order string, limit int) ([]Film, *FilmCursor) {
+	// The extra row only tells whether another page exists
+	if len(films) <= limit {
+		return films, nil
+	}
+	films = films[:limit]
+	last := films[len(films)-1]
+	next := &FilmCursor{Order: order, ID: last.ID}
+	if order == cursorOrderCreatedAt {
+		next.CreatedAt = last.CreatedAt
+	}
+	return films, next
+}
+
+// GetFilmsByIDs retrieves the films among ids that exist
+func (fs *FilmService) GetFilmsByIDs(ids []uint) ([]Film, error) {
+	var films []Film
+	err := fs.db.Where("id IN ?", ids).Find(&films).Error
+	return films, err
+}
+
+// GetFilmByID retrieves a film by ID
+func (fs *FilmService) GetFilmByID(id uint) (*Film, error) {
+	var film Film
+	err := fs.db.First(&film, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("film not found")
+		}
+		return nil, err
+	}
+	return &film, nil
+}
+
+// SQL expressions matching normalizeFilmKey, shared with the unique index
+const (
+	filmTitleKeySQL    = `btrim(regexp_replace(lower(title), '\s+', ' ', 'g'))`
+	filmDirectorKeySQL = `btrim(regexp_replace(lower(director), '\s+', ' ', 'g'))`
+)
+
+// normalizeFilmKey lowercases a title or director and collapses whitespace
+func normalizeFilmKey(value string) string {
+	return strings.Join(strings.Fields(strings.ToLower(value)), " ")
+}
+
+// DuplicateFilmError is returned when a film with the same natural key already exists
+type DuplicateFilmError struct {
+	Existing *Film
+}
+
+func (e *DuplicateFilmError) Error() string {
+	return fmt.Sprintf("film already exists with id %d", e.Existing.ID)
+}
+
+// VersionConflictError is returned when an update is based on a stale film version
+type VersionConflictError struct {
+	Current *Film
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("film %d is at version %d", e.Current.ID, e.Current.Version)
+}
+
+// FindDuplicate returns the film sharing the natural key of a request, ignoring excludeID
+func (fs *FilmService) FindDuplicate(filmReq FilmRequest, excludeID uint) (*Film, error) {
+	var film Film
+	query := fs.db.Where(filmTitleKeySQL+" = ? AND year = ? AND "+filmDirectorKeySQL+" = ?",
+		normalizeFilmKey(filmReq.Title), filmReq.Year, normalizeFilmKey(filmReq.Director))
+	if excludeID != 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+	err := query.First(&film).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &film, nil
+}
+
+// externalIDPtr maps an empty external ID to NULL, so films without one don't collide
+func externalIDPtr(externalID string) *string {
+	if externalID == "" {
+		return nil
+	}
+	return &externalID
+}
+
+// FindConflict returns the stored film a record refers to, matched by external
+// ID first and by natural key otherwise, ignoring excludeID
+func (fs *FilmService) FindConflict(filmReq FilmRequest, excludeID uint) (*Film, error) {
+	if filmReq.ExternalID != "" {
+		var film Film
+		query := fs.db.Where("external_id = ?", filmReq.ExternalID)
+		if excludeID != 0 {
+			query = query.Where("id <> ?", excludeID)
+		}
+		err := query.First(&film).Error
+		if err == nil {
+			return &film, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	return fs.FindDuplicate(filmReq, excludeID)
+}
+
+// canEditFilm reports whether a user may change a film: admins may change
+// any film, other users only those they created. A nil editor is the server
+// itself and may change any film.
+func canEditFilm(editor *User, film *Film) bool {
+	if editor == nil || editor.Role == "admin" {
+		return true
+	}
+	return film.CreatedBy != nil && *film.CreatedBy == editor.ID
+}
+
+// creatorID returns the ID recorded as the creator of films a user adds
+func creatorID(creator *User) *uint {
+	if creator == nil {
+		return nil
+	}
+	id := creator.ID
+	return &id
+}
+
+// newFilm returns the film a request creates in an organization
+func newFilm(filmReq FilmRequest, creator *User, organizationID uint) Film {
+	film := Film{
+		Title:          filmReq.Title,
+		Director:       filmReq.Director,
+		Year:           filmReq.Year,
+		Genre:          filmReq.Genre,
+		ExternalID:     externalIDPtr(filmReq.ExternalID),
+		CreatedBy:      creatorID(creator),
+		OrganizationID: organizationID,
+	}
+	applyFilmMetadata(&film, filmReq)
+	return film
+}
+
+// applyFilmRequest copies the fields an update request changes onto a film
+func applyFilmRequest(film *Film, filmReq FilmRequest) {
+	film.Title = filmReq.Title
+	film.Director = filmReq.Director
+	film.Year = filmReq.Year
+	film.Genre = filmReq.Genre
+	if filmReq.ExternalID != "" {
+		film.ExternalID = externalIDPtr(filmReq.ExternalID)
+	}
+	applyFilmMetadata(film, filmReq)
+}
+
+// applyFilmMetadata copies the metadata and link fields present in a request onto a film
+func applyFilmMetadata(film *Film, filmReq FilmRequest) {
+	if filmReq.RuntimeMinutes != nil {
+		film.RuntimeMinutes = *filmReq.RuntimeMinutes
+	}
+	if filmReq.Synopsis != nil {
+		film.Synopsis = *filmReq.Synopsis
+	}
+	if filmReq.Language != nil {
+		film.Language = *filmReq.Language
+	}
+	if filmReq.Country != nil {
+		film.Country = *filmReq.Country
+	}
+	if filmReq.AgeRating != nil {
+		film.AgeRating = *filmReq.AgeRating
+	}
+	if filmReq.IMDbID != nil {
+		film.IMDbID = *filmReq.IMDbID
+	}
+	if filmReq.TrailerURL != nil {
+		film.TrailerURL = *filmReq.TrailerURL
+	}
+	if filmReq.ExternalLinks != nil {
+		film.ExternalLinks = *filmReq.ExternalLinks
+	}
+}
+
+// CreateFilm creates a new film owned by its creator
+func (fs *FilmService) CreateFilm(filmReq FilmRequest, creator *User) (*Film, error) {
+	return fs.createFilm(0, filmReq, creator)
+}
+
+// CreateFilmAt creates a new film owned by its creator under a chosen ID
+func (fs *FilmService) CreateFilmAt(id uint, filmReq FilmRequest, creator *User) (*Film, error) {
+	return fs.createFilm(id, filmReq, creator)
+}
+
+// createFilm creates a film under an ID, or the next one of the sequence for 0
+func (fs *FilmService) createFilm(id uint, filmReq FilmRequest, creator *User) (*Film, error) {
+	if existing, err := fs.FindConflict(filmReq, 0); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return nil, &DuplicateFilmError{Existing: existing}
+	}
+
+	if id != 0 {
+		var maxID uint
+		err := fs.db.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&Film{}).Select("coalesce(max(id), 0)").Scan(&maxID).Error
+		if err != nil {
+			return nil, err
+		}
+		if err := checkFilmID(id, maxID); err != nil {
+			return nil, err
+		}
+	}
+
+	count, plan, err := CheckCatalogQuota(fs.db, fs.tenant, fs.config.Load().Quota, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDailyQuota(fs.config.Load(), fs, creator, 1, fs.db.NowFunc()); err != nil {
+		return nil, err
+	}
+
+	film := newFilm(filmReq, creator, fs.tenant.OrganizationID)
+	film.ID = id
+
+	hc := HookContext{Action: ActionCreate}
+	if err := fs.plugins.runFilmPrePersist(hc, &film); err != nil {
+		return nil, err
+	}
+
+	err = WithTransaction(fs.db, func(tx *gorm.DB) error {
+		if err := tx.Create(&film).Error; err != nil {
+			return err
+		}
+		if id != 0 {
+			// Move the sequence past the chosen ID, so later films don't
+			// collide with it. checkFilmID keeps the ID close to the highest
+			// one, so clients can't run the shared sequence out.
+			err := tx.Session(&gorm.Session{NewDB: true}).
+				Exec(`SELECT setval(pg_get_serial_sequence('films', 'id'), coalesce(max(id), 0) + 1, false) FROM films`).Error
+			if err != nil {
+				return err
+			}
+		}
+		AfterCommit(tx, func() {
+			NotifyQuotaUsage(fs.config.Load().Alerts, fs.tenant.Slug, plan, count, count+1)
+			fs.plugins.runFilmPostCommit(hc, &film)
+		})
+		return nil
+	})
+	if err != nil {
+		// A concurrent create may have won the race for the unique index
+		if existing, _ := fs.FindConflict(filmReq, 0); existing != nil {
+			return nil, &DuplicateFilmError{Existing: existing}
+		}
+		if id != 0 && fs.idTaken(id) {
+			return nil, errors.New("film id taken")
+		}
+		return nil, err
+	}
+
+	return &film, nil
+}
+
+// maxFilmIDGap is how far past the highest film ID clients may choose the ID
+// of a film they create
+const maxFilmIDGap = 1000
+
+// FilmIDRangeError rejects a chosen film ID too far past the highest one
+type FilmIDRangeError struct {
+	Max uint
+}
+
+func (e *FilmIDRangeError) Error() string {
+	return fmt.Sprintf("film id must be at most %d", e.Max)
+}
+
+// checkFilmID rejects a chosen film ID more than maxFilmIDGap past maxID, the
+// highest ID of any film
+func checkFilmID(id, maxID uint) error {
+	if id > maxID+maxFilmIDGap {
+		return &FilmIDRangeError{Max: maxID + maxFilmIDGap}
+	}
+	return nil
+}
+
+// idTaken reports whether any film has an ID, deleted ones and those of
+// other organizations included
+func (fs *FilmService) idTaken(id uint) bool {
+	var count int64
+	fs.db.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&Film{}).Where("id = ?", id).Count(&count)
+	return count > 0
+}
+
+// CreateFilms creates several films owned by their creator in a single transaction
+func (fs *FilmService) CreateFilms(filmReqs []FilmRequest, creator *User) ([]Film, error) {
+	count, plan, err := CheckCatalogQuota(fs.db, fs.tenant, fs.config.Load().Quota, int64(len(filmReqs)))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDailyQuota(fs.config.Load(), fs, creator, int64(len(filmReqs)), fs.db.NowFunc()); err != nil {
+		return nil, err
+	}
+
+	hc := HookContext{Action: ActionCreate}
+	films := make([]Film, len(filmReqs))
+	for i, filmReq := range filmReqs {
+		films[i] = newFilm(filmReq, creator, fs.tenant.OrganizationID)
+		if err := fs.plugins.runFilmPrePersist(hc, &films[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	err = WithTransaction(fs.db, func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(&films, 100).Error; err != nil {
+			return err
+		}
+		AfterCommit(tx, func() {
+			NotifyQuotaUsage(fs.config.Load().Alerts, fs.tenant.Slug, plan, count, count+int64(len(films)))
+			for i := range films {
+				fs.plugins.runFilmPostCommit(hc, &films[i])
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return films, nil
+}
+
+// CountCreatedSince counts the films a user created since a time, deleted
+// ones included, so deleting films doesn't free up quota
+func (fs *FilmService) CountCreatedSince(userID uint, since time.Time) (int64, error) {
+	var count int64
+	err := fs.db.Unscoped().Model(&Film{}).Where("created_by = ? AND created_at >= ?", userID, since).Count(&count).Error
+	return count, err
+}
+
+// UpdateFilm updates an existing film the editor may change
+func (fs *FilmService) UpdateFilm(id uint, filmReq FilmRequest, editor *User) (*Film, error) {
+	var film Film
+	err := fs.db.First(&film, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("film not found")
+		}
+		return nil, err
+	}
+	if !canEditFilm(editor, &film) {
+		return nil, errors.New("not the film creator")
+	}
+
+	if filmReq.Version != nil && *filmReq.Version != film.Version {
+		return nil, &VersionConflictError{Current: &film}
+	}
+
+	if existing, err := fs.FindConflict(filmReq, id); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return nil, &DuplicateFilmError{Existing: existing}
+	}
+
+	// Update fields, keeping the version they replace
+	revision := newFilmRevision(&film, editor, fs.db.NowFunc())
+	applyFilmRequest(&film, filmReq)
+
+	hc := HookContext{Action: ActionUpdate}
+	if err := fs.plugins.runFilmPrePersist(hc, &film); err != nil {
+		return nil, err
+	}
+
+	// Only write over the version we read, so a concurrent update can't be lost
+	loadedVersion := film.Version
+	film.Version++
+	updated := true
+	err = WithTransaction(fs.db, func(tx *gorm.DB) error {
+		result := tx.Model(&film).Where("version = ?", loadedVersion).
+			Select("title", "director", "year", "genre", "external_id", "runtime_minutes", "synopsis", "language", "country", "age_rating", "imdb_id", "trailer_url", "external_links", "version", "updated_at").Updates(&film)
+		if result.Error != nil || result.RowsAffected == 0 {
+			updated = false
+			return result.Error
+		}
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+		AfterCommit(tx, func() { fs.plugins.runFilmPostCommit(hc, &film) })
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		var current Film
+		if err := fs.db.First(&current, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errors.New("film not found")
+			}
+			return nil, err
+		}
+		return nil, &VersionConflictError{Current: &current}
+	}
+
+	return &film, nil
+}
+
+// SetPoster stores the blob key of the poster of a film the editor may
+// change, "" to remove it, forgetting the thumbnails of the old one. The
+// film is locked while the key is swapped, so concurrent uploads each learn
+// which key they replaced and no blob is left behind. Posters aren't
+// versioned: the film keeps its version.
+func (fs *FilmService) SetPoster(id uint, key string, editor *User) (*Film, string, error) {
+	var film Film
+	var previous string
+	err := WithTransaction(fs.db, func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&film, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("film not found")
+			}
+			return err
+		}
+		if !canEditFilm(editor, &film) {
+			return errors.New("not the film creator")
+		}
+		previous = film.PosterKey
+		return tx.Model(&film).Updates(map[string]interface{}{"poster_key": key, "poster_sizes": ""}).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &film, previous, nil
+}
+
+// SetPosterSizes records the thumbnails stored for the poster under a key.
+// The film is only touched if it still has that poster, and updated_at is
+// left alone: generating thumbnails doesn't change the film.
+func (fs *FilmService) SetPosterSizes(id uint, key string, sizes []string) (bool, error) {
+	result := fs.db.Model(&Film{}).Where("id = ? AND poster_key = ?", id, key).
+		UpdateColumn("poster_sizes", strings.Join(sizes, ","))
+	return result.RowsAffected > 0, result.Error
+}
+
+// DeleteFilm soft deletes a film the editor may change
+func (fs *FilmService) DeleteFilm(id uint, editor *User) error {
+	// Load the film first so hooks see the full record being deleted
+	var film Film
+	if err := fs.db.First(&film, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("film not found")
+		}
+		return err
+	}
+	if !canEditFilm(editor, &film) {
+		return errors.New("not the film creator")
+	}
+
+	hc := HookContext{Action: ActionDelete}
+	if err := fs.plugins.runFilmPrePersist(hc, &film); err != nil {
+		return err
+	}
+
+	return WithTransaction(fs.db, func(tx *gorm.DB) error {
+		result := tx.Delete(&Film{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("film not found")
+		}
+		AfterCommit(tx, func() { fs.plugins.runFilmPostCommit(hc, &film) })
+		return nil
+	})
+}
+
+// PurgeDeleted permanently removes the films deleted before a time, and
+// their places in collections and lists, returning how many were removed
+// and the blob keys of their posters, which are left to the caller to delete.
+// Films with physical copies or screenings are kept for their history.
+func (fs *FilmService) PurgeDeleted(ctx context.Context, before time.Time) (int64, []string, error) {
+	var purged int64
+	var posters []string
+	err := fs.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		err := tx.Unscoped().Model(&Film{}).
+			Where("deleted_at < ?", before).
+			Where("NOT EXISTS (SELECT 1 FROM copies WHERE copies.film_id = films.id)").
+			Where("NOT EXISTS (SELECT 1 FROM screenings WHERE screenings.film_id = films.id)").
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		if err := tx.Where("film_id IN ?", ids).Delete(&CollectionFilm{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("film_id IN ?", ids).Delete(&FilmListItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("film_id IN ?", ids).Delete(&FilmView{}).Error; err != nil {
+			return err
+		}
+		err = tx.Unscoped().Model(&Film{}).Where("id IN ? AND poster_key <> ''", ids).Pluck("poster_key", &posters).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("id IN ?", ids).Delete(&Film{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return purged, posters, nil
+}
+
+// DeleteFilms soft deletes the films matching an ID list or filter in one statement.
+// Only post-commit hooks run for bulk deletes, with the rows returned by the statement.
+// Films the editor may not change are left alone.
+func (fs *FilmService) DeleteFilms(ids []uint, filter *FilmFilter, editor *User) (int64, error) {
+	query := fs.db.Model(&Film{})
+	conditions := 0
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+		conditions++
+	}
+	if filter != nil {
+		if filter.Genre != "" {
+			query = query.Where("genre = ?", filter.Genre)
+			conditions++
+		}
+		if filter.Director != "" {
+			query = query.Where("director = ?", filter.Director)
+			conditions++
+		}
+		if filter.Year != 0 {
+			query = query.Where("year = ?", filter.Year)
+			conditions++
+		}
+	}
+	if conditions == 0 {
+		return 0, ErrBatchSelectorRequired
+	}
+	if editor != nil && editor.Role != "admin" {
+		query = query.Where("created_by = ?", editor.ID)
+	}
+
+	var deleted []Film
+	var count int64
+	err := WithTransaction(query, func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Returning{}).Delete(&deleted)
+		if result.Error != nil {
+			return result.Error
+		}
+		count = result.RowsAffected
+		hc := HookContext{Action: ActionDelete}
+		AfterCommit(tx, func() {
+			for i := range deleted {
+				fs.plugins.runFilmPostCommit(hc, &deleted[i])
+			}
+		})
+		return nil
+	})
+	return count, err
+}
+
+// UserService handles user-related database operations
+type UserService struct {
+	db      *gorm.DB
+	lists   *ListService
+	mail    *MailService
+	plugins *Plugins
+}
+
+// NewUserService creates a new user service running the hooks of plugins
+func NewUserService(db *gorm.DB, lists *ListService, mail *MailService, plugins *Plugins) *UserService {
+	return &UserService{db: db, lists: lists, mail: mail, plugins: plugins}
+}
+
+// GetUserByUsername retrieves a user by username
+func (us *UserService) GetUserByUsername(username string) (*User, error) {
+	var user User
+	err := us.db.Where("username = ?", username).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// IsAdmin reports whether a user has the admin role
+func (us *UserService) IsAdmin(username string) bool {
+	user, err := us.GetUserByUsername(username)
+	if err != nil {
+		return false
+	}
+	return user.Role == "admin"
+}
+
+// ValidateUser validates user credentials and returns the user they belong to
+func (us *UserService) ValidateUser(username, password string) (*User, bool) {
+	user, err := us.GetUserByUsername(username)
+	if err != nil || user.Password == unusablePassword || user.Password != password {
+		return nil, false
+	}
+	return user, true
+}
+
+// TenantOf returns the organization a user acts for
+func (us *UserService) TenantOf(user *User) (Tenant, error) {
+	var organization Organization
+	if err := us.db.First(&organization, user.OrganizationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Tenant{}, errors.New("organization not found")
+		}
+		return Tenant{}, err
+	}
+	return Tenant{OrganizationID: organization.ID, Slug: organization.Slug}, nil
+}
+
+// emailTaken reports whether another user already uses an email address
+func (us *UserService) emailTaken(email string, excludeID uint) (bool, error) {
+	var count int64
+	err := us.db.Model(&User{}).Where("email = ? AND id <> ?", email, excludeID).Count(&count).Error
+	return count > 0, err
+}
+
+// UpdateProfile replaces the profile fields of a user
+func (us *UserService) UpdateProfile(username string, profileReq ProfileRequest) (*User, error) {
+	user, err := us.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	previousEmail := user.Email
+	user.Email = nil
+	if profileReq.Email != "" {
+		if taken, err := us.emailTaken(profileReq.Email, user.ID); err != nil {
+			return nil, err
+		} else if taken {
+			return nil, errors.New("email already in use")
+		}
+		user.Email = &profileReq.Email
+	}
+	user.DisplayName = profileReq.DisplayName
+	user.AvatarURL = profileReq.AvatarURL
+	user.Digest = profileReq.Digest
+	emailChanged := user.Email != nil && (previousEmail == nil || *previousEmail != *user.Email)
+	if user.Email == nil || emailChanged {
+		user.EmailVerified = false
+	}
+
+	hc := HookContext{Action: ActionUpdate}
+	if err := us.plugins.runUserPrePersist(hc, user); err != nil {
+		return nil, err
+	}
+
+	err = WithTransaction(us.db, func(tx *gorm.DB) error {
+		err := tx.Model(user).Select("email", "email_verified", "display_name", "avatar_url", "digest", "updated_at").Updates(user).Error
+		if err != nil {
+			return err
+		}
+		AfterCommit(tx, func() { us.plugins.runUserPostCommit(hc, user) })
+		// Confirm a new address before mailing anything else to it. An
+		// address that can't be confirmed isn't kept.
+		if emailChanged {
+			return us.mail.queueVerification(tx, user)
+		}
+		return nil
+	})
+	if err != nil {
+		// Lost a race for the unique email index
+		if user.Email != nil {
+			if taken, _ := us.emailTaken(*user.Email, user.ID); taken {
+				return nil, errors.New("email already in use")
+			}
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// SetRole changes the role of a user
+func (us *UserService) SetRole(username, role string) error {
+	result := us.db.Model(&User{}).Where("username = ?", username).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+// SetPassword replaces the password of a user
+func (us *UserService) SetPassword(username, password string) error {
+	result := us.db.Model(&User{}).Where("username = ?", username).Update("password", password)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
+// CreateUser creates a new user in the default organization, creating that
+// too the first time
+func (us *UserService) CreateUser(username, password string) (*User, error) {
+	var user User
+	hc := HookContext{Action: ActionCreate}
+	err := WithTransaction(us.db, func(tx *gorm.DB) error {
+		organization, err := ensureDefaultOrganization(tx)
+		if err != nil {
+			return err
+		}
+		user = User{
+			Username:       username,
+			Password:       password,
+			Role:           "user",
+			Active:         true,
+			OrganizationID: organization.ID,
+		}
+		if err := us.plugins.runUserPreValidate(hc, &user); err != nil {
+			return err
+		}
+		if err := us.plugins.runUserPrePersist(hc, &user); err != nil {
+			return err
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		AfterCommit(tx, func() { us.plugins.runUserPostCommit(hc, &user) })
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// DeleteAccount anonymizes a user and soft-deletes the account. Usage totals,
+// loans, and exports keep counting under a pseudonym, while lists,
+// notifications, and pending mail go. The last admin and users with borrowed
+// copies can't delete their account.
+func (us *UserService) DeleteAccount(username string) error {
+	user, err := us.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user.Role == "admin" {
+		var admins int64
+		if err := us.db.Model(&User{}).Where("role = ?", "admin").Count(&admins).Error; err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return errors.New("last admin")
+		}
+	}
+	var borrowed int64
+	if err := us.db.Model(&Loan{}).Where("borrower = ? AND returned_at IS NULL", username).Count(&borrowed).Error; err != nil {
+		return err
+	}
+	if borrowed > 0 {
+		return errors.New("copies still borrowed")
+	}
+
+	pseudonym := fmt.Sprintf("deleted-%d", user.ID)
+	return us.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&MeteringEvent{}, &UsageRollup{}} {
+			if err := tx.Model(model).Where("username = ?", username).Update("username", pseudonym).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&Loan{}).Where("borrower = ?", username).Update("borrower", pseudonym).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&ExportSnapshot{}).Where("created_by = ?", username).Update("created_by", pseudonym).Error; err != nil {
+			return err
+		}
+
+		var listIDs []uint
+		if err := tx.Model(&FilmList{}).Where("owner = ?", username).Pluck("id", &listIDs).Error; err != nil {
+			return err
+		}
+		if len(listIDs) > 0 {
+			if err := tx.Where("list_id IN ?", listIDs).Delete(&FilmListItem{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", listIDs).Delete(&FilmList{}).Error; err != nil {
+				return err
+			}
+		}
+		for _, model := range []interface{}{&Notification{}, &MailToken{}} {
+			if err := tx.Where("username = ?", username).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if user.Email != nil {
+			if err := tx.Where(`"to" = ? AND sent_at IS NULL`, *user.Email).Delete(&OutboxEmail{}).Error; err != nil {
+				return err
+			}
+		}
+
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"username":       pseudonym,
+			"password":       unusablePassword,
+			"email":          nil,
+			"email_verified": false,
+			"display_name":   "",
+			"avatar_url":     "",
+			"digest":         false,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(user).Error
+	})
+}
+
+// PurgeDeleted permanently removes the accounts deleted before a time,
+// returning how many were removed. Films they added stay without a creator.
+func (us *UserService) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := us.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Unscoped().Model(&User{}).Where("deleted_at < ?", before).Pluck("id", &ids).Error; err != nil || len(ids) == 0 {
+			return err
+		}
+		if err := tx.Unscoped().Model(&Film{}).Where("created_by IN ?", ids).Update("created_by", nil).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("id IN ?", ids).Delete(&User{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+// ExportAccount gathers the data stored about a user. Sessions live in the
+// token store and are added by the caller.
+func (us *UserService) ExportAccount(username string) (*AccountData, error) {
+	user, err := us.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	data := AccountData{
+		ExportedAt: time.Now().UTC(),
+		Profile:    newUserProfile(user),
+		Sessions:   []Session{},
+	}
+	if data.Lists, err = us.lists.GetLists(username); err != nil {
+		return nil, err
+	}
+	if err := us.db.Where("borrower = ?", username).Order("borrowed_at, id").Find(&data.Loans).Error; err != nil {
+		return nil, err
+	}
+	if err := us.db.Where("username = ?", username).Order("created_at, id").Find(&data.Notifications).Error; err != nil {
+		return nil, err
+	}
+	if err := us.db.Where("username = ?", username).Order("day, operation, tenant").Find(&data.Usage).Error; err != nil {
+		return nil, err
+	}
+	if err := us.db.Where("created_by = ?", user.ID).Order("id").Find(&data.FilmsAdded).Error; err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// SetActive deactivates or reactivates a user of an organization. Its last
+// active admin can't be deactivated, so someone is always left to reactivate
+// accounts.
+func (us *UserService) SetActive(organizationID uint, username string, active bool) (*User, error) {
+	var user User
+	if err := us.db.Scopes(tenantScope(organizationID)).Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+	if !active && user.Active && user.Role == "admin" {
+		var admins int64
+		if err := us.db.Model(&User{}).Scopes(tenantScope(organizationID)).Where("role = ? AND active", "admin").Count(&admins).Error; err != nil {
+			return nil, err
+		}
+		if admins <= 1 {
+			return nil, errors.New("last admin")
+		}
+	}
+	if err := us.db.Model(&user).Update("active", active).Error; err != nil {
+		return nil, err
+	}
+	user.Active = active
+	return &user, nil
+}
+
+// GetUsersPage retrieves one page of the users of an organization ordered by
+// username, with the total count. search matches part of the username, email,
+// or display name; an empty search or role matches every user.
+func (us *UserService) GetUsersPage(organizationID uint, search, role string, page, pageSize int) ([]User, int64, error) {
+	query := us.db.Model(&User{}).Scopes(tenantScope(organizationID))
+	if search != "" {
+		pattern := "%" + escapeLike(search) + "%"
+		query = query.Where("username ILIKE ? OR email ILIKE ? OR display_name ILIKE ?", pattern, pattern, pattern)
+	}
+	if role != "" {
+		query = query.Where("role = ?", role)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []User
+	err := query.Order("username").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error
+	return users, total, err
+}
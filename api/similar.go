@@ -0,0 +1,122 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm/clause"
+)
+
+// Weights of what a film shares with the one it is similar to
+const (
+	similarDirectorWeight = 3
+	similarGenreWeight    = 2
+	similarDecadeWeight   = 1
+)
+
+// Similar film limits
+const (
+	defaultSimilarLimit = 10
+	maxSimilarLimit     = 50
+)
+
+// SimilarFilm is a film ranked by what it shares with another film
+// @Description Similar film with its score
+type SimilarFilm struct {
+	Film
+	Score   int      `json:"score" xml:"score" example:"5"`
+	Reasons []string `json:"reasons" gorm:"-" xml:"reasons>reason" example:"same_director,same_genre"`
+}
+
+// GetSimilarFilms ranks the other films by the weighted sum of sharing the
+// director, the genre, and the decade of a film. Films sharing none are left
+// out; ties go to the closest year.
+func (fs *FilmService) GetSimilarFilms(film *Film, limit int) ([]SimilarFilm, error) {
+	decade := film.Year / 10
+	var similar []SimilarFilm
+	err := fs.db.Model(&Film{}).
+		Select(fmt.Sprintf(`films.*, `+
+			`CASE WHEN lower(director) = lower(?) THEN %d ELSE 0 END + `+
+			`CASE WHEN lower(genre) = lower(?) AND genre <> '' THEN %d ELSE 0 END + `+
+			`CASE WHEN year / 10 = ? THEN %d ELSE 0 END AS score`,
+			similarDirectorWeight, similarGenreWeight, similarDecadeWeight),
+			film.Director, film.Genre, decade).
+		Where("id <> ?", film.ID).
+		Where("(lower(director) = lower(?) OR (lower(genre) = lower(?) AND genre <> '') OR year / 10 = ?)", film.Director, film.Genre, decade).
+		Clauses(clause.OrderBy{Expression: clause.Expr{SQL: "score DESC, abs(year - ?), id", Vars: []interface{}{film.Year}}}).
+		Limit(limit).
+		Find(&similar).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range similar {
+		similar[i].Reasons = similarReasons(film, &similar[i].Film)
+	}
+	return similar, nil
+}
+
+// similarReasons names what two films share, for "because you liked" labels
+func similarReasons(film, other *Film) []string {
+	reasons := []string{}
+	if strings.EqualFold(film.Director, other.Director) {
+		reasons = append(reasons, "same_director")
+	}
+	if film.Genre != "" && strings.EqualFold(film.Genre, other.Genre) {
+		reasons = append(reasons, "same_genre")
+	}
+	if film.Year/10 == other.Year/10 {
+		reasons = append(reasons, "same_decade")
+	}
+	return reasons
+}
+
+// similarFilmsHandler handles GET /api/films/{id}/similar
+func (s *Server) similarFilmsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/films/"), "/similar")
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid film ID", Code: "invalid_film_id"})
+		return
+	}
+	limit := defaultSimilarLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxSimilarLimit {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "limit must be between 1 and 50", Code: "limit_invalid", Params: Params{"min": 1, "max": 50}})
+			return
+		}
+		limit = parsed
+	}
+
+	catalog := s.tenantCatalog(r)
+	film, err := catalog.GetFilmByID(uint(id))
+	if err != nil {
+		if err.Error() == "film not found" {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Film not found", Code: "film_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve film", Code: "film_retrieve_failed"})
+		}
+		return
+	}
+
+	similar, err := catalog.GetSimilarFilms(film, limit)
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve similar films", Code: "similar_retrieve_failed"})
+		return
+	}
+	for i := range similar {
+		withLinks(&similar[i].Film)
+	}
+	if similar == nil {
+		similar = []SimilarFilm{}
+	}
+	writeResponse(w, r, http.StatusOK, similar)
+}
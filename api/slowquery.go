@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"log"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// slowQueryLogger logs SQL like the GORM logger it wraps, and logs queries
+// slower than the threshold as warnings naming the handler that ran them
+type slowQueryLogger struct {
+	logger.Interface
+	level     logger.LogLevel
+	threshold time.Duration
+}
+
+// newDBLogger returns the database logger for the logging settings
+func newDBLogger(cfg *Config) (logger.Interface, error) {
+	level, err := cfg.LogLevel()
+	if err != nil {
+		return nil, err
+	}
+	inner := logger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), logger.Config{
+		// Slow queries are logged by slowQueryLogger itself
+		SlowThreshold: 0,
+		LogLevel:      level,
+		Colorful:      true,
+	})
+	return slowQueryLogger{Interface: inner, level: level, threshold: cfg.Logging.SlowQueryThreshold}, nil
+}
+
+// LogMode returns a logger fixed at the given level, as used by db.Debug()
+func (sl slowQueryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	sl.Interface = sl.Interface.LogMode(level)
+	sl.level = level
+	return sl
+}
+
+// Trace logs a SQL statement, as a warning when it ran longer than the threshold
+func (sl slowQueryLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sl.Interface.Trace(ctx, begin, fc, err)
+
+	elapsed := time.Since(begin)
+	if sl.threshold <= 0 || elapsed <= sl.threshold || sl.level < logger.Warn {
+		return
+	}
+	sql, rows := fc()
+	log.Printf("🐢 Slow query in %s took %s (threshold %s, %d rows): %s", callingHandler(), elapsed, sl.threshold, rows, sql)
+}
+
+// callingHandler names the HTTP handler up the stack, or the first caller
+// outside GORM and the loggers for queries run by jobs and startup code
+func callingHandler() string {
+	// Functions of this package are prefixed main. in the server and with the
+	// module path in test binaries
+	self := runtime.FuncForPC(reflect.ValueOf(callingHandler).Pointer()).Name()
+	prefix := strings.TrimSuffix(self, "callingHandler")
+
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	caller := ""
+	for {
+		frame, more := frames.Next()
+		if name, ok := strings.CutPrefix(frame.Function, prefix); ok {
+			// Closures are named after the function they are declared in
+			name, _, _ = strings.Cut(name, ".")
+			if strings.HasSuffix(name, "Handler") {
+				return name
+			}
+			if caller == "" && name != "slowQueryLogger" && name != "(*reloadableLogger)" {
+				caller = frame.File + ":" + strconv.Itoa(frame.Line)
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	return caller
+}
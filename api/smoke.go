@@ -0,0 +1,285 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smokeClient sends requests to a deployment, for smoke runs and purge-tokens
+type smokeClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// smokeResponse is a response read in full
+type smokeResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// do sends a request with the login token and a JSON body, if any
+func (sc *smokeClient) do(method, path string, body interface{}, header map[string]string) (*smokeResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(content)
+	}
+	req, err := http.NewRequest(method, sc.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if sc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+sc.token)
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := sc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	return &smokeResponse{status: resp.StatusCode, header: resp.Header, body: content}, nil
+}
+
+// expect checks the status of a response and decodes its JSON body into out
+func (resp *smokeResponse) expect(status int, out interface{}) error {
+	if resp.status != status {
+		return fmt.Errorf("expected status %d, got %d: %s", status, resp.status, strings.TrimSpace(string(resp.body)))
+	}
+	if out == nil {
+		return nil
+	}
+	if contentType := resp.header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		return fmt.Errorf("expected a JSON response, got Content-Type %q", contentType)
+	}
+	if err := json.Unmarshal(resp.body, out); err != nil {
+		return fmt.Errorf("invalid response body: %v", err)
+	}
+	return nil
+}
+
+// smokeCommand runs a scripted scenario against a live deployment and fails
+// on the first response that breaks the API contract
+func smokeCommand(args []string) error {
+	flags := flag.NewFlagSet("smoke", flag.ContinueOnError)
+	baseURL := flags.String("base-url", "", "Base URL of the deployment, e.g. https://staging.example.com")
+	username := flags.String("username", getEnv("SMOKE_USERNAME", ""), "Account to log in with (env SMOKE_USERNAME)")
+	password := flags.String("password", getEnv("SMOKE_PASSWORD", ""), "Password of the account, prompted when empty (env SMOKE_PASSWORD)")
+	timeout := flags.Duration("timeout", 10*time.Second, "Timeout of each request")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *baseURL == "" {
+		return fmt.Errorf("-base-url is required")
+	}
+	if *username == "" {
+		return fmt.Errorf("-username is required")
+	}
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	sc := &smokeClient{
+		baseURL: strings.TrimRight(*baseURL, "/"),
+		client:  &http.Client{Timeout: *timeout},
+	}
+
+	var film Film
+	filmReq := FilmRequest{
+		Title:    "Smoke Test " + time.Now().UTC().Format("20060102-150405.000"),
+		Director: "Smoke Runner",
+		Year:     time.Now().Year(),
+		Genre:    "Drama",
+	}
+	// Remove the film when a step after its creation fails
+	created := false
+	defer func() {
+		if created {
+			sc.do("DELETE", filmPath(film.ID), nil, nil)
+		}
+	}()
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"login", func() error {
+			resp, err := sc.do("POST", "/api/login", LoginRequest{Username: *username, Password: pass}, nil)
+			if err != nil {
+				return err
+			}
+			var login LoginResponse
+			if err := resp.expect(http.StatusOK, &login); err != nil {
+				return err
+			}
+			if login.Token == "" {
+				return fmt.Errorf("login returned no token")
+			}
+			sc.token = login.Token
+			return nil
+		}},
+		{"create film", func() error {
+			resp, err := sc.do("POST", "/api/films", filmReq, nil)
+			if err != nil {
+				return err
+			}
+			if err := resp.expect(http.StatusCreated, &film); err != nil {
+				return err
+			}
+			created = film.ID != 0
+			if !created {
+				return fmt.Errorf("created film has no id")
+			}
+			if film.Title != filmReq.Title || film.Director != filmReq.Director || film.Year != filmReq.Year || film.Genre != filmReq.Genre {
+				return fmt.Errorf("created film does not match the request: %+v", film)
+			}
+			if film.Version != 1 {
+				return fmt.Errorf("expected version 1, got %d", film.Version)
+			}
+			if film.Links == nil || film.Links.Self.Href != filmPath(film.ID) {
+				return fmt.Errorf("expected a self link to %s", filmPath(film.ID))
+			}
+			return nil
+		}},
+		{"update film", func() error {
+			filmReq.Genre = "Comedy"
+			resp, err := sc.do("PUT", filmPath(film.ID), filmReq, map[string]string{"If-Match": fmt.Sprintf(`"%d"`, film.Version)})
+			if err != nil {
+				return err
+			}
+			var updated Film
+			if err := resp.expect(http.StatusOK, &updated); err != nil {
+				return err
+			}
+			if updated.Genre != filmReq.Genre {
+				return fmt.Errorf("expected genre %s, got %s", filmReq.Genre, updated.Genre)
+			}
+			if updated.Version != film.Version+1 {
+				return fmt.Errorf("expected version %d, got %d", film.Version+1, updated.Version)
+			}
+			film = updated
+			return nil
+		}},
+		{"get film", func() error {
+			resp, err := sc.do("GET", filmPath(film.ID), nil, nil)
+			if err != nil {
+				return err
+			}
+			var fetched Film
+			if err := resp.expect(http.StatusOK, &fetched); err != nil {
+				return err
+			}
+			if fetched.Genre != film.Genre || fetched.Version != film.Version {
+				return fmt.Errorf("fetched film does not match the update: %+v", fetched)
+			}
+			if etag := strings.Trim(resp.header.Get("ETag"), `"`); etag != strconv.Itoa(film.Version) {
+				return fmt.Errorf("expected ETag %d, got %q", film.Version, etag)
+			}
+			return nil
+		}},
+		{"list films", func() error {
+			resp, err := sc.do("GET", fmt.Sprintf("/api/films?page=1&page_size=%d", maxPageSize), nil, nil)
+			if err != nil {
+				return err
+			}
+			var page FilmPage
+			if err := resp.expect(http.StatusOK, &page); err != nil {
+				return err
+			}
+			if page.Total < 1 || page.Links.Self.Href == "" {
+				return fmt.Errorf("expected a page with a total and a self link")
+			}
+
+			// Films are listed by ID, so the new film is on the last page
+			last := int((page.Total + int64(maxPageSize) - 1) / int64(maxPageSize))
+			if last > 1 {
+				resp, err = sc.do("GET", fmt.Sprintf("/api/films?page=%d&page_size=%d", last, maxPageSize), nil, nil)
+				if err != nil {
+					return err
+				}
+				page = FilmPage{}
+				if err := resp.expect(http.StatusOK, &page); err != nil {
+					return err
+				}
+				if page.Links.Prev == nil {
+					return fmt.Errorf("expected a prev link on page %d", last)
+				}
+			}
+			for _, listed := range page.Data {
+				if listed.ID == film.ID {
+					return nil
+				}
+			}
+			return fmt.Errorf("film %d is missing from page %d", film.ID, last)
+		}},
+		{"delete film", func() error {
+			resp, err := sc.do("DELETE", filmPath(film.ID), nil, nil)
+			if err != nil {
+				return err
+			}
+			if err := resp.expect(http.StatusNoContent, nil); err != nil {
+				return err
+			}
+			created = false
+
+			resp, err = sc.do("GET", filmPath(film.ID), nil, nil)
+			if err != nil {
+				return err
+			}
+			return resp.expect(http.StatusNotFound, &ErrorResponse{})
+		}},
+		{"logout", func() error {
+			resp, err := sc.do("POST", "/api/logout", nil, nil)
+			if err != nil {
+				return err
+			}
+			if err := resp.expect(http.StatusOK, &SuccessResponse{}); err != nil {
+				return err
+			}
+
+			resp, err = sc.do("GET", "/api/films?page=1", nil, nil)
+			if err != nil {
+				return err
+			}
+			if err := resp.expect(http.StatusUnauthorized, &ErrorResponse{}); err != nil {
+				return fmt.Errorf("token still works after logout: %v", err)
+			}
+			return nil
+		}},
+	}
+
+	fmt.Printf("Running smoke test against %s\n", sc.baseURL)
+	for _, step := range steps {
+		started := time.Now()
+		if err := step.run(); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", step.name, err)
+			return fmt.Errorf("smoke test failed at %s", step.name)
+		}
+		fmt.Printf("✅ %s (%s)\n", step.name, time.Since(started).Round(time.Millisecond))
+	}
+	fmt.Println("✅ Smoke test passed")
+	return nil
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SPAHandler serves a built frontend: files from a dist directory, index.html
+// for client-side routes, and long-lived caching for fingerprinted assets.
+// Without a directory it only serves the embedded index.html at "/".
+type SPAHandler struct {
+	dir            string
+	immutableGlobs []string
+	assets         fs.FS
+}
+
+// NewSPAHandler creates a frontend handler from STATIC_DIR and
+// STATIC_IMMUTABLE_GLOBS, serving index.html from assetsDir when set
+func NewSPAHandler(assetsDir string) *SPAHandler {
+	var globs []string
+	for _, glob := range strings.Split(getEnv("STATIC_IMMUTABLE_GLOBS", "assets/*,static/*"), ",") {
+		if glob = strings.TrimSpace(glob); glob != "" {
+			globs = append(globs, glob)
+		}
+	}
+	return &SPAHandler{
+		dir:            getEnv("STATIC_DIR", ""),
+		immutableGlobs: globs,
+		assets:         assetFS(assetsDir),
+	}
+}
+
+// isImmutable reports whether a file is a fingerprinted asset that never changes
+func (h *SPAHandler) isImmutable(name string) bool {
+	for _, glob := range h.immutableGlobs {
+		if matched, _ := path.Match(glob, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *SPAHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Unknown API routes must never fall back to the frontend
+	if r.URL.Path == "/api" || strings.HasPrefix(r.URL.Path, "/api/") {
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Not found", Code: "not_found"})
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.dir == "" {
+		if r.URL.Path == "/" {
+			http.ServeFileFS(w, r, h.assets, "index.html")
+		} else {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name != "" && !strings.HasPrefix(path.Base(name), ".") {
+		file := filepath.Join(h.dir, filepath.FromSlash(name))
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			if h.isImmutable(name) {
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			} else {
+				w.Header().Set("Cache-Control", "no-cache")
+			}
+			http.ServeFile(w, r, file)
+			return
+		}
+
+		// Missing files are real 404s, extensionless paths are client-side routes
+		if path.Ext(name) != "" {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFile(w, r, filepath.Join(h.dir, "index.html"))
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// streamBufferSize is how much of a stream is sent to the client at a time
+const streamBufferSize = 32 << 10
+
+// StreamFilms calls fn with every film matching a query, in ID order. Films
+// are scanned one row at a time, so memory doesn't grow with the catalog;
+// the query holds its connection until the last row is read or fn fails.
+func (fs *FilmService) StreamFilms(query *FilmQuery, fn func(film *Film) error) error {
+	rows, err := fs.db.Model(&Film{}).Scopes(query.scope).Order("id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var film Film
+		if err := fs.db.ScanRows(rows, &film); err != nil {
+			return err
+		}
+		if err := fn(&film); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// flushWriter sends everything written to it on to the client at once,
+// instead of when the handler returns
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func newFlushWriter(w http.ResponseWriter) *flushWriter {
+	return &flushWriter{w: w, rc: http.NewResponseController(w)}
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := fw.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+	return n, nil
+}
+
+// streamFilmsHandler handles GET /api/films/stream, the whole catalog or the
+// films matching ?q= as newline-delimited JSON, one film per line in ID
+// order. Lines go out in chunks as they are read, so catalogs of any size
+// export in constant memory.
+func (s *Server) streamFilmsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	var filter *FilmQuery
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		var err error
+		if filter, err = ParseFilmQuery(q); err != nil {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error(), Code: "invalid_query", Params: Params{"detail": err}})
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	counter := &countingWriter{w: newFlushWriter(w)}
+	writer := bufio.NewWriterSize(counter, streamBufferSize)
+	encoder := json.NewEncoder(writer)
+	var count int64
+	err := s.tenantCatalog(r).StreamFilms(filter, func(film *Film) error {
+		count++
+		return encoder.Encode(film)
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		s.meteringService.RecordRequest(r, MeterExport, count)
+		return
+	}
+	log.Printf("Warning: Film stream failed after %d films: %v", count, err)
+	if counter.n == 0 {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to stream films", Code: "films_stream_failed"})
+		return
+	}
+	// Once lines have gone out, the 200 is sent. Aborting the connection
+	// keeps the response from ending cleanly, so clients can't mistake a
+	// cut-off stream for the whole catalog.
+	panic(http.ErrAbortHandler)
+}
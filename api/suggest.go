@@ -0,0 +1,118 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm/clause"
+)
+
+// Suggestion limits
+const (
+	defaultSuggestLimit  = 10
+	maxSuggestLimit      = 25
+	maxSuggestTermLength = 100
+)
+
+// Kinds of suggestions
+const (
+	suggestionTitle    = "title"
+	suggestionDirector = "director"
+)
+
+// FilmSuggestion is a title or director completing what was typed
+// @Description Typeahead suggestion
+type FilmSuggestion struct {
+	Text string `json:"text" xml:"text" example:"The Shawshank Redemption"`
+	Kind string `json:"kind" xml:"kind,attr" example:"title"` // title or director
+}
+
+// FilmSuggestResponse lists the suggestions for a prefix, best first
+// @Description Typeahead suggestions
+type FilmSuggestResponse struct {
+	Query string           `json:"query" xml:"query" example:"sha"`
+	Data  []FilmSuggestion `json:"data" xml:"data>suggestion"`
+}
+
+// SuggestFilms returns up to limit distinct titles and directors that start
+// with a prefix, or have a word starting with it, ignoring case. Values
+// starting with the prefix come first, then shorter ones. The lower(...)
+// text_pattern_ops indexes serve the start of the value, and the trigram
+// indexes the start of a later word.
+func (fs *FilmService) SuggestFilms(prefix string, limit int) ([]FilmSuggestion, error) {
+	prefix = strings.ToLower(prefix)
+	var suggestions []FilmSuggestion
+	for _, kind := range []string{suggestionTitle, suggestionDirector} {
+		var values []string
+		err := fs.db.Model(&Film{}).
+			Where("lower("+kind+") LIKE ? OR "+kind+" ILIKE ?", escapeLike(prefix)+"%", "% "+escapeLike(prefix)+"%").
+			Group(kind).
+			Clauses(clause.OrderBy{Expression: clause.Expr{
+				SQL:  "lower(" + kind + ") LIKE ? DESC, length(" + kind + "), " + kind,
+				Vars: []interface{}{escapeLike(prefix) + "%"},
+			}}).
+			Limit(limit).
+			Pluck(kind, &values).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			suggestions = append(suggestions, FilmSuggestion{Text: value, Kind: kind})
+		}
+	}
+
+	// Rank titles and directors together the way each query ranked its own
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		a, b := suggestions[i].Text, suggestions[j].Text
+		aStarts, bStarts := strings.HasPrefix(strings.ToLower(a), prefix), strings.HasPrefix(strings.ToLower(b), prefix)
+		if aStarts != bStarts {
+			return aStarts
+		}
+		if utf8.RuneCountInString(a) != utf8.RuneCountInString(b) {
+			return utf8.RuneCountInString(a) < utf8.RuneCountInString(b)
+		}
+		return a < b
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// suggestFilmsHandler handles GET /api/films/suggest, the typeahead for the search box
+func (s *Server) suggestFilmsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	query := r.URL.Query()
+	term := strings.TrimSpace(query.Get("q"))
+	if term == "" || utf8.RuneCountInString(term) > maxSuggestTermLength {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "q must be between 1 and 100 characters", Code: "search_term_invalid", Params: Params{"min": 1, "max": 100}})
+		return
+	}
+	limit := defaultSuggestLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxSuggestLimit {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "limit must be between 1 and 25", Code: "limit_invalid", Params: Params{"min": 1, "max": 25}})
+			return
+		}
+		limit = parsed
+	}
+
+	suggestions, err := s.tenantCatalog(r).SuggestFilms(term, limit)
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to suggest films", Code: "suggest_failed"})
+		return
+	}
+	if suggestions == nil {
+		suggestions = []FilmSuggestion{}
+	}
+
+	writeResponse(w, r, http.StatusOK, FilmSuggestResponse{Query: term, Data: suggestions})
+}
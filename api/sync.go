@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Delta sync limits
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+	// syncSettleTime leaves the newest changes for the next sync, so a
+	// transaction committing a little late can't slip behind a checkpoint
+	syncSettleTime = 5 * time.Second
+)
+
+// filmChangedAtSQL is when a film last changed: its deletion, or its last update
+const filmChangedAtSQL = "COALESCE(deleted_at, updated_at)"
+
+// SyncCursor is the position after the last change a client has synced.
+// Clients receive it base64 encoded and must treat it as opaque.
+type SyncCursor struct {
+	ChangedAt time.Time `json:"t"`
+	ID        uint      `json:"id"`
+}
+
+// Encode returns the opaque representation of the cursor
+func (c SyncCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeSyncCursor parses a cursor returned by a previous sync
+func DecodeSyncCursor(value string) (*SyncCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cursor SyncCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ChangedAt.IsZero() {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// changedAt returns when a film last changed, as filmChangedAtSQL does
+func (film *Film) changedAt() time.Time {
+	if film.DeletedAt.Valid {
+		return film.DeletedAt.Time
+	}
+	return film.UpdatedAt
+}
+
+// FilmChange is a film created or updated since a checkpoint, or the
+// tombstone of a film deleted since
+// @Description Changed film
+type FilmChange struct {
+	Film
+	Deleted   bool       `json:"deleted" xml:"deleted"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" xml:"deleted_at,omitempty"`
+}
+
+// FilmChangesResponse lists the changes after a checkpoint, oldest first
+// @Description Delta sync page
+type FilmChangesResponse struct {
+	Data []FilmChange `json:"data" xml:"data>change"`
+	// NextCursor is the checkpoint to pass as since next time, also when nothing changed
+	NextCursor string `json:"next_cursor" xml:"next_cursor" example:"eyJ0IjoiMjAyNS0wMS0xNVQwOTowMDowMFoiLCJpZCI6NH0"`
+	HasMore    bool   `json:"has_more" xml:"has_more" example:"false"`
+}
+
+// GetChanges returns up to limit films changed after a position and no later
+// than until, oldest change first, including the films deleted since
+func (fs *FilmService) GetChanges(after SyncCursor, until time.Time, limit int) ([]Film, error) {
+	var films []Film
+	err := fs.db.Unscoped().
+		Where(filmChangedAtSQL+" <= ?", until).
+		Where("("+filmChangedAtSQL+", id) > (?, ?)", after.ChangedAt, after.ID).
+		Order(filmChangedAtSQL + ", id").
+		Limit(limit).
+		Find(&films).Error
+	return films, err
+}
+
+// GetChanges returns up to limit films changed after a position and no later
+// than until, oldest change first. Deleted films are gone at once, so there
+// are no tombstones.
+func (m *MemoryFilmRepository) GetChanges(after SyncCursor, until time.Time, limit int) ([]Film, error) {
+	m.table.mu.RLock()
+	films := make([]Film, 0)
+	for _, film := range m.table.films {
+		changedAt := film.changedAt()
+		if !m.visible(&film) || changedAt.After(until) || changedAt.Before(after.ChangedAt) ||
+			(changedAt.Equal(after.ChangedAt) && film.ID <= after.ID) {
+			continue
+		}
+		films = append(films, film)
+	}
+	m.table.mu.RUnlock()
+
+	sort.Slice(films, func(i, j int) bool {
+		if a, b := films[i].changedAt(), films[j].changedAt(); !a.Equal(b) {
+			return a.Before(b)
+		}
+		return films[i].ID < films[j].ID
+	})
+	if len(films) > limit {
+		films = films[:limit]
+	}
+	return films, nil
+}
+
+// filmChangesHandler handles GET /api/films/changes, the delta sync of
+// offline clients. since is an RFC 3339 time or the next_cursor of the last
+// sync; without it the whole catalog is sent.
+func (s *Server) filmChangesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	query := r.URL.Query()
+	var after SyncCursor
+	if since := query.Get("since"); since != "" {
+		if at, err := time.Parse(time.RFC3339Nano, since); err == nil {
+			after.ChangedAt = at
+		} else if cursor, err := DecodeSyncCursor(since); err == nil {
+			after = *cursor
+		} else {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "since must be an RFC 3339 time or a cursor from a previous sync", Code: "changes_since_invalid"})
+			return
+		}
+	}
+	limit := defaultChangesLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxChangesLimit {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "limit must be between 1 and 1000", Code: "limit_invalid", Params: Params{"min": 1, "max": 1000}})
+			return
+		}
+		limit = parsed
+	}
+
+	// Tombstones are purged with the trash; a client that last synced before
+	// that would never hear of the films deleted since
+	now := s.db.NowFunc()
+	if retention := s.currentConfig().Jobs.TrashRetention; retention > 0 && !after.ChangedAt.IsZero() && after.ChangedAt.Before(now.Add(-retention)) {
+		writeResponse(w, r, http.StatusGone, ErrorResponse{Error: "Checkpoint is older than the trash retention, sync the whole catalog again", Code: "changes_checkpoint_expired"})
+		return
+	}
+
+	until := now.Add(-syncSettleTime)
+	films, err := s.tenantFilms(r).GetChanges(after, until, limit+1)
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve changes", Code: "changes_retrieve_failed"})
+		return
+	}
+
+	response := FilmChangesResponse{Data: []FilmChange{}}
+	if len(films) > limit {
+		films, response.HasMore = films[:limit], true
+	}
+	for _, film := range films {
+		change := FilmChange{Film: film}
+		if film.DeletedAt.Valid {
+			deletedAt := film.DeletedAt.Time
+			change.Deleted, change.DeletedAt = true, &deletedAt
+		} else {
+			withLinks(&change.Film)
+		}
+		response.Data = append(response.Data, change)
+	}
+
+	// Once caught up, the checkpoint moves on to until even without changes,
+	// so a quiet catalog doesn't age checkpoints past the trash retention
+	if response.HasMore {
+		last := films[len(films)-1]
+		after = SyncCursor{ChangedAt: last.changedAt().UTC(), ID: last.ID}
+	} else if after.ChangedAt.Before(until) {
+		after = SyncCursor{ChangedAt: until.UTC()}
+	}
+	response.NextCursor = after.Encode()
+	writeResponse(w, r, http.StatusOK, response)
+}
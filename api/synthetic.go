@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Synthetic data limits. A batch of films must stay below the 65535 bind
+// parameters PostgreSQL allows in one statement.
+const (
+	defaultSyntheticBatchSize = 1000
+	maxSyntheticBatchSize     = 2000
+)
+
+// syntheticPassword is the password of every synthetic user, so load tests can sign in as them
+const syntheticPassword = "synthetic123"
+
+// Values synthetic films pick from, all ones validation accepts
+var (
+	syntheticLanguages = []string{"en", "fr", "es", "de", "it", "ja", "ko", "hi", "zh", "pt"}
+	syntheticCountries = []string{"US", "GB", "FR", "ES", "DE", "IT", "JP", "KR", "IN", "CN", "BR"}
+)
+
+// SyntheticOptions says how much fake data GenerateSyntheticData creates
+type SyntheticOptions struct {
+	Films     int
+	Users     int
+	Seed      uint64 // the same seed generates the same data; 0 picks a random one
+	BatchSize int
+}
+
+// GenerateSyntheticData inserts fake but realistic users and films into the
+// default organization, for benchmarking pagination, search, and caching on
+// large catalogs. Rows go in batches of their own transaction, so a long run
+// can be interrupted and keeps what it inserted. Rows clashing with stored
+// ones, like a rerun with the same seed, are skipped. It returns how many
+// films and users were inserted.
+func GenerateSyntheticData(db *gorm.DB, opts SyntheticOptions) (int, int, error) {
+	if opts.Films < 0 || opts.Users < 0 {
+		return 0, 0, errors.New("film and user counts must not be negative")
+	}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = defaultSyntheticBatchSize
+	}
+	if opts.BatchSize < 1 || opts.BatchSize > maxSyntheticBatchSize {
+		return 0, 0, fmt.Errorf("batch size must be between 1 and %d", maxSyntheticBatchSize)
+	}
+
+	organization, err := ensureDefaultOrganization(db)
+	if err != nil {
+		return 0, 0, err
+	}
+	faker := gofakeit.New(opts.Seed)
+	now := db.NowFunc()
+
+	var creators []uint
+	users := 0
+	for start := 0; start < opts.Users; start += opts.BatchSize {
+		batch := make([]User, 0, min(opts.BatchSize, opts.Users-start))
+		for i := start; i < start+cap(batch); i++ {
+			first, last := faker.FirstName(), faker.LastName()
+			// The index keeps usernames unique within a run
+			username := strings.ToLower(first+"."+last) + strconv.Itoa(i+1)
+			email := username + "@example.com"
+			createdAt := faker.DateRange(now.AddDate(-3, 0, 0), now)
+			batch = append(batch, User{
+				Username:       username,
+				Password:       syntheticPassword,
+				Role:           "user",
+				Active:         true,
+				Email:          &email,
+				EmailVerified:  faker.Bool(),
+				DisplayName:    first + " " + last,
+				OrganizationID: organization.ID,
+				CreatedAt:      createdAt,
+				UpdatedAt:      createdAt,
+			})
+		}
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&batch)
+		if result.Error != nil {
+			return 0, users, fmt.Errorf("failed to insert users: %v", result.Error)
+		}
+		users += int(result.RowsAffected)
+		for _, user := range batch {
+			// Skipped rows come back without an ID
+			if user.ID != 0 {
+				creators = append(creators, user.ID)
+			}
+		}
+		log.Printf("👤 Inserted %d of %d synthetic users", min(start+opts.BatchSize, opts.Users), opts.Users)
+	}
+
+	films := 0
+	for start := 0; start < opts.Films; start += opts.BatchSize {
+		batch := make([]Film, 0, min(opts.BatchSize, opts.Films-start))
+		for i := start; i < start+cap(batch); i++ {
+			batch = append(batch, syntheticFilm(faker, organization.ID, creators, now))
+		}
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&batch)
+		if result.Error != nil {
+			return films, users, fmt.Errorf("failed to insert films: %v", result.Error)
+		}
+		films += int(result.RowsAffected)
+		log.Printf("🎬 Inserted %d of %d synthetic films", min(start+opts.BatchSize, opts.Films), opts.Films)
+	}
+	return films, users, nil
+}
+
+// syntheticFilm returns a fake film of an organization, created by one of
+// creators if there are any
+func syntheticFilm(faker *gofakeit.Faker, organizationID uint, creators []uint, now time.Time) Film {
+	createdAt := faker.DateRange(now.AddDate(-3, 0, 0), now)
+	updatedAt := createdAt
+	if faker.IntRange(0, 3) == 0 {
+		updatedAt = faker.DateRange(createdAt, now)
+	}
+	film := Film{
+		Title:          faker.MovieName(),
+		Director:       faker.Name(),
+		Year:           faker.IntRange(1920, now.Year()),
+		Genre:          faker.MovieGenre(),
+		RuntimeMinutes: faker.IntRange(70, 200),
+		Synopsis:       faker.Sentence(),
+		Language:       faker.RandomString(syntheticLanguages),
+		Country:        faker.RandomString(syntheticCountries),
+		AgeRating:      faker.RandomString(ageRatings),
+		Version:        1,
+		OrganizationID: organizationID,
+		CreatedAt:      createdAt,
+		UpdatedAt:      updatedAt,
+	}
+	if len(creators) > 0 {
+		creator := creators[faker.IntRange(0, len(creators)-1)]
+		film.CreatedBy = &creator
+	}
+	return film
+}
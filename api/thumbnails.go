@@ -0,0 +1,194 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// posterSize is a thumbnail generated for every poster, by its width in
+// pixels; the height keeps the aspect ratio of the poster
+type posterSize struct {
+	Name  string
+	Width int
+}
+
+// posterSizes are the thumbnails clients can ask for with ?size=
+var posterSizes = []posterSize{
+	{Name: "small", Width: 200},
+	{Name: "medium", Width: 600},
+}
+
+// maxPosterPixels is the largest poster thumbnails are generated for, so a
+// small file declaring huge dimensions can't exhaust memory when decoded
+const maxPosterPixels = 40_000_000
+
+// thumbnailTimeout bounds storing the thumbnails of one poster
+const thumbnailTimeout = time.Minute
+
+// posterSizeNames returns the names of the thumbnail sizes
+func posterSizeNames() []string {
+	names := make([]string, len(posterSizes))
+	for i, size := range posterSizes {
+		names[i] = size.Name
+	}
+	return names
+}
+
+// validPosterSize reports whether a size names a thumbnail
+func validPosterSize(name string) bool {
+	for _, size := range posterSizes {
+		if size.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// thumbnailKey returns the blob key of a thumbnail of the poster under a
+// key, next to it: posters/2/9f86d081.jpg becomes posters/2/9f86d081_small.jpg
+func thumbnailKey(key, size string) string {
+	ext := path.Ext(key)
+	return strings.TrimSuffix(key, ext) + "_" + size + ext
+}
+
+// hasPosterSize reports whether the thumbnail of a size is stored for the
+// poster of a film
+func hasPosterSize(film *Film, size string) bool {
+	for _, stored := range strings.Split(film.PosterSizes, ",") {
+		if stored == size {
+			return true
+		}
+	}
+	return false
+}
+
+// decodePoster decodes a JPEG or PNG poster. WebP can't be decoded with the
+// standard library, so WebP posters get no thumbnails.
+func decodePoster(data []byte) (image.Image, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if config.Width*config.Height > maxPosterPixels {
+		return nil, "", fmt.Errorf("poster is %dx%d pixels, more than %d", config.Width, config.Height, maxPosterPixels)
+	}
+	return image.Decode(bytes.NewReader(data))
+}
+
+// shrink scales an image down to a width by averaging the pixels each
+// thumbnail pixel covers, which keeps fine detail from aliasing
+func shrink(src image.Image, width int) *image.RGBA {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	height := max(1, (sh*width+sw/2)/sw)
+
+	// Premultiplied RGBA, so transparent pixels don't bleed their color
+	rgba := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, max((y+1)*sh/height, y*sh/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, max((x+1)*sw/width, x*sw/width+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					pixel := row[sx*4 : sx*4+4]
+					r += uint64(pixel[0])
+					g += uint64(pixel[1])
+					b += uint64(pixel[2])
+					a += uint64(pixel[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// encodeThumbnail encodes a thumbnail in the format of its poster
+func encodeThumbnail(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	case "png":
+		err = png.Encode(&buf, img)
+	default:
+		err = fmt.Errorf("can't encode %s thumbnails", format)
+	}
+	return buf.Bytes(), err
+}
+
+// queuePosterThumbnails generates the thumbnails of a new poster in the
+// background. Until they are stored, and if they can't be made, the poster
+// is served in place of its thumbnails.
+func (s *Server) queuePosterThumbnails(films FilmRepository, id uint, key string, data []byte) {
+	err := s.workerPool.Submit("poster-thumbnails", PriorityLow, func() {
+		if err := s.generatePosterThumbnails(films, id, key, data); err != nil {
+			log.Printf("Warning: Failed to generate thumbnails of poster %s: %v", key, err)
+		}
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to queue thumbnails of poster %s: %v", key, err)
+	}
+}
+
+// generatePosterThumbnails stores the thumbnails of a poster next to it and
+// records them on the film. Sizes as wide as the poster or wider are
+// skipped: the poster itself serves for them. If the poster was replaced or
+// removed meanwhile, the thumbnails are deleted again.
+func (s *Server) generatePosterThumbnails(films FilmRepository, id uint, key string, data []byte) error {
+	img, format, err := decodePoster(data)
+	if errors.Is(err, image.ErrFormat) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), thumbnailTimeout)
+	defer cancel()
+	var stored []string
+	for _, size := range posterSizes {
+		if size.Width >= img.Bounds().Dx() {
+			continue
+		}
+		thumbnail, err := encodeThumbnail(shrink(img, size.Width), format)
+		if err != nil {
+			return err
+		}
+		if err := s.blobs.Put(ctx, thumbnailKey(key, size.Name), bytes.NewReader(thumbnail), int64(len(thumbnail))); err != nil {
+			return err
+		}
+		stored = append(stored, size.Name)
+	}
+	if len(stored) == 0 {
+		return nil
+	}
+	current, err := films.SetPosterSizes(id, key, stored)
+	if err == nil && !current {
+		for _, size := range stored {
+			err = errors.Join(err, s.blobs.Delete(ctx, thumbnailKey(key, size)))
+		}
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// sessionID names the session of a token without revealing the token
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// clientIP returns the address a request came from, as resolveClientIP
+// found it behind trusted proxies
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+// remoteIP returns the address of the peer that sent a request
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// currentToken returns the token of an authenticated request
+func currentToken(r *http.Request) string {
+	token, _ := r.Context().Value(tokenContextKey).(string)
+	return token
+}
+
+// introspectHandler reports whether a token issued by this server is active
+// and what it was issued for, so other services can validate the tokens
+// they are presented
+func (s *Server) introspectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	var introspectionReq IntrospectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&introspectionReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+	if introspectionReq.Token == "" {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Token is required", Code: "token_required"})
+		return
+	}
+
+	info, active := s.tokenStore.Lookup(introspectionReq.Token)
+	if !active {
+		writeResponse(w, r, http.StatusOK, IntrospectionResponse{Active: false})
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, IntrospectionResponse{
+		Active:       true,
+		Username:     info.username,
+		Scope:        strings.Join(info.scopes, " "),
+		Organization: info.tenant.Slug,
+		TokenType:    "Bearer",
+		Exp:          info.expiry.Unix(),
+	})
+}
+
+// logoutAllHandler revokes every token of the authenticated user, the one
+// used for the request included, e.g. after a suspected credential leak
+func (s *Server) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	s.tokenStore.RemoveUserTokens(currentUsername(r))
+	writeResponse(w, r, http.StatusOK, SuccessResponse{Message: "Logged out from all devices"})
+}
+
+// TokenPurgeResult reports how many tokens a purge revoked
+// @Description Token purge result
+type TokenPurgeResult struct {
+	Revoked int `json:"revoked" example:"12"`
+}
+
+// purgeTokensHandler revokes every token of every organization, the one used
+// for the request included, e.g. after a leaked signing secret or a security
+// incident. Used by the purge-tokens command.
+func (s *Server) purgeTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	revoked := s.tokenStore.RemoveAll()
+	log.Printf("🔒 %s revoked all %d login tokens", currentUsername(r), revoked)
+	writeResponse(w, r, http.StatusOK, TokenPurgeResult{Revoked: revoked})
+}
+
+// sessions lists the signed-in devices of the authenticated user. Demo
+// accounts are shared by every visitor, so a demo instance lists only the
+// session of the request rather than where others signed in from.
+func (s *Server) sessions(r *http.Request) []Session {
+	sessions := s.tokenStore.Sessions(currentUsername(r), currentToken(r))
+	if !s.cfg.Server.DemoMode {
+		return sessions
+	}
+	current := []Session{}
+	for _, session := range sessions {
+		if session.Current {
+			current = append(current, session)
+		}
+	}
+	return current
+}
+
+// sessionsHandler lists the signed-in devices of the authenticated user and
+// signs single devices out
+func (s *Server) sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	username := currentUsername(r)
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/me/sessions"), "/")
+
+	if id == "" {
+		if r.Method != "GET" {
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+			return
+		}
+		writeResponse(w, r, http.StatusOK, s.sessions(r))
+		return
+	}
+
+	if r.Method != "DELETE" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+	if !s.tokenStore.RemoveSession(username, id) {
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Session not found", Code: "session_not_found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// txStateKey finds the state of the outermost WithTransaction in the context of its queries
+type txStateKey struct{}
+
+// txState collects what runs once the outermost transaction commits
+type txState struct {
+	afterCommit []func()
+}
+
+// transactionState returns the state of the WithTransaction db runs in, if any
+func transactionState(db *gorm.DB) *txState {
+	if db.Statement.Context == nil {
+		return nil
+	}
+	state, _ := db.Statement.Context.Value(txStateKey{}).(*txState)
+	return state
+}
+
+// WithTransaction runs the steps of a compound operation in one transaction:
+// they commit together if fn returns nil and roll back together if it
+// returns an error or panics. Called with the tx of another WithTransaction,
+// fn runs in a savepoint of it instead, so services can build operations
+// out of each other's and still succeed or fail as one. Side effects outside
+// the database, like hooks and alerts, go through AfterCommit, so they never
+// announce rows that were rolled back.
+func WithTransaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if state := transactionState(db); state != nil {
+		registered := len(state.afterCommit)
+		err := db.Transaction(fn)
+		if err != nil {
+			// The savepoint was rolled back, and with it what it registered
+			state.afterCommit = state.afterCommit[:registered]
+		}
+		return err
+	}
+
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	state := &txState{}
+	if err := db.WithContext(context.WithValue(ctx, txStateKey{}, state)).Transaction(fn); err != nil {
+		return err
+	}
+	for _, run := range state.afterCommit {
+		run()
+	}
+	return nil
+}
+
+// AfterCommit runs fn once the WithTransaction of tx commits, and not at all
+// if it rolls back. Outside a WithTransaction fn runs right away.
+func AfterCommit(tx *gorm.DB, fn func()) {
+	if state := transactionState(tx); state != nil {
+		state.afterCommit = append(state.afterCommit, fn)
+		return
+	}
+	fn()
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+// Weights of what makes a film trend. The catalog has no favorites or
+// ratings, so borrowing a copy stands in as the stronger sign of interest.
+const (
+	trendingViewWeight = 1
+	trendingLoanWeight = 5
+)
+
+const (
+	// trendingHalfLife is how long it takes a view or loan to count half
+	trendingHalfLife = 3 * 24 * time.Hour
+	// trendingWindow is how far back views and loans count at all
+	trendingWindow = 30 * 24 * time.Hour
+)
+
+// Trending film limits
+const (
+	defaultTrendingLimit = 10
+	maxTrendingLimit     = 50
+)
+
+// TrendingFilm is a film ranked by its recent views and loans
+// @Description Trending film with its score
+type TrendingFilm struct {
+	Film
+	Score float64 `json:"score" xml:"score" example:"42.5"`
+	Rank  int     `json:"rank" xml:"rank" example:"1"`
+}
+
+// TrendingFilms is the ranking of trending films of an organization
+// @Description Trending films
+type TrendingFilms struct {
+	ComputedAt time.Time      `json:"computed_at" xml:"computed_at"`
+	Data       []TrendingFilm `json:"data" xml:"data>film"`
+}
+
+// TrendingService ranks films by recent interest. Rankings are computed by
+// the trending job and kept in memory, so serving one is a map lookup.
+type TrendingService struct {
+	db         *gorm.DB
+	mu         sync.Mutex
+	rankings   map[uint][]TrendingFilm
+	computedAt time.Time
+	// first lets the requests arriving before the first ranking share one computation
+	first singleflight.Group
+}
+
+// NewTrendingService creates a new trending service
+func NewTrendingService(db *gorm.DB) *TrendingService {
+	return &TrendingService{db: db}
+}
+
+// Recompute ranks the films of every organization by their views and loans
+// in the trending window, each decayed by its age
+func (ts *TrendingService) Recompute(ctx context.Context) error {
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	halfLifeDays := trendingHalfLife.Hours() / 24
+
+	var films []TrendingFilm
+	err := ts.db.WithContext(ctx).Raw(`SELECT * FROM (`+
+		`SELECT films.*, sum(signals.score) AS score, `+
+		`row_number() OVER (PARTITION BY films.organization_id ORDER BY sum(signals.score) DESC, films.id) AS rank FROM (`+
+		`SELECT film_id, ? * views * power(0.5, (?::date - day) / ?::float) AS score FROM film_views WHERE day >= ? `+
+		`UNION ALL `+
+		`SELECT film_id, ? * power(0.5, extract(epoch FROM ?::timestamptz - borrowed_at) / ?) AS score FROM loans WHERE borrowed_at >= ?`+
+		`) AS signals JOIN films ON films.id = signals.film_id AND films.deleted_at IS NULL `+
+		`GROUP BY films.id) AS ranked WHERE rank <= ? ORDER BY organization_id, rank`,
+		trendingViewWeight, today, halfLifeDays, today.Add(-trendingWindow),
+		trendingLoanWeight, now, trendingHalfLife.Seconds(), now.Add(-trendingWindow),
+		maxTrendingLimit).
+		Scan(&films).Error
+	if err != nil {
+		return err
+	}
+
+	rankings := make(map[uint][]TrendingFilm)
+	for _, film := range films {
+		rankings[film.OrganizationID] = append(rankings[film.OrganizationID], film)
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.rankings = rankings
+	ts.computedAt = now
+	return nil
+}
+
+// Ranking returns up to limit trending films of an organization from the
+// last ranking however old it is, or nil before the first one
+func (ts *TrendingService) Ranking(organizationID uint, limit int) *TrendingFilms {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.rankings == nil {
+		return nil
+	}
+	films := ts.rankings[organizationID]
+	if len(films) > limit {
+		films = films[:limit]
+	}
+	return &TrendingFilms{ComputedAt: ts.computedAt, Data: append([]TrendingFilm{}, films...)}
+}
+
+// computeFirst computes the first ranking, for requests arriving before the
+// trending job ran, e.g. right after a restart. Concurrent callers share one
+// computation, which goes on when the caller that started it goes away.
+// Later rankings are left to the job.
+func (ts *TrendingService) computeFirst(ctx context.Context) error {
+	_, err, _ := ts.first.Do("ranking", func() (interface{}, error) {
+		ts.mu.Lock()
+		computed := ts.rankings != nil
+		ts.mu.Unlock()
+		if computed {
+			return nil, nil
+		}
+		return nil, ts.Recompute(context.WithoutCancel(ctx))
+	})
+	return err
+}
+
+// trendingFilmsHandler handles GET /api/films/trending
+func (s *Server) trendingFilmsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	limit := defaultTrendingLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxTrendingLimit {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "limit must be between 1 and 50", Code: "limit_invalid", Params: Params{"min": 1, "max": 50}})
+			return
+		}
+		limit = parsed
+	}
+
+	organizationID := currentTenant(r).OrganizationID
+	ranking := s.trendingService.Ranking(organizationID, limit)
+	if ranking == nil {
+		if err := s.trendingService.computeFirst(r.Context()); err != nil {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve films", Code: "films_retrieve_failed"})
+			return
+		}
+		ranking = s.trendingService.Ranking(organizationID, limit)
+	}
+	writeResponse(w, r, http.StatusOK, ranking)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// adminUsersHandler routes /api/admin/users,
+// /api/admin/users/{username}/deactivate, and
+// /api/admin/users/{username}/reactivate
+func (s *Server) adminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/users"), "/")
+	if path == "" {
+		s.listUsersHandler(w, r)
+		return
+	}
+	username, action, found := strings.Cut(path, "/")
+	if !found || username == "" || (action != "deactivate" && action != "reactivate") {
+		writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Not found", Code: "not_found"})
+		return
+	}
+	if r.Method != "POST" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	active := action == "reactivate"
+	if !active && username == currentUsername(r) {
+		writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "You can't deactivate your own account", Code: "deactivate_self"})
+		return
+	}
+	user, err := s.users.SetActive(currentTenant(r).OrganizationID, username, active)
+	if err != nil {
+		switch err.Error() {
+		case "user not found":
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "User not found", Code: "user_unknown"})
+		case "last admin":
+			writeResponse(w, r, http.StatusConflict, ErrorResponse{Error: "The last admin can't be deactivated", Code: "last_admin_deactivate"})
+		default:
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update user", Code: "user_update_failed"})
+		}
+		return
+	}
+
+	// Deactivated users are signed out everywhere right away
+	if !active {
+		s.tokenStore.RemoveUserTokens(user.Username)
+	}
+	writeResponse(w, r, http.StatusOK, newUserProfile(user))
+}
+
+// listUsersHandler handles GET /api/admin/users, a page of the user
+// directory filtered by ?search= and ?role=
+func (s *Server) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	query := r.URL.Query()
+	pageSize, err := parsePageSize(query)
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	page := 1
+	if query.Has("page") {
+		page, err = strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "page must be a positive integer", Code: "invalid_page"})
+			return
+		}
+	}
+	role := query.Get("role")
+	if role != "" && role != "user" && role != "admin" {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "role must be user or admin", Code: "role_invalid"})
+		return
+	}
+
+	users, total, err := s.users.GetUsersPage(currentTenant(r).OrganizationID, strings.TrimSpace(query.Get("search")), role, page, pageSize)
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve users", Code: "users_retrieve_failed"})
+		return
+	}
+	response := UserPage{
+		Data:     make([]UserProfile, len(users)),
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+		Links:    offsetPageLinks(r, page, pageSize, total),
+	}
+	for i := range users {
+		response.Data[i] = newUserProfile(&users[i])
+	}
+	writeResponse(w, r, http.StatusOK, response)
+}
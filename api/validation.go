@@ -0,0 +1,308 @@
+package api
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+)
+
+// Film validation limits
+const (
+	minFilmYear         = 1878 // The Horse in Motion
+	maxFutureYears      = 5
+	maxTitleLength      = 200
+	maxDirectorLength   = 100
+	maxExternalIDLength = 100
+	maxRuntimeMinutes   = 1440
+	maxSynopsisLength   = 2000
+	maxFilmURLLength    = 500
+	maxExternalLinks    = 20
+	maxLinkLabelLength  = 50
+)
+
+// Profile validation limits
+const (
+	maxEmailLength       = 254
+	maxDisplayNameLength = 100
+	maxAvatarURLLength   = 500
+)
+
+// defaultGenres is the allowed genre list when ALLOWED_GENRES isn't set
+var defaultGenres = []string{
+	"Action", "Adventure", "Animation", "Biography", "Comedy", "Crime", "Documentary",
+	"Drama", "Family", "Fantasy", "History", "Horror", "Music", "Musical", "Mystery",
+	"Romance", "Sci-Fi", "Sport", "Thriller", "War", "Western",
+}
+
+// ageRatings are the MPAA ratings a film may have
+var ageRatings = []string{"G", "PG", "PG-13", "R", "NC-17", "NR"}
+
+// imdbIDPattern matches IMDb title IDs such as tt0111161
+var imdbIDPattern = regexp.MustCompile(`^tt[0-9]{7,10}$`)
+
+// FieldError describes why a single field is invalid
+type FieldError struct {
+	Field   string `json:"field" xml:"field" example:"year"`
+	Message string `json:"message" xml:"message" example:"must be between 1878 and 2030"`
+	Code    string `json:"code,omitempty" xml:"code,omitempty" example:"field_out_of_range"`
+	Params  Params `json:"-" xml:"-" swaggerignore:"true"`
+}
+
+// ValidationError collects the field errors of a request
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + " " + field.Message
+	}
+	return strings.Join(messages, ", ")
+}
+
+// allowedGenres returns the configured genre list, or nil when any genre is accepted
+func allowedGenres() []string {
+	value := getEnv("ALLOWED_GENRES", "")
+	if value == "" {
+		return defaultGenres
+	}
+	if value == "*" {
+		return nil
+	}
+	var genres []string
+	for _, genre := range strings.Split(value, ",") {
+		if genre = strings.TrimSpace(genre); genre != "" {
+			genres = append(genres, genre)
+		}
+	}
+	return genres
+}
+
+// ValidateFilmRequest trims the text fields of a film payload in place and
+// checks it against the catalog rules and the link settings of cfg. It
+// returns nil when the film is valid.
+func ValidateFilmRequest(filmReq *FilmRequest, cfg *Config) *ValidationError {
+	filmReq.Title = strings.TrimSpace(filmReq.Title)
+	filmReq.Director = strings.TrimSpace(filmReq.Director)
+	filmReq.Genre = strings.TrimSpace(filmReq.Genre)
+
+	var fields []FieldError
+	if filmReq.Title == "" {
+		fields = append(fields, FieldError{Field: "title", Message: "is required", Code: "field_required"})
+	} else if utf8.RuneCountInString(filmReq.Title) > maxTitleLength {
+		fields = append(fields, FieldError{Field: "title", Message: fmt.Sprintf("must be at most %d characters", maxTitleLength), Code: "field_too_long", Params: Params{"max": maxTitleLength}})
+	}
+
+	if filmReq.Director == "" {
+		fields = append(fields, FieldError{Field: "director", Message: "is required", Code: "field_required"})
+	} else if utf8.RuneCountInString(filmReq.Director) > maxDirectorLength {
+		fields = append(fields, FieldError{Field: "director", Message: fmt.Sprintf("must be at most %d characters", maxDirectorLength), Code: "field_too_long", Params: Params{"max": maxDirectorLength}})
+	}
+
+	filmReq.ExternalID = strings.TrimSpace(filmReq.ExternalID)
+	if utf8.RuneCountInString(filmReq.ExternalID) > maxExternalIDLength {
+		fields = append(fields, FieldError{Field: "external_id", Message: fmt.Sprintf("must be at most %d characters", maxExternalIDLength), Code: "field_too_long", Params: Params{"max": maxExternalIDLength}})
+	}
+
+	maxYear := time.Now().Year() + maxFutureYears
+	if filmReq.Year == 0 {
+		fields = append(fields, FieldError{Field: "year", Message: "is required", Code: "field_required"})
+	} else if filmReq.Year < minFilmYear || filmReq.Year > maxYear {
+		fields = append(fields, FieldError{Field: "year", Message: fmt.Sprintf("must be between %d and %d", minFilmYear, maxYear), Code: "field_out_of_range", Params: Params{"min": minFilmYear, "max": maxYear}})
+	}
+
+	if genres := allowedGenres(); filmReq.Genre != "" && genres != nil {
+		allowed := false
+		for _, genre := range genres {
+			// Store the canonical spelling of the genre
+			if strings.EqualFold(genre, filmReq.Genre) {
+				filmReq.Genre = genre
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			fields = append(fields, FieldError{Field: "genre", Message: "must be one of " + strings.Join(genres, ", "), Code: "field_not_one_of", Params: Params{"values": strings.Join(genres, ", ")}})
+		}
+	}
+
+	fields = append(fields, validateFilmMetadata(filmReq)...)
+	fields = append(fields, validateFilmLinks(filmReq, cfg.Media)...)
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// validateFilmMetadata trims and canonicalizes the metadata fields present in
+// a film payload and returns the errors of the invalid ones. Empty values are
+// valid, they clear the field.
+func validateFilmMetadata(filmReq *FilmRequest) []FieldError {
+	var fields []FieldError
+	if filmReq.RuntimeMinutes != nil && (*filmReq.RuntimeMinutes < 0 || *filmReq.RuntimeMinutes > maxRuntimeMinutes) {
+		fields = append(fields, FieldError{Field: "runtime_minutes", Message: fmt.Sprintf("must be between %d and %d", 0, maxRuntimeMinutes), Code: "field_out_of_range", Params: Params{"min": 0, "max": maxRuntimeMinutes}})
+	}
+
+	if filmReq.Synopsis != nil {
+		*filmReq.Synopsis = strings.TrimSpace(*filmReq.Synopsis)
+		if utf8.RuneCountInString(*filmReq.Synopsis) > maxSynopsisLength {
+			fields = append(fields, FieldError{Field: "synopsis", Message: fmt.Sprintf("must be at most %d characters", maxSynopsisLength), Code: "field_too_long", Params: Params{"max": maxSynopsisLength}})
+		}
+	}
+
+	if filmReq.Language != nil {
+		*filmReq.Language = strings.TrimSpace(*filmReq.Language)
+		if *filmReq.Language != "" {
+			// Store the two-letter code when the language has one, so "eng" and "en" match
+			base, err := language.ParseBase(*filmReq.Language)
+			if err != nil || base.String() == "und" {
+				fields = append(fields, FieldError{Field: "language", Message: "must be an ISO 639 language code", Code: "field_invalid_language"})
+			} else {
+				*filmReq.Language = base.String()
+			}
+		}
+	}
+
+	if filmReq.Country != nil {
+		*filmReq.Country = strings.TrimSpace(*filmReq.Country)
+		if *filmReq.Country != "" {
+			region, err := language.ParseRegion(*filmReq.Country)
+			if err != nil || len(*filmReq.Country) != 2 || !region.IsCountry() {
+				fields = append(fields, FieldError{Field: "country", Message: "must be an ISO 3166-1 alpha-2 country code", Code: "field_invalid_country"})
+			} else {
+				*filmReq.Country = region.String()
+			}
+		}
+	}
+
+	if filmReq.AgeRating != nil {
+		*filmReq.AgeRating = strings.TrimSpace(*filmReq.AgeRating)
+		if *filmReq.AgeRating != "" {
+			allowed := false
+			for _, rating := range ageRatings {
+				if strings.EqualFold(rating, *filmReq.AgeRating) {
+					*filmReq.AgeRating = rating
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				fields = append(fields, FieldError{Field: "age_rating", Message: "must be one of " + strings.Join(ageRatings, ", "), Code: "field_not_one_of", Params: Params{"values": strings.Join(ageRatings, ", ")}})
+			}
+		}
+	}
+
+	if filmReq.IMDbID != nil {
+		*filmReq.IMDbID = strings.ToLower(strings.TrimSpace(*filmReq.IMDbID))
+		if *filmReq.IMDbID != "" && !imdbIDPattern.MatchString(*filmReq.IMDbID) {
+			fields = append(fields, FieldError{Field: "imdb_id", Message: "must be an IMDb title ID such as tt0111161", Code: "field_invalid_imdb_id"})
+		}
+	}
+	return fields
+}
+
+// validateFilmLinks checks the trailer and external links present in a film
+// payload. Links must be plain https URLs, and trailers must come from one of
+// the configured hosts, so the UI can embed them without further checks.
+func validateFilmLinks(filmReq *FilmRequest, media MediaConfig) []FieldError {
+	var fields []FieldError
+	if filmReq.TrailerURL != nil {
+		*filmReq.TrailerURL = strings.TrimSpace(*filmReq.TrailerURL)
+		if *filmReq.TrailerURL != "" {
+			if fieldErr := checkFilmURL("trailer_url", *filmReq.TrailerURL, media.TrailerHosts); fieldErr != nil {
+				fields = append(fields, *fieldErr)
+			}
+		}
+	}
+
+	if filmReq.ExternalLinks != nil {
+		links := *filmReq.ExternalLinks
+		if len(links) > maxExternalLinks {
+			fields = append(fields, FieldError{Field: "external_links", Message: fmt.Sprintf("must have at most %d items", maxExternalLinks), Code: "field_too_many_items", Params: Params{"max": maxExternalLinks}})
+		}
+		for i := range links {
+			field := fmt.Sprintf("external_links[%d]", i)
+			links[i].Label = strings.TrimSpace(links[i].Label)
+			links[i].URL = strings.TrimSpace(links[i].URL)
+			if links[i].Label == "" {
+				fields = append(fields, FieldError{Field: field + ".label", Message: "is required", Code: "field_required"})
+			} else if utf8.RuneCountInString(links[i].Label) > maxLinkLabelLength {
+				fields = append(fields, FieldError{Field: field + ".label", Message: fmt.Sprintf("must be at most %d characters", maxLinkLabelLength), Code: "field_too_long", Params: Params{"max": maxLinkLabelLength}})
+			}
+			if links[i].URL == "" {
+				fields = append(fields, FieldError{Field: field + ".url", Message: "is required", Code: "field_required"})
+			} else if fieldErr := checkFilmURL(field+".url", links[i].URL, media.LinkHosts); fieldErr != nil {
+				fields = append(fields, *fieldErr)
+			}
+		}
+	}
+	return fields
+}
+
+// checkFilmURL returns why a film link is unsafe to show, or nil when it is a
+// plain https URL on one of the hosts. Any host is allowed when hosts is empty.
+func checkFilmURL(field, value string, hosts []string) *FieldError {
+	if len(value) > maxFilmURLLength {
+		return &FieldError{Field: field, Message: fmt.Sprintf("must be at most %d characters", maxFilmURLLength), Code: "field_too_long", Params: Params{"max": maxFilmURLLength}}
+	}
+	// Reject anything a browser would read differently than url.Parse does
+	if strings.ContainsAny(value, " \t\r\n\\\"'<>`") {
+		return &FieldError{Field: field, Message: "must be an https URL", Code: "field_invalid_https_url"}
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme != "https" || parsed.Opaque != "" || parsed.User != nil || parsed.Hostname() == "" || parsed.Port() != "" {
+		return &FieldError{Field: field, Message: "must be an https URL", Code: "field_invalid_https_url"}
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+	for _, host := range hosts {
+		if strings.EqualFold(host, parsed.Hostname()) {
+			return nil
+		}
+	}
+	return &FieldError{Field: field, Message: "must be a URL on " + strings.Join(hosts, ", "), Code: "field_host_not_allowed", Params: Params{"values": strings.Join(hosts, ", ")}}
+}
+
+// ValidateProfileRequest trims a profile payload in place, lowercases the email,
+// and checks it. It returns nil when the profile is valid.
+func ValidateProfileRequest(profileReq *ProfileRequest) *ValidationError {
+	profileReq.Email = strings.ToLower(strings.TrimSpace(profileReq.Email))
+	profileReq.DisplayName = strings.TrimSpace(profileReq.DisplayName)
+	profileReq.AvatarURL = strings.TrimSpace(profileReq.AvatarURL)
+
+	var fields []FieldError
+	if profileReq.Email != "" {
+		// Reject display-name forms like "Bob <bob@example.com>", only the bare address is stored
+		address, err := mail.ParseAddress(profileReq.Email)
+		if err != nil || address.Address != profileReq.Email || len(profileReq.Email) > maxEmailLength {
+			fields = append(fields, FieldError{Field: "email", Message: "must be a valid email address", Code: "field_invalid_email"})
+		}
+	}
+
+	if utf8.RuneCountInString(profileReq.DisplayName) > maxDisplayNameLength {
+		fields = append(fields, FieldError{Field: "display_name", Message: fmt.Sprintf("must be at most %d characters", maxDisplayNameLength), Code: "field_too_long", Params: Params{"max": maxDisplayNameLength}})
+	}
+
+	if profileReq.AvatarURL != "" {
+		parsed, err := url.Parse(profileReq.AvatarURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			fields = append(fields, FieldError{Field: "avatar_url", Message: "must be an absolute http or https URL", Code: "field_invalid_url"})
+		} else if len(profileReq.AvatarURL) > maxAvatarURLLength {
+			fields = append(fields, FieldError{Field: "avatar_url", Message: fmt.Sprintf("must be at most %d characters", maxAvatarURLLength), Code: "field_too_long", Params: Params{"max": maxAvatarURLLength}})
+		}
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Most viewed film limits
+const (
+	defaultMostViewedDays  = 30
+	maxMostViewedDays      = 365
+	defaultMostViewedLimit = 10
+	maxMostViewedLimit     = 50
+)
+
+// viewKey counts the views of a film on one day
+type viewKey struct {
+	filmID uint
+	day    time.Time
+}
+
+// ViewCounter counts film views in memory, so reads only take a lock, and
+// adds the counts to the film_views table when flushed
+type ViewCounter struct {
+	db      *gorm.DB
+	mu      sync.Mutex
+	pending map[viewKey]int64
+}
+
+// NewViewCounter creates a new view counter
+func NewViewCounter(db *gorm.DB) *ViewCounter {
+	return &ViewCounter{db: db, pending: make(map[viewKey]int64)}
+}
+
+// Record counts a view of a film
+func (vc *ViewCounter) Record(filmID uint) {
+	now := time.Now().UTC()
+	key := viewKey{filmID: filmID, day: time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)}
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.pending[key]++
+}
+
+// Flush adds the views counted since the last flush to the daily totals. It
+// runs as the view-flush scheduled job; counts that fail to store are kept
+// for the next flush.
+func (vc *ViewCounter) Flush(ctx context.Context) error {
+	vc.mu.Lock()
+	pending := vc.pending
+	vc.pending = make(map[viewKey]int64)
+	vc.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	rows := make([]FilmView, 0, len(pending))
+	for key, views := range pending {
+		rows = append(rows, FilmView{FilmID: key.filmID, Day: key.day, Views: views})
+	}
+	err := vc.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "film_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"views": gorm.Expr("film_views.views + excluded.views")}),
+	}).Create(&rows).Error
+	if err != nil {
+		vc.mu.Lock()
+		for key, views := range pending {
+			vc.pending[key] += views
+		}
+		vc.mu.Unlock()
+	}
+	return err
+}
+
+// AttachViews sets the all-time view count of films, including views not
+// flushed yet
+func (vc *ViewCounter) AttachViews(films []Film) error {
+	if len(films) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(films))
+	for i := range films {
+		ids[i] = films[i].ID
+	}
+
+	var totals []struct {
+		FilmID uint
+		Views  int64
+	}
+	err := vc.db.Model(&FilmView{}).Select("film_id, sum(views) AS views").
+		Where("film_id IN ?", ids).Group("film_id").Scan(&totals).Error
+	if err != nil {
+		return err
+	}
+	byFilm := make(map[uint]int64, len(totals))
+	for _, total := range totals {
+		byFilm[total.FilmID] = total.Views
+	}
+	vc.mu.Lock()
+	for key, views := range vc.pending {
+		byFilm[key.filmID] += views
+	}
+	vc.mu.Unlock()
+
+	for i := range films {
+		views := byFilm[films[i].ID]
+		films[i].Views = &views
+	}
+	return nil
+}
+
+// GetMostViewed returns the films viewed most since a time, most viewed
+// first, with those views. Views not flushed yet aren't counted.
+func (fs *FilmService) GetMostViewed(since time.Time, limit int) ([]Film, error) {
+	var counts []struct {
+		FilmID uint
+		Views  int64
+	}
+	err := fs.db.Model(&Film{}).
+		Select("films.id AS film_id, sum(film_views.views) AS views").
+		Joins("JOIN film_views ON film_views.film_id = films.id").
+		Where("film_views.day >= ?", since).
+		Group("films.id").Order("views DESC, films.id").Limit(limit).
+		Scan(&counts).Error
+	if err != nil || len(counts) == 0 {
+		return []Film{}, err
+	}
+
+	ids := make([]uint, len(counts))
+	rank := make(map[uint]int, len(counts))
+	for i, count := range counts {
+		ids[i] = count.FilmID
+		rank[count.FilmID] = i
+	}
+	var films []Film
+	if err := fs.db.Where("id IN ?", ids).Find(&films).Error; err != nil {
+		return nil, err
+	}
+	sort.Slice(films, func(i, j int) bool { return rank[films[i].ID] < rank[films[j].ID] })
+	for i := range films {
+		views := counts[rank[films[i].ID]].Views
+		films[i].Views = &views
+	}
+	return films, nil
+}
+
+// mostViewedFilmsHandler handles GET /api/films/most-viewed
+func (s *Server) mostViewedFilmsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	days := defaultMostViewedDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxMostViewedDays {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "days must be between 1 and 365", Code: "views_days_invalid", Params: Params{"min": 1, "max": 365}})
+			return
+		}
+		days = parsed
+	}
+	limit := defaultMostViewedLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxMostViewedLimit {
+			writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "limit must be between 1 and 50", Code: "limit_invalid", Params: Params{"min": 1, "max": 50}})
+			return
+		}
+		limit = parsed
+	}
+
+	// Today counts as one of the days
+	now := time.Now().UTC()
+	since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1-days)
+	films, err := s.tenantCatalog(r).GetMostViewed(since, limit)
+	if err != nil {
+		writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve films", Code: "films_retrieve_failed"})
+		return
+	}
+	writeResponse(w, r, http.StatusOK, films)
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// warmupTimeout bounds the warm-up so a slow database can't keep the server unready forever
+const warmupTimeout = 30 * time.Second
+
+// warmUp opens the idle database connections and runs the queries the first
+// requests after a deploy need, so they don't pay for cold connections,
+// schema parsing, and an empty database cache. It flips readiness when done;
+// failures are logged and the server becomes ready anyway.
+func (s *Server) warmUp() {
+	started := time.Now()
+	ctx, cancel := context.WithTimeout(s.ctx, warmupTimeout)
+	defer cancel()
+
+	if err := s.warmConnections(ctx, s.currentConfig().Database.MaxIdleConns); err != nil {
+		log.Printf("Warning: Failed to open database connections during warm-up: %v", err)
+	}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"film list", func() error {
+			_, _, err := s.filmService.GetFilmsPage(nil, 1, defaultPageSize)
+			return err
+		}},
+		{"film lookup", func() error {
+			_, err := s.filmService.GetFilmByID(0)
+			if err != nil && err.Error() == "film not found" {
+				return nil
+			}
+			return err
+		}},
+		{"users", func() error {
+			_, err := s.userService.GetUserByUsername("")
+			if err != nil && err.Error() == "user not found" {
+				return nil
+			}
+			return err
+		}},
+		{"admin stats", func() error {
+			_, err := s.adminService.GetStats()
+			return err
+		}},
+	}
+	for _, step := range steps {
+		if ctx.Err() != nil {
+			log.Printf("Warning: Warm-up timed out before %s", step.name)
+			break
+		}
+		if err := step.run(); err != nil {
+			log.Printf("Warning: Failed to warm up %s: %v", step.name, err)
+		}
+	}
+
+	s.ready.Store(true)
+	log.Printf("🔥 Warm-up finished in %s, ready for traffic", time.Since(started).Round(time.Millisecond))
+}
+
+// warmConnections opens up to count pool connections at once and returns
+// them to the pool as idle connections
+func (s *Server) warmConnections(ctx context.Context, count int) error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	conns := make([]*sql.Conn, 0, count)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for i := 0; i < count; i++ {
+		conn, err := sqlDB.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, conn)
+		if err := conn.PingContext(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readyzHandler reports whether the server has finished warming up, for load
+// balancers and orchestrators deciding when to send traffic
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !s.ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"status": "warming up"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Film events delivered to webhooks
+const (
+	EventFilmCreated = "film.created"
+	EventFilmUpdated = "film.updated"
+	EventFilmDeleted = "film.deleted"
+)
+
+// webhookAttempts is how many times a delivery is tried before giving up
+const webhookAttempts = 3
+
+// filmEvents maps hook actions to webhook events
+var filmEvents = map[string]string{
+	ActionCreate: EventFilmCreated,
+	ActionUpdate: EventFilmUpdated,
+	ActionDelete: EventFilmDeleted,
+}
+
+// WebhookService stores webhook subscriptions and delivers film events
+type WebhookService struct {
+	db     *gorm.DB
+	pool   *WorkerPool
+	client *http.Client
+}
+
+// NewWebhookService creates a new webhook service delivering events on a worker pool
+func NewWebhookService(db *gorm.DB, pool *WorkerPool) *WebhookService {
+	return &WebhookService{
+		db:     db,
+		pool:   pool,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(strings.TrimSpace(candidate), strings.TrimSpace(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether a subscription wants an event for a film.
+// An empty event list or filter list matches everything.
+func (wh *Webhook) Matches(event string, film *Film) bool {
+	if !wh.Active {
+		return false
+	}
+	if len(wh.Events) > 0 && !containsFold(wh.Events, event) {
+		return false
+	}
+	if len(wh.Filters.Genres) > 0 && !containsFold(wh.Filters.Genres, film.Genre) {
+		return false
+	}
+	if len(wh.Filters.Directors) > 0 && !containsFold(wh.Filters.Directors, film.Director) {
+		return false
+	}
+	return true
+}
+
+// Publish delivers a film event to every matching subscription in the background
+func (ws *WebhookService) Publish(event string, film *Film) {
+	var webhooks []Webhook
+	if err := ws.db.Where("active = ?", true).Find(&webhooks).Error; err != nil {
+		log.Printf("Warning: Failed to load webhooks for %s: %v", event, err)
+		return
+	}
+
+	payload, err := json.Marshal(WebhookEvent{Event: event, Film: *film, Timestamp: time.Now().UTC()})
+	if err != nil {
+		log.Printf("Warning: Failed to encode %s event: %v", event, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if webhook.Matches(event, film) {
+			ws.deliver(webhook, event, payload, 1)
+		}
+	}
+}
+
+// deliver queues a delivery attempt at high priority. Failed attempts are
+// queued again after a backoff instead of holding a worker while waiting.
+func (ws *WebhookService) deliver(webhook Webhook, event string, payload []byte, attempt int) {
+	err := ws.pool.Submit(fmt.Sprintf("webhook-%d", webhook.ID), PriorityHigh, func() {
+		err := ws.send(webhook, event, payload)
+		if err == nil {
+			return
+		}
+		log.Printf("Warning: Webhook %d delivery of %s failed (attempt %d/%d): %v", webhook.ID, event, attempt, webhookAttempts, err)
+		if attempt < webhookAttempts {
+			time.AfterFunc(time.Duration(attempt*attempt)*time.Second, func() {
+				ws.deliver(webhook, event, payload, attempt+1)
+			})
+		}
+	})
+	if err != nil {
+		log.Printf("Warning: Dropped webhook %d delivery of %s: %v", webhook.ID, event, err)
+	}
+}
+
+// send performs a single delivery, signing the payload when the subscription has a secret
+func (ws *WebhookService) send(webhook Webhook, event string, payload []byte) error {
+	req, err := http.NewRequest("POST", webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event)
+	if webhook.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(webhook.Secret))
+		mac.Write(payload)
+		req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("subscriber answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Plugin publishes film events after every committed change
+func (ws *WebhookService) Plugin() Plugin {
+	return Plugin{
+		Name: "webhooks",
+		Films: FilmHooks{
+			PostCommit: func(hc HookContext, film *Film) {
+				if event, exists := filmEvents[hc.Action]; exists {
+					ws.Publish(event, film)
+				}
+			},
+		},
+	}
+}
+
+// validateWebhookRequest checks the URL and event names of a subscription
+func validateWebhookRequest(webhookReq WebhookRequest) error {
+	parsed, err := url.Parse(webhookReq.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return &CodedError{Code: "webhook_url_invalid", Message: "url must be an absolute http or https URL"}
+	}
+	for _, event := range webhookReq.Events {
+		if event != EventFilmCreated && event != EventFilmUpdated && event != EventFilmDeleted {
+			return &CodedError{Code: "webhook_event_unknown", Params: Params{"event": strconv.Quote(event)}, Message: fmt.Sprintf("unknown event %q", event)}
+		}
+	}
+	return nil
+}
+
+// GetWebhooks retrieves all subscriptions
+func (ws *WebhookService) GetWebhooks() ([]Webhook, error) {
+	var webhooks []Webhook
+	err := ws.db.Order("id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// SaveWebhook creates a subscription (id 0) or updates an existing one
+func (ws *WebhookService) SaveWebhook(id uint, webhookReq WebhookRequest) (*Webhook, error) {
+	webhook := Webhook{Active: true}
+	if id != 0 {
+		if err := ws.db.First(&webhook, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errors.New("webhook not found")
+			}
+			return nil, err
+		}
+	}
+
+	webhook.URL = webhookReq.URL
+	webhook.Secret = webhookReq.Secret
+	webhook.Events = webhookReq.Events
+	webhook.Filters = webhookReq.Filters
+	if webhookReq.Active != nil {
+		webhook.Active = *webhookReq.Active
+	}
+
+	if err := ws.db.Save(&webhook).Error; err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// DeleteWebhook removes a subscription
+func (ws *WebhookService) DeleteWebhook(id uint) error {
+	result := ws.db.Delete(&Webhook{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("webhook not found")
+	}
+	return nil
+}
+
+// webhooksHandler routes /api/webhooks endpoints (admin only)
+func (s *Server) webhooksHandler(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	if path == "/api/webhooks" {
+		switch r.Method {
+		case "GET":
+			webhooks, err := s.webhookService.GetWebhooks()
+			if err != nil {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve webhooks", Code: "webhooks_retrieve_failed"})
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(webhooks)
+		case "POST":
+			s.saveWebhookHandler(w, r, 0)
+		default:
+			writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(path, "/api/webhooks/"))
+	if err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid webhook ID", Code: "invalid_webhook_id"})
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		s.saveWebhookHandler(w, r, uint(id))
+	case "DELETE":
+		if err := s.webhookService.DeleteWebhook(uint(id)); err != nil {
+			if err.Error() == "webhook not found" {
+				writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Webhook not found", Code: "webhook_not_found"})
+			} else {
+				writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete webhook", Code: "webhook_delete_failed"})
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+	}
+}
+
+// saveWebhookHandler creates a subscription (id 0) or updates an existing one
+func (s *Server) saveWebhookHandler(w http.ResponseWriter, r *http.Request, id uint) {
+	var webhookReq WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&webhookReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, ErrorResponse{Error: "Invalid JSON", Code: "invalid_json"})
+		return
+	}
+
+	if err := validateWebhookRequest(webhookReq); err != nil {
+		writeResponse(w, r, http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	webhook, err := s.webhookService.SaveWebhook(id, webhookReq)
+	if err != nil {
+		if err.Error() == "webhook not found" {
+			writeResponse(w, r, http.StatusNotFound, ErrorResponse{Error: "Webhook not found", Code: "webhook_not_found"})
+		} else {
+			writeResponse(w, r, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save webhook", Code: "webhook_save_failed"})
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if id == 0 {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(webhook)
+}
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// workerIdleTimeout is how long a worker above the minimum waits for work before exiting
+const workerIdleTimeout = 30 * time.Second
+
+// ErrQueueSaturated is returned when the job queue has no room left
+var ErrQueueSaturated = errors.New("job queue saturated")
+
+// Priority is the class of a background job. Each class has its own queue.
+type Priority int
+
+// Job priorities, from most to least latency-sensitive
+const (
+	PriorityHigh Priority = iota
+	PriorityNormal
+	PriorityLow
+	priorityCount
+)
+
+// priorityNames are the names priorities have in the API and the database
+var priorityNames = [priorityCount]string{"high", "normal", "low"}
+
+// priorityTurns is the weighted round-robin order workers take jobs in when
+// every queue has work: 6 high, 3 normal, and 1 low per cycle. Lower classes
+// always get a turn, so a flood of high priority jobs can't starve them.
+var priorityTurns = []Priority{
+	PriorityHigh, PriorityNormal, PriorityHigh, PriorityHigh, PriorityNormal,
+	PriorityHigh, PriorityLow, PriorityHigh, PriorityNormal, PriorityHigh,
+}
+
+// String returns the name of a priority
+func (p Priority) String() string {
+	if p < 0 || p >= priorityCount {
+		return "unknown"
+	}
+	return priorityNames[p]
+}
+
+// parsePriority parses a priority name
+func parsePriority(name string) (Priority, error) {
+	for i, priorityName := range priorityNames {
+		if name == priorityName {
+			return Priority(i), nil
+		}
+	}
+	return 0, &CodedError{Code: "job_priority_invalid", Params: Params{"values": "high, normal, or low"}, Message: "invalid priority: use high, normal, or low"}
+}
+
+// queuedJob is a unit of work waiting for a worker
+type queuedJob struct {
+	name string
+	run  func()
+}
+
+// priorityQueue is the bounded queue of one priority class
+type priorityQueue struct {
+	jobs      chan queuedJob
+	submitted atomic.Int64
+	rejected  atomic.Int64
+}
+
+// WorkerPool runs background jobs from bounded per-priority queues. It starts
+// with the minimum number of workers, adds workers up to the maximum while jobs
+// wait, and lets extra workers exit once they have been idle for a while.
+type WorkerPool struct {
+	queues     [priorityCount]*priorityQueue
+	ready      chan struct{} // one token per queued job, across all queues
+	minWorkers int
+	maxWorkers int
+
+	mu      sync.Mutex
+	workers int
+	busy    int
+	turn    int
+
+	completed atomic.Int64
+
+	stop    chan struct{}
+	stopped sync.Once
+	running sync.WaitGroup
+}
+
+// NewWorkerPool creates a worker pool from WORKER_MIN, WORKER_MAX, and
+// JOB_QUEUE_CAPACITY, which bounds each priority's queue
+func NewWorkerPool() *WorkerPool {
+	minWorkers := getEnvInt("WORKER_MIN", 1)
+	maxWorkers := getEnvInt("WORKER_MAX", 4)
+	capacity := getEnvInt("JOB_QUEUE_CAPACITY", 100)
+	if minWorkers < 1 {
+		minWorkers = 1
+	}
+	if maxWorkers < minWorkers {
+		maxWorkers = minWorkers
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	pool := &WorkerPool{
+		ready:      make(chan struct{}, capacity*int(priorityCount)),
+		minWorkers: minWorkers,
+		maxWorkers: maxWorkers,
+		stop:       make(chan struct{}),
+	}
+	for i := range pool.queues {
+		pool.queues[i] = &priorityQueue{jobs: make(chan queuedJob, capacity)}
+	}
+	pool.mu.Lock()
+	for i := 0; i < minWorkers; i++ {
+		pool.spawn()
+	}
+	pool.mu.Unlock()
+	return pool
+}
+
+// getEnvInt reads an integer environment variable, falling back on missing or invalid values
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// Submit queues a job, or returns ErrQueueSaturated without blocking when the
+// queue of its priority is full
+func (wp *WorkerPool) Submit(name string, priority Priority, run func()) error {
+	queue := wp.queues[priority]
+	select {
+	case queue.jobs <- queuedJob{name: name, run: run}:
+	default:
+		queue.rejected.Add(1)
+		return ErrQueueSaturated
+	}
+	queue.submitted.Add(1)
+	wp.ready <- struct{}{}
+
+	// Scale up while jobs are waiting and every worker is busy, unless stopped
+	wp.mu.Lock()
+	if len(wp.ready) > wp.workers-wp.busy && wp.workers < wp.maxWorkers && !wp.isStopped() {
+		wp.spawn()
+	}
+	wp.mu.Unlock()
+	return nil
+}
+
+// next takes the job whose turn it is, falling back to the most urgent queue
+// with work. The caller must hold a ready token, so some queue has a job.
+func (wp *WorkerPool) next() queuedJob {
+	wp.mu.Lock()
+	preferred := priorityTurns[wp.turn]
+	wp.turn = (wp.turn + 1) % len(priorityTurns)
+	wp.mu.Unlock()
+
+	for {
+		select {
+		case job := <-wp.queues[preferred].jobs:
+			return job
+		default:
+		}
+		for _, queue := range wp.queues {
+			select {
+			case job := <-queue.jobs:
+				return job
+			default:
+			}
+		}
+	}
+}
+
+// spawn starts a worker. The caller must hold wp.mu.
+func (wp *WorkerPool) spawn() {
+	wp.workers++
+	wp.running.Add(1)
+	go wp.work()
+}
+
+// isStopped reports whether Stop was called
+func (wp *WorkerPool) isStopped() bool {
+	select {
+	case <-wp.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop lets every worker exit once its current job is done and waits for
+// them. Jobs still queued are dropped.
+func (wp *WorkerPool) Stop() {
+	// Closed under the lock, so Submit never spawns a worker after Wait starts
+	wp.mu.Lock()
+	wp.stopped.Do(func() { close(wp.stop) })
+	wp.mu.Unlock()
+	wp.running.Wait()
+}
+
+// work runs queued jobs until the worker has been idle for too long
+func (wp *WorkerPool) work() {
+	defer wp.running.Done()
+	idle := time.NewTimer(workerIdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case <-wp.stop:
+			wp.mu.Lock()
+			wp.workers--
+			wp.mu.Unlock()
+			return
+		case <-wp.ready:
+			job := wp.next()
+			wp.mu.Lock()
+			wp.busy++
+			wp.mu.Unlock()
+
+			wp.runJob(job)
+
+			wp.mu.Lock()
+			wp.busy--
+			wp.mu.Unlock()
+			wp.completed.Add(1)
+
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(workerIdleTimeout)
+		case <-idle.C:
+			wp.mu.Lock()
+			if wp.workers > wp.minWorkers {
+				wp.workers--
+				wp.mu.Unlock()
+				return
+			}
+			wp.mu.Unlock()
+			idle.Reset(workerIdleTimeout)
+		}
+	}
+}
+
+// runJob runs a job, keeping the worker alive if it panics
+func (wp *WorkerPool) runJob(job queuedJob) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("Warning: Job %s panicked: %v", job.name, recovered)
+		}
+	}()
+	job.run()
+}
+
+// Metrics returns a snapshot of the pool and queue state
+func (wp *WorkerPool) Metrics() QueueMetrics {
+	metrics := QueueMetrics{
+		MinWorkers: wp.minWorkers,
+		MaxWorkers: wp.maxWorkers,
+		Completed:  wp.completed.Load(),
+	}
+	for i, queue := range wp.queues {
+		priority := PriorityQueueMetrics{
+			Priority:  Priority(i).String(),
+			Depth:     len(queue.jobs),
+			Capacity:  cap(queue.jobs),
+			Submitted: queue.submitted.Load(),
+			Rejected:  queue.rejected.Load(),
+		}
+		metrics.Depth += priority.Depth
+		metrics.Capacity += priority.Capacity
+		metrics.Submitted += priority.Submitted
+		metrics.Rejected += priority.Rejected
+		metrics.Queues = append(metrics.Queues, priority)
+	}
+
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	metrics.Workers = wp.workers
+	metrics.Busy = wp.busy
+	return metrics
+}
+
+// queueMetricsHandler returns the worker pool and queue metrics (admin only)
+func (s *Server) queueMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeResponse(w, r, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed", Code: "method_not_allowed"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.workerPool.Metrics())
+}